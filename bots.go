@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/auth"
+	"github.com/AradD7/Go-Knuclebones/internal/database"
+	"github.com/google/uuid"
+)
+
+// botTurnEvent tells a bot it's its move in a game, with the die rolled for
+// it
+const botTurnEvent = "turn"
+
+type BotStatus struct {
+	IsBot bool `json:"is_bot"`
+}
+
+// handlerSetBot flags the player's account as a bot, or back to a person.
+// Only bot accounts can play with a personal access token, and their
+// opponents see they are playing a bot.
+func (cfg *apiConfig) handlerSetBot(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		IsBot *bool `json:"is_bot"`
+	}
+
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return
+	}
+	if player.IsGuest {
+		respondWithError(w, http.StatusForbidden, guestUpgradeRequired, nil)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var params parameters
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Failed to decode the json data", err)
+		return
+	}
+	if params.IsBot == nil {
+		respondWithError(w, http.StatusBadRequest, "is_bot is required", nil)
+		return
+	}
+
+	if err := cfg.db.SetPlayerBot(r.Context(), database.SetPlayerBotParams{
+		ID:    player.ID,
+		IsBot: *params.IsBot,
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update the player", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, BotStatus{
+		IsBot: *params.IsBot,
+	})
+}
+
+// rollForBot rolls the die for the player to move in a game when that
+// player is a bot, and tells its event stream. The bot answers through the
+// normal move endpoint. Nothing happens for players who aren't bots, or when
+// the turn already has a roll.
+func (cfg *apiConfig) rollForBot(ctx context.Context, gameId uuid.UUID) {
+	dice := rand.Intn(6) + 1
+
+	botId, err := cfg.db.SetBotRoll(ctx, database.SetBotRollParams{
+		ID: gameId,
+		LastRoll: sql.NullInt32{
+			Valid: true,
+			Int32: int32(dice),
+		},
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to roll for the bot in game %v: %v", gameId, err)
+		return
+	}
+
+	cfg.gs.broadcastRolled(gameId, dice)
+	cfg.gs.notifyPlayer(botId.UUID, PlayerMessage{
+		Type:   botTurnEvent,
+		GameId: gameId,
+		Dice:   dice,
+	})
+}
+
+// handlerBotEvents streams what a bot needs to play as Server-Sent Events: a
+// turn event with the rolled die whenever it's the bot's move, and the
+// notifications of its player channel. Turns that were pending when the
+// stream opened are sent first, so a bot that reconnects misses nothing.
+func (cfg *apiConfig) handlerBotEvents(w http.ResponseWriter, r *http.Request) {
+	playerId, ok := cfg.authorizeToken(w, r, auth.ScopeGamesPlay)
+	if !ok {
+		return
+	}
+
+	player, err := cfg.db.GetPlayerByPlayerId(r.Context(), playerId)
+	if err != nil || player.DeletedAt.Valid {
+		respondWithError(w, http.StatusNotFound, "Player not found", err)
+		return
+	}
+	if !player.IsBot {
+		respondWithError(w, http.StatusForbidden, "Only bot accounts have a bot event stream", nil)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Streaming is not supported", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	sub := &sseSubscriber{
+		w:        w,
+		flusher:  flusher,
+		mux:      &sync.Mutex{},
+		playerId: playerId,
+	}
+	defer sub.close()
+	// subscribed before the pending turns are looked up, so a turn starting
+	// in between isn't lost
+	cfg.gs.addPlayerConnection(sub)
+	defer cfg.gs.removePlayerConnection(sub)
+
+	turns, err := cfg.db.GetPlayerTurns(r.Context(), uuid.NullUUID{UUID: playerId, Valid: true})
+	if err != nil {
+		log.Printf("Failed to get the pending turns of bot %v: %v", playerId, err)
+	}
+	for _, turn := range turns {
+		if !turn.LastRoll.Valid {
+			cfg.rollForBot(r.Context(), turn.ID)
+			continue
+		}
+		if err = sub.send(PlayerMessage{
+			Type:   botTurnEvent,
+			GameId: turn.ID,
+			Dice:   int(turn.LastRoll.Int32),
+		}); err != nil {
+			return
+		}
+	}
+
+	ticker := time.NewTicker(sseKeepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			if err := sub.keepAlive(); err != nil {
+				return
+			}
+		}
+	}
+}
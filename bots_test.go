@@ -0,0 +1,227 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/auth"
+	"github.com/google/uuid"
+)
+
+func openBotEvents(t *testing.T, srv *httptest.Server, token string) *http.Response {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/bots/events", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open the bot event stream: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestBotEventsAuthorization(t *testing.T) {
+	botId := uuid.New()
+	token, _ := auth.MakePersonalAccessToken()
+
+	tests := []struct {
+		name       string
+		token      string
+		scopes     string
+		isBot      bool
+		wantStatus int
+	}{
+		{name: "Read only token", token: token, scopes: "{games:read}", isBot: true, wantStatus: http.StatusForbidden},
+		{name: "Not a bot", token: makeToken(t, botId), wantStatus: http.StatusForbidden},
+		{name: "Bot", token: token, scopes: "{games:play}", isBot: true, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &apiConfig{
+				tokenKeys: testKeys,
+				gs:        newGameServer(),
+				db: newStubDB(t, map[string]stubQuery{
+					"IsActivePlayer": activePlayer,
+					"GetPersonalAccessTokenByHash": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						return [][]driver.Value{{uuid.NewString(), botId.String(), tt.scopes, nil, tt.isBot, nil}}, nil
+					},
+					"TouchPersonalAccessToken": execOK,
+					"GetPlayerByPlayerId": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						row := playerRow(botId, nil, nil)
+						row[12] = tt.isBot
+						return [][]driver.Value{row}, nil
+					},
+					"GetPlayerTurns": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						return nil, nil
+					},
+				}),
+			}
+			cfg.gs.backend = newMemoryBackend(cfg.gs.deliver)
+			srv := httptest.NewServer(http.HandlerFunc(cfg.handlerBotEvents))
+			t.Cleanup(srv.Close)
+
+			resp := openBotEvents(t, srv, tt.token)
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("Got status %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestBotEventsTurns(t *testing.T) {
+	botId := uuid.New()
+	rolledGame := uuid.New()
+	pendingGame := uuid.New()
+	laterGame := uuid.New()
+	token, _ := auth.MakePersonalAccessToken()
+	rolls := map[string]driver.Value{}
+	var rollsMux sync.Mutex
+
+	cfg := &apiConfig{
+		tokenKeys: testKeys,
+		gs:        newGameServer(),
+		db: newStubDB(t, map[string]stubQuery{
+			"GetPersonalAccessTokenByHash": func(args []driver.NamedValue) ([][]driver.Value, error) {
+				return [][]driver.Value{{uuid.NewString(), botId.String(), "{games:play}", nil, true, nil}}, nil
+			},
+			"TouchPersonalAccessToken": execOK,
+			"GetPlayerByPlayerId": func(args []driver.NamedValue) ([][]driver.Value, error) {
+				row := playerRow(botId, nil, nil)
+				row[12] = true
+				return [][]driver.Value{row}, nil
+			},
+			// one turn was already rolled for, the other started before the
+			// player became a bot
+			"GetPlayerTurns": func(args []driver.NamedValue) ([][]driver.Value, error) {
+				if args[0].Value != botId.String() {
+					t.Errorf("Got the turns of %v, want the bot's", args[0].Value)
+				}
+				return [][]driver.Value{{rolledGame.String(), int64(4)}, {pendingGame.String(), nil}}, nil
+			},
+			"SetBotRoll": func(args []driver.NamedValue) ([][]driver.Value, error) {
+				rollsMux.Lock()
+				rolls[args[0].Value.(string)] = args[1].Value
+				rollsMux.Unlock()
+				return [][]driver.Value{{botId.String()}}, nil
+			},
+		}),
+	}
+	cfg.gs.backend = newMemoryBackend(cfg.gs.deliver)
+	srv := httptest.NewServer(http.HandlerFunc(cfg.handlerBotEvents))
+	t.Cleanup(srv.Close)
+
+	resp := openBotEvents(t, srv, token)
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Got content type %q", ct)
+	}
+	// the turn after the opponent's move, once the stream is subscribed
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		cfg.gs.rwMux.RLock()
+		subscribed := len(cfg.gs.players[botId]) > 0
+		cfg.gs.rwMux.RUnlock()
+		if subscribed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("The bot never subscribed")
+		}
+	}
+	cfg.rollForBot(t.Context(), laterGame)
+	events := readSSE(t, resp, 3)
+
+	rollsMux.Lock()
+	defer rollsMux.Unlock()
+	want := map[uuid.UUID]driver.Value{
+		rolledGame:  int64(4),
+		pendingGame: rolls[pendingGame.String()],
+		laterGame:   rolls[laterGame.String()],
+	}
+	for _, event := range events {
+		if event.msg.Type != botTurnEvent {
+			t.Errorf("Got a %s event, want turns only", event.msg.Type)
+			continue
+		}
+		if dice, ok := want[event.msg.GameId]; !ok || int64(event.msg.Dice) != dice {
+			t.Errorf("Got a turn in %v with %d, want %v", event.msg.GameId, event.msg.Dice, dice)
+		}
+		if event.msg.Dice < 1 || event.msg.Dice > 6 {
+			t.Errorf("Rolled %d", event.msg.Dice)
+		}
+		delete(want, event.msg.GameId)
+	}
+	if len(want) != 0 {
+		t.Errorf("Missing turns in %v", want)
+	}
+}
+
+func TestRollForBotSkipsPeople(t *testing.T) {
+	cfg := &apiConfig{
+		gs: newGameServer(),
+		db: newStubDB(t, map[string]stubQuery{
+			// the player to move isn't a bot, or already rolled
+			"SetBotRoll": func(args []driver.NamedValue) ([][]driver.Value, error) {
+				return nil, nil
+			},
+		}),
+	}
+	cfg.gs.backend = newMemoryBackend(func(event gameEvent) {
+		t.Errorf("Published %+v for a player who isn't a bot", event)
+	})
+
+	cfg.rollForBot(t.Context(), uuid.New())
+}
+
+func TestMoveWithRolledDie(t *testing.T) {
+	playerId := uuid.New()
+	gameId := uuid.New()
+	boardId := uuid.New()
+
+	tests := []struct {
+		name       string
+		playerTurn uuid.UUID
+		lastRoll   driver.Value
+	}{
+		{name: "Another die", playerTurn: playerId, lastRoll: int64(4)},
+		{name: "Before the roll", playerTurn: playerId},
+		// the opponent rolled a 3, the move uses it on their turn
+		{name: "Opponent's turn", playerTurn: uuid.New(), lastRoll: int64(3)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &apiConfig{
+				tokenKeys: testKeys,
+				db: newStubDB(t, map[string]stubQuery{
+					"IsActivePlayer": activePlayer,
+					"GetBoardByPlayerIdAndGameId": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						return [][]driver.Value{boardRow(boardId, playerId)}, nil
+					},
+					"GetGameById": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						row := gameRow(gameId, boardId, false, nil, nil)
+						row[6] = tt.playerTurn.String()
+						row[8] = tt.lastRoll
+						return [][]driver.Value{row}, nil
+					},
+				}),
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/games/move/"+gameId.String(), strings.NewReader(`{"dice": 3, "row": 2, "col": 0}`))
+			req.SetPathValue("game_id", gameId.String())
+			req.Header.Set("Authorization", "Bearer "+makeToken(t, playerId))
+			w := httptest.NewRecorder()
+			cfg.handlerMakeMove(w, req)
+
+			if w.Code != http.StatusConflict {
+				t.Errorf("Got status %d, want %d: %s", w.Code, http.StatusConflict, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const gameEventsChannel = "game_events"
+
+// gameEvent is a message for every subscriber of a game, or for every
+// connection of a single player when PlayerId is set, as it travels between
+// API instances
+type gameEvent struct {
+	GameId   uuid.UUID     `json:"game_id"`
+	PlayerId uuid.UUID     `json:"player_id,omitzero"`
+	Message  PlayerMessage `json:"message"`
+}
+
+// broadcastBackend fans game events out to every API instance. Each
+// instance hands the events it receives to its own deliver func, which
+// writes them to the connections it holds.
+type broadcastBackend interface {
+	// nextSeq hands out the next event sequence number of a game, unique
+	// across every instance sharing the backend
+	nextSeq(ctx context.Context, gameId uuid.UUID) (int64, error)
+	publish(ctx context.Context, event gameEvent) error
+	// forget drops what the backend keeps in memory about a game whose event
+	// log was pruned
+	forget(gameId uuid.UUID)
+}
+
+// memoryBackend delivers straight to this instance, which is all a single
+// instance deployment needs
+type memoryBackend struct {
+	deliver func(gameEvent)
+	seqs    map[uuid.UUID]int64
+	mux     *sync.Mutex
+}
+
+func newMemoryBackend(deliver func(gameEvent)) *memoryBackend {
+	return &memoryBackend{
+		deliver: deliver,
+		seqs:    make(map[uuid.UUID]int64),
+		mux:     &sync.Mutex{},
+	}
+}
+
+func (b *memoryBackend) nextSeq(ctx context.Context, gameId uuid.UUID) (int64, error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	b.seqs[gameId]++
+	return b.seqs[gameId], nil
+}
+
+func (b *memoryBackend) publish(ctx context.Context, event gameEvent) error {
+	b.deliver(event)
+	return nil
+}
+
+// forget restarts the game's sequence, a client that reconnects after that
+// is ahead of the log and gets a snapshot
+func (b *memoryBackend) forget(gameId uuid.UUID) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	delete(b.seqs, gameId)
+}
+
+// postgresBackend publishes with NOTIFY and delivers whatever arrives on
+// its LISTEN connection, including the events this instance published
+type postgresBackend struct {
+	db       *database.Queries
+	listener *pq.Listener
+	deliver  func(gameEvent)
+}
+
+func newPostgresBackend(dbURL string, db *sql.DB, deliver func(gameEvent)) (*postgresBackend, error) {
+	listener := pq.NewListener(dbURL, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Broadcast listener event %d: %v", ev, err)
+		}
+	})
+	if err := listener.Listen(gameEventsChannel); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("Failed to listen on %s: %v", gameEventsChannel, err)
+	}
+
+	b := &postgresBackend{
+		db:       database.New(db),
+		listener: listener,
+		deliver:  deliver,
+	}
+	go b.listen()
+
+	return b, nil
+}
+
+func (b *postgresBackend) nextSeq(ctx context.Context, gameId uuid.UUID) (int64, error) {
+	return b.db.NextGameEventSeq(ctx, gameId)
+}
+
+func (b *postgresBackend) publish(ctx context.Context, event gameEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return b.db.NotifyGameEvent(ctx, string(payload))
+}
+
+// forget has nothing to drop, the sequences are kept in the games table
+func (b *postgresBackend) forget(gameId uuid.UUID) {}
+
+func (b *postgresBackend) listen() {
+	for {
+		select {
+		case n, ok := <-b.listener.Notify:
+			if !ok {
+				return
+			}
+			// nil is sent after the listener reconnects
+			if n == nil {
+				continue
+			}
+
+			var event gameEvent
+			if err := json.Unmarshal([]byte(n.Extra), &event); err != nil {
+				log.Printf("Dropping malformed game event: %v", err)
+				continue
+			}
+			b.deliver(event)
+		case <-time.After(90 * time.Second):
+			go b.listener.Ping()
+		}
+	}
+}
+
+func (b *postgresBackend) close() error {
+	return b.listener.Close()
+}
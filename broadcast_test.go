@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestPostgresBackendFansOutAcrossInstances(t *testing.T) {
+	dbURL := os.Getenv("TEST_DB_URL")
+	if dbURL == "" {
+		t.Skip("TEST_DB_URL not set")
+	}
+
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	// two backends stand in for two API instances behind a load balancer
+	received := make(chan gameEvent, 1)
+	publisher, err := newPostgresBackend(dbURL, db, func(gameEvent) {})
+	if err != nil {
+		t.Fatalf("Failed to start publisher: %v", err)
+	}
+	defer publisher.close()
+
+	subscriber, err := newPostgresBackend(dbURL, db, func(event gameEvent) {
+		received <- event
+	})
+	if err != nil {
+		t.Fatalf("Failed to start subscriber: %v", err)
+	}
+	defer subscriber.close()
+
+	want := gameEvent{
+		GameId:  uuid.New(),
+		Message: PlayerMessage{Type: "roll", Dice: 3},
+	}
+	if err = publisher.publish(context.Background(), want); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+
+	select {
+	case got := <-received:
+		if got != want {
+			t.Errorf("Got event %+v, want %+v", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Event was not delivered to the other instance")
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/database"
+	"github.com/AradD7/Go-Knuclebones/internal/emails"
+	"github.com/google/uuid"
+)
+
+const (
+	// a correspondence game gives each move between an hour and two weeks
+	minTurnTimeoutHours = 1
+	maxTurnTimeoutHours = 14 * 24
+	// how many unfinished correspondence games a player can have at once
+	maxCorrespondenceGames = 50
+
+	// a player is reminded once this long into their turn, or halfway
+	// through it when the game gives less than twice that
+	defaultTurnReminderAfter = 12 * time.Hour
+	turnPollInterval         = time.Minute
+	turnReminderBatchSize    = 20
+)
+
+var errTooManyCorrespondenceGames = fmt.Errorf("players can have at most %d correspondence games going", maxCorrespondenceGames)
+
+// turnTimeout is the per-move deadline stored for a game created with
+// hours, no deadline for zero hours, which is a live game
+func turnTimeout(hours int) (sql.NullInt32, error) {
+	if hours == 0 {
+		return sql.NullInt32{}, nil
+	}
+	if hours < minTurnTimeoutHours || hours > maxTurnTimeoutHours {
+		return sql.NullInt32{}, fmt.Errorf("turn_timeout_hours must be between %d and %d", minTurnTimeoutHours, maxTurnTimeoutHours)
+	}
+	return sql.NullInt32{Int32: int32(hours * 3600), Valid: true}, nil
+}
+
+// turnEnds is when a turn started at startedAt runs out, zero without a
+// timeout
+func turnEnds(timeout sql.NullInt32, startedAt sql.NullTime) time.Time {
+	if !timeout.Valid || !startedAt.Valid {
+		return time.Time{}
+	}
+	return startedAt.Time.Add(time.Duration(timeout.Int32) * time.Second)
+}
+
+// turnDeadline is when the player whose turn it is forfeits the game, zero
+// for live games and games that haven't started or are over
+func turnDeadline(game database.Game) time.Time {
+	if game.Winner.Valid {
+		return time.Time{}
+	}
+	return turnEnds(game.TurnTimeoutSeconds, game.TurnStartedAt)
+}
+
+func turnTimeoutHours(game database.Game) int {
+	return int(game.TurnTimeoutSeconds.Int32) / 3600
+}
+
+// respondWithCorrespondenceLimitError answers a failed
+// checkCorrespondenceLimit
+func respondWithCorrespondenceLimitError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errTooManyCorrespondenceGames) {
+		respondWithError(w, http.StatusConflict, "You have too many correspondence games going", err)
+		return
+	}
+	respondWithError(w, http.StatusInternalServerError, "Failed to count correspondence games", err)
+}
+
+// checkCorrespondenceLimit keeps a player from starting another
+// correspondence game once they have maxCorrespondenceGames going
+func (cfg *apiConfig) checkCorrespondenceLimit(ctx context.Context, playerId uuid.UUID) error {
+	count, err := cfg.db.CountActiveCorrespondenceGames(ctx, playerId)
+	if err != nil {
+		return err
+	}
+	if count >= maxCorrespondenceGames {
+		return errTooManyCorrespondenceGames
+	}
+	return nil
+}
+
+// gameLink opens a game on the frontend
+func gameLink(gameId uuid.UUID) string {
+	return fmt.Sprintf("%s/play?game=%s", os.Getenv("FRONTEND_URL"), gameId)
+}
+
+// notificationSettingsLink is where players turn the reminder emails off
+func notificationSettingsLink() string {
+	return os.Getenv("FRONTEND_URL") + "/settings/notifications"
+}
+
+// loadTurnReminderAfter reads TURN_REMINDER_AFTER, how long into a
+// correspondence turn the player is emailed a reminder
+func loadTurnReminderAfter() (time.Duration, error) {
+	value := os.Getenv("TURN_REMINDER_AFTER")
+	if value == "" {
+		return defaultTurnReminderAfter, nil
+	}
+	after, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid TURN_REMINDER_AFTER: %v", err)
+	}
+	if after <= 0 {
+		return 0, errors.New("TURN_REMINDER_AFTER must be positive")
+	}
+	return after, nil
+}
+
+// turnScheduler looks after the deadlines of correspondence games: it
+// forfeits the games whose player ran out of time and emails a reminder to
+// players who have had the turn for a while. Every instance can run one,
+// games are claimed with SKIP LOCKED and each turn is reminded once.
+type turnScheduler struct {
+	cfg         *apiConfig
+	remindAfter time.Duration
+}
+
+func newTurnScheduler(cfg *apiConfig, remindAfter time.Duration) *turnScheduler {
+	return &turnScheduler{
+		cfg:         cfg,
+		remindAfter: remindAfter,
+	}
+}
+
+func (s *turnScheduler) run(ctx context.Context) {
+	ticker := time.NewTicker(turnPollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.forfeitExpired(ctx)
+		// a full batch may have left more due
+		for s.remind(ctx) == turnReminderBatchSize {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// forfeitExpired ends the games whose player to move let the deadline
+// pass, their opponent wins
+func (s *turnScheduler) forfeitExpired(ctx context.Context) {
+	forfeited, err := s.cfg.db.ForfeitExpiredGames(ctx)
+	if err != nil {
+		log.Printf("Failed to forfeit expired games: %v", err)
+		return
+	}
+
+	for _, game := range forfeited {
+		s.cfg.gs.broadcastToGame(game.ID)
+		s.cfg.publishWebhook(ctx, webhookGameFinished, WebhookGameFinished{
+			GameId:   game.ID,
+			WinnerId: game.Winner.UUID,
+			LoserId:  game.PlayerTurn.UUID,
+			Reason:   "forfeit",
+		}, game.Winner.UUID, game.PlayerTurn.UUID)
+
+		winner, err := s.cfg.db.GetPlayerByPlayerId(ctx, game.Winner.UUID)
+		if err != nil {
+			log.Printf("Failed to get the winner of forfeited game %v: %v", game.ID, err)
+			continue
+		}
+		loser, err := s.cfg.db.GetPlayerByPlayerId(ctx, game.PlayerTurn.UUID)
+		if err != nil {
+			log.Printf("Failed to get the loser of forfeited game %v: %v", game.ID, err)
+			continue
+		}
+		s.cfg.notify(ctx, winner.ID, notificationGameOver, game.ID, loser)
+		s.cfg.notify(ctx, loser.ID, notificationGameOver, game.ID, winner)
+	}
+}
+
+// remind emails one batch of players whose turn is due a reminder and
+// returns how many turns it claimed
+func (s *turnScheduler) remind(ctx context.Context) int {
+	due, err := s.cfg.db.ClaimTurnReminders(ctx, database.ClaimTurnRemindersParams{
+		RemindAfter: s.remindAfter.Seconds(),
+		BatchSize:   turnReminderBatchSize,
+	})
+	if err != nil {
+		log.Printf("Failed to claim turn reminders: %v", err)
+		return 0
+	}
+
+	for _, turn := range due {
+		player, err := s.cfg.db.GetPlayerByPlayerId(ctx, turn.PlayerTurn.UUID)
+		if err != nil {
+			log.Printf("Failed to get the player to remind about game %v: %v", turn.ID, err)
+			continue
+		}
+		if player.DeletedAt.Valid || !player.Email.Valid || !player.EmailVerified.Bool {
+			continue
+		}
+
+		opponent := turn.OpponentUsername
+		if turn.OpponentDisplayName.Valid {
+			opponent = turn.OpponentDisplayName.String
+		}
+		if err = s.cfg.queueEmail(ctx, emails.TurnReminder, player.Email.String, player.Locale, emails.Data{
+			Link:            gameLink(turn.ID),
+			Player:          opponent,
+			Deadline:        turnEnds(turn.TurnTimeoutSeconds, turn.TurnStartedAt),
+			UnsubscribeLink: notificationSettingsLink(),
+		}); err != nil {
+			log.Printf("Failed to queue the turn reminder to %s: %v", player.ID, err)
+		}
+	}
+	return len(due)
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestTurnTimeout(t *testing.T) {
+	tests := []struct {
+		hours     int
+		wantValid bool
+		wantErr   bool
+	}{
+		{hours: 0},
+		{hours: 1, wantValid: true},
+		{hours: 72, wantValid: true},
+		{hours: maxTurnTimeoutHours, wantValid: true},
+		{hours: maxTurnTimeoutHours + 1, wantErr: true},
+		{hours: -5, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		timeout, err := turnTimeout(tt.hours)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("turnTimeout(%d) error = %v, want error %v", tt.hours, err, tt.wantErr)
+			continue
+		}
+		if timeout.Valid != tt.wantValid || timeout.Valid && int(timeout.Int32) != tt.hours*3600 {
+			t.Errorf("turnTimeout(%d) = %+v", tt.hours, timeout)
+		}
+	}
+}
+
+func TestNewCorrespondenceGame(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		active     int64
+		wantStatus int
+	}{
+		{
+			name:       "Two days a move",
+			query:      "?turn_timeout_hours=48",
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "Too long a move",
+			query:      "?turn_timeout_hours=1000",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Too many games going",
+			query:      "?turn_timeout_hours=48",
+			active:     maxCorrespondenceGames,
+			wantStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			playerId := uuid.New()
+			var timeout driver.Value
+
+			cfg := &apiConfig{
+				tokenKeys: testKeys,
+				db: newStubDB(t, map[string]stubQuery{
+					"IsActivePlayer": activePlayer,
+					"GetPlayerByPlayerId": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						return [][]driver.Value{playerRow(playerId, nil, "player@example.com")}, nil
+					},
+					"CountActiveCorrespondenceGames": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						return [][]driver.Value{{tt.active}}, nil
+					},
+					"DeleteEmptyPublicGamesForPlayer": execOK,
+					"CreateBoard": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						return [][]driver.Value{boardRow(uuid.New(), playerId)}, nil
+					},
+					"CreateNewGame": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						timeout = args[2].Value
+						row := gameRow(uuid.New(), uuid.New(), false, nil, nil)
+						row[12] = timeout
+						return [][]driver.Value{row}, nil
+					},
+					"LinkGame":                 execOK,
+					"EnqueueWebhookDeliveries": execOK,
+				}),
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/games/new"+tt.query, nil)
+			req.Header.Set("Authorization", "Bearer "+makeToken(t, playerId))
+			w := httptest.NewRecorder()
+			cfg.handlerNewGame(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Got status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if w.Code != http.StatusCreated {
+				return
+			}
+
+			if timeout != int64(48*3600) {
+				t.Errorf("Created the game with a timeout of %v, want two days in seconds", timeout)
+			}
+			var game Game
+			if err := json.NewDecoder(w.Body).Decode(&game); err != nil {
+				t.Fatal(err)
+			}
+			if game.TurnTimeoutHours != 48 || !game.Deadline.IsZero() {
+				t.Errorf("Got %+v, want a 48 hour game without a deadline until someone joins", game)
+			}
+		})
+	}
+}
+
+func TestMoveAfterDeadline(t *testing.T) {
+	playerId := uuid.New()
+	gameId := uuid.New()
+	boardId := uuid.New()
+
+	tests := []struct {
+		name   string
+		winner driver.Value
+	}{
+		{name: "Deadline passed"},
+		// once forfeited the game has no deadline anymore
+		{name: "Forfeited", winner: uuid.NewString()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &apiConfig{
+				tokenKeys: testKeys,
+				db: newStubDB(t, map[string]stubQuery{
+					"IsActivePlayer": activePlayer,
+					"GetBoardByPlayerIdAndGameId": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						return [][]driver.Value{boardRow(boardId, playerId)}, nil
+					},
+					"GetGameById": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						row := gameRow(gameId, boardId, false, nil, nil)
+						row[5] = tt.winner
+						row[12] = int64(24 * 3600)
+						row[13] = time.Now().Add(-25 * time.Hour)
+						return [][]driver.Value{row}, nil
+					},
+				}),
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/games/move/"+gameId.String(), strings.NewReader(`{"dice": 3, "row": 2, "col": 0}`))
+			req.SetPathValue("game_id", gameId.String())
+			req.Header.Set("Authorization", "Bearer "+makeToken(t, playerId))
+			w := httptest.NewRecorder()
+			cfg.handlerMakeMove(w, req)
+
+			if w.Code != http.StatusConflict {
+				t.Errorf("Got status %d, want %d: %s", w.Code, http.StatusConflict, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestTurnSchedulerRemind(t *testing.T) {
+	tests := []struct {
+		name      string
+		email     any
+		wantEmail bool
+	}{
+		{
+			name:      "Verified email",
+			email:     "player@example.com",
+			wantEmail: true,
+		},
+		{
+			name:  "No email",
+			email: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("FRONTEND_URL", "https://example.com")
+			playerId := uuid.New()
+			gameId := uuid.New()
+			startedAt := time.Date(2025, 3, 14, 6, 30, 0, 0, time.UTC)
+			var queued []driver.Value
+
+			cfg := &apiConfig{
+				db: newStubDB(t, map[string]stubQuery{
+					"ClaimTurnReminders": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						if args[0].Value != (6 * time.Hour).Seconds() {
+							t.Errorf("Claimed reminders after %v seconds, want the configured 6 hours", args[0].Value)
+						}
+						return [][]driver.Value{{gameId.String(), playerId.String(), startedAt, int64(12 * 3600), "bones", "Bones"}}, nil
+					},
+					"GetPlayerByPlayerId": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						return [][]driver.Value{playerRow(playerId, nil, tt.email)}, nil
+					},
+					"EnqueueEmail": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						now := time.Now()
+						queued = []driver.Value{uuid.NewString(), args[0].Value, args[1].Value, args[2].Value, args[3].Value, 0, now, nil, now, nil, nil}
+						return [][]driver.Value{queued}, nil
+					},
+				}),
+			}
+
+			if claimed := newTurnScheduler(cfg, 6*time.Hour).remind(t.Context()); claimed != 1 {
+				t.Errorf("Claimed %d reminders, want 1", claimed)
+			}
+
+			if !tt.wantEmail {
+				if queued != nil {
+					t.Errorf("Queued %v for a player without an email", queued)
+				}
+				return
+			}
+			if queued == nil {
+				t.Fatal("No reminder was queued")
+			}
+			text := queued[4].(string)
+			if queued[1] != "player@example.com" || queued[2] != "It's your turn against Bones" {
+				t.Errorf("Queued %q to %v, want the reminder to the player", queued[2], queued[1])
+			}
+			for _, want := range []string{"2025-03-14 18:30 UTC", "https://example.com/play?game=" + gameId.String(), "https://example.com/settings/notifications"} {
+				if !strings.Contains(text, want) {
+					t.Errorf("Reminder is missing %q:\n%s", want, text)
+				}
+			}
+		})
+	}
+}
+
+func TestTurnSchedulerForfeitExpired(t *testing.T) {
+	gameId := uuid.New()
+	winnerId := uuid.New()
+	loserId := uuid.New()
+	notified := map[string]driver.Value{}
+
+	cfg := &apiConfig{
+		gs: newGameServer(),
+		db: newStubDB(t, map[string]stubQuery{
+			"ForfeitExpiredGames": func(args []driver.NamedValue) ([][]driver.Value, error) {
+				return [][]driver.Value{{gameId.String(), winnerId.String(), loserId.String()}}, nil
+			},
+			"GetPlayerByPlayerId": func(args []driver.NamedValue) ([][]driver.Value, error) {
+				id, _ := uuid.Parse(args[0].Value.(string))
+				return [][]driver.Value{playerRow(id, nil, nil)}, nil
+			},
+			"CreateNotification": func(args []driver.NamedValue) ([][]driver.Value, error) {
+				if args[1].Value != notificationGameOver || args[2].Value != gameId.String() {
+					t.Errorf("Notified %v about %v, want game over of %v", args[1].Value, args[2].Value, gameId)
+				}
+				notified[args[0].Value.(string)] = args[3].Value
+				return [][]driver.Value{notificationRow(args)}, nil
+			},
+			"EnqueueWebhookDeliveries": func(args []driver.NamedValue) ([][]driver.Value, error) {
+				if args[0].Value != webhookGameFinished || !strings.Contains(args[1].Value.(string), `"reason":"forfeit"`) {
+					t.Errorf("Published %v %v, want the forfeit", args[0].Value, args[1].Value)
+				}
+				return nil, nil
+			},
+		}),
+	}
+	cfg.gs.backend = newMemoryBackend(cfg.gs.deliver)
+
+	newTurnScheduler(cfg, time.Hour).forfeitExpired(t.Context())
+
+	if notified[winnerId.String()] != loserId.String() || notified[loserId.String()] != winnerId.String() {
+		t.Errorf("Notified %v, want both players told about the other", notified)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	maxBufferedEvents = 64
+	eventLogTTL       = time.Hour
+)
+
+// gameLog keeps the latest events of a game so a player whose websocket
+// dropped can catch up on what they missed when they reconnect
+type gameLog struct {
+	seq       int64
+	events    []PlayerMessage
+	updatedAt time.Time
+}
+
+// record adds a delivered event to its game's log. Callers must hold the
+// write lock.
+func (gs *gameServer) record(event gameEvent) {
+	id := event.GameId.String()
+	history, ok := gs.events[id]
+	if !ok {
+		gs.pruneEventLogs()
+		history = &gameLog{}
+		gs.events[id] = history
+	}
+
+	// events published by different instances can arrive slightly out of
+	// order, keep the buffer sorted by sequence
+	i := len(history.events)
+	for i > 0 && history.events[i-1].Seq > event.Message.Seq {
+		i--
+	}
+	history.events = append(history.events, PlayerMessage{})
+	copy(history.events[i+1:], history.events[i:])
+	history.events[i] = event.Message
+
+	if len(history.events) > maxBufferedEvents {
+		history.events = history.events[len(history.events)-maxBufferedEvents:]
+	}
+	history.seq = max(history.seq, event.Message.Seq)
+	history.updatedAt = time.Now()
+
+	if event.Message.Type == "presence" {
+		gs.recordPresence(id, event.Message)
+	}
+}
+
+// missedEvents returns what a client that last saw lastSeq has to receive to
+// be up to date: the buffered events after lastSeq, or a snapshot telling it
+// to refetch the game when the buffer no longer covers the gap. Callers must
+// hold the lock.
+func (gs *gameServer) missedEvents(id string, lastSeq int64) []PlayerMessage {
+	history, ok := gs.events[id]
+	if !ok {
+		history = &gameLog{}
+	}
+
+	if lastSeq == history.seq {
+		return nil
+	}
+
+	if lastSeq > history.seq || len(history.events) == 0 || history.events[0].Seq > lastSeq+1 {
+		return []PlayerMessage{{
+			Type: "snapshot",
+			Seq:  history.seq,
+		}}
+	}
+
+	var missed []PlayerMessage
+	for _, msg := range history.events {
+		if msg.Seq > lastSeq {
+			missed = append(missed, msg)
+		}
+	}
+	return missed
+}
+
+func (gs *gameServer) pruneEventLogs() {
+	for id, history := range gs.events {
+		if time.Since(history.updatedAt) > eventLogTTL && len(gs.connections[id]) == 0 {
+			delete(gs.events, id)
+			if gameId, err := uuid.Parse(id); err == nil && gs.backend != nil {
+				gs.backend.forget(gameId)
+			}
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/auth"
+	"github.com/AradD7/Go-Knuclebones/internal/database"
+	"github.com/AradD7/Go-Knuclebones/internal/emails"
+	"github.com/AradD7/Go-Knuclebones/internal/verification"
+)
+
+// authenticatedPlayer loads the player the bearer token belongs to, writing
+// the error response itself when it can't
+func (cfg *apiConfig) authenticatedPlayer(w http.ResponseWriter, r *http.Request) (database.Player, bool) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Not Authorized", err)
+		return database.Player{}, false
+	}
+
+	playerId, err := auth.ValidateJWT(token, cfg.tokenKeys)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Token is exipred, refresh JWT token or login again", err)
+		return database.Player{}, false
+	}
+
+	player, err := cfg.db.GetPlayerByPlayerId(r.Context(), playerId)
+	if err != nil || player.DeletedAt.Valid {
+		respondWithError(w, http.StatusNotFound, "Player not found", err)
+		return database.Player{}, false
+	}
+
+	return player, true
+}
+
+// accounts without a password confirm sensitive changes by having logged in
+// within this window
+const recentLoginWindow = 5 * time.Minute
+
+var errLoginNotRecent = errors.New("the session was not logged in to recently")
+
+// recentlyLoggedIn is how an account without a password shows it's really
+// the player: the session of the access token was logged in to within
+// recentLoginWindow. Refreshing the access token doesn't count as a login.
+func (cfg *apiConfig) recentlyLoggedIn(r *http.Request) error {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return err
+	}
+	authTime, err := auth.GetJWTAuthTime(token, cfg.tokenKeys)
+	if err != nil {
+		return err
+	}
+	if time.Since(authTime) > recentLoginWindow {
+		return errLoginNotRecent
+	}
+	return nil
+}
+
+// confirmPassword makes sure it's really the player before a sensitive
+// change. Accounts that login with a provider have no password to confirm,
+// they must have logged in recently instead. It returns whether it passed.
+func (cfg *apiConfig) confirmPassword(w http.ResponseWriter, r *http.Request, player database.Player, password string) bool {
+	if !player.HashedPassword.Valid {
+		if err := cfg.recentlyLoggedIn(r); err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Login again to confirm it's you", err)
+			return false
+		}
+		return true
+	}
+	if err := auth.CompareHashPassword(player.HashedPassword.String, password); err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Password is incorrect", err)
+		return false
+	}
+	return true
+}
+
+func (cfg *apiConfig) handlerChangePassword(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return
+	}
+	if player.IsGuest {
+		respondWithError(w, http.StatusForbidden, guestUpgradeRequired, nil)
+		return
+	}
+
+	var params parameters
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request", err)
+		return
+	}
+
+	if params.NewPassword == "" {
+		respondWithError(w, http.StatusBadRequest, "Password cannot be empty", nil)
+		return
+	}
+
+	if !cfg.confirmPassword(w, r, player, params.CurrentPassword) {
+		return
+	}
+
+	hashPassword, err := auth.HashPassword(params.NewPassword)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to hash the password", err)
+		return
+	}
+
+	if err = cfg.db.UpdatePlayerPassword(r.Context(), database.UpdatePlayerPasswordParams{
+		ID: player.ID,
+		HashedPassword: sql.NullString{
+			Valid:  true,
+			String: hashPassword,
+		},
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update password", err)
+		return
+	}
+
+	// other devices are logged out, this one gets a fresh session
+	if err = cfg.db.RevokeAllRefreshTokensForPlayer(r.Context(), player.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to revoke sessions", err)
+		return
+	}
+
+	if err = cfg.db.RevokeAllSessionsForPlayer(r.Context(), player.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to revoke sessions", err)
+		return
+	}
+
+	cfg.respondWithSession(w, r, player)
+}
+
+func (cfg *apiConfig) handlerChangeEmail(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		NewEmail string `json:"new_email"`
+		Password string `json:"password"`
+	}
+
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return
+	}
+	if player.IsGuest {
+		respondWithError(w, http.StatusForbidden, guestUpgradeRequired, nil)
+		return
+	}
+
+	var params parameters
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request", err)
+		return
+	}
+
+	if params.NewEmail == "" {
+		respondWithError(w, http.StatusBadRequest, "Email cannot be empty", nil)
+		return
+	}
+
+	if !cfg.confirmPassword(w, r, player, params.Password) {
+		return
+	}
+
+	if _, err := cfg.db.GetPlayerByEmail(r.Context(), sql.NullString{
+		Valid:  true,
+		String: params.NewEmail,
+	}); err == nil {
+		respondWithError(w, http.StatusBadRequest, "Email is already in use", nil)
+		return
+	}
+
+	// only the latest link works
+	if err := cfg.db.DeleteVerificationTokensForPlayer(r.Context(), database.DeleteVerificationTokensForPlayerParams{
+		PlayerID: player.ID,
+		Purpose:  verification.PurposeEmailChange,
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to generate confirmation token", err)
+		return
+	}
+
+	token, hash := verification.GenerateVerificationToken()
+	if _, err := cfg.db.CreateVerificationToken(r.Context(), database.CreateVerificationTokenParams{
+		TokenHash:        hash,
+		PlayerID:         player.ID,
+		ExpiresInMinutes: int32(verification.EmailChangeTTL.Minutes()),
+		Purpose:          verification.PurposeEmailChange,
+		Payload: sql.NullString{
+			Valid:  true,
+			String: params.NewEmail,
+		},
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to generate confirmation token", err)
+		return
+	}
+
+	if err := cfg.queueEmail(r.Context(), emails.EmailChange, params.NewEmail, player.Locale, emails.Data{
+		Link:      verification.Link(verification.PurposeEmailChange, token),
+		ExpiresIn: verification.EmailChangeTTL,
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to send email", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{
+		"message": "A confirmation email has been sent to the new address",
+	})
+}
+
+func (cfg *apiConfig) handlerConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token string `json:"token"`
+	}
+
+	var params parameters
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request", err)
+		return
+	}
+
+	tokenHash := verification.HashToken(params.Token)
+	changeToken, err := cfg.db.GetVerificationToken(r.Context(), database.GetVerificationTokenParams{
+		TokenHash: tokenHash,
+		Purpose:   verification.PurposeEmailChange,
+	})
+	if err != nil || !changeToken.Payload.Valid {
+		respondWithError(w, http.StatusBadRequest, "Invalid token", err)
+		return
+	}
+
+	// single use, whatever happens next
+	cfg.db.DeleteVerificationToken(r.Context(), tokenHash)
+
+	if !changeToken.ExpiresAt.After(time.Now().UTC()) {
+		respondWithError(w, http.StatusBadRequest, "Token expired", nil)
+		return
+	}
+
+	// someone may have registered the address since the link was sent
+	if existing, err := cfg.db.GetPlayerByEmail(r.Context(), changeToken.Payload); err == nil && existing.ID != changeToken.PlayerID {
+		respondWithError(w, http.StatusBadRequest, "Email is already in use", nil)
+		return
+	}
+
+	if err = cfg.db.UpdatePlayerEmail(r.Context(), database.UpdatePlayerEmailParams{
+		ID:    changeToken.PlayerID,
+		Email: changeToken.Payload,
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update email", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{
+		"message": "Email has been changed",
+		"email":   changeToken.Payload.String,
+	})
+}
+
+// respondWithSession starts a new session for the player and responds with
+// its tokens
+func (cfg *apiConfig) respondWithSession(w http.ResponseWriter, r *http.Request, player database.Player) {
+	refreshToken, err := cfg.startSession(r, player.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create new refreshToken token", err)
+		return
+	}
+
+	accessToken, err := auth.MakeJWT(player.ID, cfg.tokenKeys, time.Minute*60)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create new JWT token", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, Player{
+		Id:            player.ID,
+		CreatedAt:     player.CreatedAt,
+		Username:      player.Username,
+		Email:         player.Email.String,
+		EmailVerified: player.EmailVerified.Bool,
+		DisplayName:   player.DisplayName.String,
+		Avatar:        player.Avatar.String,
+		RefreshToken:  refreshToken.Token,
+		Token:         accessToken,
+		IsGuest:       player.IsGuest,
+		Locale:        player.Locale,
+	})
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/auth"
+	"github.com/AradD7/Go-Knuclebones/internal/verification"
+	"github.com/google/uuid"
+)
+
+// playerRow is a players row in the column order of the generated Scan calls
+func playerRow(id uuid.UUID, hashedPassword, email any) []driver.Value {
+	now := time.Now()
+	return []driver.Value{id.String(), now, now, "player", nil, hashedPassword, nil, email, true, nil, false, "en", false}
+}
+
+func TestChangePassword(t *testing.T) {
+	current, err := auth.HashPassword("0ld-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		hashedPassword any
+		currentPass    string
+		wantStatus     int
+	}{
+		{
+			name:           "Correct current password",
+			hashedPassword: current,
+			currentPass:    "0ld-password",
+			wantStatus:     http.StatusOK,
+		},
+		{
+			name:           "Wrong current password",
+			hashedPassword: current,
+			currentPass:    "guess",
+			wantStatus:     http.StatusUnauthorized,
+		},
+		{
+			name:           "Google-only account sets one",
+			hashedPassword: nil,
+			wantStatus:     http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			playerId := uuid.New()
+			var newHash string
+			revoked := false
+
+			cfg := &apiConfig{
+				tokenKeys: testKeys,
+				db: newStubDB(t, map[string]stubQuery{
+					"GetPlayerByPlayerId": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						return [][]driver.Value{playerRow(playerId, tt.hashedPassword, "old@example.com")}, nil
+					},
+					"UpdatePlayerPassword": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						newHash = args[1].Value.(string)
+						return nil, nil
+					},
+					"RevokeAllRefreshTokensForPlayer": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						revoked = true
+						return nil, nil
+					},
+					"RevokeAllSessionsForPlayer": execOK,
+					"CreateSession":              createSessionStub,
+					"CreateRefreshToken":         createRefreshTokenStub,
+				}),
+			}
+
+			body := strings.NewReader(`{"current_password": "` + tt.currentPass + `", "new_password": "n3w-password"}`)
+			req := httptest.NewRequest(http.MethodPost, "/api/players/password/change", body)
+			req.Header.Set("Authorization", "Bearer "+makeToken(t, playerId))
+			w := httptest.NewRecorder()
+			cfg.handlerChangePassword(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Got status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				if newHash != "" || revoked {
+					t.Errorf("Password changed without the current password")
+				}
+				return
+			}
+			if err := auth.CompareHashPassword(newHash, "n3w-password"); err != nil {
+				t.Errorf("Stored hash doesn't match the new password: %v", err)
+			}
+			if !revoked {
+				t.Errorf("Other sessions were not revoked")
+			}
+		})
+	}
+}
+
+func TestChangeEmail(t *testing.T) {
+	current, err := auth.HashPassword("0ld-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		password    string
+		noPassword  bool
+		loggedInAgo time.Duration
+		taken       bool
+		wantStatus  int
+	}{
+		{name: "Link sent to the new address", password: "0ld-password", wantStatus: http.StatusOK},
+		{name: "Wrong password", password: "guess", wantStatus: http.StatusUnauthorized},
+		{name: "Address already taken", password: "0ld-password", taken: true, wantStatus: http.StatusBadRequest},
+		{name: "Google-only account just logged in", noPassword: true, wantStatus: http.StatusOK},
+		// having no password isn't proof it's the player
+		{name: "Google-only account with a refreshed token", noPassword: true, loggedInAgo: time.Hour, wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			playerId := uuid.New()
+			var purpose, payload, recipient driver.Value
+
+			cfg := &apiConfig{
+				tokenKeys: testKeys,
+				db: newStubDB(t, map[string]stubQuery{
+					"GetPlayerByPlayerId": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						if tt.noPassword {
+							return [][]driver.Value{playerRow(playerId, nil, "old@example.com")}, nil
+						}
+						return [][]driver.Value{playerRow(playerId, current, "old@example.com")}, nil
+					},
+					"GetPlayerByEmail": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						if !tt.taken {
+							return nil, nil
+						}
+						return [][]driver.Value{playerRow(uuid.New(), nil, args[0].Value)}, nil
+					},
+					"DeleteVerificationTokensForPlayer": execOK,
+					"CreateVerificationToken": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						purpose, payload = args[3].Value, args[4].Value
+						now := time.Now()
+						return [][]driver.Value{{args[0].Value, args[1].Value, now.Add(time.Hour), now, args[3].Value, args[4].Value}}, nil
+					},
+					"EnqueueEmail": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						recipient = args[0].Value
+						now := time.Now()
+						return [][]driver.Value{{uuid.NewString(), args[0].Value, args[1].Value, args[2].Value, args[3].Value, 0, now, nil, now, nil, nil}}, nil
+					},
+				}),
+			}
+
+			token, err := auth.MakeSessionJWT(playerId, testKeys, time.Hour, time.Now().Add(-tt.loggedInAgo))
+			if err != nil {
+				t.Fatal(err)
+			}
+			body := strings.NewReader(`{"new_email": "new@example.com", "password": "` + tt.password + `"}`)
+			req := httptest.NewRequest(http.MethodPost, "/api/players/email/change", body)
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			cfg.handlerChangeEmail(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Got status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				if payload != nil || recipient != nil {
+					t.Errorf("Sent a link for %v to %v", payload, recipient)
+				}
+				return
+			}
+			// the new address waits in the token until it is confirmed
+			if purpose != verification.PurposeEmailChange || payload != "new@example.com" {
+				t.Errorf("Stored a %v token for %v", purpose, payload)
+			}
+			if recipient != "new@example.com" {
+				t.Errorf("Sent the link to %v, want the new address", recipient)
+			}
+		})
+	}
+}
+
+func TestConfirmEmailChange(t *testing.T) {
+	playerId := uuid.New()
+	token, hash := verification.GenerateVerificationToken()
+
+	tests := []struct {
+		name        string
+		purpose     string
+		payload     any
+		expiresAt   time.Time
+		takenBy     uuid.UUID
+		wantStatus  int
+		wantUpdated bool
+	}{
+		{
+			name:        "Confirmed",
+			purpose:     verification.PurposeEmailChange,
+			payload:     "new@example.com",
+			expiresAt:   time.Now().UTC().Add(time.Hour),
+			wantStatus:  http.StatusOK,
+			wantUpdated: true,
+		},
+		{
+			name:       "Token of another purpose",
+			purpose:    verification.PurposePasswordReset,
+			payload:    "new@example.com",
+			expiresAt:  time.Now().UTC().Add(time.Hour),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Token without an address",
+			purpose:    verification.PurposeEmailChange,
+			expiresAt:  time.Now().UTC().Add(time.Hour),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Expired token",
+			purpose:    verification.PurposeEmailChange,
+			payload:    "new@example.com",
+			expiresAt:  time.Now().UTC().Add(-time.Minute),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Address taken since",
+			purpose:    verification.PurposeEmailChange,
+			payload:    "new@example.com",
+			expiresAt:  time.Now().UTC().Add(time.Hour),
+			takenBy:    uuid.New(),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "Address already the player's",
+			purpose:     verification.PurposeEmailChange,
+			payload:     "new@example.com",
+			expiresAt:   time.Now().UTC().Add(time.Hour),
+			takenBy:     playerId,
+			wantStatus:  http.StatusOK,
+			wantUpdated: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var updated driver.Value
+			deleted := false
+
+			cfg := &apiConfig{
+				db: newStubDB(t, map[string]stubQuery{
+					"GetVerificationToken": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						if args[0].Value != hash || args[1].Value != tt.purpose {
+							return nil, nil
+						}
+						return [][]driver.Value{{hash, playerId.String(), tt.expiresAt, time.Now(), tt.purpose, tt.payload}}, nil
+					},
+					"DeleteVerificationToken": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						deleted = args[0].Value == hash
+						return nil, nil
+					},
+					"GetPlayerByEmail": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						if tt.takenBy == uuid.Nil {
+							return nil, nil
+						}
+						return [][]driver.Value{playerRow(tt.takenBy, nil, args[0].Value)}, nil
+					},
+					"UpdatePlayerEmail": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						if args[0].Value != playerId.String() {
+							t.Errorf("Updated the email of %v, want %v", args[0].Value, playerId)
+						}
+						updated = args[1].Value
+						return nil, nil
+					},
+				}),
+			}
+
+			body := strings.NewReader(`{"token": "` + token + `"}`)
+			w := httptest.NewRecorder()
+			cfg.handlerConfirmEmailChange(w, httptest.NewRequest(http.MethodPost, "/api/players/email/confirm", body))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Got status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantUpdated != (updated == "new@example.com") {
+				t.Errorf("Updated the email to %v", updated)
+			}
+			// a token that was found is used up, confirmed or not
+			if found := tt.purpose == verification.PurposeEmailChange && tt.payload != nil; deleted != found {
+				t.Errorf("Deleted the token: %v", deleted)
+			}
+		})
+	}
+}
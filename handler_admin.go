@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/auth"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultFailedEmailsLimit = 50
+	maxFailedEmailsLimit     = 500
+)
+
+// authorizeAdmin lets through requests with ADMIN_API_KEY as their bearer
+// token, writing the error response itself otherwise
+func (cfg *apiConfig) authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if cfg.adminKey == "" {
+		respondWithError(w, http.StatusForbidden, "Admin endpoints are disabled, set ADMIN_API_KEY to use them", nil)
+		return false
+	}
+
+	key, err := auth.GetBearerToken(r.Header)
+	if err != nil || subtle.ConstantTimeCompare([]byte(key), []byte(cfg.adminKey)) != 1 {
+		respondWithError(w, http.StatusUnauthorized, "Not Authorized", err)
+		return false
+	}
+	return true
+}
+
+// queryLimit reads the limit query parameter of a listing, fallback when
+// it isn't given
+func queryLimit(r *http.Request, fallback, maximum int) (int, error) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return fallback, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > maximum {
+		return 0, fmt.Errorf("limit must be between 1 and %d", maximum)
+	}
+	return limit, nil
+}
+
+// the bodies are left out, they hold login and verification links
+type FailedEmail struct {
+	Id        uuid.UUID `json:"id"`
+	Recipient string    `json:"recipient"`
+	Subject   string    `json:"subject"`
+	Attempts  int32     `json:"attempts"`
+	LastError string    `json:"last_error"`
+	CreatedAt time.Time `json:"created_at"`
+	FailedAt  time.Time `json:"failed_at"`
+}
+
+func (cfg *apiConfig) handlerGetFailedEmails(w http.ResponseWriter, r *http.Request) {
+	if !cfg.authorizeAdmin(w, r) {
+		return
+	}
+
+	limit, err := queryLimit(r, defaultFailedEmailsLimit, maxFailedEmailsLimit)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	emails, err := cfg.db.GetFailedEmails(r.Context(), int32(limit))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get failed emails", err)
+		return
+	}
+
+	failed := []FailedEmail{}
+	for _, email := range emails {
+		failed = append(failed, FailedEmail{
+			Id:        email.ID,
+			Recipient: email.Recipient,
+			Subject:   email.Subject,
+			Attempts:  email.Attempts,
+			LastError: email.LastError.String,
+			CreatedAt: email.CreatedAt,
+			FailedAt:  email.FailedAt.Time,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, failed)
+}
+
+// handlerRetryEmail queues a dead-lettered email again, with its attempts
+// reset
+func (cfg *apiConfig) handlerRetryEmail(w http.ResponseWriter, r *http.Request) {
+	if !cfg.authorizeAdmin(w, r) {
+		return
+	}
+
+	emailId, err := uuid.Parse(r.PathValue("email_id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid email id", err)
+		return
+	}
+
+	requeued, err := cfg.db.RequeueFailedEmail(r.Context(), emailId)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to queue the email", err)
+		return
+	}
+	if requeued == 0 {
+		respondWithError(w, http.StatusNotFound, "No failed email with that id", nil)
+		return
+	}
+
+	if cfg.outbox != nil {
+		cfg.outbox.notify()
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
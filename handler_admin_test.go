@@ -0,0 +1,76 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestGetFailedEmails(t *testing.T) {
+	tests := []struct {
+		name       string
+		adminKey   string
+		bearer     string
+		wantStatus int
+	}{
+		{
+			name:       "Admin key",
+			adminKey:   "s3cret",
+			bearer:     "s3cret",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Wrong key",
+			adminKey:   "s3cret",
+			bearer:     "guess",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "No admin key configured",
+			bearer:     "",
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &apiConfig{
+				adminKey: tt.adminKey,
+				db: newStubDB(t, map[string]stubQuery{
+					"GetFailedEmails": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						now := time.Now()
+						return [][]driver.Value{{uuid.NewString(), "player@example.com", "Verify your account", "<p>link</p>", "link", outboxMaxAttempts, now, "provider is down", now, nil, now}}, nil
+					},
+				}),
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/admin/emails/failed", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.bearer)
+			w := httptest.NewRecorder()
+			cfg.handlerGetFailedEmails(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Got status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var failed []map[string]any
+			if err := json.NewDecoder(w.Body).Decode(&failed); err != nil {
+				t.Fatal(err)
+			}
+			if len(failed) != 1 || failed[0]["last_error"] != "provider is down" {
+				t.Errorf("Got %v, want the failed email", failed)
+			}
+			if _, ok := failed[0]["text"]; ok {
+				t.Errorf("Email body with its link was exposed: %v", failed[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/AradD7/Go-Knuclebones/internal/database"
+	"github.com/AradD7/Go-Knuclebones/internal/oidc"
+)
+
+const googleProvider = "google"
+
+var googleIssuer = oidc.Provider{
+	Name:    googleProvider,
+	Issuer:  "https://accounts.google.com",
+	JWKSURL: "https://www.googleapis.com/oauth2/v3/certs",
+}
+
+var providerName = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// loadOIDCProviders reads the providers players can login with, Google
+// when GOOGLE_CLIENT_ID is set and those listed as JSON in OIDC_PROVIDERS
+func loadOIDCProviders() (map[string]*oidc.Verifier, error) {
+	var providers []oidc.Provider
+	if clientId := os.Getenv("GOOGLE_CLIENT_ID"); clientId != "" {
+		google := googleIssuer
+		google.ClientID = clientId
+		providers = append(providers, google)
+	}
+
+	if value := os.Getenv("OIDC_PROVIDERS"); value != "" {
+		var configured []oidc.Provider
+		if err := json.Unmarshal([]byte(value), &configured); err != nil {
+			return nil, fmt.Errorf("invalid OIDC_PROVIDERS: %v", err)
+		}
+		providers = append(providers, configured...)
+	}
+
+	verifiers := make(map[string]*oidc.Verifier)
+	for _, provider := range providers {
+		if !providerName.MatchString(provider.Name) {
+			return nil, fmt.Errorf("invalid OIDC provider name %q, use lowercase letters, digits and dashes", provider.Name)
+		}
+		if provider.Issuer == "" || provider.ClientID == "" {
+			return nil, fmt.Errorf("OIDC provider %q needs an issuer and a client_id", provider.Name)
+		}
+		if _, ok := verifiers[provider.Name]; ok {
+			return nil, fmt.Errorf("OIDC provider %q is configured twice", provider.Name)
+		}
+		verifiers[provider.Name] = oidc.NewVerifier(provider, nil)
+	}
+	return verifiers, nil
+}
+
+// verifyIdToken checks the id token in the request body against the
+// provider in the path, writing the error response itself when it can't
+func (cfg *apiConfig) verifyIdToken(w http.ResponseWriter, r *http.Request, provider string) (oidc.Claims, bool) {
+	type parameters struct {
+		IdToken string `json:"id_token"`
+	}
+
+	verifier, ok := cfg.oidc[provider]
+	if !ok {
+		respondWithError(w, http.StatusNotFound, "Unknown login provider", nil)
+		return oidc.Claims{}, false
+	}
+
+	var params parameters
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "failed to read json data", err)
+		return oidc.Claims{}, false
+	}
+
+	claims, err := verifier.Verify(r.Context(), params.IdToken)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid id token", err)
+		return oidc.Claims{}, false
+	}
+	return claims, true
+}
+
+// handlerAuthGoogle is kept for clients from before other providers
+func (cfg *apiConfig) handlerAuthGoogle(w http.ResponseWriter, r *http.Request) {
+	cfg.loginWithOIDC(w, r, googleProvider)
+}
+
+func (cfg *apiConfig) handlerAuthOIDC(w http.ResponseWriter, r *http.Request) {
+	cfg.loginWithOIDC(w, r, r.PathValue("provider"))
+}
+
+// loginWithOIDC logs in the player the identity is linked to, creating one
+// the first time it is seen
+func (cfg *apiConfig) loginWithOIDC(w http.ResponseWriter, r *http.Request, provider string) {
+	claims, ok := cfg.verifyIdToken(w, r, provider)
+	if !ok {
+		return
+	}
+
+	player, err := cfg.db.GetPlayerByOAuthIdentity(r.Context(), database.GetPlayerByOAuthIdentityParams{
+		Provider: provider,
+		Subject:  claims.Subject,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		// an existing account is only linked by its owner, anyone can
+		// claim an email at some provider
+		if claims.Email != "" {
+			if _, err = cfg.db.GetPlayerByEmail(r.Context(), sql.NullString{Valid: true, String: claims.Email}); err == nil {
+				respondWithError(w, http.StatusConflict, "Account with that email already exists, login to it and link "+provider+" from there", nil)
+				return
+			}
+		}
+
+		player, err = cfg.createOIDCPlayer(r.Context(), provider, claims, requestLocale(r))
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to find account and to create one", err)
+		return
+	}
+	if player.DeletedAt.Valid {
+		respondWithError(w, http.StatusNotFound, "Player not found", nil)
+		return
+	}
+
+	if cfg.challengeSecondFactor(w, r, player.ID) {
+		return
+	}
+
+	cfg.respondWithSession(w, r, player)
+}
+
+func (cfg *apiConfig) createOIDCPlayer(ctx context.Context, provider string, claims oidc.Claims, locale string) (database.Player, error) {
+	username := provider + "-player"
+	if claims.Email != "" {
+		username = strings.Split(claims.Email, "@")[0]
+	}
+
+	var player database.Player
+	var err error
+	for attempt := range guestNameAttempts {
+		name := username
+		if attempt > 0 {
+			suffix := make([]byte, 2)
+			rand.Read(suffix)
+			name += "-" + hex.EncodeToString(suffix)
+		}
+
+		player, err = cfg.db.CreateOAuthPlayer(ctx, database.CreateOAuthPlayerParams{
+			Username: name,
+			Email: sql.NullString{
+				Valid:  claims.Email != "",
+				String: claims.Email,
+			},
+			DisplayName: sql.NullString{
+				Valid:  claims.Name != "",
+				String: claims.Name,
+			},
+			EmailVerified: sql.NullBool{
+				Valid: true,
+				Bool:  claims.Email != "",
+			},
+			Locale: locale,
+		})
+		if err == nil || !strings.Contains(err.Error(), "username") {
+			break
+		}
+	}
+	if err != nil {
+		return database.Player{}, err
+	}
+
+	if _, err = cfg.db.CreateOAuthIdentity(ctx, database.CreateOAuthIdentityParams{
+		PlayerID: player.ID,
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email: sql.NullString{
+			Valid:  claims.Email != "",
+			String: claims.Email,
+		},
+	}); err != nil {
+		// a player nobody can login to would keep the username and email
+		cfg.db.AnonymizePlayer(ctx, player.ID)
+		return database.Player{}, err
+	}
+	return player, nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/oidc"
+	"github.com/AradD7/Go-Knuclebones/internal/oidc/oidctest"
+	"github.com/google/uuid"
+)
+
+const testClientId = "knucklebones-test"
+
+func TestLoginWithOIDC(t *testing.T) {
+	server := oidctest.NewServer(t)
+	providers := map[string]*oidc.Verifier{
+		"test": oidc.NewVerifier(oidc.Provider{Name: "test", Issuer: server.Issuer, ClientID: testClientId}, nil),
+	}
+	existingId := uuid.New()
+
+	tests := []struct {
+		name         string
+		provider     string
+		token        string
+		linked       bool
+		emailTaken   bool
+		wantStatus   int
+		wantCreated  bool
+		wantUsername string
+	}{
+		{
+			name:         "First login creates a player",
+			provider:     "test",
+			token:        server.IDToken("new-subject", testClientId, nil),
+			wantStatus:   http.StatusOK,
+			wantCreated:  true,
+			wantUsername: "new-subject",
+		},
+		{
+			name:         "Linked identity logs in",
+			provider:     "test",
+			token:        server.IDToken("linked-subject", testClientId, nil),
+			linked:       true,
+			wantStatus:   http.StatusOK,
+			wantUsername: "player",
+		},
+		{
+			name:       "Email of another account",
+			provider:   "test",
+			token:      server.IDToken("new-subject", testClientId, nil),
+			emailTaken: true,
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "Token for another client",
+			provider:   "test",
+			token:      server.IDToken("new-subject", "another-client", nil),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "Unknown provider",
+			provider:   "nope",
+			token:      server.IDToken("new-subject", testClientId, nil),
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			created := false
+			cfg := &apiConfig{
+				tokenKeys: testKeys,
+				oidc:      providers,
+				db: newStubDB(t, map[string]stubQuery{
+					"GetPlayerByOAuthIdentity": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						if !tt.linked || args[0].Value != "test" || args[1].Value != "linked-subject" {
+							return nil, nil
+						}
+						return [][]driver.Value{playerRow(existingId, nil, "linked-subject@example.com")}, nil
+					},
+					"GetPlayerByEmail": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						if !tt.emailTaken {
+							return nil, nil
+						}
+						return [][]driver.Value{playerRow(existingId, nil, args[0].Value)}, nil
+					},
+					"CreateOAuthPlayer": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						now := time.Now()
+						return [][]driver.Value{{uuid.NewString(), now, now, args[0].Value, nil, nil, args[2].Value, args[1].Value, args[3].Value, nil, false, args[4].Value, false}}, nil
+					},
+					"CreateOAuthIdentity": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						created = true
+						return [][]driver.Value{{uuid.NewString(), args[0].Value, args[1].Value, args[2].Value, args[3].Value, time.Now()}}, nil
+					},
+					"GetPlayerTOTP":      func(args []driver.NamedValue) ([][]driver.Value, error) { return nil, nil },
+					"CreateSession":      createSessionStub,
+					"CreateRefreshToken": createRefreshTokenStub,
+				}),
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/auth/oidc/"+tt.provider, strings.NewReader(`{"id_token": "`+tt.token+`"}`))
+			req.SetPathValue("provider", tt.provider)
+			w := httptest.NewRecorder()
+			cfg.handlerAuthOIDC(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Got status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if created != tt.wantCreated {
+				t.Errorf("Identity created = %v, want %v", created, tt.wantCreated)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var player Player
+			if err := json.NewDecoder(w.Body).Decode(&player); err != nil {
+				t.Fatal(err)
+			}
+			if player.Username != tt.wantUsername || player.Token == "" || player.RefreshToken == "" {
+				t.Errorf("Got %+v, want %s with tokens", player, tt.wantUsername)
+			}
+		})
+	}
+}
+
+func TestUnlinkIdentity(t *testing.T) {
+	tests := []struct {
+		name           string
+		hashedPassword any
+		identities     int
+		wantStatus     int
+	}{
+		{
+			name:           "Player with a password",
+			hashedPassword: "hash",
+			identities:     1,
+			wantStatus:     http.StatusNoContent,
+		},
+		{
+			name:       "Another identity is left",
+			identities: 2,
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "Last way to login",
+			identities: 1,
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:           "Provider not linked",
+			hashedPassword: "hash",
+			wantStatus:     http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			playerId := uuid.New()
+			cfg := &apiConfig{
+				tokenKeys: testKeys,
+				db: newStubDB(t, map[string]stubQuery{
+					"GetPlayerByPlayerId": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						return [][]driver.Value{playerRow(playerId, tt.hashedPassword, "player@example.com")}, nil
+					},
+					"GetOAuthIdentitiesByPlayerId": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						var rows [][]driver.Value
+						for range tt.identities {
+							rows = append(rows, []driver.Value{uuid.NewString(), playerId.String(), "test", uuid.NewString(), nil, time.Now()})
+						}
+						return rows, nil
+					},
+					"DeleteOAuthIdentity": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						return rowsAffected(min(tt.identities, 1)), nil
+					},
+				}),
+			}
+
+			req := httptest.NewRequest(http.MethodDelete, "/api/players/me/identities/test", nil)
+			req.SetPathValue("provider", "test")
+			req.Header.Set("Authorization", "Bearer "+makeToken(t, playerId))
+			w := httptest.NewRecorder()
+			cfg.handlerUnlinkIdentity(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Got status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/database"
+	"github.com/google/uuid"
+)
+
+// errBlocked keeps a player out of the games of someone they blocked or who
+// blocked them
+var errBlocked = errors.New("player is blocked by or blocked someone in the game")
+
+type BlockedPlayer struct {
+	PlayerSummary
+	BlockedAt time.Time `json:"blocked_at"`
+}
+
+// handlerBlockPlayer keeps the two players out of each other's games, both
+// joining and following them, and stops friend requests and invites between
+// them. Any friendship
+// or pending invite between the two goes away.
+func (cfg *apiConfig) handlerBlockPlayer(w http.ResponseWriter, r *http.Request) {
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return
+	}
+
+	blockedId, err := uuid.Parse(r.PathValue("player_id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid player id", err)
+		return
+	}
+	if blockedId == player.ID {
+		respondWithError(w, http.StatusBadRequest, "You can't block yourself", nil)
+		return
+	}
+
+	blocked, err := cfg.db.GetPlayerByPlayerId(r.Context(), blockedId)
+	if err != nil || blocked.DeletedAt.Valid {
+		respondWithError(w, http.StatusNotFound, "Player not found", err)
+		return
+	}
+
+	if err = cfg.db.BlockPlayer(r.Context(), database.BlockPlayerParams{
+		BlockerID: player.ID,
+		BlockedID: blocked.ID,
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to block player", err)
+		return
+	}
+
+	if _, err = cfg.db.DeleteFriendship(r.Context(), database.DeleteFriendshipParams{
+		RequesterID: player.ID,
+		AddresseeID: blocked.ID,
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to remove friend", err)
+		return
+	}
+
+	if err = cfg.db.DeleteInvitesBetweenPlayers(r.Context(), database.DeleteInvitesBetweenPlayersParams{
+		BlockerID: player.ID,
+		BlockedID: blocked.ID,
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete game invites", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerUnblockPlayer(w http.ResponseWriter, r *http.Request) {
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return
+	}
+
+	blockedId, err := uuid.Parse(r.PathValue("player_id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid player id", err)
+		return
+	}
+
+	unblocked, err := cfg.db.UnblockPlayer(r.Context(), database.UnblockPlayerParams{
+		BlockerID: player.ID,
+		BlockedID: blockedId,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to unblock player", err)
+		return
+	}
+	if unblocked == 0 {
+		respondWithError(w, http.StatusNotFound, "That player isn't blocked", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerGetBlockedPlayers(w http.ResponseWriter, r *http.Request) {
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := cfg.db.GetBlockedPlayers(r.Context(), player.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get blocked players", err)
+		return
+	}
+
+	blocked := []BlockedPlayer{}
+	for _, row := range rows {
+		blocked = append(blocked, BlockedPlayer{
+			PlayerSummary: PlayerSummary{
+				Id:          row.ID,
+				Username:    row.Username,
+				DisplayName: row.DisplayName.String,
+				Avatar:      row.Avatar.String,
+			},
+			BlockedAt: row.CreatedAt,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, blocked)
+}
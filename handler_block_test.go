@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/AradD7/Go-Knuclebones/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestBlockPlayer(t *testing.T) {
+	playerId := uuid.New()
+	blockedId := uuid.New()
+
+	tests := []struct {
+		name       string
+		target     uuid.UUID
+		exists     bool
+		wantStatus int
+	}{
+		{
+			name:       "Block",
+			target:     blockedId,
+			exists:     true,
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "Yourself",
+			target:     playerId,
+			exists:     true,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Unknown player",
+			target:     blockedId,
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var blocked, unfriended, uninvited bool
+			cfg := &apiConfig{
+				tokenKeys: testKeys,
+				db: newStubDB(t, map[string]stubQuery{
+					"GetPlayerByPlayerId": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						if args[0].Value == playerId.String() {
+							return [][]driver.Value{playerRow(playerId, nil, "player@example.com")}, nil
+						}
+						if tt.exists {
+							return [][]driver.Value{playerRow(blockedId, nil, "blocked@example.com")}, nil
+						}
+						return nil, nil
+					},
+					"BlockPlayer": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						blocked = args[0].Value == playerId.String() && args[1].Value == blockedId.String()
+						return nil, nil
+					},
+					"DeleteFriendship": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						unfriended = true
+						return rowsAffected(1), nil
+					},
+					"DeleteInvitesBetweenPlayers": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						uninvited = true
+						return nil, nil
+					},
+				}),
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/players/"+tt.target.String()+"/block", nil)
+			req.SetPathValue("player_id", tt.target.String())
+			req.Header.Set("Authorization", "Bearer "+makeToken(t, playerId))
+			w := httptest.NewRecorder()
+			cfg.handlerBlockPlayer(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Got status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			want := tt.wantStatus == http.StatusNoContent
+			if blocked != want || unfriended != want || uninvited != want {
+				t.Errorf("Blocked %v, removed the friendship %v and the invites %v, want %v", blocked, unfriended, uninvited, want)
+			}
+		})
+	}
+}
+
+func TestAuthorizeGameBlocked(t *testing.T) {
+	gameId := uuid.New()
+	playerId := uuid.New()
+
+	for _, blocked := range []bool{false, true} {
+		cfg := &apiConfig{
+			db: newStubDB(t, map[string]stubQuery{
+				"GetBoardByPlayerIdAndGameId": func(args []driver.NamedValue) ([][]driver.Value, error) {
+					return [][]driver.Value{boardRow(uuid.New(), playerId)}, nil
+				},
+				"IsBlockedFromGame": func(args []driver.NamedValue) ([][]driver.Value, error) {
+					return [][]driver.Value{{blocked}}, nil
+				},
+			}),
+		}
+
+		err := cfg.authorizeGame(context.Background(), gameId, playerId)
+		if blocked && !errors.Is(err, errBlocked) || !blocked && err != nil {
+			t.Errorf("Got %v for a player who is blocked: %v", err, blocked)
+		}
+	}
+}
+
+// The block goes both ways: a player who blocked someone can't join their open
+// game either, which would lock its host out of following it
+func TestPostgresBlockedFromGame(t *testing.T) {
+	dbURL := os.Getenv("TEST_DB_URL")
+	if dbURL == "" {
+		t.Skip("TEST_DB_URL not set")
+	}
+
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	cfg := &apiConfig{db: database.New(db)}
+	newPlayer := func() uuid.UUID {
+		player, err := cfg.db.CreatePlayer(ctx, database.CreatePlayerParams{
+			Username: "player-" + uuid.NewString(),
+			Locale:   "en",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return player.ID
+	}
+	blocker, host, other := newPlayer(), newPlayer(), newPlayer()
+
+	board, err := cfg.db.CreateBoard(ctx, host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	game, err := cfg.db.CreateNewGame(ctx, database.CreateNewGameParams{Board1: board.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gameId := uuid.NullUUID{Valid: true, UUID: game.ID}
+	if err = cfg.db.LinkGame(ctx, database.LinkGameParams{ID: board.ID, GameID: gameId}); err != nil {
+		t.Fatal(err)
+	}
+	if err = cfg.db.BlockPlayer(ctx, database.BlockPlayerParams{BlockerID: blocker, BlockedID: host}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name     string
+		playerId uuid.UUID
+		want     bool
+	}{
+		{name: "Blocker", playerId: blocker, want: true},
+		{name: "Someone else", playerId: other, want: false},
+		{name: "Host", playerId: host, want: false},
+	} {
+		blocked, err := cfg.db.IsBlockedFromGame(ctx, database.IsBlockedFromGameParams{
+			GameID:   gameId,
+			PlayerID: tt.playerId,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if blocked != tt.want {
+			t.Errorf("%s is blocked from the game: %v, want %v", tt.name, blocked, tt.want)
+		}
+	}
+
+	if err = cfg.authorizeGame(ctx, game.ID, host); err != nil {
+		t.Errorf("The host can't follow their own game: %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// handlerDeletePlayer anonymizes the player instead of deleting the row, so
+// the games their opponents played against them keep their history
+func (cfg *apiConfig) handlerDeletePlayer(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Password string `json:"password"`
+	}
+
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return
+	}
+
+	var params parameters
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&params); err != nil && !errors.Is(err, io.EOF) {
+		respondWithError(w, http.StatusBadRequest, "Invalid request", err)
+		return
+	}
+
+	if !cfg.confirmPassword(w, r, player, params.Password) {
+		return
+	}
+
+	// nobody can join a game the player is no longer around for
+	if err := cfg.db.DeleteEmptyBoardsForPlayer(r.Context(), player.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete open games", err)
+		return
+	}
+
+	// nor are they around to accept the games they were invited to
+	if err := cfg.db.DeleteInvitesForPlayer(r.Context(), uuid.NullUUID{UUID: player.ID, Valid: true}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete game invites", err)
+		return
+	}
+
+	// refresh tokens go with their sessions
+	if err := cfg.db.DeleteSessionsForPlayer(r.Context(), player.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete sessions", err)
+		return
+	}
+
+	if err := cfg.db.DeleteAllVerificationTokensForPlayer(r.Context(), player.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete tokens", err)
+		return
+	}
+
+	if err := cfg.db.DeletePlayerTOTP(r.Context(), player.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete two-factor authentication", err)
+		return
+	}
+
+	if err := cfg.db.DeleteRecoveryCodes(r.Context(), player.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete recovery codes", err)
+		return
+	}
+
+	// logging in with the provider again makes a new account
+	if err := cfg.db.DeleteOAuthIdentitiesForPlayer(r.Context(), player.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to unlink accounts", err)
+		return
+	}
+
+	if err := cfg.db.DeleteFriendshipsForPlayer(r.Context(), player.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete friends", err)
+		return
+	}
+
+	if err := cfg.db.DeleteBlocksForPlayer(r.Context(), player.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete blocked players", err)
+		return
+	}
+
+	if err := cfg.db.DeleteNotificationsForPlayer(r.Context(), player.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete notifications", err)
+		return
+	}
+
+	if err := cfg.db.DeleteNotificationPreferencesForPlayer(r.Context(), player.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete notification preferences", err)
+		return
+	}
+
+	if err := cfg.db.DeleteWebhooksForPlayer(r.Context(), uuid.NullUUID{UUID: player.ID, Valid: true}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete webhooks", err)
+		return
+	}
+
+	if err := cfg.db.DeletePersonalAccessTokensForPlayer(r.Context(), player.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete personal access tokens", err)
+		return
+	}
+
+	if err := cfg.db.AnonymizePlayer(r.Context(), player.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete player", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{
+		"message": "Account has been deleted",
+	})
+}
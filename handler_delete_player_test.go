@@ -0,0 +1,107 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/auth"
+	"github.com/google/uuid"
+)
+
+func TestDeletePlayer(t *testing.T) {
+	hashed, err := auth.HashPassword("s3cret-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		hashedPassword any
+		body           string
+		loggedInAgo    time.Duration
+		wantStatus     int
+	}{
+		{
+			name:           "Correct password",
+			hashedPassword: hashed,
+			body:           `{"password": "s3cret-password"}`,
+			wantStatus:     http.StatusOK,
+		},
+		{
+			name:           "Wrong password",
+			hashedPassword: hashed,
+			body:           `{"password": "guess"}`,
+			wantStatus:     http.StatusUnauthorized,
+		},
+		{
+			name:           "Missing password",
+			hashedPassword: hashed,
+			wantStatus:     http.StatusUnauthorized,
+		},
+		{
+			name:           "Google-only account just logged in",
+			hashedPassword: nil,
+			wantStatus:     http.StatusOK,
+		},
+		{
+			// refreshing the access token of an old session isn't a login
+			name:           "Google-only account with a refreshed token",
+			hashedPassword: nil,
+			loggedInAgo:    time.Hour,
+			wantStatus:     http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			playerId := uuid.New()
+			anonymized := false
+
+			cfg := &apiConfig{
+				tokenKeys: testKeys,
+				db: newStubDB(t, map[string]stubQuery{
+					"GetPlayerByPlayerId": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						return [][]driver.Value{playerRow(playerId, tt.hashedPassword, "player@example.com")}, nil
+					},
+					"DeleteEmptyBoardsForPlayer":             execOK,
+					"DeleteInvitesForPlayer":                 execOK,
+					"DeleteBlocksForPlayer":                  execOK,
+					"DeleteNotificationsForPlayer":           execOK,
+					"DeleteNotificationPreferencesForPlayer": execOK,
+					"DeleteWebhooksForPlayer":                execOK,
+					"DeletePersonalAccessTokensForPlayer":    execOK,
+					"DeleteSessionsForPlayer":                execOK,
+					"DeletePlayerTOTP":                       execOK,
+					"DeleteRecoveryCodes":                    execOK,
+					"DeleteOAuthIdentitiesForPlayer":         execOK,
+					"DeleteFriendshipsForPlayer":             execOK,
+					"DeleteAllVerificationTokensForPlayer":   execOK,
+					"AnonymizePlayer": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						anonymized = args[0].Value == playerId.String()
+						return nil, nil
+					},
+				}),
+			}
+
+			token, err := auth.MakeSessionJWT(playerId, testKeys, time.Hour, time.Now().Add(-tt.loggedInAgo))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest(http.MethodDelete, "/api/players/me", strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			cfg.handlerDeletePlayer(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Got status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if anonymized != (tt.wantStatus == http.StatusOK) {
+				t.Errorf("Got anonymized %v with status %d", anonymized, w.Code)
+			}
+		})
+	}
+}
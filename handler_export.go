@@ -0,0 +1,360 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type playerExport struct {
+	ExportedAt         time.Time                   `json:"exported_at"`
+	Profile            exportedProfile             `json:"profile"`
+	Games              []exportedGame              `json:"games"`
+	Boards             []exportedBoard             `json:"boards"`
+	Sessions           []exportedSession           `json:"sessions"`
+	Identities         []Identity                  `json:"identities"`
+	Friends            []exportedFriend            `json:"friends"`
+	FriendRequests     FriendRequests              `json:"friend_requests"`
+	BlockedPlayers     []BlockedPlayer             `json:"blocked_players"`
+	VerificationTokens []exportedVerificationToken `json:"verification_tokens"`
+	AccessTokens       []PersonalAccessToken       `json:"access_tokens"`
+	Notifications      []exportedNotification      `json:"notifications"`
+	NotificationPrefs  NotificationPreferences     `json:"notification_preferences"`
+	Webhooks           []Webhook                   `json:"webhooks"`
+	Reports            []exportedReport            `json:"reports"`
+}
+
+type exportedProfile struct {
+	Id            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Username      string    `json:"username"`
+	DisplayName   string    `json:"display_name"`
+	Avatar        string    `json:"avatar"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	HasPassword   bool      `json:"has_password"`
+	IsGuest       bool      `json:"is_guest"`
+	Locale        string    `json:"locale"`
+	TwoFactor     bool      `json:"two_factor_enabled"`
+}
+
+type exportedGame struct {
+	Id         uuid.UUID     `json:"id"`
+	CreatedAt  time.Time     `json:"created_at"`
+	UpdatedAt  time.Time     `json:"updated_at"`
+	Board1     uuid.UUID     `json:"board1"`
+	Board2     uuid.NullUUID `json:"board2"`
+	Winner     uuid.NullUUID `json:"winner"`
+	PlayerTurn uuid.NullUUID `json:"player_turn"`
+}
+
+type exportedBoard struct {
+	Id        uuid.UUID       `json:"id"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	GameId    uuid.NullUUID   `json:"game_id"`
+	Board     json.RawMessage `json:"board"`
+	Score     int32           `json:"score"`
+}
+
+// the refresh tokens of a session are left out of the export
+type exportedSession struct {
+	Id         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	UserAgent  string     `json:"user_agent"`
+	Ip         string     `json:"ip"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+type exportedFriend struct {
+	Id       uuid.UUID `json:"id"`
+	Username string    `json:"username"`
+	Since    time.Time `json:"since"`
+}
+
+type exportedVerificationToken struct {
+	Purpose   string    `json:"purpose"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type exportedNotification struct {
+	Id        uuid.UUID     `json:"id"`
+	Type      string        `json:"type"`
+	GameId    uuid.NullUUID `json:"game_id"`
+	ActorId   uuid.NullUUID `json:"actor_id"`
+	CreatedAt time.Time     `json:"created_at"`
+	ReadAt    *time.Time    `json:"read_at"`
+}
+
+// the reports the player filed, not the ones filed against them
+type exportedReport struct {
+	Id         uuid.UUID     `json:"id"`
+	ReportedId uuid.UUID     `json:"reported_id"`
+	Reason     string        `json:"reason"`
+	Details    string        `json:"details"`
+	GameId     uuid.NullUUID `json:"game_id"`
+	CreatedAt  time.Time     `json:"created_at"`
+	ResolvedAt *time.Time    `json:"resolved_at"`
+}
+
+func (cfg *apiConfig) handlerExportPlayer(w http.ResponseWriter, r *http.Request) {
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return
+	}
+
+	games, err := cfg.db.GetGamesByPlayerId(r.Context(), player.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get games", err)
+		return
+	}
+
+	boards, err := cfg.db.GetBoardsByPlayerId(r.Context(), player.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get boards", err)
+		return
+	}
+
+	sessions, err := cfg.db.GetSessionsByPlayerId(r.Context(), player.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get sessions", err)
+		return
+	}
+
+	identities, err := cfg.db.GetOAuthIdentitiesByPlayerId(r.Context(), player.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get linked accounts", err)
+		return
+	}
+
+	friends, err := cfg.db.GetFriends(r.Context(), player.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get friends", err)
+		return
+	}
+
+	incoming, err := cfg.db.GetIncomingFriendRequests(r.Context(), player.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get friend requests", err)
+		return
+	}
+
+	outgoing, err := cfg.db.GetOutgoingFriendRequests(r.Context(), player.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get friend requests", err)
+		return
+	}
+
+	blocked, err := cfg.db.GetBlockedPlayers(r.Context(), player.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get blocked players", err)
+		return
+	}
+
+	verificationTokens, err := cfg.db.GetVerificationTokensByPlayerId(r.Context(), player.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get verification tokens", err)
+		return
+	}
+
+	accessTokens, err := cfg.db.GetPersonalAccessTokens(r.Context(), player.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get access tokens", err)
+		return
+	}
+
+	notifications, err := cfg.db.GetNotificationsByPlayerId(r.Context(), player.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get notifications", err)
+		return
+	}
+
+	// players who never changed their preferences have the defaults
+	prefs := NotificationPreferences{TurnReminders: true}
+	storedPrefs, err := cfg.db.GetNotificationPreferences(r.Context(), player.ID)
+	if err == nil {
+		prefs.TurnReminders = storedPrefs.TurnReminders
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get notification preferences", err)
+		return
+	}
+
+	webhooks, err := cfg.db.GetWebhooks(r.Context(), webhookOwner(player))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get webhooks", err)
+		return
+	}
+
+	reports, err := cfg.db.GetReportsByReporterId(r.Context(), player.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get reports", err)
+		return
+	}
+
+	twoFactor, err := cfg.twoFactorEnabled(r.Context(), player.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to check two-factor authentication", err)
+		return
+	}
+
+	export := playerExport{
+		ExportedAt: time.Now().UTC(),
+		Profile: exportedProfile{
+			Id:            player.ID,
+			CreatedAt:     player.CreatedAt,
+			UpdatedAt:     player.UpdatedAt,
+			Username:      player.Username,
+			DisplayName:   player.DisplayName.String,
+			Avatar:        player.Avatar.String,
+			Email:         player.Email.String,
+			EmailVerified: player.EmailVerified.Bool,
+			HasPassword:   player.HashedPassword.Valid,
+			IsGuest:       player.IsGuest,
+			Locale:        player.Locale,
+			TwoFactor:     twoFactor,
+		},
+		Games:              []exportedGame{},
+		Boards:             []exportedBoard{},
+		Sessions:           []exportedSession{},
+		Identities:         []Identity{},
+		Friends:            []exportedFriend{},
+		FriendRequests:     FriendRequests{Incoming: []FriendRequest{}, Outgoing: []FriendRequest{}},
+		BlockedPlayers:     []BlockedPlayer{},
+		VerificationTokens: []exportedVerificationToken{},
+		AccessTokens:       []PersonalAccessToken{},
+		Notifications:      []exportedNotification{},
+		NotificationPrefs:  prefs,
+		Webhooks:           []Webhook{},
+		Reports:            []exportedReport{},
+	}
+
+	for _, game := range games {
+		export.Games = append(export.Games, exportedGame{
+			Id:         game.ID,
+			CreatedAt:  game.CreatedAt,
+			UpdatedAt:  game.UpdatedAt,
+			Board1:     game.Board1,
+			Board2:     game.Board2,
+			Winner:     game.Winner,
+			PlayerTurn: game.PlayerTurn,
+		})
+	}
+
+	for _, board := range boards {
+		export.Boards = append(export.Boards, exportedBoard{
+			Id:        board.ID,
+			CreatedAt: board.CreatedAt,
+			UpdatedAt: board.UpdatedAt,
+			GameId:    board.GameID,
+			Board:     board.Board,
+			Score:     board.Score.Int32,
+		})
+	}
+
+	for _, session := range sessions {
+		export.Sessions = append(export.Sessions, exportedSession{
+			Id:         session.ID,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt:  session.ExpiresAt,
+			UserAgent:  session.UserAgent,
+			Ip:         session.Ip,
+			RevokedAt:  nullTime(session.RevokedAt),
+		})
+	}
+
+	for _, identity := range identities {
+		export.Identities = append(export.Identities, Identity{
+			Provider:  identity.Provider,
+			Email:     identity.Email.String,
+			CreatedAt: identity.CreatedAt,
+		})
+	}
+
+	for _, friend := range friends {
+		export.Friends = append(export.Friends, exportedFriend{
+			Id:       friend.ID,
+			Username: friend.Username,
+			Since:    friend.AcceptedAt.Time,
+		})
+	}
+
+	for _, request := range incoming {
+		export.FriendRequests.Incoming = append(export.FriendRequests.Incoming, FriendRequest{
+			PlayerSummary: PlayerSummary{Id: request.ID, Username: request.Username},
+			CreatedAt:     request.CreatedAt,
+		})
+	}
+
+	for _, request := range outgoing {
+		export.FriendRequests.Outgoing = append(export.FriendRequests.Outgoing, FriendRequest{
+			PlayerSummary: PlayerSummary{Id: request.ID, Username: request.Username},
+			CreatedAt:     request.CreatedAt,
+		})
+	}
+
+	for _, row := range blocked {
+		export.BlockedPlayers = append(export.BlockedPlayers, BlockedPlayer{
+			PlayerSummary: PlayerSummary{Id: row.ID, Username: row.Username},
+			BlockedAt:     row.CreatedAt,
+		})
+	}
+
+	for _, verificationToken := range verificationTokens {
+		export.VerificationTokens = append(export.VerificationTokens, exportedVerificationToken{
+			Purpose:   verificationToken.Purpose,
+			CreatedAt: verificationToken.CreatedAt,
+			ExpiresAt: verificationToken.ExpiresAt,
+		})
+	}
+
+	for _, accessToken := range accessTokens {
+		export.AccessTokens = append(export.AccessTokens, personalAccessTokenResponse(accessToken))
+	}
+
+	for _, notification := range notifications {
+		export.Notifications = append(export.Notifications, exportedNotification{
+			Id:        notification.ID,
+			Type:      notification.Type,
+			GameId:    notification.GameID,
+			ActorId:   notification.ActorID,
+			CreatedAt: notification.CreatedAt,
+			ReadAt:    nullTime(notification.ReadAt),
+		})
+	}
+
+	// the signing secrets of webhooks are left out
+	for _, webhook := range webhooks {
+		export.Webhooks = append(export.Webhooks, webhookResponse(webhook))
+	}
+
+	for _, report := range reports {
+		export.Reports = append(export.Reports, exportedReport{
+			Id:         report.ID,
+			ReportedId: report.ReportedID,
+			Reason:     report.Reason,
+			Details:    report.Details,
+			GameId:     report.GameID,
+			CreatedAt:  report.CreatedAt,
+			ResolvedAt: nullTime(report.ResolvedAt),
+		})
+	}
+
+	w.Header().Set("Content-Disposition", `attachment; filename="knucklebones-export.json"`)
+	respondWithJSON(w, http.StatusOK, export)
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestExportPlayer(t *testing.T) {
+	playerId := uuid.New()
+	reportedId := uuid.New()
+	now := time.Now().UTC()
+	none := func(args []driver.NamedValue) ([][]driver.Value, error) { return nil, nil }
+
+	cfg := &apiConfig{
+		tokenKeys: testKeys,
+		db: newStubDB(t, map[string]stubQuery{
+			"GetPlayerByPlayerId": func(args []driver.NamedValue) ([][]driver.Value, error) {
+				return [][]driver.Value{playerRow(playerId, nil, "player@example.com")}, nil
+			},
+			"GetGamesByPlayerId":              none,
+			"GetBoardsByPlayerId":             none,
+			"GetSessionsByPlayerId":           none,
+			"GetOAuthIdentitiesByPlayerId":    none,
+			"GetFriends":                      none,
+			"GetIncomingFriendRequests":       none,
+			"GetOutgoingFriendRequests":       none,
+			"GetBlockedPlayers":               none,
+			"GetVerificationTokensByPlayerId": none,
+			"GetPersonalAccessTokens": func(args []driver.NamedValue) ([][]driver.Value, error) {
+				return [][]driver.Value{{uuid.NewString(), playerId.String(), "scoreboard", "token-hash", "{games:read}", now, now, now.Add(time.Hour)}}, nil
+			},
+			"GetNotificationsByPlayerId": func(args []driver.NamedValue) ([][]driver.Value, error) {
+				return [][]driver.Value{{uuid.NewString(), playerId.String(), "your_turn", uuid.NewString(), nil, now, nil}}, nil
+			},
+			"GetNotificationPreferences": func(args []driver.NamedValue) ([][]driver.Value, error) {
+				return [][]driver.Value{{playerId.String(), false, now}}, nil
+			},
+			"GetWebhooks": func(args []driver.NamedValue) ([][]driver.Value, error) {
+				return [][]driver.Value{{uuid.NewString(), playerId.String(), "https://hooks.example.com/knucklebones", "webhook-signing-secret", "{game.finished}", now}}, nil
+			},
+			"GetReportsByReporterId": func(args []driver.NamedValue) ([][]driver.Value, error) {
+				return [][]driver.Value{{uuid.NewString(), playerId.String(), reportedId.String(), "spam", "", nil, now, nil}}, nil
+			},
+			"GetPlayerTOTP": func(args []driver.NamedValue) ([][]driver.Value, error) {
+				return [][]driver.Value{{playerId.String(), "totp-secret", now, now, int64(0)}}, nil
+			},
+		}),
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/players/me/export", nil)
+	req.Header.Set("Authorization", "Bearer "+makeToken(t, playerId))
+	w := httptest.NewRecorder()
+	cfg.handlerExportPlayer(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Got status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	for _, secret := range []string{"token-hash", "webhook-signing-secret", "totp-secret"} {
+		if strings.Contains(w.Body.String(), secret) {
+			t.Errorf("Export contains the secret %q", secret)
+		}
+	}
+
+	var export playerExport
+	if err := json.NewDecoder(w.Body).Decode(&export); err != nil {
+		t.Fatalf("Failed to decode export: %v", err)
+	}
+
+	if !export.Profile.TwoFactor {
+		t.Error("Export doesn't show two-factor authentication as enabled")
+	}
+	if len(export.AccessTokens) != 1 || export.AccessTokens[0].Name != "scoreboard" || export.AccessTokens[0].LastUsedAt.IsZero() || export.AccessTokens[0].ExpiresAt.IsZero() {
+		t.Errorf("Got access tokens %+v", export.AccessTokens)
+	}
+	if len(export.Notifications) != 1 || export.Notifications[0].Type != "your_turn" {
+		t.Errorf("Got notifications %+v", export.Notifications)
+	}
+	if export.NotificationPrefs.TurnReminders {
+		t.Error("Export shows turn reminders on, the player turned them off")
+	}
+	if len(export.Webhooks) != 1 || export.Webhooks[0].Url != "https://hooks.example.com/knucklebones" || len(export.Webhooks[0].Events) != 1 {
+		t.Errorf("Got webhooks %+v", export.Webhooks)
+	}
+	if len(export.Reports) != 1 || export.Reports[0].ReportedId != reportedId || export.Reports[0].Reason != "spam" {
+		t.Errorf("Got reports %+v", export.Reports)
+	}
+}
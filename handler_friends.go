@@ -0,0 +1,335 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	minSearchLength   = 2
+	searchResultLimit = 20
+)
+
+// PlayerSummary is what other players get to see of a player
+type PlayerSummary struct {
+	Id          uuid.UUID `json:"id"`
+	Username    string    `json:"username"`
+	DisplayName string    `json:"display_name"`
+	Avatar      string    `json:"avatar"`
+}
+
+func playerSummary(player database.Player) PlayerSummary {
+	return PlayerSummary{
+		Id:          player.ID,
+		Username:    player.Username,
+		DisplayName: player.DisplayName.String,
+		Avatar:      player.Avatar.String,
+	}
+}
+
+type Friend struct {
+	PlayerSummary
+	Presence string    `json:"presence"`
+	Since    time.Time `json:"since"`
+}
+
+type FriendRequest struct {
+	PlayerSummary
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type FriendRequests struct {
+	Incoming []FriendRequest `json:"incoming"`
+	Outgoing []FriendRequest `json:"outgoing"`
+}
+
+// handlerSearchPlayers finds players by the start of their username, to send
+// them a friend request
+func (cfg *apiConfig) handlerSearchPlayers(w http.ResponseWriter, r *http.Request) {
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("username"))
+	if len(query) < minSearchLength {
+		respondWithError(w, http.StatusBadRequest, "Search for at least 2 characters of a username", nil)
+		return
+	}
+
+	// the query is matched literally, not as a pattern
+	pattern := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(query) + "%"
+	players, err := cfg.db.SearchPlayersByUsername(r.Context(), database.SearchPlayersByUsernameParams{
+		Username: pattern,
+		ID:       player.ID,
+		Limit:    searchResultLimit,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to search players", err)
+		return
+	}
+
+	found := []PlayerSummary{}
+	for _, p := range players {
+		found = append(found, playerSummary(p))
+	}
+
+	respondWithJSON(w, http.StatusOK, found)
+}
+
+func (cfg *apiConfig) handlerGetFriends(w http.ResponseWriter, r *http.Request) {
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := cfg.db.GetFriends(r.Context(), player.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get friends", err)
+		return
+	}
+
+	friends := []Friend{}
+	for _, row := range rows {
+		friends = append(friends, Friend{
+			PlayerSummary: PlayerSummary{
+				Id:          row.ID,
+				Username:    row.Username,
+				DisplayName: row.DisplayName.String,
+				Avatar:      row.Avatar.String,
+			},
+			Presence: cfg.gs.playerStatus(row.ID),
+			Since:    row.AcceptedAt.Time,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, friends)
+}
+
+func (cfg *apiConfig) handlerGetFriendRequests(w http.ResponseWriter, r *http.Request) {
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return
+	}
+
+	incoming, err := cfg.db.GetIncomingFriendRequests(r.Context(), player.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get friend requests", err)
+		return
+	}
+	outgoing, err := cfg.db.GetOutgoingFriendRequests(r.Context(), player.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get friend requests", err)
+		return
+	}
+
+	requests := FriendRequests{
+		Incoming: []FriendRequest{},
+		Outgoing: []FriendRequest{},
+	}
+	for _, row := range incoming {
+		requests.Incoming = append(requests.Incoming, FriendRequest{
+			PlayerSummary: PlayerSummary{
+				Id:          row.ID,
+				Username:    row.Username,
+				DisplayName: row.DisplayName.String,
+				Avatar:      row.Avatar.String,
+			},
+			CreatedAt: row.CreatedAt,
+		})
+	}
+	for _, row := range outgoing {
+		requests.Outgoing = append(requests.Outgoing, FriendRequest{
+			PlayerSummary: PlayerSummary{
+				Id:          row.ID,
+				Username:    row.Username,
+				DisplayName: row.DisplayName.String,
+				Avatar:      row.Avatar.String,
+			},
+			CreatedAt: row.CreatedAt,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, requests)
+}
+
+// handlerSendFriendRequest asks another player to be friends. Asking a
+// player who already asked you accepts their request instead.
+func (cfg *apiConfig) handlerSendFriendRequest(w http.ResponseWriter, r *http.Request) {
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return
+	}
+	if player.IsGuest {
+		respondWithError(w, http.StatusForbidden, guestUpgradeRequired, nil)
+		return
+	}
+
+	type parameters struct {
+		PlayerId uuid.UUID `json:"player_id"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var params parameters
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Failed to decode the json data", err)
+		return
+	}
+
+	if params.PlayerId == player.ID {
+		respondWithError(w, http.StatusBadRequest, "You can't send a friend request to yourself", nil)
+		return
+	}
+
+	friend, err := cfg.db.GetPlayerByPlayerId(r.Context(), params.PlayerId)
+	if err != nil || friend.DeletedAt.Valid || friend.IsGuest {
+		respondWithError(w, http.StatusNotFound, "Player not found", err)
+		return
+	}
+
+	// either of them blocking the other looks the same as there being no
+	// such player, so the blocked one isn't told
+	blocked, err := cfg.db.IsBlockedBetween(r.Context(), database.IsBlockedBetweenParams{
+		BlockerID: player.ID,
+		BlockedID: friend.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to check blocked players", err)
+		return
+	}
+	if blocked {
+		respondWithError(w, http.StatusNotFound, "Player not found", nil)
+		return
+	}
+
+	_, err = cfg.db.CreateFriendRequest(r.Context(), database.CreateFriendRequestParams{
+		RequesterID: player.ID,
+		AddresseeID: friend.ID,
+	})
+	if err == nil {
+		respondWithJSON(w, http.StatusCreated, map[string]string{"status": "pending"})
+		return
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusInternalServerError, "Failed to send friend request", err)
+		return
+	}
+
+	// the pair already has a friendship or a request
+	existing, err := cfg.db.GetFriendship(r.Context(), database.GetFriendshipParams{
+		RequesterID: player.ID,
+		AddresseeID: friend.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to send friend request", err)
+		return
+	}
+	switch {
+	case existing.Status == "accepted":
+		respondWithError(w, http.StatusConflict, "You are already friends", nil)
+	case existing.RequesterID == player.ID:
+		respondWithError(w, http.StatusConflict, "Friend request already sent", nil)
+	default:
+		if _, err = cfg.db.AcceptFriendRequest(r.Context(), database.AcceptFriendRequestParams{
+			RequesterID: friend.ID,
+			AddresseeID: player.ID,
+		}); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to accept friend request", err)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, map[string]string{"status": "accepted"})
+	}
+}
+
+func (cfg *apiConfig) handlerAcceptFriendRequest(w http.ResponseWriter, r *http.Request) {
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return
+	}
+
+	requesterId, err := uuid.Parse(r.PathValue("player_id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid player id", err)
+		return
+	}
+
+	accepted, err := cfg.db.AcceptFriendRequest(r.Context(), database.AcceptFriendRequestParams{
+		RequesterID: requesterId,
+		AddresseeID: player.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to accept friend request", err)
+		return
+	}
+	if accepted == 0 {
+		respondWithError(w, http.StatusNotFound, "No friend request from that player", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerDeclineFriendRequest(w http.ResponseWriter, r *http.Request) {
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return
+	}
+
+	requesterId, err := uuid.Parse(r.PathValue("player_id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid player id", err)
+		return
+	}
+
+	declined, err := cfg.db.DeclineFriendRequest(r.Context(), database.DeclineFriendRequestParams{
+		RequesterID: requesterId,
+		AddresseeID: player.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to decline friend request", err)
+		return
+	}
+	if declined == 0 {
+		respondWithError(w, http.StatusNotFound, "No friend request from that player", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerRemoveFriend ends a friendship, or takes back a request the player
+// sent
+func (cfg *apiConfig) handlerRemoveFriend(w http.ResponseWriter, r *http.Request) {
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return
+	}
+
+	friendId, err := uuid.Parse(r.PathValue("player_id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid player id", err)
+		return
+	}
+
+	removed, err := cfg.db.DeleteFriendship(r.Context(), database.DeleteFriendshipParams{
+		RequesterID: player.ID,
+		AddresseeID: friendId,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to remove friend", err)
+		return
+	}
+	if removed == 0 {
+		respondWithError(w, http.StatusNotFound, "You aren't friends with that player", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func friendshipRow(requester, addressee uuid.UUID, status string) []driver.Value {
+	return []driver.Value{requester.String(), addressee.String(), status, time.Now(), nil}
+}
+
+func TestSendFriendRequest(t *testing.T) {
+	playerId := uuid.New()
+	friendId := uuid.New()
+
+	tests := []struct {
+		name       string
+		senderRow  []driver.Value
+		friendRow  []driver.Value
+		to         uuid.UUID
+		created    bool
+		existing   []driver.Value
+		blocked    bool
+		wantStatus int
+		wantAccept bool
+	}{
+		{
+			name:       "New request",
+			senderRow:  playerRow(playerId, nil, "player@example.com"),
+			friendRow:  playerRow(friendId, nil, "friend@example.com"),
+			to:         friendId,
+			created:    true,
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "They already asked",
+			senderRow:  playerRow(playerId, nil, "player@example.com"),
+			friendRow:  playerRow(friendId, nil, "friend@example.com"),
+			to:         friendId,
+			existing:   friendshipRow(friendId, playerId, "pending"),
+			wantStatus: http.StatusOK,
+			wantAccept: true,
+		},
+		{
+			name:       "Already sent",
+			senderRow:  playerRow(playerId, nil, "player@example.com"),
+			friendRow:  playerRow(friendId, nil, "friend@example.com"),
+			to:         friendId,
+			existing:   friendshipRow(playerId, friendId, "pending"),
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "Already friends",
+			senderRow:  playerRow(playerId, nil, "player@example.com"),
+			friendRow:  playerRow(friendId, nil, "friend@example.com"),
+			to:         friendId,
+			existing:   friendshipRow(friendId, playerId, "accepted"),
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "Blocked",
+			senderRow:  playerRow(playerId, nil, "player@example.com"),
+			friendRow:  playerRow(friendId, nil, "friend@example.com"),
+			to:         friendId,
+			blocked:    true,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "Yourself",
+			senderRow:  playerRow(playerId, nil, "player@example.com"),
+			to:         playerId,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Guest sender",
+			senderRow:  guestRow(playerId, "guest-1234"),
+			to:         friendId,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Guest friend",
+			senderRow:  playerRow(playerId, nil, "player@example.com"),
+			friendRow:  guestRow(friendId, "guest-1234"),
+			to:         friendId,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "Unknown player",
+			senderRow:  playerRow(playerId, nil, "player@example.com"),
+			to:         friendId,
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			accepted := false
+			cfg := &apiConfig{
+				tokenKeys: testKeys,
+				db: newStubDB(t, map[string]stubQuery{
+					"GetPlayerByPlayerId": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						switch args[0].Value {
+						case playerId.String():
+							return [][]driver.Value{tt.senderRow}, nil
+						case friendId.String():
+							if tt.friendRow != nil {
+								return [][]driver.Value{tt.friendRow}, nil
+							}
+						}
+						return nil, nil
+					},
+					"IsBlockedBetween": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						return [][]driver.Value{{tt.blocked}}, nil
+					},
+					"CreateFriendRequest": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						if !tt.created {
+							return nil, nil
+						}
+						return [][]driver.Value{friendshipRow(playerId, friendId, "pending")}, nil
+					},
+					"GetFriendship": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						return [][]driver.Value{tt.existing}, nil
+					},
+					"AcceptFriendRequest": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						if args[0].Value != friendId.String() || args[1].Value != playerId.String() {
+							t.Errorf("Accepted the request from %v to %v", args[0].Value, args[1].Value)
+						}
+						accepted = true
+						return rowsAffected(1), nil
+					},
+				}),
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/friends/requests", strings.NewReader(`{"player_id":"`+tt.to.String()+`"}`))
+			req.Header.Set("Authorization", "Bearer "+makeToken(t, playerId))
+			w := httptest.NewRecorder()
+			cfg.handlerSendFriendRequest(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Got status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if accepted != tt.wantAccept {
+				t.Errorf("Accepted their request: %v, want %v", accepted, tt.wantAccept)
+			}
+		})
+	}
+}
+
+func TestGetFriendsPresence(t *testing.T) {
+	playerId := uuid.New()
+	online := uuid.New()
+	offline := uuid.New()
+
+	cfg := &apiConfig{
+		tokenKeys: testKeys,
+		gs:        newGameServer(),
+		db: newStubDB(t, map[string]stubQuery{
+			"GetPlayerByPlayerId": func(args []driver.NamedValue) ([][]driver.Value, error) {
+				return [][]driver.Value{playerRow(playerId, nil, "player@example.com")}, nil
+			},
+			"GetFriends": func(args []driver.NamedValue) ([][]driver.Value, error) {
+				now := time.Now()
+				return [][]driver.Value{
+					{offline.String(), "alice", nil, nil, now},
+					{online.String(), "bob", "Bob", "003", now},
+				}, nil
+			},
+		}),
+	}
+	// bob has one game open and is idle in another
+	cfg.gs.presence[uuid.NewString()] = map[uuid.UUID]string{online: presenceIdle}
+	cfg.gs.presence[uuid.NewString()] = map[uuid.UUID]string{online: presenceConnected, playerId: presenceConnected}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/friends", nil)
+	req.Header.Set("Authorization", "Bearer "+makeToken(t, playerId))
+	w := httptest.NewRecorder()
+	cfg.handlerGetFriends(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Got status %d: %s", w.Code, w.Body.String())
+	}
+	var friends []Friend
+	if err := json.NewDecoder(w.Body).Decode(&friends); err != nil {
+		t.Fatal(err)
+	}
+	if len(friends) != 2 {
+		t.Fatalf("Got %d friends, want 2", len(friends))
+	}
+	if friends[0].Presence != presenceDisconnected || friends[1].Presence != presenceConnected {
+		t.Errorf("Got presence %q and %q, want disconnected and connected", friends[0].Presence, friends[1].Presence)
+	}
+}
+
+func TestSearchPlayers(t *testing.T) {
+	playerId := uuid.New()
+
+	tests := []struct {
+		name        string
+		query       string
+		wantStatus  int
+		wantPattern string
+	}{
+		{
+			name:        "Prefix",
+			query:       "knuck",
+			wantStatus:  http.StatusOK,
+			wantPattern: "knuck%",
+		},
+		{
+			name:        "Wildcards are matched literally",
+			query:       `a_b%c\`,
+			wantStatus:  http.StatusOK,
+			wantPattern: `a\_b\%c\\%`,
+		},
+		{
+			name:       "Too short",
+			query:      "k",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &apiConfig{
+				tokenKeys: testKeys,
+				db: newStubDB(t, map[string]stubQuery{
+					"GetPlayerByPlayerId": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						return [][]driver.Value{playerRow(playerId, nil, "player@example.com")}, nil
+					},
+					"SearchPlayersByUsername": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						if args[0].Value != tt.wantPattern {
+							t.Errorf("Searched for %q, want %q", args[0].Value, tt.wantPattern)
+						}
+						if args[1].Value != playerId.String() {
+							t.Error("The player wasn't left out of their own search")
+						}
+						return [][]driver.Value{playerRow(uuid.New(), nil, "knuckles@example.com")}, nil
+					},
+				}),
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/players/search?username="+url.QueryEscape(tt.query), nil)
+			req.Header.Set("Authorization", "Bearer "+makeToken(t, playerId))
+			w := httptest.NewRecorder()
+			cfg.handlerSearchPlayers(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Got status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
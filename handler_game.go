@@ -1,9 +1,12 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
+	"log"
 	"math/rand"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/AradD7/Go-Knuclebones/internal/auth"
@@ -12,16 +15,21 @@ import (
 )
 
 type Game struct {
-	Id        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	Board1    [][]int32 `json:"board1"`
-	Board2    [][]int32 `json:"board2"`
-	Score1    int       `json:"score1"`
-	Score2    int       `json:"score2"`
-	IsTurn    bool      `json:"is_turn"`
-	IsOver    bool      `json:"is_over"`
-	OppName   string    `json:"opp_name"`
-	OppAvatar string    `json:"opp_avatar"`
+	Id               uuid.UUID `json:"id"`
+	CreatedAt        time.Time `json:"created_at"`
+	Board1           [][]int32 `json:"board1"`
+	Board2           [][]int32 `json:"board2"`
+	Score1           int       `json:"score1"`
+	Score2           int       `json:"score2"`
+	IsTurn           bool      `json:"is_turn"`
+	IsOver           bool      `json:"is_over"`
+	OppName          string    `json:"opp_name"`
+	OppAvatar        string    `json:"opp_avatar"`
+	Dice             int       `json:"dice"` //last roll not yet placed, 0 if none
+	OppPresence      string    `json:"opp_presence"`
+	OppIsBot         bool      `json:"opp_is_bot"`
+	TurnTimeoutHours int       `json:"turn_timeout_hours,omitzero"` //only for correspondence games
+	Deadline         time.Time `json:"deadline,omitzero"`           //when the player to move forfeits
 }
 
 type GameOverview struct {
@@ -29,28 +37,43 @@ type GameOverview struct {
 	CreatedAt time.Time `json:"date"`
 	Status    int	    `json:"status"` //-1 means lost, 0 means in progress, 1 means won
 	OppName   string    `json:"opp_name"`
+	IsTurn    bool      `json:"is_turn"`
+	Deadline  time.Time `json:"deadline,omitzero"`
 }
 
 func (cfg *apiConfig) handlerNewGame(w http.ResponseWriter, r *http.Request) {
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Not Authorized", err)
+	playerId, ok := cfg.authorizeToken(w, r, auth.ScopeGamesPlay)
+	if !ok {
 		return
 	}
 
-	playerId, err := auth.ValidateJWT(token, cfg.tokenSecret)
+	player1, err := cfg.db.GetPlayerByPlayerId(r.Context(), playerId)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Token is exipred, refresh JWT token or login again", err)
+		respondWithError(w, http.StatusInternalServerError, "Faild to get player from DB", err)
 		return
 	}
 
-	player1, err := cfg.db.GetPlayerByPlayerId(r.Context(), playerId)
+	hours := 0
+	if value := r.URL.Query().Get("turn_timeout_hours"); value != "" {
+		hours, err = strconv.Atoi(value)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "turn_timeout_hours must be a number", err)
+			return
+		}
+	}
+	timeout, err := turnTimeout(hours)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Faild to get player from DB", err)
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
 		return
 	}
+	if timeout.Valid {
+		if err = cfg.checkCorrespondenceLimit(r.Context(), playerId); err != nil {
+			respondWithCorrespondenceLimitError(w, err)
+			return
+		}
+	}
 
-	_ = cfg.db.DeleteEmptyBoardsForPlayer(r.Context(), playerId) //don't care if error, this is just housekeeping
+	_ = cfg.db.DeleteEmptyPublicGamesForPlayer(r.Context(), playerId) //don't care if error, this is just housekeeping
 
 	player1Board, err := cfg.db.CreateBoard(r.Context(), player1.ID)
 	if err != nil {
@@ -59,8 +82,9 @@ func (cfg *apiConfig) handlerNewGame(w http.ResponseWriter, r *http.Request) {
 	}
 
 	newGame, err := cfg.db.CreateNewGame(r.Context(), database.CreateNewGameParams{
-		Board1: player1Board.ID,
-		Board2: uuid.NullUUID{Valid: false},
+		Board1:             player1Board.ID,
+		Board2:             uuid.NullUUID{Valid: false},
+		TurnTimeoutSeconds: timeout,
 	})
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Faild to create a game", err)
@@ -84,25 +108,25 @@ func (cfg *apiConfig) handlerNewGame(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	cfg.publishWebhook(r.Context(), webhookGameCreated, WebhookGameCreated{
+		GameId:           newGame.ID,
+		PlayerId:         player1.ID,
+		TurnTimeoutHours: hours,
+	}, player1.ID)
+
 	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
 	respondWithJSON(w, http.StatusCreated, Game{
-		Id:        newGame.ID,
-		CreatedAt: newGame.CreatedAt,
-		Board1:    player1BoardData,
-		Board2:    nil,
+		Id:               newGame.ID,
+		CreatedAt:        newGame.CreatedAt,
+		Board1:           player1BoardData,
+		Board2:           nil,
+		TurnTimeoutHours: hours,
 	})
 }
 
 func (cfg *apiConfig) handlerGetGames(w http.ResponseWriter, r *http.Request) {
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Failed to get JWT token from request header", err)
-		return
-	}
-
-	playerId, err := auth.ValidateJWT(token, cfg.tokenSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Token is exipred, refresh JWT token or login again", err)
+	playerId, ok := cfg.authorizeToken(w, r, auth.ScopeGamesRead)
+	if !ok {
 		return
 	}
 
@@ -123,11 +147,17 @@ func (cfg *apiConfig) handlerGetGames(w http.ResponseWriter, r *http.Request) {
 				status = -1
 			}
 		}
+		var deadline time.Time
+		if status == 0 {
+			deadline = turnEnds(game.TurnTimeoutSeconds, game.TurnStartedAt)
+		}
 		games = append(games, GameOverview{
 			Id: 		game.GameID,
 			CreatedAt: 	game.Date,
 			OppName: 	game.OpponentName,
 			Status: 	status,
+			IsTurn:		status == 0 && game.PlayerTurn.UUID == playerId,
+			Deadline:	deadline,
 		})
 	}
 
@@ -142,15 +172,8 @@ func (cfg *apiConfig) handlerGetGame(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Not Authorized", err)
-		return
-	}
-
-	playerId, err := auth.ValidateJWT(token, cfg.tokenSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Token is exipred, refresh JWT token or login again", err)
+	playerId, ok := cfg.authorizeToken(w, r, auth.ScopeGamesRead)
+	if !ok {
 		return
 	}
 
@@ -197,16 +220,21 @@ func (cfg *apiConfig) handlerGetGame(w http.ResponseWriter, r *http.Request) {
 		}
 
 		respondWithJSON(w, http.StatusOK, Game{
-			Id:        game.ID,
-			CreatedAt: game.CreatedAt,
-			Board1:    board1Data,
-			Board2:    board2Data,
-			Score1:    int(board1.Score.Int32),
-			Score2:    int(board2.Score.Int32),
-			OppName:   oppDisplayName,
-			OppAvatar: opp.Avatar.String,
-			IsTurn:    game.PlayerTurn.UUID == playerId,
-			IsOver:    game.Winner.Valid,
+			Id:               game.ID,
+			CreatedAt:        game.CreatedAt,
+			Board1:           board1Data,
+			Board2:           board2Data,
+			Score1:           int(board1.Score.Int32),
+			Score2:           int(board2.Score.Int32),
+			OppName:          oppDisplayName,
+			OppAvatar:        opp.Avatar.String,
+			IsTurn:           game.PlayerTurn.UUID == playerId,
+			IsOver:           game.Winner.Valid,
+			Dice:             int(game.LastRoll.Int32),
+			OppPresence:      cfg.gs.playerPresence(game.ID, opp.ID),
+			OppIsBot:         opp.IsBot,
+			TurnTimeoutHours: turnTimeoutHours(game),
+			Deadline:         turnDeadline(game),
 		})
 		return
 	}
@@ -224,16 +252,21 @@ func (cfg *apiConfig) handlerGetGame(w http.ResponseWriter, r *http.Request) {
 		}
 
 		respondWithJSON(w, http.StatusOK, Game{
-			Id:        game.ID,
-			CreatedAt: game.CreatedAt,
-			Board1:    board2Data,
-			Board2:    board1Data,
-			Score1:    int(board2.Score.Int32),
-			Score2:    int(board1.Score.Int32),
-			OppName:   oppDisplayName,
-			OppAvatar: opp.Avatar.String,
-			IsTurn:    game.PlayerTurn.UUID == playerId,
-			IsOver:    game.Winner.Valid,
+			Id:               game.ID,
+			CreatedAt:        game.CreatedAt,
+			Board1:           board2Data,
+			Board2:           board1Data,
+			Score1:           int(board2.Score.Int32),
+			Score2:           int(board1.Score.Int32),
+			OppName:          oppDisplayName,
+			OppAvatar:        opp.Avatar.String,
+			IsTurn:           game.PlayerTurn.UUID == playerId,
+			IsOver:           game.Winner.Valid,
+			Dice:             int(game.LastRoll.Int32),
+			OppPresence:      cfg.gs.playerPresence(game.ID, opp.ID),
+			OppIsBot:         opp.IsBot,
+			TurnTimeoutHours: turnTimeoutHours(game),
+			Deadline:         turnDeadline(game),
 		})
 		return
 	}
@@ -247,15 +280,8 @@ func (cfg *apiConfig) handlerJoinGame(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Not Authorized", err)
-		return
-	}
-
-	playerId, err := auth.ValidateJWT(token, cfg.tokenSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Token is exipred, refresh JWT token or login again", err)
+	playerId, ok := cfg.authorizeToken(w, r, auth.ScopeGamesPlay)
+	if !ok {
 		return
 	}
 
@@ -270,22 +296,60 @@ func (cfg *apiConfig) handlerJoinGame(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if currentGame.IsPrivate && !canJoinPrivateGame(currentGame, playerId, r.URL.Query().Get("code")) {
+		respondWithError(w, http.StatusForbidden, "This game is private", nil)
+		return
+	}
+
+	blocked, err := cfg.db.IsBlockedFromGame(r.Context(), database.IsBlockedFromGameParams{
+		GameID: uuid.NullUUID{
+			Valid: true,
+			UUID:  gameId,
+		},
+		PlayerID: playerId,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to check blocked players", err)
+		return
+	}
+	if blocked {
+		respondWithError(w, http.StatusForbidden, "You can't join this game", nil)
+		return
+	}
+
+	if currentGame.TurnTimeoutSeconds.Valid {
+		if err = cfg.checkCorrespondenceLimit(r.Context(), playerId); err != nil {
+			respondWithCorrespondenceLimitError(w, err)
+			return
+		}
+	}
+
 	playerBoard, err := cfg.db.CreateBoard(r.Context(), playerId)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Falied to initialize board", err)
 		return
 	}
 
-	if err = cfg.db.JoinGame(r.Context(), database.JoinGameParams{
+	// only joins while the seat is still empty, someone else may have taken
+	// it since the game was read
+	joined, err := cfg.db.JoinGame(r.Context(), database.JoinGameParams{
 		Board2: uuid.NullUUID{
 			Valid: true,
 			UUID:  playerBoard.ID,
 		},
 		ID: gameId,
-	}); err != nil {
+	})
+	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Falied to join game", err)
 		return
 	}
+	if joined == 0 {
+		if err = cfg.db.DeleteBoard(r.Context(), playerBoard.ID); err != nil {
+			log.Printf("Failed to delete the board of a lost join: %v", err)
+		}
+		respondWithError(w, http.StatusConflict, "Already in game", nil)
+		return
+	}
 
 	if err = cfg.db.LinkGame(r.Context(), database.LinkGameParams{
 		ID: playerBoard.ID,
@@ -344,13 +408,16 @@ func (cfg *apiConfig) handlerJoinGame(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
 	respondWithJSON(w, http.StatusCreated, Game{
-		Id:        gameId,
-		CreatedAt: currentGame.CreatedAt,
-		Board1:    playerBoardData,
-		Board2:    oppBoardData,
-		IsTurn:    playerId == playerTurnId,
-		OppName:   oppDisplayName,
-		OppAvatar: opp.Avatar.String,
+		Id:               gameId,
+		CreatedAt:        currentGame.CreatedAt,
+		Board1:           playerBoardData,
+		Board2:           oppBoardData,
+		IsTurn:           playerId == playerTurnId,
+		OppName:          oppDisplayName,
+		OppAvatar:        opp.Avatar.String,
+		OppIsBot:         opp.IsBot,
+		TurnTimeoutHours: turnTimeoutHours(currentGame),
+		Deadline:         turnEnds(currentGame.TurnTimeoutSeconds, sql.NullTime{Time: time.Now(), Valid: true}),
 	})
 
 	player, err := cfg.db.GetPlayerByPlayerId(r.Context(), playerId)
@@ -364,4 +431,15 @@ func (cfg *apiConfig) handlerJoinGame(w http.ResponseWriter, r *http.Request) {
 	} else {
 		cfg.gs.broadcastJoined(gameId, player.Username, player.Avatar.String)
 	}
+
+	cfg.notify(r.Context(), opp.ID, notificationOpponentJoined, gameId, player)
+
+	cfg.publishWebhook(r.Context(), webhookGameJoined, WebhookGameJoined{
+		GameId:     gameId,
+		PlayerId:   playerId,
+		OpponentId: opp.ID,
+		PlayerTurn: playerTurnId,
+	}, playerId, opp.ID)
+
+	cfg.rollForBot(r.Context(), gameId)
 }
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/database"
+	"github.com/AradD7/Go-Knuclebones/internal/emails"
+	"github.com/AradD7/Go-Knuclebones/internal/verification"
+	"github.com/google/uuid"
+)
+
+// PrivateGame is a new game only the invited player, or whoever has the
+// invite code, can join
+type PrivateGame struct {
+	Game
+	InvitedPlayer *PlayerSummary `json:"invited_player,omitempty"`
+	// only ever returned here, the game keeps just its hash
+	InviteCode string `json:"invite_code,omitempty"`
+}
+
+// GameInvite is a private game waiting for the invited player to join
+type GameInvite struct {
+	GameId    uuid.UUID     `json:"game_id"`
+	CreatedAt time.Time     `json:"created_at"`
+	From      PlayerSummary `json:"from"`
+}
+
+// gameInviteLink opens the frontend page that joins a game
+func gameInviteLink(gameId uuid.UUID) string {
+	return fmt.Sprintf("%s/join?game=%s", os.Getenv("FRONTEND_URL"), gameId)
+}
+
+// canJoinPrivateGame reports whether a player may join a private game: they
+// are the one invited, or they have its invite code. Joining clears the
+// code, so it only ever lets one player in.
+func canJoinPrivateGame(game database.Game, playerId uuid.UUID, code string) bool {
+	if game.InvitedPlayer.Valid {
+		return game.InvitedPlayer.UUID == playerId
+	}
+	if !game.InviteCodeHash.Valid || code == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(verification.HashToken(code)), []byte(game.InviteCodeHash.String)) == 1
+}
+
+// handlerNewPrivateGame creates a game for a specific player, who is told
+// about it by email and on any game they have open. Without a player the
+// game gets an invite code to share instead.
+func (cfg *apiConfig) handlerNewPrivateGame(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		PlayerId         uuid.UUID `json:"player_id"`
+		TurnTimeoutHours int       `json:"turn_timeout_hours"`
+	}
+
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return
+	}
+
+	var params parameters
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&params); err != nil && !errors.Is(err, io.EOF) {
+		respondWithError(w, http.StatusBadRequest, "Invalid request", err)
+		return
+	}
+
+	timeout, err := turnTimeout(params.TurnTimeoutHours)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if timeout.Valid {
+		if err = cfg.checkCorrespondenceLimit(r.Context(), player.ID); err != nil {
+			respondWithCorrespondenceLimitError(w, err)
+			return
+		}
+	}
+
+	var (
+		invitee database.Player
+		code    string
+	)
+	createParams := database.CreatePrivateGameParams{
+		TurnTimeoutSeconds: timeout,
+	}
+	if params.PlayerId != uuid.Nil {
+		if params.PlayerId == player.ID {
+			respondWithError(w, http.StatusBadRequest, "You can't invite yourself", nil)
+			return
+		}
+		invitee, err = cfg.db.GetPlayerByPlayerId(r.Context(), params.PlayerId)
+		if errors.Is(err, sql.ErrNoRows) || err == nil && invitee.DeletedAt.Valid {
+			respondWithError(w, http.StatusNotFound, "Player not found", err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to get player", err)
+			return
+		}
+		blocked, err := cfg.db.IsBlockedBetween(r.Context(), database.IsBlockedBetweenParams{
+			BlockerID: player.ID,
+			BlockedID: invitee.ID,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to check blocked players", err)
+			return
+		}
+		if blocked {
+			respondWithError(w, http.StatusNotFound, "Player not found", nil)
+			return
+		}
+		createParams.InvitedPlayer = uuid.NullUUID{UUID: invitee.ID, Valid: true}
+	} else {
+		var hash string
+		code, hash = verification.GenerateVerificationToken()
+		createParams.InviteCodeHash = sql.NullString{String: hash, Valid: true}
+	}
+
+	board, err := cfg.db.CreateBoard(r.Context(), player.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to initialize board", err)
+		return
+	}
+
+	createParams.Board1 = board.ID
+	game, err := cfg.db.CreatePrivateGame(r.Context(), createParams)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create a game", err)
+		return
+	}
+
+	if err = cfg.db.LinkGame(r.Context(), database.LinkGameParams{
+		GameID: uuid.NullUUID{UUID: game.ID, Valid: true},
+		ID:     board.ID,
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to link board to game", err)
+		return
+	}
+
+	var boardData [][]int32
+	if err = json.Unmarshal(board.Board, &boardData); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't turn the board into [][]int32", err)
+		return
+	}
+
+	response := PrivateGame{
+		Game: Game{
+			Id:               game.ID,
+			CreatedAt:        game.CreatedAt,
+			Board1:           boardData,
+			TurnTimeoutHours: params.TurnTimeoutHours,
+		},
+		InviteCode: code,
+	}
+	// an invited player's webhooks hear about the game too
+	subscribers := []uuid.UUID{player.ID}
+	if params.PlayerId != uuid.Nil {
+		summary := playerSummary(invitee)
+		response.InvitedPlayer = &summary
+		cfg.sendGameInvite(r.Context(), player, invitee, game.ID)
+		subscribers = append(subscribers, invitee.ID)
+	}
+	cfg.publishWebhook(r.Context(), webhookGameCreated, WebhookGameCreated{
+		GameId:           game.ID,
+		PlayerId:         player.ID,
+		IsPrivate:        true,
+		TurnTimeoutHours: params.TurnTimeoutHours,
+	}, subscribers...)
+
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	respondWithJSON(w, http.StatusCreated, response)
+}
+
+// sendGameInvite tells the invitee about a game, by email when they have a
+// verified address and in their inbox. The game is created either way, so
+// failures are only logged.
+func (cfg *apiConfig) sendGameInvite(ctx context.Context, inviter, invitee database.Player, gameId uuid.UUID) {
+	name := inviter.Username
+	if inviter.DisplayName.Valid {
+		name = inviter.DisplayName.String
+	}
+
+	if invitee.Email.Valid && invitee.EmailVerified.Bool {
+		if err := cfg.queueEmail(ctx, emails.GameInvite, invitee.Email.String, invitee.Locale, emails.Data{
+			Link:   gameInviteLink(gameId),
+			Player: name,
+		}); err != nil {
+			log.Printf("Failed to queue the game invite email to %s: %v", invitee.ID, err)
+		}
+	}
+
+	cfg.notify(ctx, invitee.ID, notificationInvite, gameId, inviter)
+}
+
+// handlerGetGameInvites lists the private games the player was invited to
+// and hasn't joined yet
+func (cfg *apiConfig) handlerGetGameInvites(w http.ResponseWriter, r *http.Request) {
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return
+	}
+
+	pending, err := cfg.db.GetPendingInvites(r.Context(), uuid.NullUUID{UUID: player.ID, Valid: true})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get game invites", err)
+		return
+	}
+
+	invites := []GameInvite{}
+	for _, invite := range pending {
+		invites = append(invites, GameInvite{
+			GameId:    invite.ID,
+			CreatedAt: invite.CreatedAt,
+			From: PlayerSummary{
+				Id:          invite.PlayerID,
+				Username:    invite.Username,
+				DisplayName: invite.DisplayName.String,
+				Avatar:      invite.Avatar.String,
+			},
+		})
+	}
+
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	respondWithJSON(w, http.StatusOK, invites)
+}
+
+// handlerDeleteGameInvite lets the player who created a private game cancel
+// it, or the invited player decline it, as long as nobody joined yet
+func (cfg *apiConfig) handlerDeleteGameInvite(w http.ResponseWriter, r *http.Request) {
+	gameId, err := uuid.Parse(r.PathValue("game_id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Game ID is not valid", err)
+		return
+	}
+
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return
+	}
+
+	cancelled, err := cfg.db.DeleteGameInvite(r.Context(), database.DeleteGameInviteParams{
+		ID:       gameId,
+		PlayerID: player.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to cancel the invite", err)
+		return
+	}
+	if cancelled == 0 {
+		declined, err := cfg.db.DeclineGameInvite(r.Context(), database.DeclineGameInviteParams{
+			ID:            gameId,
+			InvitedPlayer: uuid.NullUUID{UUID: player.ID, Valid: true},
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to decline the invite", err)
+			return
+		}
+		if declined == 0 {
+			respondWithError(w, http.StatusNotFound, "Invite not found", nil)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/verification"
+	"github.com/google/uuid"
+)
+
+func gameRow(id, board1 uuid.UUID, isPrivate bool, invitedPlayer, inviteCodeHash any) []driver.Value {
+	now := time.Now()
+	return []driver.Value{id.String(), now, now, board1.String(), nil, nil, nil, int64(0), nil, isPrivate, invitedPlayer, inviteCodeHash, nil, nil, nil}
+}
+
+func boardRow(id, playerId uuid.UUID) []driver.Value {
+	now := time.Now()
+	return []driver.Value{id.String(), now, now, []byte("[[0,0,0],[0,0,0],[0,0,0]]"), playerId.String(), nil, nil}
+}
+
+func TestJoinPrivateGame(t *testing.T) {
+	gameId := uuid.New()
+	hostId := uuid.New()
+	hostBoard := uuid.New()
+	invitedId := uuid.New()
+	code, codeHash := verification.GenerateVerificationToken()
+
+	tests := []struct {
+		name       string
+		game       []driver.Value
+		playerId   uuid.UUID
+		code       string
+		blocked    bool
+		taken      bool
+		wantStatus int
+	}{
+		{
+			name:       "Open game",
+			game:       gameRow(gameId, hostBoard, false, nil, nil),
+			playerId:   uuid.New(),
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "Invited player",
+			game:       gameRow(gameId, hostBoard, true, invitedId.String(), nil),
+			playerId:   invitedId,
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "Someone else",
+			game:       gameRow(gameId, hostBoard, true, invitedId.String(), nil),
+			playerId:   uuid.New(),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Invite code",
+			game:       gameRow(gameId, hostBoard, true, nil, codeHash),
+			playerId:   uuid.New(),
+			code:       code,
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "Wrong invite code",
+			game:       gameRow(gameId, hostBoard, true, nil, codeHash),
+			playerId:   uuid.New(),
+			code:       "nope",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Blocked by the host",
+			game:       gameRow(gameId, hostBoard, false, nil, nil),
+			playerId:   uuid.New(),
+			blocked:    true,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Invite code already used",
+			game:       gameRow(gameId, hostBoard, true, nil, nil),
+			playerId:   uuid.New(),
+			code:       code,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Joined by someone else meanwhile",
+			game:       gameRow(gameId, hostBoard, false, nil, nil),
+			playerId:   uuid.New(),
+			taken:      true,
+			wantStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			joined, notified, deleted := false, false, false
+			cfg := &apiConfig{
+				tokenKeys: testKeys,
+				gs:        newGameServer(),
+				db: newStubDB(t, map[string]stubQuery{
+					"IsActivePlayer": activePlayer,
+					"GetGameById": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						return [][]driver.Value{tt.game}, nil
+					},
+					"IsBlockedFromGame": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						if args[0].Value != gameId.String() || args[1].Value != tt.playerId.String() {
+							t.Errorf("Checked whether %v is blocked from %v", args[1].Value, args[0].Value)
+						}
+						return [][]driver.Value{{tt.blocked}}, nil
+					},
+					"CreateBoard": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						return [][]driver.Value{boardRow(uuid.New(), tt.playerId)}, nil
+					},
+					"JoinGame": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						if tt.taken {
+							return rowsAffected(0), nil
+						}
+						joined = true
+						return rowsAffected(1), nil
+					},
+					"DeleteBoard": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						deleted = true
+						return nil, nil
+					},
+					"LinkGame":      execOK,
+					"SetPlayerTurn": execOK,
+					"GetBoardById": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						return [][]driver.Value{boardRow(hostBoard, hostId)}, nil
+					},
+					"GetPlayerByPlayerId": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						id, _ := uuid.Parse(args[0].Value.(string))
+						return [][]driver.Value{playerRow(id, nil, "player@example.com")}, nil
+					},
+					"CreateNotification": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						notified = args[0].Value == hostId.String() && args[1].Value == notificationOpponentJoined
+						return [][]driver.Value{notificationRow(args)}, nil
+					},
+					"EnqueueWebhookDeliveries": execOK,
+					// the host isn't a bot
+					"SetBotRoll": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						return nil, nil
+					},
+				}),
+			}
+			cfg.gs.backend = newMemoryBackend(cfg.gs.deliver)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/games/"+gameId.String()+"/join?code="+tt.code, nil)
+			req.SetPathValue("game_id", gameId.String())
+			req.Header.Set("Authorization", "Bearer "+makeToken(t, tt.playerId))
+			w := httptest.NewRecorder()
+			cfg.handlerJoinGame(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Got status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if joined != (tt.wantStatus == http.StatusCreated) {
+				t.Errorf("Joined the game: %v", joined)
+			}
+			if notified != joined {
+				t.Errorf("Told the host someone joined: %v", notified)
+			}
+			if deleted != tt.taken {
+				t.Errorf("Deleted the new board: %v", deleted)
+			}
+		})
+	}
+}
+
+func TestNewPrivateGameNotifiesInvitee(t *testing.T) {
+	hostId := uuid.New()
+	invitedId := uuid.New()
+	watchedGame := uuid.New()
+	var emailedTo driver.Value
+
+	srv, cfg := newTestServer(t, map[uuid.UUID][]uuid.UUID{watchedGame: {invitedId}})
+	cfg.db = newStubDB(t, map[string]stubQuery{
+		"IsActivePlayer": activePlayer,
+		"GetPlayerByPlayerId": func(args []driver.NamedValue) ([][]driver.Value, error) {
+			if args[0].Value == hostId.String() {
+				return [][]driver.Value{playerRow(hostId, nil, "host@example.com")}, nil
+			}
+			return [][]driver.Value{playerRow(invitedId, nil, "invited@example.com")}, nil
+		},
+		"IsBlockedBetween": func(args []driver.NamedValue) ([][]driver.Value, error) {
+			return [][]driver.Value{{false}}, nil
+		},
+		"CreateBoard": func(args []driver.NamedValue) ([][]driver.Value, error) {
+			return [][]driver.Value{boardRow(uuid.New(), hostId)}, nil
+		},
+		"CreatePrivateGame": func(args []driver.NamedValue) ([][]driver.Value, error) {
+			if args[1].Value != invitedId.String() || args[2].Value != nil {
+				t.Errorf("Created a game inviting %v with code %v", args[1].Value, args[2].Value)
+			}
+			return [][]driver.Value{gameRow(uuid.New(), uuid.New(), true, args[1].Value, nil)}, nil
+		},
+		"LinkGame": execOK,
+		"CreateNotification": func(args []driver.NamedValue) ([][]driver.Value, error) {
+			if args[0].Value != invitedId.String() || args[1].Value != notificationInvite {
+				t.Errorf("Stored a %v notification for %v", args[1].Value, args[0].Value)
+			}
+			return [][]driver.Value{notificationRow(args)}, nil
+		},
+		"EnqueueEmail": func(args []driver.NamedValue) ([][]driver.Value, error) {
+			emailedTo = args[0].Value
+			now := time.Now()
+			return [][]driver.Value{{uuid.NewString(), args[0].Value, args[1].Value, args[2].Value, args[3].Value, 0, now, nil, now, nil, nil}}, nil
+		},
+		"EnqueueWebhookDeliveries": func(args []driver.NamedValue) ([][]driver.Value, error) {
+			if !strings.Contains(args[2].Value.(string), invitedId.String()) {
+				t.Errorf("Published the game to the webhooks of %v, want the invitee's too", args[2].Value)
+			}
+			return nil, nil
+		},
+	})
+
+	conn := dialGame(t, srv, watchedGame, makeToken(t, invitedId))
+	waitForConnections(t, cfg.gs, watchedGame, 1)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/games/private", strings.NewReader(`{"player_id":"`+invitedId.String()+`"}`))
+	req.Header.Set("Authorization", "Bearer "+makeToken(t, hostId))
+	w := httptest.NewRecorder()
+	cfg.handlerNewPrivateGame(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Got status %d: %s", w.Code, w.Body.String())
+	}
+	var game PrivateGame
+	if err := json.NewDecoder(w.Body).Decode(&game); err != nil {
+		t.Fatal(err)
+	}
+	if game.InviteCode != "" || game.InvitedPlayer == nil || game.InvitedPlayer.Id != invitedId {
+		t.Errorf("Got invite code %q for player %+v, want only the player", game.InviteCode, game.InvitedPlayer)
+	}
+	if emailedTo != "invited@example.com" {
+		t.Errorf("Emailed the invite to %v", emailedTo)
+	}
+
+	msg := readMessages(t, conn, 1)[0]
+	if msg.Type != notificationInvite || msg.GameId != game.Id || msg.PlayerId != hostId || msg.Seq != 0 || msg.NotificationId == uuid.Nil {
+		t.Errorf("Got %+v, want an invite to %s from %s", msg, game.Id, hostId)
+	}
+}
+
+func TestNewPrivateGameWithInviteCode(t *testing.T) {
+	hostId := uuid.New()
+	var storedHash driver.Value
+
+	cfg := &apiConfig{
+		tokenKeys: testKeys,
+		gs:        newGameServer(),
+		db: newStubDB(t, map[string]stubQuery{
+			"GetPlayerByPlayerId": func(args []driver.NamedValue) ([][]driver.Value, error) {
+				return [][]driver.Value{playerRow(hostId, nil, "host@example.com")}, nil
+			},
+			"CreateBoard": func(args []driver.NamedValue) ([][]driver.Value, error) {
+				return [][]driver.Value{boardRow(uuid.New(), hostId)}, nil
+			},
+			"CreatePrivateGame": func(args []driver.NamedValue) ([][]driver.Value, error) {
+				storedHash = args[2].Value
+				return [][]driver.Value{gameRow(uuid.New(), uuid.New(), true, nil, args[2].Value)}, nil
+			},
+			"LinkGame":                 execOK,
+			"EnqueueWebhookDeliveries": execOK,
+		}),
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/games/private", nil)
+	req.Header.Set("Authorization", "Bearer "+makeToken(t, hostId))
+	w := httptest.NewRecorder()
+	cfg.handlerNewPrivateGame(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Got status %d: %s", w.Code, w.Body.String())
+	}
+	var game PrivateGame
+	if err := json.NewDecoder(w.Body).Decode(&game); err != nil {
+		t.Fatal(err)
+	}
+	if game.InviteCode == "" || storedHash != verification.HashToken(game.InviteCode) {
+		t.Errorf("Stored %v for invite code %q, want its hash", storedHash, game.InviteCode)
+	}
+}
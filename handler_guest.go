@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/AradD7/Go-Knuclebones/internal/auth"
+	"github.com/AradD7/Go-Knuclebones/internal/database"
+	"github.com/AradD7/Go-Knuclebones/internal/emails"
+	"github.com/AradD7/Go-Knuclebones/internal/verification"
+)
+
+const guestUpgradeRequired = "Guest accounts need to be upgraded first"
+
+// generated names can collide, this many tries makes that vanishingly rare
+const guestNameAttempts = 5
+
+func guestUsername() string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return "guest-" + hex.EncodeToString(suffix)
+}
+
+// handlerNewGuest creates a player without an email or password, so a game
+// can be shared with someone who doesn't have an account yet
+func (cfg *apiConfig) handlerNewGuest(w http.ResponseWriter, r *http.Request) {
+	var player database.Player
+	var err error
+	for range guestNameAttempts {
+		player, err = cfg.db.CreateGuestPlayer(r.Context(), database.CreateGuestPlayerParams{
+			Username: guestUsername(),
+			Locale:   requestLocale(r),
+		})
+		if err == nil || !strings.Contains(err.Error(), "username") {
+			break
+		}
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create guest player", err)
+		return
+	}
+
+	cfg.respondWithSession(w, r, player)
+}
+
+// handlerUpgradeGuest turns a guest into a full account with an email and
+// password. The player keeps their id, so their games stay theirs.
+func (cfg *apiConfig) handlerUpgradeGuest(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Username string `json:"username"`
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return
+	}
+
+	var params parameters
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request", err)
+		return
+	}
+
+	if !player.IsGuest {
+		respondWithError(w, http.StatusConflict, "Player is not a guest", nil)
+		return
+	}
+
+	if params.Email == "" || params.Password == "" {
+		respondWithError(w, http.StatusBadRequest, "Email and password are required", nil)
+		return
+	}
+
+	username := params.Username
+	if username == "" {
+		username = player.Username
+	}
+
+	hashPassword, err := auth.HashPassword(params.Password)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to hash the password", err)
+		return
+	}
+
+	upgraded, err := cfg.db.UpgradeGuestPlayer(r.Context(), database.UpgradeGuestPlayerParams{
+		ID:       player.ID,
+		Username: username,
+		Email: sql.NullString{
+			Valid:  true,
+			String: params.Email,
+		},
+		HashedPassword: sql.NullString{
+			Valid:  true,
+			String: hashPassword,
+		},
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusConflict, "Player is not a guest", err)
+			return
+		}
+		if strings.Contains(err.Error(), "email") {
+			respondWithError(w, http.StatusBadRequest, "Account with that email already exists", err)
+			return
+		}
+		if strings.Contains(err.Error(), "username") {
+			respondWithError(w, http.StatusBadRequest, "Account with that username already exists", err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to upgrade the guest", err)
+		return
+	}
+
+	token, hash := verification.GenerateVerificationToken()
+	_, err = cfg.db.CreateVerificationToken(r.Context(), database.CreateVerificationTokenParams{
+		TokenHash:        hash,
+		PlayerID:         upgraded.ID,
+		ExpiresInMinutes: int32(verification.EmailVerificationTTL.Minutes()),
+		Purpose:          verification.PurposeEmailVerification,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to generate verification token", err)
+		return
+	}
+
+	if err = cfg.queueEmail(r.Context(), emails.Verification, params.Email, upgraded.Locale, emails.Data{
+		Link:      verification.Link(verification.PurposeEmailVerification, token),
+		ExpiresIn: verification.EmailVerificationTTL,
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to send email", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, playerProfile(upgraded))
+}
+
+// playerProfile is the player without any tokens
+func playerProfile(player database.Player) Player {
+	return Player{
+		Id:            player.ID,
+		CreatedAt:     player.CreatedAt,
+		Username:      player.Username,
+		Avatar:        player.Avatar.String,
+		DisplayName:   player.DisplayName.String,
+		Email:         player.Email.String,
+		EmailVerified: player.EmailVerified.Bool,
+		IsGuest:       player.IsGuest,
+		Locale:        player.Locale,
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// guestRow is a players row of a guest, in the column order of the
+// generated Scan calls
+func guestRow(id uuid.UUID, username string) []driver.Value {
+	now := time.Now()
+	return []driver.Value{id.String(), now, now, username, nil, nil, "Guest", nil, false, nil, true, "en", false}
+}
+
+func TestNewGuest(t *testing.T) {
+	cfg := &apiConfig{
+		tokenKeys: testKeys,
+		db: newStubDB(t, map[string]stubQuery{
+			"CreateGuestPlayer": func(args []driver.NamedValue) ([][]driver.Value, error) {
+				row := guestRow(uuid.New(), args[0].Value.(string))
+				row[11] = args[1].Value
+				return [][]driver.Value{row}, nil
+			},
+			"CreateSession":      createSessionStub,
+			"CreateRefreshToken": createRefreshTokenStub,
+		}),
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/api/players/guest", nil)
+	r.Header.Set("Accept-Language", "es-MX,es;q=0.9,en;q=0.8")
+	cfg.handlerNewGuest(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Got status %d: %s", w.Code, w.Body.String())
+	}
+
+	var guest Player
+	if err := json.NewDecoder(w.Body).Decode(&guest); err != nil {
+		t.Fatal(err)
+	}
+	if !guest.IsGuest || !strings.HasPrefix(guest.Username, "guest-") {
+		t.Errorf("Got %+v, want a guest with a generated name", guest)
+	}
+	if guest.Token == "" || guest.RefreshToken == "" {
+		t.Errorf("Guest got no tokens: %+v", guest)
+	}
+	if guest.Locale != "es" {
+		t.Errorf("Got locale %q, want the one the browser prefers", guest.Locale)
+	}
+}
+
+func TestUpgradeGuest(t *testing.T) {
+	tests := []struct {
+		name       string
+		isGuest    bool
+		body       string
+		wantStatus int
+	}{
+		{
+			name:       "Guest with email and password",
+			isGuest:    true,
+			body:       `{"username": "knuckles", "email": "new@example.com", "password": "pa55word"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Guest without a password",
+			isGuest:    true,
+			body:       `{"email": "new@example.com"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Player who is not a guest",
+			isGuest:    false,
+			body:       `{"email": "new@example.com", "password": "pa55word"}`,
+			wantStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			playerId := uuid.New()
+			upgraded := false
+			var queued []driver.Value
+
+			cfg := &apiConfig{
+				tokenKeys: testKeys,
+				db: newStubDB(t, map[string]stubQuery{
+					"GetPlayerByPlayerId": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						if tt.isGuest {
+							return [][]driver.Value{guestRow(playerId, "guest-0a1b2c3d")}, nil
+						}
+						return [][]driver.Value{playerRow(playerId, "hash", "player@example.com")}, nil
+					},
+					"UpgradeGuestPlayer": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						upgraded = true
+						// the same id, so the guest's games carry over
+						if args[0].Value != playerId.String() {
+							t.Errorf("Upgraded player %v, want %v", args[0].Value, playerId)
+						}
+						now := time.Now()
+						return [][]driver.Value{{playerId.String(), now, now, args[1].Value, nil, args[3].Value, "Guest", args[2].Value, false, nil, false, "en", false}}, nil
+					},
+					"CreateVerificationToken": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						now := time.Now()
+						return [][]driver.Value{{args[0].Value, args[1].Value, now.Add(time.Hour), now, args[3].Value, nil}}, nil
+					},
+					"EnqueueEmail": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						now := time.Now()
+						queued = []driver.Value{uuid.NewString(), args[0].Value, args[1].Value, args[2].Value, args[3].Value, 0, now, nil, now, nil, nil}
+						return [][]driver.Value{queued}, nil
+					},
+				}),
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/players/guest/upgrade", strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+makeToken(t, playerId))
+			w := httptest.NewRecorder()
+			cfg.handlerUpgradeGuest(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Got status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if upgraded != (tt.wantStatus == http.StatusOK) {
+				t.Errorf("Upgraded = %v with status %d", upgraded, w.Code)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var player Player
+			if err := json.NewDecoder(w.Body).Decode(&player); err != nil {
+				t.Fatal(err)
+			}
+			if player.IsGuest || player.Username != "knuckles" || player.EmailVerified {
+				t.Errorf("Got %+v, want an unverified full account", player)
+			}
+
+			if queued == nil || queued[1] != "new@example.com" || !strings.Contains(queued[4].(string), "/verify?token=") {
+				t.Errorf("Queued email %v, want a verification link to the new email", queued)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/database"
+)
+
+type Identity struct {
+	Provider  string    `json:"provider"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (cfg *apiConfig) handlerGetIdentities(w http.ResponseWriter, r *http.Request) {
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return
+	}
+
+	identities, err := cfg.db.GetOAuthIdentitiesByPlayerId(r.Context(), player.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get linked accounts", err)
+		return
+	}
+
+	linked := []Identity{}
+	for _, identity := range identities {
+		linked = append(linked, Identity{
+			Provider:  identity.Provider,
+			Email:     identity.Email.String,
+			CreatedAt: identity.CreatedAt,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, linked)
+}
+
+// handlerLinkIdentity lets the player login with another provider too
+func (cfg *apiConfig) handlerLinkIdentity(w http.ResponseWriter, r *http.Request) {
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return
+	}
+	if player.IsGuest {
+		respondWithError(w, http.StatusForbidden, guestUpgradeRequired, nil)
+		return
+	}
+
+	provider := r.PathValue("provider")
+	claims, ok := cfg.verifyIdToken(w, r, provider)
+	if !ok {
+		return
+	}
+
+	if _, err := cfg.db.GetPlayerByOAuthIdentity(r.Context(), database.GetPlayerByOAuthIdentityParams{
+		Provider: provider,
+		Subject:  claims.Subject,
+	}); err == nil {
+		respondWithError(w, http.StatusConflict, "That account is already linked to a player", nil)
+		return
+	}
+
+	identity, err := cfg.db.CreateOAuthIdentity(r.Context(), database.CreateOAuthIdentityParams{
+		PlayerID: player.ID,
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email: sql.NullString{
+			Valid:  claims.Email != "",
+			String: claims.Email,
+		},
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "player_id") {
+			respondWithError(w, http.StatusConflict, "A "+provider+" account is already linked, unlink it first", err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to link account", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, Identity{
+		Provider:  identity.Provider,
+		Email:     identity.Email.String,
+		CreatedAt: identity.CreatedAt,
+	})
+}
+
+func (cfg *apiConfig) handlerUnlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return
+	}
+
+	identities, err := cfg.db.GetOAuthIdentitiesByPlayerId(r.Context(), player.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get linked accounts", err)
+		return
+	}
+
+	// the player would have no way left to login
+	if !player.HashedPassword.Valid && len(identities) <= 1 {
+		respondWithError(w, http.StatusConflict, "Set a password or link another account before unlinking the last one", nil)
+		return
+	}
+
+	removed, err := cfg.db.DeleteOAuthIdentity(r.Context(), database.DeleteOAuthIdentityParams{
+		PlayerID: player.ID,
+		Provider: r.PathValue("provider"),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to unlink account", err)
+		return
+	}
+	if removed == 0 {
+		respondWithError(w, http.StatusNotFound, "No account of that provider is linked", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerUpgradeGuestOIDC links a guest to an account of the provider,
+// which then logs in to the same player
+func (cfg *apiConfig) handlerUpgradeGuestOIDC(w http.ResponseWriter, r *http.Request) {
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return
+	}
+	if !player.IsGuest {
+		respondWithError(w, http.StatusConflict, "Player is not a guest", nil)
+		return
+	}
+
+	provider := r.PathValue("provider")
+	claims, ok := cfg.verifyIdToken(w, r, provider)
+	if !ok {
+		return
+	}
+
+	if _, err := cfg.db.GetPlayerByOAuthIdentity(r.Context(), database.GetPlayerByOAuthIdentityParams{
+		Provider: provider,
+		Subject:  claims.Subject,
+	}); err == nil {
+		respondWithError(w, http.StatusConflict, "That account already has a player, sign in with it instead", nil)
+		return
+	}
+
+	email := sql.NullString{
+		Valid:  claims.Email != "",
+		String: claims.Email,
+	}
+
+	// linked first, a guest upgraded without it couldn't login again
+	if _, err := cfg.db.CreateOAuthIdentity(r.Context(), database.CreateOAuthIdentityParams{
+		PlayerID: player.ID,
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    email,
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to upgrade the guest", err)
+		return
+	}
+
+	upgraded, err := cfg.db.UpgradeGuestWithOAuth(r.Context(), database.UpgradeGuestWithOAuthParams{
+		ID:    player.ID,
+		Email: email,
+		EmailVerified: sql.NullBool{
+			Valid: true,
+			Bool:  claims.Email != "",
+		},
+		DisplayName: sql.NullString{
+			Valid:  claims.Name != "",
+			String: claims.Name,
+		},
+	})
+	if err != nil {
+		cfg.db.DeleteOAuthIdentity(r.Context(), database.DeleteOAuthIdentityParams{
+			PlayerID: player.ID,
+			Provider: provider,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusConflict, "Player is not a guest", err)
+			return
+		}
+		if strings.Contains(err.Error(), "email") {
+			respondWithError(w, http.StatusConflict, "Account with that email already exists", err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to upgrade the guest", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, playerProfile(upgraded))
+}
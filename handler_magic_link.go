@@ -0,0 +1,144 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/database"
+	"github.com/AradD7/Go-Knuclebones/internal/emails"
+	"github.com/AradD7/Go-Knuclebones/internal/verification"
+)
+
+const magicLinkSentMessage = "If an account with that email exists, a login link has been sent"
+
+// a new link can be requested this long after the last one
+const magicLinkResendWait = time.Minute
+
+func (cfg *apiConfig) handlerRequestMagicLink(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email string `json:"email"`
+	}
+
+	var params parameters
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request", err)
+		return
+	}
+
+	if params.Email == "" {
+		respondWithError(w, http.StatusBadRequest, "Email is required", nil)
+		return
+	}
+
+	// same as the password reset, the response doesn't tell whether the
+	// account exists
+	sent := map[string]string{
+		"message": magicLinkSentMessage,
+	}
+
+	player, err := cfg.db.GetPlayerByEmail(r.Context(), sql.NullString{
+		Valid:  true,
+		String: params.Email,
+	})
+	if err != nil || player.DeletedAt.Valid {
+		respondWithJSON(w, http.StatusOK, sent)
+		return
+	}
+
+	existing, _ := cfg.db.GetVerificationTokenByPlayerId(r.Context(), database.GetVerificationTokenByPlayerIdParams{
+		PlayerID: player.ID,
+		Purpose:  verification.PurposeMagicLink,
+	})
+	// nothing is sent so soon after the last link, without saying so
+	if existing.TokenHash != "" && time.Now().UTC().Sub(existing.CreatedAt) < magicLinkResendWait {
+		respondWithJSON(w, http.StatusOK, sent)
+		return
+	}
+
+	// only the latest link works
+	if err = cfg.db.DeleteVerificationTokensForPlayer(r.Context(), database.DeleteVerificationTokensForPlayerParams{
+		PlayerID: player.ID,
+		Purpose:  verification.PurposeMagicLink,
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to generate login link", err)
+		return
+	}
+
+	token, hash := verification.GenerateVerificationToken()
+	if _, err = cfg.db.CreateVerificationToken(r.Context(), database.CreateVerificationTokenParams{
+		TokenHash:        hash,
+		PlayerID:         player.ID,
+		ExpiresInMinutes: int32(verification.MagicLinkTTL.Minutes()),
+		Purpose:          verification.PurposeMagicLink,
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to generate login link", err)
+		return
+	}
+
+	if err = cfg.queueEmail(r.Context(), emails.MagicLink, player.Email.String, player.Locale, emails.Data{
+		Link:      verification.Link(verification.PurposeMagicLink, token),
+		ExpiresIn: verification.MagicLinkTTL,
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to send email", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, sent)
+}
+
+// handlerVerifyMagicLink logs in the player the link was sent to, like a
+// login with a password would
+func (cfg *apiConfig) handlerVerifyMagicLink(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token string `json:"token"`
+	}
+
+	var params parameters
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request", err)
+		return
+	}
+
+	tokenHash := verification.HashToken(params.Token)
+	loginToken, err := cfg.db.GetVerificationToken(r.Context(), database.GetVerificationTokenParams{
+		TokenHash: tokenHash,
+		Purpose:   verification.PurposeMagicLink,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid token", err)
+		return
+	}
+
+	// single use, whatever happens next
+	cfg.db.DeleteVerificationToken(r.Context(), tokenHash)
+
+	if !loginToken.ExpiresAt.After(time.Now().UTC()) {
+		respondWithError(w, http.StatusBadRequest, "Token expired", nil)
+		return
+	}
+
+	player, err := cfg.db.GetPlayerByPlayerId(r.Context(), loginToken.PlayerID)
+	if err != nil || player.DeletedAt.Valid {
+		respondWithError(w, http.StatusBadRequest, "Invalid token", err)
+		return
+	}
+
+	// following the link proved they own the email
+	if !player.EmailVerified.Bool {
+		if err = cfg.db.VerifyPlayerEmail(r.Context(), player.ID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to verify email", err)
+			return
+		}
+		player.EmailVerified = sql.NullBool{Valid: true, Bool: true}
+	}
+
+	if cfg.challengeSecondFactor(w, r, player.ID) {
+		return
+	}
+
+	cfg.respondWithSession(w, r, player)
+}
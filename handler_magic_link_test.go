@@ -0,0 +1,138 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/verification"
+	"github.com/google/uuid"
+)
+
+func TestVerifyMagicLink(t *testing.T) {
+	tests := []struct {
+		name       string
+		expiresIn  time.Duration
+		purpose    string
+		wantStatus int
+	}{
+		{
+			name:       "Valid link",
+			expiresIn:  verification.MagicLinkTTL,
+			purpose:    verification.PurposeMagicLink,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Expired link",
+			expiresIn:  -time.Minute,
+			purpose:    verification.PurposeMagicLink,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Password reset token",
+			expiresIn:  verification.PasswordResetTTL,
+			purpose:    verification.PurposePasswordReset,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			playerId := uuid.New()
+			token, hash := verification.GenerateVerificationToken()
+			deleted := false
+
+			cfg := &apiConfig{
+				tokenKeys: testKeys,
+				db: newStubDB(t, map[string]stubQuery{
+					"GetVerificationToken": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						if args[0].Value != hash || args[1].Value != tt.purpose {
+							return nil, nil
+						}
+						now := time.Now().UTC()
+						return [][]driver.Value{{hash, playerId.String(), now.Add(tt.expiresIn), now, tt.purpose, nil}}, nil
+					},
+					"DeleteVerificationToken": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						deleted = true
+						return nil, nil
+					},
+					"GetPlayerByPlayerId": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						return [][]driver.Value{playerRow(playerId, nil, "player@example.com")}, nil
+					},
+					"GetPlayerTOTP":      func(args []driver.NamedValue) ([][]driver.Value, error) { return nil, nil },
+					"CreateSession":      createSessionStub,
+					"CreateRefreshToken": createRefreshTokenStub,
+				}),
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/auth/magic-link/verify", strings.NewReader(`{"token": "`+token+`"}`))
+			w := httptest.NewRecorder()
+			cfg.handlerVerifyMagicLink(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Got status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.purpose == verification.PurposeMagicLink && !deleted {
+				t.Errorf("The link was not used up")
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var player Player
+			if err := json.NewDecoder(w.Body).Decode(&player); err != nil {
+				t.Fatal(err)
+			}
+			if player.Id != playerId || player.Token == "" || player.RefreshToken == "" {
+				t.Errorf("Got %+v, want the player with tokens", player)
+			}
+		})
+	}
+}
+
+func TestRequestMagicLinkUnknownEmail(t *testing.T) {
+	cfg := &apiConfig{
+		db: newStubDB(t, map[string]stubQuery{
+			"GetPlayerByEmail": func(args []driver.NamedValue) ([][]driver.Value, error) { return nil, nil },
+		}),
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/magic-link", strings.NewReader(`{"email": "nobody@example.com"}`))
+	w := httptest.NewRecorder()
+	cfg.handlerRequestMagicLink(w, req)
+
+	// answered like a known email so accounts can't be discovered
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), magicLinkSentMessage) {
+		t.Errorf("Got %d %s, want the sent message", w.Code, w.Body.String())
+	}
+}
+
+func TestRequestMagicLinkTooSoon(t *testing.T) {
+	playerId := uuid.New()
+	sentAt := time.Now().UTC().Add(-10 * time.Second)
+
+	// nothing is queued, any other query fails the test
+	cfg := &apiConfig{
+		db: newStubDB(t, map[string]stubQuery{
+			"GetPlayerByEmail": func(args []driver.NamedValue) ([][]driver.Value, error) {
+				return [][]driver.Value{playerRow(playerId, nil, "player@example.com")}, nil
+			},
+			"GetVerificationTokenByPlayerId": func(args []driver.NamedValue) ([][]driver.Value, error) {
+				return [][]driver.Value{{"hash", playerId.String(), sentAt.Add(verification.MagicLinkTTL), sentAt, verification.PurposeMagicLink, nil}}, nil
+			},
+		}),
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/magic-link", strings.NewReader(`{"email": "player@example.com"}`))
+	w := httptest.NewRecorder()
+	cfg.handlerRequestMagicLink(w, req)
+
+	// answered like an unknown email
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), magicLinkSentMessage) {
+		t.Errorf("Got %d %s, want the sent message", w.Code, w.Body.String())
+	}
+}
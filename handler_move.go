@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/AradD7/Go-Knuclebones/internal/auth"
 	"github.com/AradD7/Go-Knuclebones/internal/database"
@@ -24,15 +25,8 @@ func (cfg *apiConfig) handlerMakeMove(w http.ResponseWriter, r *http.Request) {
 		Col  int `json:"col"`
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Not Authorized", err)
-		return
-	}
-
-	playerId, err := auth.ValidateJWT(token, cfg.tokenSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Token is exipred, refresh JWT token or login again", err)
+	playerId, ok := cfg.authorizeToken(w, r, auth.ScopeGamesPlay)
+	if !ok {
 		return
 	}
 
@@ -61,6 +55,33 @@ func (cfg *apiConfig) handlerMakeMove(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// a game that was won, by a full board or a forfeit, takes no more moves
+	if currentGame.Winner.Valid {
+		respondWithError(w, http.StatusConflict, "The game is over", nil)
+		return
+	}
+
+	if deadline := turnDeadline(currentGame); !deadline.IsZero() && time.Now().After(deadline) {
+		respondWithError(w, http.StatusConflict, "The time for this move ran out", nil)
+		return
+	}
+
+	if currentGame.PlayerTurn.UUID != playerId {
+		respondWithError(w, http.StatusConflict, "It's not your turn", nil)
+		return
+	}
+
+	// every turn is played with the die rolled for it, bots wait for the
+	// server to roll for them
+	if !currentGame.LastRoll.Valid {
+		respondWithError(w, http.StatusConflict, "The die hasn't been rolled yet", nil)
+		return
+	}
+	if move.Dice != int(currentGame.LastRoll.Int32) {
+		respondWithError(w, http.StatusConflict, "That isn't the die that was rolled", nil)
+		return
+	}
+
 	oppBoardId := currentGame.Board1
 	if oppBoardId == playerBoard.ID {
 		oppBoardId = currentGame.Board2.UUID
@@ -91,9 +112,11 @@ func (cfg *apiConfig) handlerMakeMove(w http.ResponseWriter, r *http.Request) {
 	updatedOppBoard := updateOpp(oppBoardData, move.Dice, move.Col)
 
 	isGameOver := false
+	winnerId, loserId := oppBoard.PlayerID, playerBoard.PlayerID
 	if isFull(updatedPlayerBoard) {
 		isGameOver = true
 		if calcScore(updatedPlayerBoard) > calcScore(updatedOppBoard) {
+			winnerId, loserId = loserId, winnerId
 			cfg.db.SetGameWinner(r.Context(), database.SetGameWinnerParams{
 				ID: currentGame.ID,
 				Winner: uuid.NullUUID{
@@ -157,8 +180,46 @@ func (cfg *apiConfig) handlerMakeMove(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err = cfg.db.SetLastRoll(r.Context(), database.SetLastRollParams{
+		ID:       currentGame.ID,
+		LastRoll: sql.NullInt32{Valid: false},
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "failed to clear the roll", err)
+		return
+	}
+
+	cfg.gs.playerActive(currentGame.ID, playerId)
 	cfg.gs.broadcastToGame(currentGame.ID)
 
+	// the opponent hears about it even when they don't have the game open
+	player, err := cfg.db.GetPlayerByPlayerId(r.Context(), playerId)
+	if err == nil {
+		kind := notificationYourTurn
+		if isGameOver {
+			kind = notificationGameOver
+		}
+		cfg.notify(r.Context(), oppBoard.PlayerID, kind, currentGame.ID, player)
+	}
+
+	cfg.publishWebhook(r.Context(), webhookMoveMade, WebhookMoveMade{
+		GameId:     currentGame.ID,
+		PlayerId:   playerId,
+		Dice:       move.Dice,
+		Row:        move.Row,
+		Col:        move.Col,
+		PlayerTurn: oppBoard.PlayerID,
+	}, playerId, oppBoard.PlayerID)
+	if isGameOver {
+		cfg.publishWebhook(r.Context(), webhookGameFinished, WebhookGameFinished{
+			GameId:   currentGame.ID,
+			WinnerId: winnerId,
+			LoserId:  loserId,
+			Reason:   "board_full",
+		}, winnerId, loserId)
+	} else {
+		cfg.rollForBot(r.Context(), currentGame.ID)
+	}
+
 	respondWithJSON(w, http.StatusOK, GameState{
 		Board1: updatedPlayerBoard,
 		Board2: updatedOppBoard,
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/database"
+	"github.com/google/uuid"
+)
+
+// Types of the notifications in a player's inbox, each is also the type of
+// the event pushed to the player when it's created
+const (
+	notificationYourTurn       = "your_turn"
+	notificationInvite         = "invite"
+	notificationOpponentJoined = "opponent_joined"
+	notificationGameOver       = "game_over"
+)
+
+const (
+	defaultNotificationsLimit = 50
+	maxNotificationsLimit     = 200
+)
+
+type Notification struct {
+	Id     uuid.UUID `json:"id"`
+	Type   string    `json:"type"`
+	GameId uuid.UUID `json:"game_id,omitzero"`
+	// the other player, left out when the notification isn't about one
+	From      *PlayerSummary `json:"from,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+	Read      bool           `json:"read"`
+}
+
+type Inbox struct {
+	UnreadCount   int64          `json:"unread_count"`
+	Notifications []Notification `json:"notifications"`
+}
+
+// notify stores a notification in the player's inbox and pushes it to every
+// connection they have open. What it is about already happened, so failures
+// are only logged.
+func (cfg *apiConfig) notify(ctx context.Context, playerId uuid.UUID, kind string, gameId uuid.UUID, from database.Player) {
+	notification, err := cfg.db.CreateNotification(ctx, database.CreateNotificationParams{
+		PlayerID: playerId,
+		Type:     kind,
+		GameID:   uuid.NullUUID{UUID: gameId, Valid: gameId != uuid.Nil},
+		ActorID:  uuid.NullUUID{UUID: from.ID, Valid: from.ID != uuid.Nil},
+	})
+	if err != nil {
+		log.Printf("Failed to store the %s notification for %s: %v", kind, playerId, err)
+		return
+	}
+
+	name := from.Username
+	if from.DisplayName.Valid {
+		name = from.DisplayName.String
+	}
+	cfg.gs.notifyPlayer(playerId, PlayerMessage{
+		Type:           kind,
+		GameId:         gameId,
+		PlayerId:       from.ID,
+		DisplayName:    name,
+		Avatar:         from.Avatar.String,
+		NotificationId: notification.ID,
+	})
+}
+
+// handlerGetNotifications returns the player's latest notifications, newest
+// first, and how many of all of them are unread
+func (cfg *apiConfig) handlerGetNotifications(w http.ResponseWriter, r *http.Request) {
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return
+	}
+
+	limit, err := queryLimit(r, defaultNotificationsLimit, maxNotificationsLimit)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	rows, err := cfg.db.GetNotifications(r.Context(), database.GetNotificationsParams{
+		PlayerID: player.ID,
+		Limit:    int32(limit),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get notifications", err)
+		return
+	}
+
+	unread, err := cfg.db.CountUnreadNotifications(r.Context(), player.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to count unread notifications", err)
+		return
+	}
+
+	inbox := Inbox{UnreadCount: unread, Notifications: []Notification{}}
+	for _, row := range rows {
+		notification := Notification{
+			Id:        row.ID,
+			Type:      row.Type,
+			GameId:    row.GameID.UUID,
+			CreatedAt: row.CreatedAt,
+			Read:      row.ReadAt.Valid,
+		}
+		if row.ActorID.Valid {
+			notification.From = &PlayerSummary{
+				Id:          row.ActorID.UUID,
+				Username:    row.Username.String,
+				DisplayName: row.DisplayName.String,
+				Avatar:      row.Avatar.String,
+			}
+		}
+		inbox.Notifications = append(inbox.Notifications, notification)
+	}
+
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	respondWithJSON(w, http.StatusOK, inbox)
+}
+
+func (cfg *apiConfig) handlerReadNotification(w http.ResponseWriter, r *http.Request) {
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return
+	}
+
+	notificationId, err := uuid.Parse(r.PathValue("notification_id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid notification id", err)
+		return
+	}
+
+	read, err := cfg.db.MarkNotificationRead(r.Context(), database.MarkNotificationReadParams{
+		ID:       notificationId,
+		PlayerID: player.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to mark the notification read", err)
+		return
+	}
+	if read == 0 {
+		respondWithError(w, http.StatusNotFound, "Notification not found", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerReadAllNotifications(w http.ResponseWriter, r *http.Request) {
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return
+	}
+
+	if err := cfg.db.MarkAllNotificationsRead(r.Context(), player.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to mark the notifications read", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// NotificationPreferences are the notifications a player gets by email,
+// everything is on until they turn it off
+type NotificationPreferences struct {
+	TurnReminders bool `json:"turn_reminders"`
+}
+
+func (cfg *apiConfig) handlerGetNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return
+	}
+
+	prefs, err := cfg.db.GetNotificationPreferences(r.Context(), player.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithJSON(w, http.StatusOK, NotificationPreferences{TurnReminders: true})
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get notification preferences", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, NotificationPreferences{
+		TurnReminders: prefs.TurnReminders,
+	})
+}
+
+func (cfg *apiConfig) handlerUpdateNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return
+	}
+
+	type parameters struct {
+		TurnReminders *bool `json:"turn_reminders"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var params parameters
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Failed to decode the json data", err)
+		return
+	}
+	if params.TurnReminders == nil {
+		respondWithError(w, http.StatusBadRequest, "turn_reminders is required", nil)
+		return
+	}
+
+	prefs, err := cfg.db.UpsertNotificationPreferences(r.Context(), database.UpsertNotificationPreferencesParams{
+		PlayerID:      player.ID,
+		TurnReminders: *params.TurnReminders,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update notification preferences", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, NotificationPreferences{
+		TurnReminders: prefs.TurnReminders,
+	})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/database"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// notificationRow answers CreateNotification with the notification it was
+// asked to store
+func notificationRow(args []driver.NamedValue) []driver.Value {
+	return []driver.Value{uuid.NewString(), args[0].Value, args[1].Value, args[2].Value, args[3].Value, time.Now(), nil}
+}
+
+func TestPlayerWebSocketGetsNotifications(t *testing.T) {
+	playerId := uuid.New()
+	otherId := uuid.New()
+	gameId := uuid.New()
+
+	srv, cfg := newTestServer(t, nil)
+	cfg.db = newStubDB(t, map[string]stubQuery{
+		"IsActivePlayer": activePlayer,
+		"CreateNotification": func(args []driver.NamedValue) ([][]driver.Value, error) {
+			return [][]driver.Value{notificationRow(args)}, nil
+		},
+	})
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws/players/me"
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {srv.URL}})
+	if err != nil {
+		t.Fatalf("Failed to dial websocket: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if err = conn.WriteJSON(PlayerMessage{Type: "auth", Token: makeToken(t, playerId)}); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		cfg.gs.rwMux.RLock()
+		connected := len(cfg.gs.players[playerId]) == 1
+		cfg.gs.rwMux.RUnlock()
+		if connected {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("The player channel never connected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// a notification for someone else isn't delivered here
+	cfg.notify(t.Context(), otherId, notificationYourTurn, gameId, database.Player{ID: playerId, Username: "knuckles"})
+	cfg.notify(t.Context(), playerId, notificationYourTurn, gameId, database.Player{ID: otherId, Username: "bones"})
+
+	msg := readMessages(t, conn, 1)[0]
+	if msg.Type != notificationYourTurn || msg.GameId != gameId || msg.PlayerId != otherId || msg.DisplayName != "bones" || msg.NotificationId == uuid.Nil {
+		t.Errorf("Got %+v, want your turn in %s from %s", msg, gameId, otherId)
+	}
+	expectNoMessage(t, conn)
+}
+
+func TestGetNotifications(t *testing.T) {
+	playerId := uuid.New()
+	fromId := uuid.New()
+	gameId := uuid.New()
+
+	cfg := &apiConfig{
+		tokenKeys: testKeys,
+		db: newStubDB(t, map[string]stubQuery{
+			"GetPlayerByPlayerId": func(args []driver.NamedValue) ([][]driver.Value, error) {
+				return [][]driver.Value{playerRow(playerId, nil, "player@example.com")}, nil
+			},
+			"GetNotifications": func(args []driver.NamedValue) ([][]driver.Value, error) {
+				if args[1].Value != int64(defaultNotificationsLimit) {
+					t.Errorf("Got limit %v, want %d", args[1].Value, defaultNotificationsLimit)
+				}
+				now := time.Now()
+				return [][]driver.Value{
+					{uuid.NewString(), notificationYourTurn, gameId.String(), fromId.String(), "bones", nil, "002", now, nil},
+					{uuid.NewString(), notificationGameOver, gameId.String(), nil, nil, nil, nil, now, now},
+				}, nil
+			},
+			"CountUnreadNotifications": func(args []driver.NamedValue) ([][]driver.Value, error) {
+				return [][]driver.Value{{int64(1)}}, nil
+			},
+		}),
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/notifications", nil)
+	req.Header.Set("Authorization", "Bearer "+makeToken(t, playerId))
+	w := httptest.NewRecorder()
+	cfg.handlerGetNotifications(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Got status %d: %s", w.Code, w.Body.String())
+	}
+	var inbox Inbox
+	if err := json.NewDecoder(w.Body).Decode(&inbox); err != nil {
+		t.Fatal(err)
+	}
+	if inbox.UnreadCount != 1 || len(inbox.Notifications) != 2 {
+		t.Fatalf("Got %d unread of %d notifications, want 1 of 2", inbox.UnreadCount, len(inbox.Notifications))
+	}
+	first, second := inbox.Notifications[0], inbox.Notifications[1]
+	if first.Read || first.From == nil || first.From.Id != fromId || first.From.Username != "bones" {
+		t.Errorf("Got %+v, want an unread notification from bones", first)
+	}
+	if !second.Read || second.From != nil {
+		t.Errorf("Got %+v, want a read notification from nobody", second)
+	}
+}
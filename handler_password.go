@@ -0,0 +1,168 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/auth"
+	"github.com/AradD7/Go-Knuclebones/internal/database"
+	"github.com/AradD7/Go-Knuclebones/internal/emails"
+	"github.com/AradD7/Go-Knuclebones/internal/verification"
+)
+
+const passwordResetSentMessage = "If an account with that email or username exists, a password reset email has been sent"
+
+func (cfg *apiConfig) handlerForgotPassword(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email    string `json:"email"`
+		Username string `json:"username"`
+	}
+
+	var params parameters
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request", err)
+		return
+	}
+
+	// the response is the same whether or not the account exists, so this
+	// can't be used to find out who has an account
+	sent := map[string]string{
+		"message": passwordResetSentMessage,
+	}
+
+	player, err := cfg.db.GetPlayerByEmail(r.Context(), sql.NullString{
+		Valid:  true,
+		String: params.Email,
+	})
+	if err != nil {
+		player, err = cfg.db.GetPlayerByUsername(r.Context(), params.Username)
+		if err != nil {
+			respondWithJSON(w, http.StatusOK, sent)
+			return
+		}
+	}
+
+	if !player.Email.Valid {
+		respondWithJSON(w, http.StatusOK, sent)
+		return
+	}
+
+	existing, _ := cfg.db.GetVerificationTokenByPlayerId(r.Context(), database.GetVerificationTokenByPlayerIdParams{
+		PlayerID: player.ID,
+		Purpose:  verification.PurposePasswordReset,
+	})
+	// a link was sent a moment ago, nothing is sent but the response can't
+	// differ from an unknown account's
+	if existing.TokenHash != "" && time.Now().UTC().Sub(existing.CreatedAt) < 5*time.Minute {
+		respondWithJSON(w, http.StatusOK, sent)
+		return
+	}
+
+	// only the latest link works
+	if err = cfg.db.DeleteVerificationTokensForPlayer(r.Context(), database.DeleteVerificationTokensForPlayerParams{
+		PlayerID: player.ID,
+		Purpose:  verification.PurposePasswordReset,
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to generate reset token", err)
+		return
+	}
+
+	token, hash := verification.GenerateVerificationToken()
+	if _, err = cfg.db.CreateVerificationToken(r.Context(), database.CreateVerificationTokenParams{
+		TokenHash:        hash,
+		PlayerID:         player.ID,
+		ExpiresInMinutes: int32(verification.PasswordResetTTL.Minutes()),
+		Purpose:          verification.PurposePasswordReset,
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to generate reset token", err)
+		return
+	}
+
+	if err = cfg.queueEmail(r.Context(), emails.PasswordReset, player.Email.String, player.Locale, emails.Data{
+		Link:      verification.Link(verification.PurposePasswordReset, token),
+		ExpiresIn: verification.PasswordResetTTL,
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to send email", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, sent)
+}
+
+func (cfg *apiConfig) handlerResetPassword(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	var params parameters
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request", err)
+		return
+	}
+
+	if params.Password == "" {
+		respondWithError(w, http.StatusBadRequest, "Password cannot be empty", nil)
+		return
+	}
+
+	tokenHash := verification.HashToken(params.Token)
+	resetToken, err := cfg.db.GetVerificationToken(r.Context(), database.GetVerificationTokenParams{
+		TokenHash: tokenHash,
+		Purpose:   verification.PurposePasswordReset,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid token", err)
+		return
+	}
+
+	// single use, whatever happens next
+	cfg.db.DeleteVerificationToken(r.Context(), tokenHash)
+
+	if !resetToken.ExpiresAt.After(time.Now().UTC()) {
+		respondWithError(w, http.StatusBadRequest, "Token expired", nil)
+		return
+	}
+
+	hashPassword, err := auth.HashPassword(params.Password)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to hash the password", err)
+		return
+	}
+
+	if err = cfg.db.UpdatePlayerPassword(r.Context(), database.UpdatePlayerPasswordParams{
+		ID: resetToken.PlayerID,
+		HashedPassword: sql.NullString{
+			Valid:  true,
+			String: hashPassword,
+		},
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update password", err)
+		return
+	}
+
+	// whoever had the old password is logged out everywhere
+	if err = cfg.db.RevokeAllRefreshTokensForPlayer(r.Context(), resetToken.PlayerID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to revoke sessions", err)
+		return
+	}
+
+	if err = cfg.db.RevokeAllSessionsForPlayer(r.Context(), resetToken.PlayerID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to revoke sessions", err)
+		return
+	}
+
+	// following the link proved they own the email
+	if err = cfg.db.VerifyPlayerEmail(r.Context(), resetToken.PlayerID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to verify email", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{
+		"message": "Password has been reset, login with the new password",
+	})
+}
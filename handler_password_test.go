@@ -0,0 +1,151 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/auth"
+	"github.com/AradD7/Go-Knuclebones/internal/verification"
+	"github.com/google/uuid"
+)
+
+func TestResetPassword(t *testing.T) {
+	playerId := uuid.New()
+	token, hash := verification.GenerateVerificationToken()
+
+	tests := []struct {
+		name        string
+		token       string
+		expiresAt   time.Time
+		wantStatus  int
+		wantUpdated bool
+	}{
+		{
+			name:        "Valid token",
+			token:       token,
+			expiresAt:   time.Now().UTC().Add(time.Hour),
+			wantStatus:  http.StatusOK,
+			wantUpdated: true,
+		},
+		{
+			name:       "Expired token",
+			token:      token,
+			expiresAt:  time.Now().UTC().Add(-time.Minute),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Unknown token",
+			token:      "not-a-token",
+			expiresAt:  time.Now().UTC().Add(time.Hour),
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var deleted, newHash string
+			revoked := false
+
+			cfg := &apiConfig{
+				db: newStubDB(t, map[string]stubQuery{
+					"GetVerificationToken": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						if args[0].Value != hash || args[1].Value != verification.PurposePasswordReset {
+							return nil, nil
+						}
+						return [][]driver.Value{{hash, playerId.String(), tt.expiresAt, time.Now(), verification.PurposePasswordReset, nil}}, nil
+					},
+					"DeleteVerificationToken": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						deleted = args[0].Value.(string)
+						return nil, nil
+					},
+					"UpdatePlayerPassword": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						newHash = args[1].Value.(string)
+						return nil, nil
+					},
+					"RevokeAllRefreshTokensForPlayer": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						revoked = args[0].Value == playerId.String()
+						return nil, nil
+					},
+					"RevokeAllSessionsForPlayer": execOK,
+					"VerifyPlayerEmail":          execOK,
+				}),
+			}
+
+			body := strings.NewReader(`{"token": "` + tt.token + `", "password": "n3w-password"}`)
+			w := httptest.NewRecorder()
+			cfg.handlerResetPassword(w, httptest.NewRequest(http.MethodPost, "/api/players/password/reset", body))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Got status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.token == token && deleted != hash {
+				t.Errorf("Token was not consumed")
+			}
+			if !tt.wantUpdated {
+				if newHash != "" || revoked {
+					t.Errorf("Password changed with a rejected token")
+				}
+				return
+			}
+			if err := auth.CompareHashPassword(newHash, "n3w-password"); err != nil {
+				t.Errorf("Stored hash doesn't match the new password: %v", err)
+			}
+			if !revoked {
+				t.Errorf("Refresh tokens were not revoked")
+			}
+		})
+	}
+}
+
+func TestForgotPasswordSameResponse(t *testing.T) {
+	playerId := uuid.New()
+
+	tests := []struct {
+		name     string
+		exists   bool
+		recentAt time.Time
+	}{
+		{name: "Unknown account"},
+		{name: "Link sent a moment ago", exists: true, recentAt: time.Now().UTC().Add(-time.Minute)},
+	}
+
+	var bodies []string
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// nothing is queued, any other query fails the test
+			cfg := &apiConfig{
+				db: newStubDB(t, map[string]stubQuery{
+					"GetPlayerByEmail": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						if !tt.exists {
+							return nil, nil
+						}
+						return [][]driver.Value{playerRow(playerId, nil, "player@example.com")}, nil
+					},
+					"GetPlayerByUsername": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						return nil, nil
+					},
+					"GetVerificationTokenByPlayerId": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						return [][]driver.Value{{"hash", playerId.String(), tt.recentAt.Add(time.Hour), tt.recentAt, verification.PurposePasswordReset, nil}}, nil
+					},
+				}),
+			}
+
+			body := strings.NewReader(`{"email": "player@example.com"}`)
+			w := httptest.NewRecorder()
+			cfg.handlerForgotPassword(w, httptest.NewRequest(http.MethodPost, "/api/players/password/forgot", body))
+
+			if w.Code != http.StatusOK {
+				t.Errorf("Got status %d, want %d", w.Code, http.StatusOK)
+			}
+			bodies = append(bodies, w.Body.String())
+		})
+	}
+
+	if len(bodies) == 2 && bodies[0] != bodies[1] {
+		t.Errorf("Got %s for an unknown account but %s for an existing one", bodies[0], bodies[1])
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/auth"
+	"github.com/AradD7/Go-Knuclebones/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxPersonalAccessTokens = 10
+	maxTokenNameLength      = 100
+	maxTokenExpiryDays      = 365
+)
+
+var tokenScopes = []string{auth.ScopeGamesRead, auth.ScopeGamesPlay}
+
+var (
+	errTokenExpired = errors.New("personal access token expired")
+	errMissingScope = errors.New("personal access token is missing a scope")
+	errNotABot      = errors.New("only bot accounts can play with a personal access token")
+	errPlayerGone   = errors.New("player was deleted")
+)
+
+// PersonalAccessToken leaves the token out, except in the response that
+// creates it
+type PersonalAccessToken struct {
+	Id         uuid.UUID `json:"id"`
+	Name       string    `json:"name"`
+	Scopes     []string  `json:"scopes"`
+	Token      string    `json:"token,omitzero"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at,omitzero"`
+	ExpiresAt  time.Time `json:"expires_at,omitzero"`
+}
+
+func personalAccessTokenResponse(token database.PersonalAccessToken) PersonalAccessToken {
+	return PersonalAccessToken{
+		Id:         token.ID,
+		Name:       token.Name,
+		Scopes:     token.Scopes,
+		CreatedAt:  token.CreatedAt,
+		LastUsedAt: token.LastUsedAt.Time,
+		ExpiresAt:  token.ExpiresAt.Time,
+	}
+}
+
+// validateAccessToken accepts the JWT of a logged in player, or one of
+// their personal access tokens granted scope. Tokens that play need a bot
+// account, so opponents know who they are up against. Either way the player
+// must not have deleted their account since.
+func (cfg *apiConfig) validateAccessToken(ctx context.Context, token, scope string) (uuid.UUID, error) {
+	if !auth.IsPersonalAccessToken(token) {
+		playerId, err := auth.ValidateJWT(token, cfg.tokenKeys)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		active, err := cfg.db.IsActivePlayer(ctx, playerId)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		if !active {
+			return uuid.Nil, errPlayerGone
+		}
+		return playerId, nil
+	}
+
+	pat, err := cfg.db.GetPersonalAccessTokenByHash(ctx, auth.HashPersonalAccessToken(token))
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if pat.DeletedAt.Valid {
+		return uuid.Nil, errPlayerGone
+	}
+	if pat.ExpiresAt.Valid && time.Now().After(pat.ExpiresAt.Time) {
+		return uuid.Nil, errTokenExpired
+	}
+	if !slices.Contains(pat.Scopes, scope) {
+		return uuid.Nil, fmt.Errorf("%w: %s", errMissingScope, scope)
+	}
+	if scope == auth.ScopeGamesPlay && !pat.IsBot {
+		return uuid.Nil, errNotABot
+	}
+
+	if err = cfg.db.TouchPersonalAccessToken(ctx, pat.ID); err != nil {
+		log.Printf("Failed to record the use of personal access token %v: %v", pat.ID, err)
+	}
+	return pat.PlayerID, nil
+}
+
+// authorizeToken is the player a game endpoint is called for, by JWT or by
+// a personal access token granted scope, writing the error response itself
+// otherwise
+func (cfg *apiConfig) authorizeToken(w http.ResponseWriter, r *http.Request, scope string) (uuid.UUID, bool) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Not Authorized", err)
+		return uuid.Nil, false
+	}
+
+	playerId, err := cfg.validateAccessToken(r.Context(), token, scope)
+	switch {
+	case errors.Is(err, errMissingScope):
+		respondWithError(w, http.StatusForbidden, "This token doesn't have the "+scope+" scope", err)
+		return uuid.Nil, false
+	case errors.Is(err, errPlayerGone) && !auth.IsPersonalAccessToken(token):
+		respondWithError(w, http.StatusNotFound, "Player not found", err)
+		return uuid.Nil, false
+	case errors.Is(err, errNotABot):
+		respondWithError(w, http.StatusForbidden, "Only bot accounts can play with a personal access token", err)
+		return uuid.Nil, false
+	case err != nil && auth.IsPersonalAccessToken(token):
+		respondWithError(w, http.StatusUnauthorized, "Token is invalid, expired or revoked", err)
+		return uuid.Nil, false
+	case err != nil:
+		respondWithError(w, http.StatusUnauthorized, "Token is exipred, refresh JWT token or login again", err)
+		return uuid.Nil, false
+	}
+	return playerId, true
+}
+
+// handlerCreatePersonalAccessToken makes a long-lived token for the
+// player's bots and scripts, shown this once
+func (cfg *apiConfig) handlerCreatePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return
+	}
+	if player.IsGuest {
+		respondWithError(w, http.StatusForbidden, guestUpgradeRequired, nil)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var params parameters
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Failed to decode the json data", err)
+		return
+	}
+
+	params.Name = strings.TrimSpace(params.Name)
+	if params.Name == "" || len(params.Name) > maxTokenNameLength {
+		respondWithError(w, http.StatusBadRequest, "The name must be between 1 and 100 characters", nil)
+		return
+	}
+	if len(params.Scopes) == 0 {
+		respondWithError(w, http.StatusBadRequest, "Grant at least one scope", nil)
+		return
+	}
+	for _, scope := range params.Scopes {
+		if !slices.Contains(tokenScopes, scope) {
+			respondWithError(w, http.StatusBadRequest, "Unknown scope "+scope, nil)
+			return
+		}
+	}
+	slices.Sort(params.Scopes)
+	params.Scopes = slices.Compact(params.Scopes)
+	if params.ExpiresInDays < 0 || params.ExpiresInDays > maxTokenExpiryDays {
+		respondWithError(w, http.StatusBadRequest, "expires_in_days must be between 1 and 365, or 0 for a token that doesn't expire", nil)
+		return
+	}
+
+	count, err := cfg.db.CountPersonalAccessTokens(r.Context(), player.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to count tokens", err)
+		return
+	}
+	if count >= maxPersonalAccessTokens {
+		respondWithError(w, http.StatusConflict, "You can have at most 10 personal access tokens", nil)
+		return
+	}
+
+	var expiresAt sql.NullTime
+	if params.ExpiresInDays > 0 {
+		expiresAt = sql.NullTime{Time: time.Now().AddDate(0, 0, params.ExpiresInDays), Valid: true}
+	}
+
+	token, hash := auth.MakePersonalAccessToken()
+	created, err := cfg.db.CreatePersonalAccessToken(r.Context(), database.CreatePersonalAccessTokenParams{
+		PlayerID:  player.ID,
+		Name:      params.Name,
+		TokenHash: hash,
+		Scopes:    params.Scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create the token", err)
+		return
+	}
+
+	response := personalAccessTokenResponse(created)
+	response.Token = token
+	respondWithJSON(w, http.StatusCreated, response)
+}
+
+func (cfg *apiConfig) handlerGetPersonalAccessTokens(w http.ResponseWriter, r *http.Request) {
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return
+	}
+
+	tokens, err := cfg.db.GetPersonalAccessTokens(r.Context(), player.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get tokens", err)
+		return
+	}
+
+	listed := []PersonalAccessToken{}
+	for _, token := range tokens {
+		listed = append(listed, personalAccessTokenResponse(token))
+	}
+
+	respondWithJSON(w, http.StatusOK, listed)
+}
+
+// handlerDeletePersonalAccessToken revokes a token, it stops working right
+// away
+func (cfg *apiConfig) handlerDeletePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return
+	}
+
+	tokenId, err := uuid.Parse(r.PathValue("token_id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid token id", err)
+		return
+	}
+
+	deleted, err := cfg.db.DeletePersonalAccessToken(r.Context(), database.DeletePersonalAccessTokenParams{
+		ID:       tokenId,
+		PlayerID: player.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete the token", err)
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, http.StatusNotFound, "Token not found", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/auth"
+	"github.com/google/uuid"
+)
+
+func TestCreatePersonalAccessToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		guest      bool
+		count      int64
+		wantStatus int
+		wantExpiry bool
+	}{
+		{
+			name:       "Never expires",
+			body:       `{"name": "my bot", "scopes": ["games:play", "games:read", "games:play"]}`,
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "Expires in 30 days",
+			body:       `{"name": "my bot", "scopes": ["games:read"], "expires_in_days": 30}`,
+			wantStatus: http.StatusCreated,
+			wantExpiry: true,
+		},
+		{
+			name:       "Unknown scope",
+			body:       `{"name": "my bot", "scopes": ["players:delete"]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "No scopes",
+			body:       `{"name": "my bot", "scopes": []}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "No name",
+			body:       `{"name": " ", "scopes": ["games:read"]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Expires too late",
+			body:       `{"name": "my bot", "scopes": ["games:read"], "expires_in_days": 1000}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Too many tokens",
+			body:       `{"name": "my bot", "scopes": ["games:read"]}`,
+			count:      maxPersonalAccessTokens,
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "Guest",
+			body:       `{"name": "my bot", "scopes": ["games:read"]}`,
+			guest:      true,
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			playerId := uuid.New()
+			var storedHash, scopes driver.Value
+
+			cfg := &apiConfig{
+				tokenKeys: testKeys,
+				db: newStubDB(t, map[string]stubQuery{
+					"GetPlayerByPlayerId": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						if tt.guest {
+							return [][]driver.Value{guestRow(playerId, "guest-1234")}, nil
+						}
+						return [][]driver.Value{playerRow(playerId, nil, "player@example.com")}, nil
+					},
+					"CountPersonalAccessTokens": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						return [][]driver.Value{{tt.count}}, nil
+					},
+					"CreatePersonalAccessToken": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						storedHash, scopes = args[2].Value, args[3].Value
+						if (args[4].Value != nil) != tt.wantExpiry {
+							t.Errorf("Stored expiry %v", args[4].Value)
+						}
+						return [][]driver.Value{{uuid.NewString(), args[0].Value, args[1].Value, args[2].Value, args[3].Value, time.Now(), nil, args[4].Value}}, nil
+					},
+				}),
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/tokens/personal", strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+makeToken(t, playerId))
+			w := httptest.NewRecorder()
+			cfg.handlerCreatePersonalAccessToken(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Got status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if w.Code != http.StatusCreated {
+				return
+			}
+
+			var created PersonalAccessToken
+			if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+				t.Fatal(err)
+			}
+			if !auth.IsPersonalAccessToken(created.Token) || storedHash != auth.HashPersonalAccessToken(created.Token) {
+				t.Errorf("Returned token %q and stored %v, want the hash of the token stored", created.Token, storedHash)
+			}
+			if tt.name == "Never expires" && scopes != `{"games:play","games:read"}` {
+				t.Errorf("Stored scopes %v, want them sorted without duplicates", scopes)
+			}
+			if created.ExpiresAt.IsZero() == tt.wantExpiry {
+				t.Errorf("Got expiry %v", created.ExpiresAt)
+			}
+		})
+	}
+}
+
+func TestAuthorizeToken(t *testing.T) {
+	playerId := uuid.New()
+	token, hash := auth.MakePersonalAccessToken()
+
+	tests := []struct {
+		name       string
+		token      string
+		scope      string
+		scopes     string
+		isBot      bool
+		expiresAt  any
+		revoked    bool
+		deleted    bool
+		wantStatus int
+	}{
+		{
+			name:       "JWT",
+			token:      makeToken(t, playerId),
+			scope:      auth.ScopeGamesPlay,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "JWT of a deleted player",
+			token:      makeToken(t, playerId),
+			scope:      auth.ScopeGamesRead,
+			deleted:    true,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "Read token reads",
+			token:      token,
+			scope:      auth.ScopeGamesRead,
+			scopes:     "{games:read}",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Read token plays",
+			token:      token,
+			scope:      auth.ScopeGamesPlay,
+			scopes:     "{games:read}",
+			isBot:      true,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Bot plays",
+			token:      token,
+			scope:      auth.ScopeGamesPlay,
+			scopes:     "{games:play,games:read}",
+			isBot:      true,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Person plays",
+			token:      token,
+			scope:      auth.ScopeGamesPlay,
+			scopes:     "{games:play}",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Expired",
+			token:      token,
+			scope:      auth.ScopeGamesRead,
+			scopes:     "{games:read}",
+			expiresAt:  time.Now().Add(-time.Hour),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "Revoked",
+			token:      token,
+			scope:      auth.ScopeGamesRead,
+			revoked:    true,
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			touched := false
+			cfg := &apiConfig{
+				tokenKeys: testKeys,
+				db: newStubDB(t, map[string]stubQuery{
+					"IsActivePlayer": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						return [][]driver.Value{{!tt.deleted && args[0].Value == playerId.String()}}, nil
+					},
+					"GetPersonalAccessTokenByHash": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						if tt.revoked || args[0].Value != hash {
+							return nil, nil
+						}
+						return [][]driver.Value{{uuid.NewString(), playerId.String(), tt.scopes, tt.expiresAt, tt.isBot, nil}}, nil
+					},
+					"TouchPersonalAccessToken": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						touched = true
+						return nil, nil
+					},
+				}),
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/games", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+			id, ok := cfg.authorizeToken(w, req, tt.scope)
+
+			if ok != (tt.wantStatus == http.StatusOK) || !ok && w.Code != tt.wantStatus {
+				t.Fatalf("Got %v with status %d, want %d: %s", ok, w.Code, tt.wantStatus, w.Body.String())
+			}
+			if ok && id != playerId {
+				t.Errorf("Authorized %v, want %v", id, playerId)
+			}
+			if touched != (ok && tt.token == token) {
+				t.Errorf("Recorded the use of the token: %v", touched)
+			}
+		})
+	}
+}
@@ -3,12 +3,14 @@ package main
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/AradD7/Go-Knuclebones/internal/auth"
 	"github.com/AradD7/Go-Knuclebones/internal/database"
+	"github.com/AradD7/Go-Knuclebones/internal/emails"
 	"github.com/AradD7/Go-Knuclebones/internal/verification"
 	"github.com/google/uuid"
 )
@@ -23,6 +25,9 @@ type Player struct {
 	DisplayName   string    `json:"display_name"`
 	Email         string    `json:"email"`
 	EmailVerified bool      `json:"email_verified"`
+	IsGuest       bool      `json:"is_guest"`
+	IsBot         bool      `json:"is_bot"`
+	Locale        string    `json:"locale"`
 }
 
 func (cfg *apiConfig) handlerNewPlayer(w http.ResponseWriter, r *http.Request) {
@@ -55,6 +60,7 @@ func (cfg *apiConfig) handlerNewPlayer(w http.ResponseWriter, r *http.Request) {
 			Valid:  true,
 			String: newPlayer.Email,
 		},
+		Locale: requestLocale(r),
 	})
 	if err != nil {
 		if strings.Contains(err.Error(), "email"){
@@ -71,16 +77,23 @@ func (cfg *apiConfig) handlerNewPlayer(w http.ResponseWriter, r *http.Request) {
 
 	token, hash := verification.GenerateVerificationToken()
 	_, err = cfg.db.CreateVerificationToken(r.Context(), database.CreateVerificationTokenParams{
-		TokenHash: hash,
-		PlayerID:  player.ID,
+		TokenHash:        hash,
+		PlayerID:         player.ID,
+		ExpiresInMinutes: int32(verification.EmailVerificationTTL.Minutes()),
+		Purpose:          verification.PurposeEmailVerification,
 	})
+	if err == nil {
+		err = cfg.queueEmail(r.Context(), emails.Verification, newPlayer.Email, player.Locale, emails.Data{
+			Link:      verification.Link(verification.PurposeEmailVerification, token),
+			ExpiresIn: verification.EmailVerificationTTL,
+		})
+	}
+	// the account exists either way, failing here would only make a retry
+	// find the username taken. The player can ask for the email again.
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to generate verification token", err)
-		return
+		fmt.Printf("ERROR queueing the verification email of player %s: %v\n", player.ID, err)
 	}
 
-	go verification.SendVerificationEmail(newPlayer.Email, token)
-
 	respondWithJSON(w, http.StatusCreated, nil)
 }
 
@@ -97,13 +110,20 @@ func (cfg *apiConfig) handlerPlayerLogin(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if wait := cfg.loginLockedFor(r.Context(), newPlayer.Username); wait > 0 {
+		respondTooManyRequests(w, wait)
+		return
+	}
+
 	player, err := cfg.db.GetPlayerByUsername(r.Context(), newPlayer.Username)
 	if err != nil {
+		cfg.recordLoginFailure(r.Context(), newPlayer.Username)
 		respondWithError(w, http.StatusBadRequest, "Wrong Username or password", err)
 		return
 	}
 
 	if err = auth.CompareHashPassword(player.HashedPassword.String, newPlayer.Password); err != nil {
+		cfg.recordLoginFailure(r.Context(), newPlayer.Username)
 		respondWithError(w, http.StatusBadRequest, "Wrong username or Password", err)
 		return
 	}
@@ -113,22 +133,18 @@ func (cfg *apiConfig) handlerPlayerLogin(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	refreshToken, err := cfg.db.GetRefreshTokenFromPlayerId(r.Context(), player.ID)
-	if err != nil || time.Now().UTC().After(refreshToken.ExpiresAt) || refreshToken.RevokedAt.Valid {
-		cfg.db.DeleteRefreshToken(r.Context(), refreshToken.Token)
-
-		refreshToken, err = cfg.db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
-			Token:    auth.MakeRefreshToken(),
-			PlayerID: player.ID,
-		})
+	if cfg.challengeSecondFactor(w, r, player.ID) {
+		return
 	}
+	cfg.resetLoginFailures(r.Context(), newPlayer.Username)
 
+	refreshToken, err := cfg.startSession(r, player.ID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to create new refresh token", err)
 		return
 	}
 
-	token, err := auth.MakeJWT(player.ID, cfg.tokenSecret, time.Minute*60)
+	token, err := auth.MakeJWT(player.ID, cfg.tokenKeys, time.Minute*60)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to create new JWT token", err)
 		return
@@ -153,14 +169,14 @@ func (cfg *apiConfig) handlerGetPlayer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	playerId, err := auth.ValidateJWT(token, cfg.tokenSecret)
+	playerId, err := auth.ValidateJWT(token, cfg.tokenKeys)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Token is exipred, refresh JWT token or login again", err)
 		return
 	}
 
 	player, err := cfg.db.GetPlayerByPlayerId(r.Context(), playerId)
-	if err != nil {
+	if err != nil || player.DeletedAt.Valid {
 		respondWithError(w, http.StatusNotFound, "Player not found", err)
 		return
 	}
@@ -170,25 +186,24 @@ func (cfg *apiConfig) handlerGetPlayer(w http.ResponseWriter, r *http.Request) {
 		Username:    player.Username,
 		Avatar:      player.Avatar.String,
 		DisplayName: player.DisplayName.String,
+		IsGuest:     player.IsGuest,
+		IsBot:       player.IsBot,
+		Locale:      player.Locale,
 	})
 }
 
 func (cfg *apiConfig) handlerUpdateProfile(w http.ResponseWriter, r *http.Request) {
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Not Authorized", err)
-		return
-	}
-
-	playerId, err := auth.ValidateJWT(token, cfg.tokenSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Token is exipred, refresh JWT token or login again", err)
+	// a deleted player's profile stays anonymized
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
 		return
 	}
+	playerId := player.ID
 
 	type paramaters struct {
 		DisplayName string `json:"display_name"`
 		Avatar      string `json:"avatar"`
+		Locale      string `json:"locale"`
 	}
 
 	decoder := json.NewDecoder(r.Body)
@@ -198,7 +213,12 @@ func (cfg *apiConfig) handlerUpdateProfile(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	if err = cfg.db.UpdateProfile(r.Context(), database.UpdateProfileParams{
+	if params.Locale != "" && !emails.Supported(params.Locale) {
+		respondWithError(w, http.StatusBadRequest, "Unsupported locale", nil)
+		return
+	}
+
+	if err := cfg.db.UpdateProfile(r.Context(), database.UpdateProfileParams{
 		ID: playerId,
 		DisplayName: sql.NullString{
 			Valid:  params.DisplayName != "",
@@ -213,5 +233,15 @@ func (cfg *apiConfig) handlerUpdateProfile(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	if params.Locale != "" {
+		if err := cfg.db.UpdatePlayerLocale(r.Context(), database.UpdatePlayerLocaleParams{
+			ID:     playerId,
+			Locale: params.Locale,
+		}); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to update profile", err)
+			return
+		}
+	}
+
 	respondWithJSON(w, http.StatusOK, nil)
 }
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestNewPlayer(t *testing.T) {
+	tests := []struct {
+		name       string
+		outboxDown bool
+	}{
+		{name: "Verification email queued"},
+		// the email can be resent, the account must not be lost over it
+		{name: "Outbox unavailable", outboxDown: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queued := false
+
+			cfg := &apiConfig{
+				tokenKeys: testKeys,
+				db: newStubDB(t, map[string]stubQuery{
+					"CreatePlayer": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						return [][]driver.Value{playerRow(uuid.New(), args[2].Value, args[1].Value)}, nil
+					},
+					"CreateVerificationToken": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						now := time.Now()
+						return [][]driver.Value{{args[0].Value, args[1].Value, now.Add(time.Hour), now, args[3].Value, nil}}, nil
+					},
+					"EnqueueEmail": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						if tt.outboxDown {
+							return nil, errors.New("connection refused")
+						}
+						queued = true
+						now := time.Now()
+						return [][]driver.Value{{uuid.NewString(), args[0].Value, args[1].Value, args[2].Value, args[3].Value, 0, now, nil, now, nil, nil}}, nil
+					},
+				}),
+			}
+
+			body := strings.NewReader(`{"username": "newcomer", "email": "newcomer@example.com", "password": "s3cret-password"}`)
+			req := httptest.NewRequest(http.MethodPost, "/api/players/new", body)
+			w := httptest.NewRecorder()
+			cfg.handlerNewPlayer(w, req)
+
+			if w.Code != http.StatusCreated {
+				t.Fatalf("Got status %d, want %d: %s", w.Code, http.StatusCreated, w.Body.String())
+			}
+			if queued == tt.outboxDown {
+				t.Errorf("Got verification email queued %v with the outbox down %v", queued, tt.outboxDown)
+			}
+		})
+	}
+}
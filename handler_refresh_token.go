@@ -1,16 +1,21 @@
 package main
 
 import (
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/AradD7/Go-Knuclebones/internal/auth"
+	"github.com/AradD7/Go-Knuclebones/internal/database"
 )
 
 type newToken struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
 }
 
+// handlerRefresh rotates the refresh token, the one sent is used up and a
+// new one is returned with the JWT
 func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 	token, err := auth.GetBearerToken(r.Header)
 	if err != nil {
@@ -19,19 +24,63 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 	}
 
 	refreshToken, err := cfg.db.GetUserFromRefreshToken(r.Context(), token)
-	if err != nil || time.Now().UTC().After(refreshToken.ExpiresAt) || refreshToken.RevokedAt.Valid {
+	if err != nil || time.Now().UTC().After(refreshToken.ExpiresAt) {
 		respondWithError(w, http.StatusUnauthorized, "Refresh token not valid. Login again", err)
 		return
 	}
 
-	jwtToken, err := auth.MakeJWT(refreshToken.PlayerID, cfg.tokenSecret, time.Minute*60)
+	session, err := cfg.db.GetSessionById(r.Context(), refreshToken.SessionID)
+	if err != nil || session.RevokedAt.Valid || time.Now().UTC().After(session.ExpiresAt) {
+		respondWithError(w, http.StatusUnauthorized, "Refresh token not valid. Login again", err)
+		return
+	}
+
+	consumed, err := cfg.db.ConsumeRefreshToken(r.Context(), token)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to rotate refresh token", err)
+		return
+	}
+
+	// a used up token coming back means it was copied, whoever has the
+	// session now can't be told apart from the owner so it is ended
+	if consumed == 0 {
+		log.Printf("Refresh token reuse detected for session %s", session.ID)
+		if _, err = cfg.revokeSession(r, session.ID, session.PlayerID); err != nil {
+			log.Printf("Failed to revoke session %s: %v", session.ID, err)
+		}
+		respondWithError(w, http.StatusUnauthorized, "Refresh token not valid. Login again", nil)
+		return
+	}
+
+	newRefreshToken, err := cfg.db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		Token:     auth.MakeRefreshToken(),
+		PlayerID:  session.PlayerID,
+		SessionID: session.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create new refresh token", err)
+		return
+	}
+
+	if err = cfg.db.TouchSession(r.Context(), database.TouchSessionParams{
+		ID:        session.ID,
+		UserAgent: r.UserAgent(),
+		Ip:        cfg.clientIP(r),
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update session", err)
+		return
+	}
+
+	// the new token is as old a login as the session
+	jwtToken, err := auth.MakeSessionJWT(session.PlayerID, cfg.tokenKeys, time.Minute*60, session.CreatedAt)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to create new JWT token", err)
 		return
 	}
 
 	respondWithJSON(w, http.StatusOK, newToken{
-		Token: jwtToken,
+		Token:        jwtToken,
+		RefreshToken: newRefreshToken.Token,
 	})
 }
 
@@ -42,7 +91,10 @@ func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_ = cfg.db.RevokeRefreshToken(r.Context(), token)
+	// logging out ends the whole session, not only the latest token
+	if refreshToken, err := cfg.db.GetUserFromRefreshToken(r.Context(), token); err == nil {
+		_, _ = cfg.revokeSession(r, refreshToken.SessionID, refreshToken.PlayerID)
+	}
 
 	respondWithJSON(w, http.StatusOK, nil)
 }
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// createSessionStub answers CreateSession with a fresh session for the
+// player in the first argument
+func createSessionStub(args []driver.NamedValue) ([][]driver.Value, error) {
+	now := time.Now().UTC()
+	return [][]driver.Value{{uuid.NewString(), args[0].Value, now, now, now.Add(time.Hour), args[1].Value, args[2].Value, nil}}, nil
+}
+
+// createRefreshTokenStub answers CreateRefreshToken with the token it was
+// asked to store
+func createRefreshTokenStub(args []driver.NamedValue) ([][]driver.Value, error) {
+	now := time.Now().UTC()
+	return [][]driver.Value{{args[0].Value, now, now, args[1].Value, now.Add(time.Hour), nil, args[2].Value}}, nil
+}
+
+// refreshStore keeps the refresh tokens and sessions of the stubbed queries
+// the rotation in handlerRefresh goes through
+type refreshStore struct {
+	mu             sync.Mutex
+	playerId       uuid.UUID
+	sessionId      uuid.UUID
+	sessionRevoked bool
+	// token -> revoked
+	tokens map[string]bool
+}
+
+func (s *refreshStore) queries() map[string]stubQuery {
+	return map[string]stubQuery{
+		"GetUserFromRefreshToken": func(args []driver.NamedValue) ([][]driver.Value, error) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			revoked, ok := s.tokens[args[0].Value.(string)]
+			if !ok {
+				return nil, nil
+			}
+			var revokedAt driver.Value
+			if revoked {
+				revokedAt = time.Now().UTC()
+			}
+			now := time.Now().UTC()
+			return [][]driver.Value{{args[0].Value, now, now, s.playerId.String(), now.Add(time.Hour), revokedAt, s.sessionId.String()}}, nil
+		},
+		"GetSessionById": func(args []driver.NamedValue) ([][]driver.Value, error) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			var revokedAt driver.Value
+			if s.sessionRevoked {
+				revokedAt = time.Now().UTC()
+			}
+			now := time.Now().UTC()
+			return [][]driver.Value{{s.sessionId.String(), s.playerId.String(), now, now, now.Add(time.Hour), "", "", revokedAt}}, nil
+		},
+		"ConsumeRefreshToken": func(args []driver.NamedValue) ([][]driver.Value, error) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			token := args[0].Value.(string)
+			if s.tokens[token] {
+				return rowsAffected(0), nil
+			}
+			s.tokens[token] = true
+			return rowsAffected(1), nil
+		},
+		"CreateRefreshToken": func(args []driver.NamedValue) ([][]driver.Value, error) {
+			s.mu.Lock()
+			s.tokens[args[0].Value.(string)] = false
+			s.mu.Unlock()
+			return createRefreshTokenStub(args)
+		},
+		"TouchSession": execOK,
+		"RevokeSession": func(args []driver.NamedValue) ([][]driver.Value, error) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.sessionRevoked = true
+			return rowsAffected(1), nil
+		},
+		"RevokeRefreshTokensForSession": func(args []driver.NamedValue) ([][]driver.Value, error) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			for token := range s.tokens {
+				s.tokens[token] = true
+			}
+			return nil, nil
+		},
+	}
+}
+
+func refresh(t *testing.T, cfg *apiConfig, token string) (int, newToken) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/tokens/refresh", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	cfg.handlerRefresh(w, req)
+
+	var body newToken
+	if w.Code == http.StatusOK {
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+			t.Fatalf("Failed to decode the response: %v", err)
+		}
+	}
+	return w.Code, body
+}
+
+func TestRefreshRotation(t *testing.T) {
+	store := &refreshStore{
+		playerId:  uuid.New(),
+		sessionId: uuid.New(),
+		tokens:    map[string]bool{"first": false},
+	}
+	cfg := &apiConfig{
+		tokenKeys: testKeys,
+		db:        newStubDB(t, store.queries()),
+	}
+
+	code, rotated := refresh(t, cfg, "first")
+	if code != http.StatusOK {
+		t.Fatalf("Got status %d refreshing a valid token", code)
+	}
+	if rotated.RefreshToken == "" || rotated.RefreshToken == "first" {
+		t.Fatalf("Refresh token was not rotated: %q", rotated.RefreshToken)
+	}
+	if rotated.Token == "" {
+		t.Fatalf("No JWT in the response")
+	}
+
+	code, next := refresh(t, cfg, rotated.RefreshToken)
+	if code != http.StatusOK {
+		t.Fatalf("Got status %d refreshing the rotated token", code)
+	}
+
+	// the first token coming back is a reuse, the session is ended
+	if code, _ = refresh(t, cfg, "first"); code != http.StatusUnauthorized {
+		t.Fatalf("Got status %d reusing a rotated token, want %d", code, http.StatusUnauthorized)
+	}
+	if !store.sessionRevoked {
+		t.Errorf("Session was not revoked after reuse")
+	}
+	if code, _ = refresh(t, cfg, next.RefreshToken); code != http.StatusUnauthorized {
+		t.Errorf("Got status %d with the latest token of a revoked session, want %d", code, http.StatusUnauthorized)
+	}
+}
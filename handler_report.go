@@ -0,0 +1,175 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxReportDetailsLength = 1000
+	defaultReportsLimit    = 50
+	maxReportsLimit        = 500
+)
+
+var reportReasons = []string{"cheating", "harassment", "inappropriate_name", "spam", "other"}
+
+// Report is an open report for moderators
+type Report struct {
+	Id               uuid.UUID `json:"id"`
+	ReporterId       uuid.UUID `json:"reporter_id"`
+	ReporterUsername string    `json:"reporter_username"`
+	ReportedId       uuid.UUID `json:"reported_id"`
+	ReportedUsername string    `json:"reported_username"`
+	Reason           string    `json:"reason"`
+	Details          string    `json:"details"`
+	GameId           uuid.UUID `json:"game_id,omitzero"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// handlerReportPlayer records a report against a player for moderators,
+// optionally about a game the two played
+func (cfg *apiConfig) handlerReportPlayer(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Reason  string    `json:"reason"`
+		Details string    `json:"details"`
+		GameId  uuid.UUID `json:"game_id"`
+	}
+
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return
+	}
+
+	reportedId, err := uuid.Parse(r.PathValue("player_id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid player id", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var params parameters
+	if err = decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Failed to decode the json data", err)
+		return
+	}
+
+	if !slices.Contains(reportReasons, params.Reason) {
+		respondWithError(w, http.StatusBadRequest, "Unknown report reason", nil)
+		return
+	}
+	if len(params.Details) > maxReportDetailsLength {
+		respondWithError(w, http.StatusBadRequest, "Details can be at most 1000 characters", nil)
+		return
+	}
+	if reportedId == player.ID {
+		respondWithError(w, http.StatusBadRequest, "You can't report yourself", nil)
+		return
+	}
+
+	reported, err := cfg.db.GetPlayerByPlayerId(r.Context(), reportedId)
+	if err != nil || reported.DeletedAt.Valid {
+		respondWithError(w, http.StatusNotFound, "Player not found", err)
+		return
+	}
+
+	gameId := uuid.NullUUID{}
+	if params.GameId != uuid.Nil {
+		gameId = uuid.NullUUID{UUID: params.GameId, Valid: true}
+		for _, id := range []uuid.UUID{player.ID, reported.ID} {
+			if _, err = cfg.db.GetBoardByPlayerIdAndGameId(r.Context(), database.GetBoardByPlayerIdAndGameIdParams{
+				GameID:   gameId,
+				PlayerID: id,
+			}); err != nil {
+				respondWithError(w, http.StatusBadRequest, "Both players have to be in the game", err)
+				return
+			}
+		}
+	}
+
+	report, err := cfg.db.CreatePlayerReport(r.Context(), database.CreatePlayerReportParams{
+		ReporterID: player.ID,
+		ReportedID: reported.ID,
+		Reason:     params.Reason,
+		Details:    params.Details,
+		GameID:     gameId,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusConflict, "You already reported this player", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to report player", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, map[string]uuid.UUID{"id": report.ID})
+}
+
+// handlerGetReports lists the open reports, oldest first
+func (cfg *apiConfig) handlerGetReports(w http.ResponseWriter, r *http.Request) {
+	if !cfg.authorizeAdmin(w, r) {
+		return
+	}
+
+	limit, err := queryLimit(r, defaultReportsLimit, maxReportsLimit)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	rows, err := cfg.db.GetOpenReports(r.Context(), int32(limit))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get reports", err)
+		return
+	}
+
+	reports := []Report{}
+	for _, row := range rows {
+		reports = append(reports, Report{
+			Id:               row.ID,
+			ReporterId:       row.ReporterID,
+			ReporterUsername: row.ReporterUsername,
+			ReportedId:       row.ReportedID,
+			ReportedUsername: row.ReportedUsername,
+			Reason:           row.Reason,
+			Details:          row.Details,
+			GameId:           row.GameID.UUID,
+			CreatedAt:        row.CreatedAt,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, reports)
+}
+
+// handlerResolveReport closes a report once a moderator dealt with it, the
+// reporter can then report the player again
+func (cfg *apiConfig) handlerResolveReport(w http.ResponseWriter, r *http.Request) {
+	if !cfg.authorizeAdmin(w, r) {
+		return
+	}
+
+	reportId, err := uuid.Parse(r.PathValue("report_id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid report id", err)
+		return
+	}
+
+	resolved, err := cfg.db.ResolvePlayerReport(r.Context(), reportId)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to resolve the report", err)
+		return
+	}
+	if resolved == 0 {
+		respondWithError(w, http.StatusNotFound, "No open report with that id", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestReportPlayer(t *testing.T) {
+	playerId := uuid.New()
+	reportedId := uuid.New()
+	gameId := uuid.New()
+
+	tests := []struct {
+		name        string
+		body        string
+		inGame      bool
+		alreadyOpen bool
+		wantStatus  int
+	}{
+		{
+			name:       "Report",
+			body:       `{"reason":"harassment","details":"Rude in chat"}`,
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "About a game they played",
+			body:       `{"reason":"cheating","game_id":"` + gameId.String() + `"}`,
+			inGame:     true,
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "About a game they didn't play",
+			body:       `{"reason":"cheating","game_id":"` + gameId.String() + `"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Unknown reason",
+			body:       `{"reason":"lost to them"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Details too long",
+			body:       `{"reason":"other","details":"` + strings.Repeat("a", maxReportDetailsLength+1) + `"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "Already reported",
+			body:        `{"reason":"spam"}`,
+			alreadyOpen: true,
+			wantStatus:  http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &apiConfig{
+				tokenKeys: testKeys,
+				db: newStubDB(t, map[string]stubQuery{
+					"GetPlayerByPlayerId": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						id, _ := uuid.Parse(args[0].Value.(string))
+						return [][]driver.Value{playerRow(id, nil, "player@example.com")}, nil
+					},
+					"GetBoardByPlayerIdAndGameId": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						if !tt.inGame && args[1].Value == reportedId.String() {
+							return nil, nil
+						}
+						return [][]driver.Value{boardRow(uuid.New(), playerId)}, nil
+					},
+					"CreatePlayerReport": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						if tt.alreadyOpen {
+							return nil, nil
+						}
+						return [][]driver.Value{{uuid.NewString(), args[0].Value, args[1].Value, args[2].Value, args[3].Value, args[4].Value, time.Now(), nil}}, nil
+					},
+				}),
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/players/"+reportedId.String()+"/report", strings.NewReader(tt.body))
+			req.SetPathValue("player_id", reportedId.String())
+			req.Header.Set("Authorization", "Bearer "+makeToken(t, playerId))
+			w := httptest.NewRecorder()
+			cfg.handlerReportPlayer(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Got status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"database/sql"
 	"math/rand"
 	"net/http"
 
 	"github.com/AradD7/Go-Knuclebones/internal/auth"
+	"github.com/AradD7/Go-Knuclebones/internal/database"
 	"github.com/google/uuid"
 )
 
@@ -19,20 +21,61 @@ func (cfg *apiConfig) handlerRoll(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Not Authorized", err)
+	playerId, ok := cfg.authorizeToken(w, r, auth.ScopeGamesPlay)
+	if !ok {
 		return
 	}
 
-	_, err = auth.ValidateJWT(token, cfg.tokenSecret)
+	if err = cfg.gs.authorize(r.Context(), gameId, playerId); err != nil {
+		respondWithError(w, http.StatusForbidden, "Player is not in this game", err)
+		return
+	}
+
+	currentGame, err := cfg.db.GetGameById(r.Context(), gameId)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Token is exipred, refresh JWT token or login again", err)
+		respondWithError(w, http.StatusNotFound, "Game not found", err)
+		return
+	}
+	if currentGame.Winner.Valid {
+		respondWithError(w, http.StatusConflict, "The game is over", nil)
+		return
+	}
+	if currentGame.PlayerTurn.UUID != playerId {
+		respondWithError(w, http.StatusConflict, "It's not your turn", nil)
+		return
+	}
+	if currentGame.LastRoll.Valid {
+		respondWithError(w, http.StatusConflict, "The die was already rolled this turn", nil)
 		return
 	}
 
 	dice := rand.Intn(6) + 1
 
+	// the roll is stored so a player who refetches the game after missing
+	// the broadcast still sees it. Each turn is rolled for once, and the
+	// server rolls for bots, so the update only happens while the turn is
+	// still the player's and unrolled.
+	rolled, err := cfg.db.SetPlayerRoll(r.Context(), database.SetPlayerRollParams{
+		ID: gameId,
+		LastRoll: sql.NullInt32{
+			Valid: true,
+			Int32: int32(dice),
+		},
+		PlayerTurn: uuid.NullUUID{
+			Valid: true,
+			UUID:  playerId,
+		},
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to save the roll", err)
+		return
+	}
+	if rolled == 0 {
+		respondWithError(w, http.StatusConflict, "The die was already rolled this turn", nil)
+		return
+	}
+
+	cfg.gs.playerActive(gameId, playerId)
 	cfg.gs.broadcastRolled(gameId, dice)
 
 	respondWithJSON(w, http.StatusOK, DiceRoll{
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestRoll(t *testing.T) {
+	playerId := uuid.New()
+	gameId := uuid.New()
+
+	tests := []struct {
+		name       string
+		playerTurn uuid.UUID
+		lastRoll   driver.Value
+		// whether the conditional update still found the turn unrolled
+		saved      bool
+		wantStatus int
+	}{
+		{name: "Own turn", playerTurn: playerId, saved: true, wantStatus: http.StatusOK},
+		{name: "Opponent's turn", playerTurn: uuid.New(), wantStatus: http.StatusConflict},
+		{name: "Rolled twice", playerTurn: playerId, lastRoll: int64(2), wantStatus: http.StatusConflict},
+		// another roll landed in between, or the player is a bot the
+		// server is rolling for
+		{name: "Rolled meanwhile", playerTurn: playerId, wantStatus: http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var saved driver.Value
+			cfg := &apiConfig{
+				tokenKeys: testKeys,
+				gs:        newGameServer(),
+				db: newStubDB(t, map[string]stubQuery{
+					"IsActivePlayer": activePlayer,
+					"GetGameById": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						row := gameRow(gameId, uuid.New(), false, nil, nil)
+						row[6] = tt.playerTurn.String()
+						row[8] = tt.lastRoll
+						return [][]driver.Value{row}, nil
+					},
+					"SetPlayerRoll": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						if args[2].Value != playerId.String() {
+							t.Errorf("Rolled for the turn of %v, want the player's", args[2].Value)
+						}
+						if !tt.saved {
+							return rowsAffected(0), nil
+						}
+						saved = args[1].Value
+						return rowsAffected(1), nil
+					},
+				}),
+			}
+			cfg.gs.authorize = func(ctx context.Context, gameId, playerId uuid.UUID) error {
+				return nil
+			}
+			published := false
+			cfg.gs.backend = newMemoryBackend(func(event gameEvent) {
+				published = true
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/api/games/roll?game_id="+gameId.String(), nil)
+			req.Header.Set("Authorization", "Bearer "+makeToken(t, playerId))
+			w := httptest.NewRecorder()
+			cfg.handlerRoll(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Got status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if published != tt.saved || (saved != nil) != tt.saved {
+				t.Errorf("Saved %v and broadcast the roll: %v", saved, published)
+			}
+		})
+	}
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/auth"
+	"github.com/AradD7/Go-Knuclebones/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	totpIssuer            = "Silly Mini Games"
+	twoFactorChallengeTTL = 5 * time.Minute
+	recoveryCodeCount     = 10
+)
+
+type twoFactorChallenge struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+}
+
+func (cfg *apiConfig) twoFactorEnabled(ctx context.Context, playerId uuid.UUID) (bool, error) {
+	totp, err := cfg.db.GetPlayerTOTP(ctx, playerId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return totp.ConfirmedAt.Valid, nil
+}
+
+// challengeSecondFactor answers a login with a challenge token instead of
+// a session when the player has 2FA on. It returns whether it responded.
+func (cfg *apiConfig) challengeSecondFactor(w http.ResponseWriter, r *http.Request, playerId uuid.UUID) bool {
+	enabled, err := cfg.twoFactorEnabled(r.Context(), playerId)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to check two-factor authentication", err)
+		return true
+	}
+	if !enabled {
+		return false
+	}
+
+	challenge, err := auth.MakeTwoFactorJWT(playerId, cfg.tokenKeys, twoFactorChallengeTTL)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create challenge token", err)
+		return true
+	}
+
+	respondWithJSON(w, http.StatusOK, twoFactorChallenge{
+		TwoFactorRequired: true,
+		ChallengeToken:    challenge,
+	})
+	return true
+}
+
+// verifySecondFactor accepts a code from the authenticator or an unused
+// recovery code, either only once
+func (cfg *apiConfig) verifySecondFactor(ctx context.Context, playerId uuid.UUID, code string) error {
+	totp, err := cfg.db.GetPlayerTOTP(ctx, playerId)
+	if err != nil {
+		return err
+	}
+	if !totp.ConfirmedAt.Valid {
+		return errors.New("two-factor authentication is not enabled")
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) <= auth.TOTPDigits+1 {
+		counter, err := auth.ValidateTOTP(totp.Secret, code, time.Now())
+		if err != nil {
+			return err
+		}
+		used, err := cfg.db.UseTOTPCounter(ctx, database.UseTOTPCounterParams{
+			PlayerID:    playerId,
+			LastCounter: counter,
+		})
+		if err != nil {
+			return err
+		}
+		if used == 0 {
+			return errors.New("code was already used")
+		}
+		return nil
+	}
+
+	recoveryCodes, err := cfg.db.GetUnusedRecoveryCodes(ctx, playerId)
+	if err != nil {
+		return err
+	}
+	code = strings.ToLower(code)
+	for _, recoveryCode := range recoveryCodes {
+		if auth.CompareHashPassword(recoveryCode.CodeHash, code) != nil {
+			continue
+		}
+		used, err := cfg.db.UseRecoveryCode(ctx, recoveryCode.ID)
+		if err != nil {
+			return err
+		}
+		if used == 0 {
+			return errors.New("recovery code was already used")
+		}
+		return nil
+	}
+	return errors.New("invalid code")
+}
+
+func (cfg *apiConfig) handlerEnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Password string `json:"password"`
+	}
+
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return
+	}
+	if player.IsGuest {
+		respondWithError(w, http.StatusForbidden, guestUpgradeRequired, nil)
+		return
+	}
+
+	var params parameters
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request", err)
+		return
+	}
+
+	if !cfg.confirmPassword(w, r, player, params.Password) {
+		return
+	}
+
+	enabled, err := cfg.twoFactorEnabled(r.Context(), player.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to check two-factor authentication", err)
+		return
+	}
+	if enabled {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled", nil)
+		return
+	}
+
+	// enrolling again before confirming replaces the secret
+	totp, err := cfg.db.CreatePlayerTOTP(r.Context(), database.CreatePlayerTOTPParams{
+		PlayerID: player.ID,
+		Secret:   auth.NewTOTPSecret(),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to start enrollment", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{
+		"secret":      totp.Secret,
+		"otpauth_uri": auth.TOTPURI(totpIssuer, player.Username, totp.Secret),
+	})
+}
+
+func (cfg *apiConfig) handlerConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Code string `json:"code"`
+	}
+
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return
+	}
+
+	var params parameters
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request", err)
+		return
+	}
+
+	totp, err := cfg.db.GetPlayerTOTP(r.Context(), player.ID)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Start the enrollment first", err)
+		return
+	}
+	if totp.ConfirmedAt.Valid {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled", nil)
+		return
+	}
+
+	counter, err := auth.ValidateTOTP(totp.Secret, params.Code, time.Now())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid code", err)
+		return
+	}
+
+	if err = cfg.db.ConfirmPlayerTOTP(r.Context(), database.ConfirmPlayerTOTPParams{
+		PlayerID:    player.ID,
+		LastCounter: counter,
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to enable two-factor authentication", err)
+		return
+	}
+
+	if err = cfg.db.DeleteRecoveryCodes(r.Context(), player.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create recovery codes", err)
+		return
+	}
+
+	// only the hashes are kept, this is the one time the player sees them
+	recoveryCodes := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	for _, code := range recoveryCodes {
+		hash, err := auth.HashPassword(code)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to create recovery codes", err)
+			return
+		}
+		if err = cfg.db.CreateRecoveryCode(r.Context(), database.CreateRecoveryCodeParams{
+			PlayerID: player.ID,
+			CodeHash: hash,
+		}); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to create recovery codes", err)
+			return
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string][]string{
+		"recovery_codes": recoveryCodes,
+	})
+}
+
+func (cfg *apiConfig) handlerDisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return
+	}
+
+	var params parameters
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request", err)
+		return
+	}
+
+	if !cfg.confirmPassword(w, r, player, params.Password) {
+		return
+	}
+
+	if err := cfg.verifySecondFactor(r.Context(), player.ID, params.Code); err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid code", err)
+		return
+	}
+
+	if err := cfg.db.DeletePlayerTOTP(r.Context(), player.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to disable two-factor authentication", err)
+		return
+	}
+
+	if err := cfg.db.DeleteRecoveryCodes(r.Context(), player.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete recovery codes", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{
+		"message": "Two-factor authentication has been disabled",
+	})
+}
+
+// handlerLoginTwoFactor is the second step of a login, it trades the
+// challenge token and a code for a session
+func (cfg *apiConfig) handlerLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+	}
+
+	var params parameters
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request", err)
+		return
+	}
+
+	playerId, err := auth.ValidateTwoFactorJWT(params.ChallengeToken, cfg.tokenKeys)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Challenge expired, login again", err)
+		return
+	}
+
+	player, err := cfg.db.GetPlayerByPlayerId(r.Context(), playerId)
+	if err != nil || player.DeletedAt.Valid {
+		respondWithError(w, http.StatusUnauthorized, "Challenge expired, login again", err)
+		return
+	}
+
+	// codes are short enough to guess, so they count as failed logins
+	if wait := cfg.loginLockedFor(r.Context(), player.Username); wait > 0 {
+		respondTooManyRequests(w, wait)
+		return
+	}
+
+	if err = cfg.verifySecondFactor(r.Context(), player.ID, params.Code); err != nil {
+		cfg.recordLoginFailure(r.Context(), player.Username)
+		respondWithError(w, http.StatusUnauthorized, "Invalid code", err)
+		return
+	}
+	cfg.resetLoginFailures(r.Context(), player.Username)
+
+	cfg.respondWithSession(w, r, player)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/auth"
+	"github.com/google/uuid"
+)
+
+func TestTwoFactorLogin(t *testing.T) {
+	hashedPassword, err := auth.HashPassword("pa55word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recoveryHash, err := auth.HashPassword("abcde-12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	playerId := uuid.New()
+	secret := auth.NewTOTPSecret()
+	var lastCounter int64
+	recoveryUsed := false
+
+	cfg := &apiConfig{
+		tokenKeys: testKeys,
+		db: newStubDB(t, map[string]stubQuery{
+			"GetPlayerByUsername": func(args []driver.NamedValue) ([][]driver.Value, error) {
+				return [][]driver.Value{playerRow(playerId, hashedPassword, "player@example.com")}, nil
+			},
+			"GetPlayerByPlayerId": func(args []driver.NamedValue) ([][]driver.Value, error) {
+				return [][]driver.Value{playerRow(playerId, hashedPassword, "player@example.com")}, nil
+			},
+			"GetPlayerTOTP": func(args []driver.NamedValue) ([][]driver.Value, error) {
+				now := time.Now().UTC()
+				return [][]driver.Value{{playerId.String(), secret, now, now, lastCounter}}, nil
+			},
+			"UseTOTPCounter": func(args []driver.NamedValue) ([][]driver.Value, error) {
+				counter := args[1].Value.(int64)
+				if counter <= lastCounter {
+					return rowsAffected(0), nil
+				}
+				lastCounter = counter
+				return rowsAffected(1), nil
+			},
+			"GetUnusedRecoveryCodes": func(args []driver.NamedValue) ([][]driver.Value, error) {
+				if recoveryUsed {
+					return nil, nil
+				}
+				return [][]driver.Value{{uuid.NewString(), playerId.String(), recoveryHash, time.Now().UTC(), nil}}, nil
+			},
+			"UseRecoveryCode": func(args []driver.NamedValue) ([][]driver.Value, error) {
+				recoveryUsed = true
+				return rowsAffected(1), nil
+			},
+			"CreateSession":      createSessionStub,
+			"CreateRefreshToken": createRefreshTokenStub,
+		}),
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/players/login", strings.NewReader(`{"username": "player", "password": "pa55word"}`))
+	w := httptest.NewRecorder()
+	cfg.handlerPlayerLogin(w, req)
+
+	var challenge twoFactorChallenge
+	if err := json.NewDecoder(w.Body).Decode(&challenge); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || !challenge.TwoFactorRequired || challenge.ChallengeToken == "" {
+		t.Fatalf("Login got %d %+v, want a challenge", w.Code, challenge)
+	}
+	if _, err := auth.ValidateJWT(challenge.ChallengeToken, testKeys); err == nil {
+		t.Fatalf("Challenge token accepted as an access token")
+	}
+
+	code, err := auth.GenerateTOTP(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		code       string
+		wantStatus int
+	}{
+		{name: "Code from the authenticator", code: code, wantStatus: http.StatusOK},
+		{name: "Same code again", code: code, wantStatus: http.StatusUnauthorized},
+		{name: "Wrong code", code: "000000", wantStatus: http.StatusUnauthorized},
+		{name: "Recovery code", code: "ABCDE-12345", wantStatus: http.StatusOK},
+		{name: "Used recovery code", code: "abcde-12345", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.code == "000000" && code == "000000" {
+				t.Skip("the authenticator code happens to be 000000")
+			}
+
+			body := strings.NewReader(`{"challenge_token": "` + challenge.ChallengeToken + `", "code": "` + tt.code + `"}`)
+			req := httptest.NewRequest(http.MethodPost, "/api/players/login/2fa", body)
+			w := httptest.NewRecorder()
+			cfg.handlerLoginTwoFactor(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Got status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var player Player
+			if err := json.NewDecoder(w.Body).Decode(&player); err != nil {
+				t.Fatal(err)
+			}
+			if player.Token == "" || player.RefreshToken == "" {
+				t.Errorf("Response has no tokens: %+v", player)
+			}
+		})
+	}
+}
@@ -1,15 +1,14 @@
 package main
 
 import (
-	"crypto/sha256"
 	"database/sql"
-	"encoding/hex"
 	"encoding/json"
 	"net/http"
 	"time"
 
 	"github.com/AradD7/Go-Knuclebones/internal/auth"
 	"github.com/AradD7/Go-Knuclebones/internal/database"
+	"github.com/AradD7/Go-Knuclebones/internal/emails"
 	"github.com/AradD7/Go-Knuclebones/internal/verification"
 )
 
@@ -26,25 +25,26 @@ func (cfg *apiConfig) handlerVerifyEmail(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Hash the token to find it in DB
-	hasher := sha256.New()
-	hasher.Write([]byte(params.Token))
-	tokenHash := hex.EncodeToString(hasher.Sum(nil))
+	tokenHash := verification.HashToken(params.Token)
 
 	// Get verification token
-	verification, err := cfg.db.GetVerificationToken(r.Context(), tokenHash)
+	verificationToken, err := cfg.db.GetVerificationToken(r.Context(), database.GetVerificationTokenParams{
+		TokenHash: tokenHash,
+		Purpose:   verification.PurposeEmailVerification,
+	})
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid token", err)
 		return
 	}
 
-	if !verification.ExpiresAt.After(time.Now().UTC()) {
+	if !verificationToken.ExpiresAt.After(time.Now().UTC()) {
 		cfg.db.DeleteVerificationToken(r.Context(), tokenHash)
 		respondWithError(w, http.StatusBadRequest, "Token expired", nil)
 		return
 	}
 
 	// Mark email as verified
-	err = cfg.db.VerifyPlayerEmail(r.Context(), verification.PlayerID)
+	err = cfg.db.VerifyPlayerEmail(r.Context(), verificationToken.PlayerID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to verify email", err)
 		return
@@ -54,23 +54,26 @@ func (cfg *apiConfig) handlerVerifyEmail(w http.ResponseWriter, r *http.Request)
 	cfg.db.DeleteVerificationToken(r.Context(), tokenHash)
 
 	// Get player info
-	player, err := cfg.db.GetPlayerByPlayerId(r.Context(), verification.PlayerID)
+	player, err := cfg.db.GetPlayerByPlayerId(r.Context(), verificationToken.PlayerID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to get player", err)
 		return
 	}
 
+	// the email is verified either way, logging in still takes the second
+	// factor
+	if cfg.challengeSecondFactor(w, r, player.ID) {
+		return
+	}
+
 	// Create tokens and log them in
-	refreshToken, err := cfg.db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
-		Token:    auth.MakeRefreshToken(),
-		PlayerID: player.ID,
-	})
+	refreshToken, err := cfg.startSession(r, player.ID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to create new refreshToken token", err)
 		return
 	}
 
-	accessToken, err := auth.MakeJWT(player.ID, cfg.tokenSecret, time.Minute*60)
+	accessToken, err := auth.MakeJWT(player.ID, cfg.tokenKeys, time.Minute*60)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to create new JWT token", err)
 		return
@@ -117,7 +120,10 @@ func (cfg *apiConfig) handlerResendVerification(w http.ResponseWriter, r *http.R
 	}
 
 	// Check for existing valid token
-	existing, _ := cfg.db.GetVerificationTokenByPlayerId(r.Context(), player.ID)
+	existing, _ := cfg.db.GetVerificationTokenByPlayerId(r.Context(), database.GetVerificationTokenByPlayerIdParams{
+		PlayerID: player.ID,
+		Purpose:  verification.PurposeEmailVerification,
+	})
 	if existing.TokenHash != "" && existing.ExpiresAt.After(time.Now().UTC()) {
 		// don't send if token less than half hour old
 		if time.Now().UTC().Sub(existing.CreatedAt) < 30*time.Minute {
@@ -131,12 +137,20 @@ func (cfg *apiConfig) handlerResendVerification(w http.ResponseWriter, r *http.R
 	// Generate new token
 	token, hash := verification.GenerateVerificationToken()
 	cfg.db.CreateVerificationToken(r.Context(), database.CreateVerificationTokenParams{
-		TokenHash: hash,
-		PlayerID:  player.ID,
+		TokenHash:        hash,
+		PlayerID:         player.ID,
+		ExpiresInMinutes: int32(verification.EmailVerificationTTL.Minutes()),
+		Purpose:          verification.PurposeEmailVerification,
 	})
 
 	// Send email
-	go verification.SendVerificationEmail(player.Email.String, token)
+	if err = cfg.queueEmail(r.Context(), emails.Verification, player.Email.String, player.Locale, emails.Data{
+		Link:      verification.Link(verification.PurposeEmailVerification, token),
+		ExpiresIn: verification.EmailVerificationTTL,
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to send email", err)
+		return
+	}
 
 	respondWithJSON(w, http.StatusOK, map[string]string{
 		"message": "Verification email sent",
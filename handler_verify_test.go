@@ -0,0 +1,89 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/verification"
+	"github.com/google/uuid"
+)
+
+func TestVerifyEmailLogin(t *testing.T) {
+	tests := []struct {
+		name          string
+		twoFactor     bool
+		wantChallenge bool
+	}{
+		{name: "Logged in"},
+		{name: "Second factor required", twoFactor: true, wantChallenge: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			playerId := uuid.New()
+			token, hash := verification.GenerateVerificationToken()
+			verified := false
+
+			cfg := &apiConfig{
+				tokenKeys: testKeys,
+				db: newStubDB(t, map[string]stubQuery{
+					"GetVerificationToken": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						if args[0].Value != hash || args[1].Value != verification.PurposeEmailVerification {
+							return nil, nil
+						}
+						now := time.Now().UTC()
+						return [][]driver.Value{{hash, playerId.String(), now.Add(time.Hour), now, verification.PurposeEmailVerification, nil}}, nil
+					},
+					"VerifyPlayerEmail": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						verified = args[0].Value == playerId.String()
+						return nil, nil
+					},
+					"DeleteVerificationToken": execOK,
+					"GetPlayerByPlayerId": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						return [][]driver.Value{playerRow(playerId, nil, "player@example.com")}, nil
+					},
+					"GetPlayerTOTP": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						if !tt.twoFactor {
+							return nil, nil
+						}
+						now := time.Now().UTC()
+						return [][]driver.Value{{playerId.String(), "secret", now, now, int64(0)}}, nil
+					},
+					"CreateSession":      createSessionStub,
+					"CreateRefreshToken": createRefreshTokenStub,
+				}),
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/players/verify", strings.NewReader(`{"token": "`+token+`"}`))
+			w := httptest.NewRecorder()
+			cfg.handlerVerifyEmail(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Got status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+			}
+			if !verified {
+				t.Errorf("The email was not verified")
+			}
+
+			var response struct {
+				twoFactorChallenge
+				Token        string `json:"token"`
+				RefreshToken string `json:"refresh_token"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantChallenge != (response.TwoFactorRequired && response.ChallengeToken != "") {
+				t.Errorf("Got %+v, want a challenge: %v", response, tt.wantChallenge)
+			}
+			if tt.wantChallenge != (response.Token == "" && response.RefreshToken == "") {
+				t.Errorf("Got %+v, want a session: %v", response, !tt.wantChallenge)
+			}
+		})
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxWebhooksPerPlayer   = 10
+	maxWebhookURLLength    = 2048
+	minWebhookSecretLength = 16
+	maxWebhookSecretLength = 256
+	defaultDeliveriesLimit = 50
+	maxDeliveriesLimit     = 500
+)
+
+// Webhook leaves the secret out, it is only ever sent by its owner
+type Webhook struct {
+	Id        uuid.UUID `json:"id"`
+	Url       string    `json:"url"`
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookDelivery is an entry of a webhook's delivery log
+type WebhookDelivery struct {
+	Id       uuid.UUID `json:"id"`
+	Event    string    `json:"event"`
+	Payload  string    `json:"payload"`
+	Status   string    `json:"status"`
+	Attempts int32     `json:"attempts"`
+	// the HTTP status the receiver last answered with
+	LastStatus    int32     `json:"last_status,omitzero"`
+	LastError     string    `json:"last_error,omitzero"`
+	NextAttemptAt time.Time `json:"next_attempt_at,omitzero"`
+	CreatedAt     time.Time `json:"created_at"`
+	DeliveredAt   time.Time `json:"delivered_at,omitzero"`
+	FailedAt      time.Time `json:"failed_at,omitzero"`
+}
+
+func webhookResponse(webhook database.Webhook) Webhook {
+	return Webhook{
+		Id:        webhook.ID,
+		Url:       webhook.Url,
+		Events:    webhook.Events,
+		CreatedAt: webhook.CreatedAt,
+	}
+}
+
+// validateWebhookURL only lets admins send deliveries over plain http, or to
+// an internal address. Hostnames are checked again by the dispatcher when it
+// connects, whatever they resolve to then.
+func validateWebhookURL(rawURL string, admin bool) error {
+	if len(rawURL) > maxWebhookURLLength {
+		return errors.New("url can be at most 2048 characters")
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return errors.New("url must be an absolute URL")
+	}
+	if parsed.Scheme != "https" && (parsed.Scheme != "http" || !admin) {
+		return errors.New("url must use https")
+	}
+	if admin {
+		return nil
+	}
+
+	host := strings.ToLower(parsed.Hostname())
+	if addr, err := netip.ParseAddr(host); err == nil && !publicAddress(addr) {
+		return errors.New("url must point to a public address")
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return errors.New("url must point to a public address")
+	}
+	return nil
+}
+
+// webhookOwner is the player_id of the webhooks a player registers
+func webhookOwner(player database.Player) uuid.NullUUID {
+	return uuid.NullUUID{Valid: true, UUID: player.ID}
+}
+
+// webhookPlayer is the player managing their webhooks, guests have to
+// upgrade first
+func (cfg *apiConfig) webhookPlayer(w http.ResponseWriter, r *http.Request) (database.Player, bool) {
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return database.Player{}, false
+	}
+	if player.IsGuest {
+		respondWithError(w, http.StatusForbidden, guestUpgradeRequired, nil)
+		return database.Player{}, false
+	}
+	return player, true
+}
+
+func (cfg *apiConfig) handlerCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	player, ok := cfg.webhookPlayer(w, r)
+	if !ok {
+		return
+	}
+	cfg.createWebhook(w, r, webhookOwner(player))
+}
+
+func (cfg *apiConfig) handlerGetWebhooks(w http.ResponseWriter, r *http.Request) {
+	player, ok := cfg.webhookPlayer(w, r)
+	if !ok {
+		return
+	}
+	cfg.getWebhooks(w, r, webhookOwner(player))
+}
+
+func (cfg *apiConfig) handlerDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	player, ok := cfg.webhookPlayer(w, r)
+	if !ok {
+		return
+	}
+	cfg.deleteWebhook(w, r, webhookOwner(player))
+}
+
+func (cfg *apiConfig) handlerGetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	player, ok := cfg.webhookPlayer(w, r)
+	if !ok {
+		return
+	}
+	cfg.getWebhookDeliveries(w, r, webhookOwner(player))
+}
+
+// the admin webhooks have no owner and hear about every game
+
+func (cfg *apiConfig) handlerAdminCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	if !cfg.authorizeAdmin(w, r) {
+		return
+	}
+	cfg.createWebhook(w, r, uuid.NullUUID{})
+}
+
+func (cfg *apiConfig) handlerAdminGetWebhooks(w http.ResponseWriter, r *http.Request) {
+	if !cfg.authorizeAdmin(w, r) {
+		return
+	}
+	cfg.getWebhooks(w, r, uuid.NullUUID{})
+}
+
+func (cfg *apiConfig) handlerAdminDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	if !cfg.authorizeAdmin(w, r) {
+		return
+	}
+	cfg.deleteWebhook(w, r, uuid.NullUUID{})
+}
+
+func (cfg *apiConfig) handlerAdminGetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	if !cfg.authorizeAdmin(w, r) {
+		return
+	}
+	cfg.getWebhookDeliveries(w, r, uuid.NullUUID{})
+}
+
+func (cfg *apiConfig) createWebhook(w http.ResponseWriter, r *http.Request, owner uuid.NullUUID) {
+	type parameters struct {
+		Url    string   `json:"url"`
+		Secret string   `json:"secret"`
+		Events []string `json:"events"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var params parameters
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Failed to decode the json data", err)
+		return
+	}
+
+	if err := validateWebhookURL(params.Url, !owner.Valid); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if len(params.Secret) < minWebhookSecretLength || len(params.Secret) > maxWebhookSecretLength {
+		respondWithError(w, http.StatusBadRequest, "The secret must be between 16 and 256 characters", nil)
+		return
+	}
+	if len(params.Events) == 0 {
+		respondWithError(w, http.StatusBadRequest, "Subscribe to at least one event", nil)
+		return
+	}
+	for _, event := range params.Events {
+		if !webhookEvents[event] {
+			respondWithError(w, http.StatusBadRequest, "Unknown event "+event, nil)
+			return
+		}
+	}
+	slices.Sort(params.Events)
+	params.Events = slices.Compact(params.Events)
+
+	if owner.Valid {
+		count, err := cfg.db.CountWebhooks(r.Context(), owner)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to count webhooks", err)
+			return
+		}
+		if count >= maxWebhooksPerPlayer {
+			respondWithError(w, http.StatusConflict, "You can have at most 10 webhooks", nil)
+			return
+		}
+	}
+
+	webhook, err := cfg.db.CreateWebhook(r.Context(), database.CreateWebhookParams{
+		PlayerID: owner,
+		Url:      params.Url,
+		Secret:   params.Secret,
+		Events:   params.Events,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create the webhook", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, webhookResponse(webhook))
+}
+
+func (cfg *apiConfig) getWebhooks(w http.ResponseWriter, r *http.Request, owner uuid.NullUUID) {
+	webhooks, err := cfg.db.GetWebhooks(r.Context(), owner)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get webhooks", err)
+		return
+	}
+
+	listed := []Webhook{}
+	for _, webhook := range webhooks {
+		listed = append(listed, webhookResponse(webhook))
+	}
+
+	respondWithJSON(w, http.StatusOK, listed)
+}
+
+func (cfg *apiConfig) deleteWebhook(w http.ResponseWriter, r *http.Request, owner uuid.NullUUID) {
+	webhookId, err := uuid.Parse(r.PathValue("webhook_id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid webhook id", err)
+		return
+	}
+
+	deleted, err := cfg.db.DeleteWebhook(r.Context(), database.DeleteWebhookParams{
+		ID:       webhookId,
+		PlayerID: owner,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete the webhook", err)
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, http.StatusNotFound, "Webhook not found", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) getWebhookDeliveries(w http.ResponseWriter, r *http.Request, owner uuid.NullUUID) {
+	webhookId, err := uuid.Parse(r.PathValue("webhook_id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid webhook id", err)
+		return
+	}
+
+	limit, err := queryLimit(r, defaultDeliveriesLimit, maxDeliveriesLimit)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	if _, err = cfg.db.GetWebhook(r.Context(), database.GetWebhookParams{
+		ID:       webhookId,
+		PlayerID: owner,
+	}); errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Webhook not found", err)
+		return
+	} else if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get the webhook", err)
+		return
+	}
+
+	deliveries, err := cfg.db.GetWebhookDeliveries(r.Context(), database.GetWebhookDeliveriesParams{
+		WebhookID: webhookId,
+		Limit:     int32(limit),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get the deliveries", err)
+		return
+	}
+
+	entries := []WebhookDelivery{}
+	for _, delivery := range deliveries {
+		entry := WebhookDelivery{
+			Id:          delivery.ID,
+			Event:       delivery.Event,
+			Payload:     delivery.Payload,
+			Status:      "pending",
+			Attempts:    delivery.Attempts,
+			LastStatus:  delivery.LastStatus.Int32,
+			LastError:   delivery.LastError.String,
+			CreatedAt:   delivery.CreatedAt,
+			DeliveredAt: delivery.DeliveredAt.Time,
+			FailedAt:    delivery.FailedAt.Time,
+		}
+		switch {
+		case delivery.DeliveredAt.Valid:
+			entry.Status = "delivered"
+		case delivery.FailedAt.Valid:
+			entry.Status = "failed"
+		default:
+			entry.NextAttemptAt = delivery.NextAttemptAt
+		}
+		entries = append(entries, entry)
+	}
+
+	respondWithJSON(w, http.StatusOK, entries)
+}
@@ -34,33 +34,42 @@ func TestHashing(t *testing.T) {
 }
 func TestValidateJWT(t *testing.T) {
 	userID := uuid.New()
-	validToken, _ := MakeJWT(userID, "secret", time.Hour)
+	keys := NewKeySet(NewHMACKey([]byte("secret")))
+	validToken, _ := MakeJWT(userID, keys, time.Hour)
+	twoFactorToken, _ := MakeTwoFactorJWT(userID, keys, time.Hour)
 
 	tests := []struct {
 		name        string
 		tokenString string
-		tokenSecret string
+		keys        *KeySet
 		wantUserID  uuid.UUID
 		wantErr     bool
 	}{
 		{
 			name:        "Valid token",
 			tokenString: validToken,
-			tokenSecret: "secret",
+			keys:        keys,
 			wantUserID:  userID,
 			wantErr:     false,
 		},
 		{
 			name:        "Invalid token",
 			tokenString: "invalid.token.string",
-			tokenSecret: "secret",
+			keys:        keys,
+			wantUserID:  uuid.Nil,
+			wantErr:     true,
+		},
+		{
+			name:        "Two factor challenge token",
+			tokenString: twoFactorToken,
+			keys:        keys,
 			wantUserID:  uuid.Nil,
 			wantErr:     true,
 		},
 		{
 			name:        "Wrong secret",
 			tokenString: validToken,
-			tokenSecret: "wrong_secret",
+			keys:        NewKeySet(NewHMACKey([]byte("wrong_secret"))),
 			wantUserID:  uuid.Nil,
 			wantErr:     true,
 		},
@@ -68,7 +77,7 @@ func TestValidateJWT(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotUserID, err := ValidateJWT(tt.tokenString, tt.tokenSecret)
+			gotUserID, err := ValidateJWT(tt.tokenString, tt.keys)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ValidateJWT() error = %v, wantErr %v", err, tt.wantErr)
 				return
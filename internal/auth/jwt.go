@@ -14,26 +14,73 @@ type TokenType string
 
 const (
 	TokenTypeAccess TokenType = "knucklebones-access"
+	// proves the password was right while the second factor is pending, it
+	// is not accepted where an access token is
+	TokenTypeTwoFactor TokenType = "knucklebones-2fa"
 )
 
-func MakeJWT(userId uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	newToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer: string(TokenTypeAccess),
-		IssuedAt: jwt.NewNumericDate(time.Now()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
-		Subject: userId.String(),
-	})
+// accessClaims add when the player logged in, which stays the same when the
+// token is refreshed, so a new token doesn't pass for a new login
+type accessClaims struct {
+	jwt.RegisteredClaims
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+}
+
+// MakeJWT signs with the current key of the set, its kid goes in the header
+// so the token can still be checked once the key has been rotated out. It is
+// for a player who just logged in.
+func MakeJWT(userId uuid.UUID, keys *KeySet, expiresIn time.Duration) (string, error) {
+	return makeJWT(TokenTypeAccess, userId, keys, expiresIn, time.Now())
+}
+
+// MakeSessionJWT is a new access token for a session the player logged in to
+// at authTime
+func MakeSessionJWT(userId uuid.UUID, keys *KeySet, expiresIn time.Duration, authTime time.Time) (string, error) {
+	return makeJWT(TokenTypeAccess, userId, keys, expiresIn, authTime)
+}
+
+func MakeTwoFactorJWT(userId uuid.UUID, keys *KeySet, expiresIn time.Duration) (string, error) {
+	return makeJWT(TokenTypeTwoFactor, userId, keys, expiresIn, time.Time{})
+}
+
+func makeJWT(tokenType TokenType, userId uuid.UUID, keys *KeySet, expiresIn time.Duration, authTime time.Time) (string, error) {
+	key := keys.Current()
+	if key.signKey == nil {
+		return "", fmt.Errorf("key %q can only verify tokens", key.ID)
+	}
+
+	claims := accessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer: string(tokenType),
+			IssuedAt: jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+			Subject: userId.String(),
+		},
+	}
+	if !authTime.IsZero() {
+		claims.AuthTime = jwt.NewNumericDate(authTime)
+	}
+	newToken := jwt.NewWithClaims(key.method, claims)
 
-	return newToken.SignedString([]byte(tokenSecret))
+	newToken.Header["kid"] = key.ID
+
+	return newToken.SignedString(key.signKey)
+}
+
+
+// ValidateJWT accepts tokens signed with the current key or with a previous
+// key that is still in its grace period
+func ValidateJWT(tokenString string, keys *KeySet) (uuid.UUID, error) {
+	return validateJWT(TokenTypeAccess, tokenString, keys)
 }
 
+func ValidateTwoFactorJWT(tokenString string, keys *KeySet) (uuid.UUID, error) {
+	return validateJWT(TokenTypeTwoFactor, tokenString, keys)
+}
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+func validateJWT(tokenType TokenType, tokenString string, keys *KeySet) (uuid.UUID, error) {
 	tokenClaim := jwt.RegisteredClaims{}
-	token, err := jwt.ParseWithClaims(tokenString, &tokenClaim,
-		func(jwt *jwt.Token) (any, error) {
-			return []byte(tokenSecret), nil
-		})
+	token, err := jwt.ParseWithClaims(tokenString, &tokenClaim, keys.keyFunc)
 	if err != nil {
 		return uuid.Nil, err
 	}
@@ -45,13 +92,32 @@ func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
 
 	if issuer, err := token.Claims.GetIssuer(); err != nil {
 		return uuid.Nil, fmt.Errorf("failed to get jwt issuer: %v", err)
-	} else if issuer != string(TokenTypeAccess) {
+	} else if issuer != string(tokenType) {
 		return uuid.Nil, fmt.Errorf("Failed to validate JWT")
 	}
 	return uuid.Parse(userId)
 }
 
 
+// GetJWTAuthTime is used to tell a fresh login from a session that has been
+// open for a while, it is when the player logged in rather than when the
+// token was issued
+func GetJWTAuthTime(tokenString string, keys *KeySet) (time.Time, error) {
+	tokenClaim := accessClaims{}
+	if _, err := jwt.ParseWithClaims(tokenString, &tokenClaim, keys.keyFunc); err != nil {
+		return time.Time{}, err
+	}
+
+	if tokenClaim.Issuer != string(TokenTypeAccess) {
+		return time.Time{}, fmt.Errorf("Failed to validate JWT")
+	}
+	if tokenClaim.AuthTime == nil {
+		return time.Time{}, fmt.Errorf("jwt has no auth time")
+	}
+	return tokenClaim.AuthTime.Time, nil
+}
+
+
 func GetBearerToken(headers http.Header) (string, error) {
 	auth := headers.Get("Authorization")
 	if auth == "" {
@@ -0,0 +1,303 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key signs or verifies JWTs. HMAC keys are shared secrets and are never
+// published, RSA and Ed25519 keys publish their public half in the JWKS.
+type Key struct {
+	ID     string
+	method jwt.SigningMethod
+	// nil for keys that can only verify
+	signKey   any
+	verifyKey any
+}
+
+// NewHMACKey makes a key from a shared secret. Its kid is derived from the
+// secret, so rotating one secret to another doesn't reuse the kid, without
+// giving away anything that helps guess the secret.
+func NewHMACKey(secret []byte) *Key {
+	sum := sha256.Sum256(secret)
+	return &Key{
+		ID:        "hs256-" + base64.RawURLEncoding.EncodeToString(sum[:9]),
+		method:    jwt.SigningMethodHS256,
+		signKey:   secret,
+		verifyKey: secret,
+	}
+}
+
+// ParseKeyPEM reads an RSA or Ed25519 key. A private key signs with RS256
+// or EdDSA, a public key can only verify. The kid is the RFC 7638
+// thumbprint so every service derives the same one from the key.
+func ParseKeyPEM(data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+
+	var parsed any
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.method, key.signKey, key.verifyKey = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.method, key.verifyKey = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.method, key.signKey, key.verifyKey = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.method, key.verifyKey = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	jwk, err := key.JWK()
+	if err != nil {
+		return nil, err
+	}
+	key.ID, err = jwk.Thumbprint()
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func LoadKeyFile(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKeyPEM(data)
+}
+
+func (k *Key) Algorithm() string {
+	return k.method.Alg()
+}
+
+func (k *Key) CanSign() bool {
+	return k.signKey != nil
+}
+
+// JWK is a public key in the JSON Web Key format
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+func (k *Key) JWK() (JWK, error) {
+	jwk := JWK{
+		Kid: k.ID,
+		Use: "sig",
+		Alg: k.method.Alg(),
+	}
+
+	switch pub := k.verifyKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	default:
+		return JWK{}, fmt.Errorf("%s keys have no public JWK", k.method.Alg())
+	}
+	return jwk, nil
+}
+
+// Thumbprint is the RFC 7638 SHA-256 thumbprint of the key, the hash of its
+// required members in lexicographic order
+func (j JWK) Thumbprint() (string, error) {
+	var members any
+	switch j.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{j.E, j.Kty, j.N}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{j.Crv, j.Kty, j.X}
+	default:
+		return "", fmt.Errorf("unsupported key type %q", j.Kty)
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// KeySet is the key new tokens are signed with and the keys it replaced,
+// which keep verifying tokens until their grace period ends so rotating
+// the key doesn't log everyone out
+type KeySet struct {
+	current  *Key
+	mux      *sync.RWMutex
+	previous map[string]previousKey
+}
+
+type previousKey struct {
+	key   *Key
+	until time.Time
+}
+
+func NewKeySet(current *Key) *KeySet {
+	return &KeySet{
+		current:  current,
+		mux:      &sync.RWMutex{},
+		previous: map[string]previousKey{},
+	}
+}
+
+// AddPrevious keeps accepting tokens signed with key until the given time
+func (ks *KeySet) AddPrevious(key *Key, until time.Time) {
+	ks.mux.Lock()
+	defer ks.mux.Unlock()
+
+	ks.previous[key.ID] = previousKey{
+		key:   key,
+		until: until,
+	}
+}
+
+func (ks *KeySet) Current() *Key {
+	return ks.current
+}
+
+func (ks *KeySet) lookup(kid string) (*Key, error) {
+	if kid == ks.current.ID {
+		return ks.current, nil
+	}
+
+	ks.mux.RLock()
+	defer ks.mux.RUnlock()
+
+	previous, ok := ks.previous[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	if time.Now().After(previous.until) {
+		return nil, fmt.Errorf("key %q is no longer accepted", kid)
+	}
+	return previous.key, nil
+}
+
+// legacyKeys are the keys a token without a kid may have been signed with.
+// Tokens from before kids existed were all signed with a shared secret.
+func (ks *KeySet) legacyKeys() jwt.VerificationKeySet {
+	var set jwt.VerificationKeySet
+	if ks.current.method == jwt.SigningMethodHS256 {
+		set.Keys = append(set.Keys, ks.current.verifyKey)
+	}
+
+	ks.mux.RLock()
+	defer ks.mux.RUnlock()
+
+	for _, previous := range ks.previous {
+		if previous.key.method == jwt.SigningMethodHS256 && time.Now().Before(previous.until) {
+			set.Keys = append(set.Keys, previous.key.verifyKey)
+		}
+	}
+	return set
+}
+
+// keyFunc finds the key a token was signed with and refuses tokens whose
+// alg doesn't match it, an RS256 public key must never be used as an HS256
+// secret
+func (ks *KeySet) keyFunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if token.Method.Alg() != jwt.SigningMethodHS256.Alg() {
+			return nil, fmt.Errorf("token without a kid signed with %s", token.Method.Alg())
+		}
+		set := ks.legacyKeys()
+		if len(set.Keys) == 0 {
+			return nil, fmt.Errorf("no key accepts tokens without a kid")
+		}
+		return set, nil
+	}
+
+	key, err := ks.lookup(kid)
+	if err != nil {
+		return nil, err
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("key %q doesn't sign with %s", key.ID, token.Method.Alg())
+	}
+	return key.verifyKey, nil
+}
+
+// JWKS is the public keys of the set, the current one first. HMAC keys and
+// previous keys past their grace period are left out.
+func (ks *KeySet) JWKS() []JWK {
+	keys := []JWK{}
+	if jwk, err := ks.current.JWK(); err == nil {
+		keys = append(keys, jwk)
+	}
+
+	ks.mux.RLock()
+	defer ks.mux.RUnlock()
+
+	kids := make([]string, 0, len(ks.previous))
+	for kid := range ks.previous {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	now := time.Now()
+	for _, kid := range kids {
+		previous := ks.previous[kid]
+		if now.After(previous.until) {
+			continue
+		}
+		if jwk, err := previous.key.JWK(); err == nil {
+			keys = append(keys, jwk)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func newRSAKey(t *testing.T) *Key {
+	t.Helper()
+
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsePrivateKey(t, private)
+}
+
+func newEd25519Key(t *testing.T) *Key {
+	t.Helper()
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsePrivateKey(t, private)
+}
+
+func parsePrivateKey(t *testing.T, private any) *Key {
+	t.Helper()
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ParseKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestThumbprint(t *testing.T) {
+	// RFC 7638 section 3.1
+	jwk := JWK{
+		Kty: "RSA",
+		N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E:   "AQAB",
+	}
+
+	got, err := jwk.Thumbprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"; got != want {
+		t.Errorf("Thumbprint() = %s, want %s", got, want)
+	}
+}
+
+func TestAsymmetricJWT(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     *Key
+		wantAlg string
+	}{
+		{name: "RS256", key: newRSAKey(t), wantAlg: "RS256"},
+		{name: "EdDSA", key: newEd25519Key(t), wantAlg: "EdDSA"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID := uuid.New()
+			token, err := MakeJWT(userID, NewKeySet(tt.key), time.Hour)
+			if err != nil {
+				t.Fatalf("MakeJWT() error = %v", err)
+			}
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &jwt.RegisteredClaims{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.Header["kid"] != tt.key.ID || parsed.Method.Alg() != tt.wantAlg {
+				t.Errorf("Got kid %v alg %s, want %s %s", parsed.Header["kid"], parsed.Method.Alg(), tt.key.ID, tt.wantAlg)
+			}
+
+			gotUserID, err := ValidateJWT(token, NewKeySet(tt.key))
+			if err != nil {
+				t.Fatalf("ValidateJWT() error = %v", err)
+			}
+			if gotUserID != userID {
+				t.Errorf("ValidateJWT() gotUserID = %v, want %v", gotUserID, userID)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	userID := uuid.New()
+	oldKey := newEd25519Key(t)
+	newKey := newRSAKey(t)
+
+	oldToken, err := MakeJWT(userID, NewKeySet(oldKey), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inGrace := NewKeySet(newKey)
+	inGrace.AddPrevious(oldKey, time.Now().Add(time.Hour))
+	if _, err := ValidateJWT(oldToken, inGrace); err != nil {
+		t.Errorf("Token of the previous key rejected during the grace period: %v", err)
+	}
+
+	afterGrace := NewKeySet(newKey)
+	afterGrace.AddPrevious(oldKey, time.Now().Add(-time.Minute))
+	if _, err := ValidateJWT(oldToken, afterGrace); err == nil {
+		t.Errorf("Token of the previous key accepted after the grace period")
+	}
+
+	if _, err := ValidateJWT(oldToken, NewKeySet(newKey)); err == nil {
+		t.Errorf("Token of an unknown key accepted")
+	}
+
+	// HS256 tokens from before kids existed
+	secret := []byte("secret")
+	legacy := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:    string(TokenTypeAccess),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		Subject:   userID.String(),
+	})
+	legacyToken, err := legacy.SignedString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inGrace.AddPrevious(NewHMACKey(secret), time.Now().Add(time.Hour))
+	if _, err := ValidateJWT(legacyToken, inGrace); err != nil {
+		t.Errorf("Token without a kid rejected during the grace period: %v", err)
+	}
+
+	// one shared secret replaced by another
+	oldSecret := NewHMACKey([]byte("old secret"))
+	newSecret := NewHMACKey([]byte("new secret"))
+	if oldSecret.ID == newSecret.ID {
+		t.Fatalf("Both secrets got the kid %q", oldSecret.ID)
+	}
+	oldSecretToken, err := MakeJWT(userID, NewKeySet(oldSecret), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated := NewKeySet(newSecret)
+	rotated.AddPrevious(oldSecret, time.Now().Add(time.Hour))
+	if _, err := ValidateJWT(oldSecretToken, rotated); err != nil {
+		t.Errorf("Token of the previous secret rejected during the grace period: %v", err)
+	}
+	newSecretToken, err := MakeJWT(userID, rotated, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateJWT(newSecretToken, rotated); err != nil {
+		t.Errorf("Token of the new secret rejected: %v", err)
+	}
+	if _, err := ValidateJWT(newSecretToken, NewKeySet(oldSecret)); err == nil {
+		t.Errorf("Token of the new secret accepted by the old one")
+	}
+}
+
+func TestAlgorithmConfusion(t *testing.T) {
+	key := newRSAKey(t)
+	publicDER, err := x509.MarshalPKIXPublicKey(key.verifyKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+
+	// signed with the published public key as if it were an HMAC secret
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:    string(TokenTypeAccess),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		Subject:   uuid.NewString(),
+	})
+	forged.Header["kid"] = key.ID
+	forgedToken, err := forged.SignedString(publicPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ValidateJWT(forgedToken, NewKeySet(key)); err == nil {
+		t.Errorf("HS256 token signed with the RSA public key was accepted")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	current := newRSAKey(t)
+	previous := newEd25519Key(t)
+	expired := newEd25519Key(t)
+
+	keys := NewKeySet(current)
+	keys.AddPrevious(previous, time.Now().Add(time.Hour))
+	keys.AddPrevious(expired, time.Now().Add(-time.Minute))
+	keys.AddPrevious(NewHMACKey([]byte("secret")), time.Now().Add(time.Hour))
+
+	jwks := keys.JWKS()
+	if len(jwks) != 2 {
+		t.Fatalf("Got %d keys, want the current and previous public keys: %+v", len(jwks), jwks)
+	}
+	if jwks[0].Kid != current.ID || jwks[0].Kty != "RSA" || jwks[0].E != "AQAB" {
+		t.Errorf("First key = %+v, want the current RSA key", jwks[0])
+	}
+	if jwks[1].Kid != previous.ID || jwks[1].Kty != "OKP" || jwks[1].Crv != "Ed25519" {
+		t.Errorf("Second key = %+v, want the previous Ed25519 key", jwks[1])
+	}
+}
@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// PersonalAccessTokenPrefix tells personal access tokens apart from JWTs,
+// and makes them easy to spot when one leaks into a log or a repository
+const PersonalAccessTokenPrefix = "kbp_"
+
+// Scopes a personal access token can be granted
+const (
+	// follow the player's games
+	ScopeGamesRead = "games:read"
+	// start, join and play games
+	ScopeGamesPlay = "games:play"
+)
+
+// MakePersonalAccessToken is a long-lived token for bots and scripts. Only
+// its hash is stored, the token itself is shown to the player once.
+func MakePersonalAccessToken() (token, hash string) {
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	token = PersonalAccessTokenPrefix + hex.EncodeToString(secret)
+
+	return token, HashPersonalAccessToken(token)
+}
+
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
+
+// HashPersonalAccessToken is how tokens are looked up
+func HashPersonalAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestMakePersonalAccessToken(t *testing.T) {
+	token, hash := MakePersonalAccessToken()
+
+	if !IsPersonalAccessToken(token) || len(token) != len(PersonalAccessTokenPrefix)+64 {
+		t.Errorf("Got token %q, want the prefix and 32 random bytes in hex", token)
+	}
+	if hash != HashPersonalAccessToken(token) || hash == token {
+		t.Errorf("Got hash %q, want the hash of the token", hash)
+	}
+
+	other, _ := MakePersonalAccessToken()
+	if other == token {
+		t.Error("Made the same token twice")
+	}
+}
+
+func TestIsPersonalAccessToken(t *testing.T) {
+	jwt, err := MakeJWT(uuid.New(), NewKeySet(NewHMACKey([]byte("secret"))), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if IsPersonalAccessToken(jwt) {
+		t.Errorf("Took the JWT %q for a personal access token", jwt)
+	}
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTPVectors(t *testing.T) {
+	// RFC 6238 appendix B
+	seeds := map[string]struct {
+		key     []byte
+		newHash func() hash.Hash
+	}{
+		"SHA1":   {[]byte("12345678901234567890"), sha1.New},
+		"SHA256": {[]byte("12345678901234567890123456789012"), sha256.New},
+		"SHA512": {[]byte("1234567890123456789012345678901234567890123456789012345678901234"), sha512.New},
+	}
+
+	tests := []struct {
+		unix int64
+		mode string
+		want string
+	}{
+		{59, "SHA1", "94287082"},
+		{59, "SHA256", "46119246"},
+		{59, "SHA512", "90693936"},
+		{1111111109, "SHA1", "07081804"},
+		{1111111109, "SHA256", "68084774"},
+		{1111111109, "SHA512", "25091201"},
+		{1111111111, "SHA1", "14050471"},
+		{1111111111, "SHA256", "67062674"},
+		{1111111111, "SHA512", "99943326"},
+		{1234567890, "SHA1", "89005924"},
+		{1234567890, "SHA256", "91819424"},
+		{1234567890, "SHA512", "93441116"},
+		{2000000000, "SHA1", "69279037"},
+		{2000000000, "SHA256", "90698825"},
+		{2000000000, "SHA512", "38618901"},
+		{20000000000, "SHA1", "65353130"},
+		{20000000000, "SHA256", "77737706"},
+		{20000000000, "SHA512", "47863826"},
+	}
+
+	for _, tt := range tests {
+		seed := seeds[tt.mode]
+		counter := tt.unix / int64(TOTPPeriod.Seconds())
+		if got := hotp(seed.key, counter, seed.newHash, 8); got != tt.want {
+			t.Errorf("TOTP %s at %d = %s, want %s", tt.mode, tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111109, 0)
+	// the SHA1 vector at this time, cut to the last 6 digits
+	code := "081804"
+
+	counter, err := ValidateTOTP(secret, code, now)
+	if err != nil {
+		t.Fatalf("ValidateTOTP() error = %v", err)
+	}
+	if want := int64(1111111109 / 30); counter != want {
+		t.Errorf("ValidateTOTP() counter = %d, want %d", counter, want)
+	}
+
+	if _, err := ValidateTOTP(secret, code, now.Add(TOTPPeriod)); err != nil {
+		t.Errorf("Code from the previous step rejected: %v", err)
+	}
+	if _, err := ValidateTOTP(secret, code, now.Add(3*TOTPPeriod)); err == nil {
+		t.Errorf("Code from three steps ago accepted")
+	}
+	if _, err := ValidateTOTP(secret, "000000", now); err == nil {
+		t.Errorf("Wrong code accepted")
+	}
+	if _, err := ValidateTOTP(strings.ToLower(secret), "081 804", now); err != nil {
+		t.Errorf("Lowercase secret or spaced code rejected: %v", err)
+	}
+}
@@ -13,27 +13,47 @@ import (
 	"github.com/google/uuid"
 )
 
-const createPlayer = `-- name: CreatePlayer :one
-INSERT INTO players (id, created_at, updated_at, username, email, hashed_password)
+const anonymizePlayer = `-- name: AnonymizePlayer :exec
+
+UPDATE players
+SET username = 'deleted-' || id::TEXT,
+    avatar = '008',
+    hashed_password = NULL,
+    display_name = 'Deleted player',
+    email = NULL,
+    email_verified = FALSE,
+    deleted_at = NOW(),
+    updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) AnonymizePlayer(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, anonymizePlayer, id)
+	return err
+}
+
+const createGuestPlayer = `-- name: CreateGuestPlayer :one
+
+INSERT INTO players (id, created_at, updated_at, username, display_name, is_guest, locale)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2,
-    $3
+    'Guest',
+    TRUE,
+    $2
 )
-RETURNING id, created_at, updated_at, username, avatar, hashed_password, display_name, google_id, email, email_verified
+RETURNING id, created_at, updated_at, username, avatar, hashed_password, display_name, email, email_verified, deleted_at, is_guest, locale, is_bot
 `
 
-type CreatePlayerParams struct {
-	Username       string
-	Email          sql.NullString
-	HashedPassword sql.NullString
+type CreateGuestPlayerParams struct {
+	Username string
+	Locale   string
 }
 
-func (q *Queries) CreatePlayer(ctx context.Context, arg CreatePlayerParams) (Player, error) {
-	row := q.db.QueryRowContext(ctx, createPlayer, arg.Username, arg.Email, arg.HashedPassword)
+func (q *Queries) CreateGuestPlayer(ctx context.Context, arg CreateGuestPlayerParams) (Player, error) {
+	row := q.db.QueryRowContext(ctx, createGuestPlayer, arg.Username, arg.Locale)
 	var i Player
 	err := row.Scan(
 		&i.ID,
@@ -43,16 +63,19 @@ func (q *Queries) CreatePlayer(ctx context.Context, arg CreatePlayerParams) (Pla
 		&i.Avatar,
 		&i.HashedPassword,
 		&i.DisplayName,
-		&i.GoogleID,
 		&i.Email,
 		&i.EmailVerified,
+		&i.DeletedAt,
+		&i.IsGuest,
+		&i.Locale,
+		&i.IsBot,
 	)
 	return i, err
 }
 
-const createPlayerWithGoogle = `-- name: CreatePlayerWithGoogle :one
+const createOAuthPlayer = `-- name: CreateOAuthPlayer :one
 
-INSERT INTO players (id, created_at, updated_at, username, google_id, email, display_name, email_verified)
+INSERT INTO players (id, created_at, updated_at, username, email, display_name, email_verified, locale)
 VALUES (
     gen_random_uuid(),
     NOW(),
@@ -61,24 +84,26 @@ VALUES (
     $2,
     $3,
     $4,
-    TRUE
+    $5
 )
-RETURNING id, created_at, updated_at, username, avatar, hashed_password, display_name, google_id, email, email_verified
+RETURNING id, created_at, updated_at, username, avatar, hashed_password, display_name, email, email_verified, deleted_at, is_guest, locale, is_bot
 `
 
-type CreatePlayerWithGoogleParams struct {
-	Username    string
-	GoogleID    sql.NullString
-	Email       sql.NullString
-	DisplayName sql.NullString
+type CreateOAuthPlayerParams struct {
+	Username      string
+	Email         sql.NullString
+	DisplayName   sql.NullString
+	EmailVerified sql.NullBool
+	Locale        string
 }
 
-func (q *Queries) CreatePlayerWithGoogle(ctx context.Context, arg CreatePlayerWithGoogleParams) (Player, error) {
-	row := q.db.QueryRowContext(ctx, createPlayerWithGoogle,
+func (q *Queries) CreateOAuthPlayer(ctx context.Context, arg CreateOAuthPlayerParams) (Player, error) {
+	row := q.db.QueryRowContext(ctx, createOAuthPlayer,
 		arg.Username,
-		arg.GoogleID,
 		arg.Email,
 		arg.DisplayName,
+		arg.EmailVerified,
+		arg.Locale,
 	)
 	var i Player
 	err := row.Scan(
@@ -89,21 +114,44 @@ func (q *Queries) CreatePlayerWithGoogle(ctx context.Context, arg CreatePlayerWi
 		&i.Avatar,
 		&i.HashedPassword,
 		&i.DisplayName,
-		&i.GoogleID,
 		&i.Email,
 		&i.EmailVerified,
+		&i.DeletedAt,
+		&i.IsGuest,
+		&i.Locale,
+		&i.IsBot,
 	)
 	return i, err
 }
 
-const getPlayerByEmail = `-- name: GetPlayerByEmail :one
-
-SELECT id, created_at, updated_at, username, avatar, hashed_password, display_name, google_id, email, email_verified FROM players
-WHERE email = $1
+const createPlayer = `-- name: CreatePlayer :one
+INSERT INTO players (id, created_at, updated_at, username, email, hashed_password, locale)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4
+)
+RETURNING id, created_at, updated_at, username, avatar, hashed_password, display_name, email, email_verified, deleted_at, is_guest, locale, is_bot
 `
 
-func (q *Queries) GetPlayerByEmail(ctx context.Context, email sql.NullString) (Player, error) {
-	row := q.db.QueryRowContext(ctx, getPlayerByEmail, email)
+type CreatePlayerParams struct {
+	Username       string
+	Email          sql.NullString
+	HashedPassword sql.NullString
+	Locale         string
+}
+
+func (q *Queries) CreatePlayer(ctx context.Context, arg CreatePlayerParams) (Player, error) {
+	row := q.db.QueryRowContext(ctx, createPlayer,
+		arg.Username,
+		arg.Email,
+		arg.HashedPassword,
+		arg.Locale,
+	)
 	var i Player
 	err := row.Scan(
 		&i.ID,
@@ -113,21 +161,24 @@ func (q *Queries) GetPlayerByEmail(ctx context.Context, email sql.NullString) (P
 		&i.Avatar,
 		&i.HashedPassword,
 		&i.DisplayName,
-		&i.GoogleID,
 		&i.Email,
 		&i.EmailVerified,
+		&i.DeletedAt,
+		&i.IsGuest,
+		&i.Locale,
+		&i.IsBot,
 	)
 	return i, err
 }
 
-const getPlayerByGoogleId = `-- name: GetPlayerByGoogleId :one
+const getPlayerByEmail = `-- name: GetPlayerByEmail :one
 
-SELECT id, created_at, updated_at, username, avatar, hashed_password, display_name, google_id, email, email_verified FROM players
-WHERE google_id = $1
+SELECT id, created_at, updated_at, username, avatar, hashed_password, display_name, email, email_verified, deleted_at, is_guest, locale, is_bot FROM players
+WHERE email = $1
 `
 
-func (q *Queries) GetPlayerByGoogleId(ctx context.Context, googleID sql.NullString) (Player, error) {
-	row := q.db.QueryRowContext(ctx, getPlayerByGoogleId, googleID)
+func (q *Queries) GetPlayerByEmail(ctx context.Context, email sql.NullString) (Player, error) {
+	row := q.db.QueryRowContext(ctx, getPlayerByEmail, email)
 	var i Player
 	err := row.Scan(
 		&i.ID,
@@ -137,16 +188,19 @@ func (q *Queries) GetPlayerByGoogleId(ctx context.Context, googleID sql.NullStri
 		&i.Avatar,
 		&i.HashedPassword,
 		&i.DisplayName,
-		&i.GoogleID,
 		&i.Email,
 		&i.EmailVerified,
+		&i.DeletedAt,
+		&i.IsGuest,
+		&i.Locale,
+		&i.IsBot,
 	)
 	return i, err
 }
 
 const getPlayerByPlayerId = `-- name: GetPlayerByPlayerId :one
 
-SELECT id, created_at, updated_at, username, avatar, hashed_password, display_name, google_id, email, email_verified FROM players
+SELECT id, created_at, updated_at, username, avatar, hashed_password, display_name, email, email_verified, deleted_at, is_guest, locale, is_bot FROM players
 WHERE id = $1
 `
 
@@ -161,16 +215,19 @@ func (q *Queries) GetPlayerByPlayerId(ctx context.Context, id uuid.UUID) (Player
 		&i.Avatar,
 		&i.HashedPassword,
 		&i.DisplayName,
-		&i.GoogleID,
 		&i.Email,
 		&i.EmailVerified,
+		&i.DeletedAt,
+		&i.IsGuest,
+		&i.Locale,
+		&i.IsBot,
 	)
 	return i, err
 }
 
 const getPlayerByRefreshToken = `-- name: GetPlayerByRefreshToken :one
 
-SELECT id, players.created_at, players.updated_at, username, avatar, hashed_password, display_name, google_id, email, email_verified, token, refresh_tokens.created_at, refresh_tokens.updated_at, player_id, expires_at, revoked_at FROM players
+SELECT id, players.created_at, players.updated_at, username, avatar, hashed_password, display_name, email, email_verified, deleted_at, is_guest, locale, is_bot, token, refresh_tokens.created_at, refresh_tokens.updated_at, player_id, expires_at, revoked_at, session_id FROM players
 LEFT JOIN refresh_tokens ON players.id = refresh_tokens.player_id
 WHERE refresh_tokens.token = $1
 `
@@ -183,15 +240,19 @@ type GetPlayerByRefreshTokenRow struct {
 	Avatar         sql.NullString
 	HashedPassword sql.NullString
 	DisplayName    sql.NullString
-	GoogleID       sql.NullString
 	Email          sql.NullString
 	EmailVerified  sql.NullBool
+	DeletedAt      sql.NullTime
+	IsGuest        bool
+	Locale         string
+	IsBot          bool
 	Token          sql.NullString
 	CreatedAt_2    sql.NullTime
 	UpdatedAt_2    sql.NullTime
 	PlayerID       uuid.NullUUID
 	ExpiresAt      sql.NullTime
 	RevokedAt      sql.NullTime
+	SessionID      uuid.NullUUID
 }
 
 func (q *Queries) GetPlayerByRefreshToken(ctx context.Context, token string) (GetPlayerByRefreshTokenRow, error) {
@@ -205,22 +266,26 @@ func (q *Queries) GetPlayerByRefreshToken(ctx context.Context, token string) (Ge
 		&i.Avatar,
 		&i.HashedPassword,
 		&i.DisplayName,
-		&i.GoogleID,
 		&i.Email,
 		&i.EmailVerified,
+		&i.DeletedAt,
+		&i.IsGuest,
+		&i.Locale,
+		&i.IsBot,
 		&i.Token,
 		&i.CreatedAt_2,
 		&i.UpdatedAt_2,
 		&i.PlayerID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.SessionID,
 	)
 	return i, err
 }
 
 const getPlayerByUsername = `-- name: GetPlayerByUsername :one
 
-SELECT id, created_at, updated_at, username, avatar, hashed_password, display_name, google_id, email, email_verified FROM players
+SELECT id, created_at, updated_at, username, avatar, hashed_password, display_name, email, email_verified, deleted_at, is_guest, locale, is_bot FROM players
 WHERE username = $1
 `
 
@@ -235,13 +300,150 @@ func (q *Queries) GetPlayerByUsername(ctx context.Context, username string) (Pla
 		&i.Avatar,
 		&i.HashedPassword,
 		&i.DisplayName,
-		&i.GoogleID,
 		&i.Email,
 		&i.EmailVerified,
+		&i.DeletedAt,
+		&i.IsGuest,
+		&i.Locale,
+		&i.IsBot,
 	)
 	return i, err
 }
 
+const isActivePlayer = `-- name: IsActivePlayer :one
+
+SELECT EXISTS (
+    SELECT 1 FROM players
+    WHERE id = $1 AND deleted_at IS NULL
+)
+`
+
+func (q *Queries) IsActivePlayer(ctx context.Context, id uuid.UUID) (bool, error) {
+	row := q.db.QueryRowContext(ctx, isActivePlayer, id)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const searchPlayersByUsername = `-- name: SearchPlayersByUsername :many
+
+SELECT id, created_at, updated_at, username, avatar, hashed_password, display_name, email, email_verified, deleted_at, is_guest, locale, is_bot FROM players
+WHERE username ILIKE $1 AND id <> $2 AND deleted_at IS NULL AND NOT is_guest
+ORDER BY username
+LIMIT $3
+`
+
+type SearchPlayersByUsernameParams struct {
+	Username string
+	ID       uuid.UUID
+	Limit    int32
+}
+
+func (q *Queries) SearchPlayersByUsername(ctx context.Context, arg SearchPlayersByUsernameParams) ([]Player, error) {
+	rows, err := q.db.QueryContext(ctx, searchPlayersByUsername, arg.Username, arg.ID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Player
+	for rows.Next() {
+		var i Player
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Username,
+			&i.Avatar,
+			&i.HashedPassword,
+			&i.DisplayName,
+			&i.Email,
+			&i.EmailVerified,
+			&i.DeletedAt,
+			&i.IsGuest,
+			&i.Locale,
+			&i.IsBot,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setPlayerBot = `-- name: SetPlayerBot :exec
+
+UPDATE players
+SET is_bot = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type SetPlayerBotParams struct {
+	ID    uuid.UUID
+	IsBot bool
+}
+
+func (q *Queries) SetPlayerBot(ctx context.Context, arg SetPlayerBotParams) error {
+	_, err := q.db.ExecContext(ctx, setPlayerBot, arg.ID, arg.IsBot)
+	return err
+}
+
+const updatePlayerEmail = `-- name: UpdatePlayerEmail :exec
+
+UPDATE players
+SET email = $2, email_verified = TRUE, updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdatePlayerEmailParams struct {
+	ID    uuid.UUID
+	Email sql.NullString
+}
+
+func (q *Queries) UpdatePlayerEmail(ctx context.Context, arg UpdatePlayerEmailParams) error {
+	_, err := q.db.ExecContext(ctx, updatePlayerEmail, arg.ID, arg.Email)
+	return err
+}
+
+const updatePlayerLocale = `-- name: UpdatePlayerLocale :exec
+
+UPDATE players
+SET locale = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdatePlayerLocaleParams struct {
+	ID     uuid.UUID
+	Locale string
+}
+
+func (q *Queries) UpdatePlayerLocale(ctx context.Context, arg UpdatePlayerLocaleParams) error {
+	_, err := q.db.ExecContext(ctx, updatePlayerLocale, arg.ID, arg.Locale)
+	return err
+}
+
+const updatePlayerPassword = `-- name: UpdatePlayerPassword :exec
+
+UPDATE players
+SET hashed_password = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdatePlayerPasswordParams struct {
+	ID             uuid.UUID
+	HashedPassword sql.NullString
+}
+
+func (q *Queries) UpdatePlayerPassword(ctx context.Context, arg UpdatePlayerPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updatePlayerPassword, arg.ID, arg.HashedPassword)
+	return err
+}
+
 const updateProfile = `-- name: UpdateProfile :exec
 
 UPDATE players
@@ -260,6 +462,97 @@ func (q *Queries) UpdateProfile(ctx context.Context, arg UpdateProfileParams) er
 	return err
 }
 
+const upgradeGuestPlayer = `-- name: UpgradeGuestPlayer :one
+
+UPDATE players
+SET username = $2,
+    email = $3,
+    hashed_password = $4,
+    email_verified = FALSE,
+    is_guest = FALSE,
+    updated_at = NOW()
+WHERE id = $1 AND is_guest
+RETURNING id, created_at, updated_at, username, avatar, hashed_password, display_name, email, email_verified, deleted_at, is_guest, locale, is_bot
+`
+
+type UpgradeGuestPlayerParams struct {
+	ID             uuid.UUID
+	Username       string
+	Email          sql.NullString
+	HashedPassword sql.NullString
+}
+
+func (q *Queries) UpgradeGuestPlayer(ctx context.Context, arg UpgradeGuestPlayerParams) (Player, error) {
+	row := q.db.QueryRowContext(ctx, upgradeGuestPlayer,
+		arg.ID,
+		arg.Username,
+		arg.Email,
+		arg.HashedPassword,
+	)
+	var i Player
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Username,
+		&i.Avatar,
+		&i.HashedPassword,
+		&i.DisplayName,
+		&i.Email,
+		&i.EmailVerified,
+		&i.DeletedAt,
+		&i.IsGuest,
+		&i.Locale,
+		&i.IsBot,
+	)
+	return i, err
+}
+
+const upgradeGuestWithOAuth = `-- name: UpgradeGuestWithOAuth :one
+
+UPDATE players
+SET email = $2,
+    display_name = COALESCE($4, display_name),
+    email_verified = $3,
+    is_guest = FALSE,
+    updated_at = NOW()
+WHERE id = $1 AND is_guest
+RETURNING id, created_at, updated_at, username, avatar, hashed_password, display_name, email, email_verified, deleted_at, is_guest, locale, is_bot
+`
+
+type UpgradeGuestWithOAuthParams struct {
+	ID            uuid.UUID
+	Email         sql.NullString
+	EmailVerified sql.NullBool
+	DisplayName   sql.NullString
+}
+
+func (q *Queries) UpgradeGuestWithOAuth(ctx context.Context, arg UpgradeGuestWithOAuthParams) (Player, error) {
+	row := q.db.QueryRowContext(ctx, upgradeGuestWithOAuth,
+		arg.ID,
+		arg.Email,
+		arg.EmailVerified,
+		arg.DisplayName,
+	)
+	var i Player
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Username,
+		&i.Avatar,
+		&i.HashedPassword,
+		&i.DisplayName,
+		&i.Email,
+		&i.EmailVerified,
+		&i.DeletedAt,
+		&i.IsGuest,
+		&i.Locale,
+		&i.IsBot,
+	)
+	return i, err
+}
+
 const verifyPlayerEmail = `-- name: VerifyPlayerEmail :exec
 
 UPDATE players
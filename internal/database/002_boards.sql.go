@@ -40,6 +40,17 @@ func (q *Queries) CreateBoard(ctx context.Context, playerID uuid.UUID) (Board, e
 	return i, err
 }
 
+const deleteBoard = `-- name: DeleteBoard :exec
+
+DELETE FROM boards
+WHERE id = $1
+`
+
+func (q *Queries) DeleteBoard(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteBoard, id)
+	return err
+}
+
 const getBoardById = `-- name: GetBoardById :one
 
 SELECT id, created_at, updated_at, board, player_id, game_id, score FROM boards
@@ -87,6 +98,44 @@ func (q *Queries) GetBoardByPlayerIdAndGameId(ctx context.Context, arg GetBoardB
 	return i, err
 }
 
+const getBoardsByPlayerId = `-- name: GetBoardsByPlayerId :many
+
+SELECT id, created_at, updated_at, board, player_id, game_id, score FROM boards
+WHERE player_id = $1
+ORDER BY created_at
+`
+
+func (q *Queries) GetBoardsByPlayerId(ctx context.Context, playerID uuid.UUID) ([]Board, error) {
+	rows, err := q.db.QueryContext(ctx, getBoardsByPlayerId, playerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Board
+	for rows.Next() {
+		var i Board
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Board,
+			&i.PlayerID,
+			&i.GameID,
+			&i.Score,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getPlayerUsernameByBoardId = `-- name: GetPlayerUsernameByBoardId :one
 
 SELECT players.username
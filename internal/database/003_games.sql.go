@@ -7,30 +7,166 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const claimTurnReminders = `-- name: ClaimTurnReminders :many
+
+UPDATE games
+SET reminder_sent_at = NOW()
+FROM boards, players
+WHERE games.id IN (
+    SELECT due.id FROM games due
+    LEFT JOIN notification_preferences ON notification_preferences.player_id = due.player_turn
+    WHERE due.turn_timeout_seconds IS NOT NULL
+      AND due.winner IS NULL
+      AND due.reminder_sent_at IS NULL
+      AND due.turn_started_at + make_interval(secs => LEAST($1::FLOAT8, due.turn_timeout_seconds / 2.0)) <= NOW()
+      AND COALESCE(notification_preferences.turn_reminders, TRUE)
+    LIMIT $2
+    FOR UPDATE OF due SKIP LOCKED
+)
+  AND boards.id IN (games.board1, games.board2)
+  AND boards.player_id != games.player_turn
+  AND players.id = boards.player_id
+RETURNING games.id, games.player_turn, games.turn_started_at, games.turn_timeout_seconds, players.username AS opponent_username, players.display_name AS opponent_display_name
+`
+
+type ClaimTurnRemindersParams struct {
+	RemindAfter float64
+	BatchSize   int32
+}
+
+type ClaimTurnRemindersRow struct {
+	ID                  uuid.UUID
+	PlayerTurn          uuid.NullUUID
+	TurnStartedAt       sql.NullTime
+	TurnTimeoutSeconds  sql.NullInt32
+	OpponentUsername    string
+	OpponentDisplayName sql.NullString
+}
+
+func (q *Queries) ClaimTurnReminders(ctx context.Context, arg ClaimTurnRemindersParams) ([]ClaimTurnRemindersRow, error) {
+	rows, err := q.db.QueryContext(ctx, claimTurnReminders, arg.RemindAfter, arg.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ClaimTurnRemindersRow
+	for rows.Next() {
+		var i ClaimTurnRemindersRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.PlayerTurn,
+			&i.TurnStartedAt,
+			&i.TurnTimeoutSeconds,
+			&i.OpponentUsername,
+			&i.OpponentDisplayName,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const countActiveCorrespondenceGames = `-- name: CountActiveCorrespondenceGames :one
+
+SELECT COUNT(*) FROM games
+JOIN boards ON boards.id IN (games.board1, games.board2)
+WHERE boards.player_id = $1
+  AND games.turn_timeout_seconds IS NOT NULL
+  AND games.winner IS NULL
+`
+
+func (q *Queries) CountActiveCorrespondenceGames(ctx context.Context, playerID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countActiveCorrespondenceGames, playerID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createNewGame = `-- name: CreateNewGame :one
-INSERT INTO games(id, created_at, updated_at, board1, board2)
+INSERT INTO games(id, created_at, updated_at, board1, board2, turn_timeout_seconds)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3
 )
-RETURNING id, created_at, updated_at, board1, board2, winner, player_turn
+RETURNING id, created_at, updated_at, board1, board2, winner, player_turn, event_seq, last_roll, is_private, invited_player, invite_code_hash, turn_timeout_seconds, turn_started_at, reminder_sent_at
 `
 
 type CreateNewGameParams struct {
-	Board1 uuid.UUID
-	Board2 uuid.NullUUID
+	Board1             uuid.UUID
+	Board2             uuid.NullUUID
+	TurnTimeoutSeconds sql.NullInt32
 }
 
 func (q *Queries) CreateNewGame(ctx context.Context, arg CreateNewGameParams) (Game, error) {
-	row := q.db.QueryRowContext(ctx, createNewGame, arg.Board1, arg.Board2)
+	row := q.db.QueryRowContext(ctx, createNewGame, arg.Board1, arg.Board2, arg.TurnTimeoutSeconds)
+	var i Game
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Board1,
+		&i.Board2,
+		&i.Winner,
+		&i.PlayerTurn,
+		&i.EventSeq,
+		&i.LastRoll,
+		&i.IsPrivate,
+		&i.InvitedPlayer,
+		&i.InviteCodeHash,
+		&i.TurnTimeoutSeconds,
+		&i.TurnStartedAt,
+		&i.ReminderSentAt,
+	)
+	return i, err
+}
+
+const createPrivateGame = `-- name: CreatePrivateGame :one
+
+INSERT INTO games(id, created_at, updated_at, board1, is_private, invited_player, invite_code_hash, turn_timeout_seconds)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    TRUE,
+    $2,
+    $3,
+    $4
+)
+RETURNING id, created_at, updated_at, board1, board2, winner, player_turn, event_seq, last_roll, is_private, invited_player, invite_code_hash, turn_timeout_seconds, turn_started_at, reminder_sent_at
+`
+
+type CreatePrivateGameParams struct {
+	Board1             uuid.UUID
+	InvitedPlayer      uuid.NullUUID
+	InviteCodeHash     sql.NullString
+	TurnTimeoutSeconds sql.NullInt32
+}
+
+func (q *Queries) CreatePrivateGame(ctx context.Context, arg CreatePrivateGameParams) (Game, error) {
+	row := q.db.QueryRowContext(ctx, createPrivateGame,
+		arg.Board1,
+		arg.InvitedPlayer,
+		arg.InviteCodeHash,
+		arg.TurnTimeoutSeconds,
+	)
 	var i Game
 	err := row.Scan(
 		&i.ID,
@@ -40,10 +176,39 @@ func (q *Queries) CreateNewGame(ctx context.Context, arg CreateNewGameParams) (G
 		&i.Board2,
 		&i.Winner,
 		&i.PlayerTurn,
+		&i.EventSeq,
+		&i.LastRoll,
+		&i.IsPrivate,
+		&i.InvitedPlayer,
+		&i.InviteCodeHash,
+		&i.TurnTimeoutSeconds,
+		&i.TurnStartedAt,
+		&i.ReminderSentAt,
 	)
 	return i, err
 }
 
+const declineGameInvite = `-- name: DeclineGameInvite :execrows
+
+DELETE FROM games
+WHERE id = $1
+  AND invited_player = $2
+  AND board2 IS NULL
+`
+
+type DeclineGameInviteParams struct {
+	ID            uuid.UUID
+	InvitedPlayer uuid.NullUUID
+}
+
+func (q *Queries) DeclineGameInvite(ctx context.Context, arg DeclineGameInviteParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, declineGameInvite, arg.ID, arg.InvitedPlayer)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const deleteEmptyBoardsForPlayer = `-- name: DeleteEmptyBoardsForPlayer :exec
 
 DELETE FROM games
@@ -58,9 +223,104 @@ func (q *Queries) DeleteEmptyBoardsForPlayer(ctx context.Context, playerID uuid.
 	return err
 }
 
+const deleteEmptyPublicGamesForPlayer = `-- name: DeleteEmptyPublicGamesForPlayer :exec
+
+DELETE FROM games
+USING boards
+WHERE games.board1 = boards.id
+  AND boards.player_id = $1
+  AND games.board2 IS NULL
+  AND NOT games.is_private
+  AND games.turn_timeout_seconds IS NULL
+`
+
+func (q *Queries) DeleteEmptyPublicGamesForPlayer(ctx context.Context, playerID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteEmptyPublicGamesForPlayer, playerID)
+	return err
+}
+
+const deleteGameInvite = `-- name: DeleteGameInvite :execrows
+
+DELETE FROM games
+USING boards
+WHERE games.id = $1
+  AND games.board1 = boards.id
+  AND boards.player_id = $2
+  AND games.is_private
+  AND games.board2 IS NULL
+`
+
+type DeleteGameInviteParams struct {
+	ID       uuid.UUID
+	PlayerID uuid.UUID
+}
+
+func (q *Queries) DeleteGameInvite(ctx context.Context, arg DeleteGameInviteParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteGameInvite, arg.ID, arg.PlayerID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteInvitesForPlayer = `-- name: DeleteInvitesForPlayer :exec
+
+DELETE FROM games
+WHERE invited_player = $1
+  AND board2 IS NULL
+`
+
+func (q *Queries) DeleteInvitesForPlayer(ctx context.Context, invitedPlayer uuid.NullUUID) error {
+	_, err := q.db.ExecContext(ctx, deleteInvitesForPlayer, invitedPlayer)
+	return err
+}
+
+const forfeitExpiredGames = `-- name: ForfeitExpiredGames :many
+
+UPDATE games
+SET winner = CASE WHEN b1.player_id = games.player_turn THEN b2.player_id ELSE b1.player_id END,
+    updated_at = NOW()
+FROM boards b1, boards b2
+WHERE games.board1 = b1.id
+  AND games.board2 = b2.id
+  AND games.turn_timeout_seconds IS NOT NULL
+  AND games.winner IS NULL
+  AND games.turn_started_at + make_interval(secs => games.turn_timeout_seconds) < NOW()
+RETURNING games.id, games.winner, games.player_turn
+`
+
+type ForfeitExpiredGamesRow struct {
+	ID         uuid.UUID
+	Winner     uuid.NullUUID
+	PlayerTurn uuid.NullUUID
+}
+
+func (q *Queries) ForfeitExpiredGames(ctx context.Context) ([]ForfeitExpiredGamesRow, error) {
+	rows, err := q.db.QueryContext(ctx, forfeitExpiredGames)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ForfeitExpiredGamesRow
+	for rows.Next() {
+		var i ForfeitExpiredGamesRow
+		if err := rows.Scan(&i.ID, &i.Winner, &i.PlayerTurn); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getGameById = `-- name: GetGameById :one
 
-SELECT id, created_at, updated_at, board1, board2, winner, player_turn FROM games
+SELECT id, created_at, updated_at, board1, board2, winner, player_turn, event_seq, last_roll, is_private, invited_player, invite_code_hash, turn_timeout_seconds, turn_started_at, reminder_sent_at FROM games
 WHERE id = $1
 `
 
@@ -75,10 +335,64 @@ func (q *Queries) GetGameById(ctx context.Context, id uuid.UUID) (Game, error) {
 		&i.Board2,
 		&i.Winner,
 		&i.PlayerTurn,
+		&i.EventSeq,
+		&i.LastRoll,
+		&i.IsPrivate,
+		&i.InvitedPlayer,
+		&i.InviteCodeHash,
+		&i.TurnTimeoutSeconds,
+		&i.TurnStartedAt,
+		&i.ReminderSentAt,
 	)
 	return i, err
 }
 
+const getGamesByPlayerId = `-- name: GetGamesByPlayerId :many
+
+SELECT id, created_at, updated_at, board1, board2, winner, player_turn, event_seq, last_roll, is_private, invited_player, invite_code_hash, turn_timeout_seconds, turn_started_at, reminder_sent_at FROM games
+WHERE id IN (SELECT game_id FROM boards WHERE player_id = $1)
+ORDER BY created_at
+`
+
+func (q *Queries) GetGamesByPlayerId(ctx context.Context, playerID uuid.UUID) ([]Game, error) {
+	rows, err := q.db.QueryContext(ctx, getGamesByPlayerId, playerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Game
+	for rows.Next() {
+		var i Game
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Board1,
+			&i.Board2,
+			&i.Winner,
+			&i.PlayerTurn,
+			&i.EventSeq,
+			&i.LastRoll,
+			&i.IsPrivate,
+			&i.InvitedPlayer,
+			&i.InviteCodeHash,
+			&i.TurnTimeoutSeconds,
+			&i.TurnStartedAt,
+			&i.ReminderSentAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getGamesWithPlayerId = `-- name: GetGamesWithPlayerId :many
 
 SELECT
@@ -88,7 +402,10 @@ SELECT
         WHEN b1.player_id = $1 THEN p2.display_name
         ELSE p1.display_name
     END::TEXT AS opponent_name,
-    g.winner AS winner_id
+    g.winner AS winner_id,
+    g.player_turn,
+    g.turn_timeout_seconds,
+    g.turn_started_at
 FROM games g
 JOIN boards b1 ON g.board1 = b1.id
 JOIN boards b2 ON g.board2 = b2.id
@@ -98,14 +415,18 @@ WHERE (b1.player_id = $1 OR b2.player_id = $1)
     AND (
         b1.board != '[[0, 0, 0], [0, 0, 0], [0, 0, 0]]'::jsonb
         OR b2.board != '[[0, 0, 0], [0, 0, 0], [0, 0, 0]]'::jsonb
+        OR g.turn_timeout_seconds IS NOT NULL
     )
 `
 
 type GetGamesWithPlayerIdRow struct {
-	GameID       uuid.UUID
-	Date         time.Time
-	OpponentName string
-	WinnerID     uuid.NullUUID
+	GameID             uuid.UUID
+	Date               time.Time
+	OpponentName       string
+	WinnerID           uuid.NullUUID
+	PlayerTurn         uuid.NullUUID
+	TurnTimeoutSeconds sql.NullInt32
+	TurnStartedAt      sql.NullTime
 }
 
 func (q *Queries) GetGamesWithPlayerId(ctx context.Context, playerID uuid.UUID) ([]GetGamesWithPlayerIdRow, error) {
@@ -122,6 +443,9 @@ func (q *Queries) GetGamesWithPlayerId(ctx context.Context, playerID uuid.UUID)
 			&i.Date,
 			&i.OpponentName,
 			&i.WinnerID,
+			&i.PlayerTurn,
+			&i.TurnTimeoutSeconds,
+			&i.TurnStartedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -136,11 +460,96 @@ func (q *Queries) GetGamesWithPlayerId(ctx context.Context, playerID uuid.UUID)
 	return items, nil
 }
 
-const joinGame = `-- name: JoinGame :exec
+const getPendingInvites = `-- name: GetPendingInvites :many
+
+SELECT games.id, games.created_at, players.id AS player_id, players.username, players.display_name, players.avatar
+FROM games
+JOIN boards ON games.board1 = boards.id
+JOIN players ON boards.player_id = players.id
+WHERE games.invited_player = $1
+  AND games.board2 IS NULL
+ORDER BY games.created_at DESC
+`
+
+type GetPendingInvitesRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	PlayerID    uuid.UUID
+	Username    string
+	DisplayName sql.NullString
+	Avatar      sql.NullString
+}
+
+func (q *Queries) GetPendingInvites(ctx context.Context, invitedPlayer uuid.NullUUID) ([]GetPendingInvitesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getPendingInvites, invitedPlayer)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPendingInvitesRow
+	for rows.Next() {
+		var i GetPendingInvitesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.PlayerID,
+			&i.Username,
+			&i.DisplayName,
+			&i.Avatar,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPlayerTurns = `-- name: GetPlayerTurns :many
+
+SELECT id, last_roll FROM games
+WHERE player_turn = $1 AND winner IS NULL AND board2 IS NOT NULL
+ORDER BY turn_started_at
+`
+
+type GetPlayerTurnsRow struct {
+	ID       uuid.UUID
+	LastRoll sql.NullInt32
+}
+
+func (q *Queries) GetPlayerTurns(ctx context.Context, playerTurn uuid.NullUUID) ([]GetPlayerTurnsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getPlayerTurns, playerTurn)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPlayerTurnsRow
+	for rows.Next() {
+		var i GetPlayerTurnsRow
+		if err := rows.Scan(&i.ID, &i.LastRoll); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const joinGame = `-- name: JoinGame :execrows
 
 UPDATE games
-SET board2 = $2, updated_at = NOW()
-WHERE id = $1
+SET board2 = $2, invite_code_hash = NULL, updated_at = NOW()
+WHERE id = $1 AND board2 IS NULL
 `
 
 type JoinGameParams struct {
@@ -148,9 +557,50 @@ type JoinGameParams struct {
 	Board2 uuid.NullUUID
 }
 
-func (q *Queries) JoinGame(ctx context.Context, arg JoinGameParams) error {
-	_, err := q.db.ExecContext(ctx, joinGame, arg.ID, arg.Board2)
-	return err
+func (q *Queries) JoinGame(ctx context.Context, arg JoinGameParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, joinGame, arg.ID, arg.Board2)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const nextGameEventSeq = `-- name: NextGameEventSeq :one
+
+UPDATE games
+SET event_seq = event_seq + 1
+WHERE id = $1
+RETURNING event_seq
+`
+
+func (q *Queries) NextGameEventSeq(ctx context.Context, id uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, nextGameEventSeq, id)
+	var event_seq int64
+	err := row.Scan(&event_seq)
+	return event_seq, err
+}
+
+const setBotRoll = `-- name: SetBotRoll :one
+
+UPDATE games
+SET last_roll = $2, updated_at = NOW()
+WHERE id = $1
+  AND winner IS NULL
+  AND last_roll IS NULL
+  AND player_turn IN (SELECT id FROM players WHERE is_bot)
+RETURNING player_turn
+`
+
+type SetBotRollParams struct {
+	ID       uuid.UUID
+	LastRoll sql.NullInt32
+}
+
+func (q *Queries) SetBotRoll(ctx context.Context, arg SetBotRollParams) (uuid.NullUUID, error) {
+	row := q.db.QueryRowContext(ctx, setBotRoll, arg.ID, arg.LastRoll)
+	var player_turn uuid.NullUUID
+	err := row.Scan(&player_turn)
+	return player_turn, err
 }
 
 const setGameWinner = `-- name: SetGameWinner :exec
@@ -169,10 +619,52 @@ func (q *Queries) SetGameWinner(ctx context.Context, arg SetGameWinnerParams) er
 	return err
 }
 
+const setLastRoll = `-- name: SetLastRoll :exec
+
+UPDATE games
+SET last_roll = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type SetLastRollParams struct {
+	ID       uuid.UUID
+	LastRoll sql.NullInt32
+}
+
+func (q *Queries) SetLastRoll(ctx context.Context, arg SetLastRollParams) error {
+	_, err := q.db.ExecContext(ctx, setLastRoll, arg.ID, arg.LastRoll)
+	return err
+}
+
+const setPlayerRoll = `-- name: SetPlayerRoll :execrows
+
+UPDATE games
+SET last_roll = $2, updated_at = NOW()
+WHERE id = $1
+  AND player_turn = $3
+  AND last_roll IS NULL
+  AND winner IS NULL
+  AND player_turn NOT IN (SELECT id FROM players WHERE is_bot)
+`
+
+type SetPlayerRollParams struct {
+	ID         uuid.UUID
+	LastRoll   sql.NullInt32
+	PlayerTurn uuid.NullUUID
+}
+
+func (q *Queries) SetPlayerRoll(ctx context.Context, arg SetPlayerRollParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setPlayerRoll, arg.ID, arg.LastRoll, arg.PlayerTurn)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const setPlayerTurn = `-- name: SetPlayerTurn :exec
 
 UPDATE games
-SET player_turn = $2, updated_at = NOW()
+SET player_turn = $2, turn_started_at = NOW(), reminder_sent_at = NULL, updated_at = NOW()
 WHERE id = $1
 `
 
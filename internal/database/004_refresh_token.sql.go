@@ -11,25 +11,42 @@ import (
 	"github.com/google/uuid"
 )
 
+const consumeRefreshToken = `-- name: ConsumeRefreshToken :execrows
+
+UPDATE refresh_tokens
+SET revoked_at = NOW() AT TIME ZONE 'UTC', updated_at = NOW() AT TIME ZONE 'UTC'
+WHERE token = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) ConsumeRefreshToken(ctx context.Context, token string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, consumeRefreshToken, token)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const createRefreshToken = `-- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (token, created_at, updated_at, player_id, expires_at)
+INSERT INTO refresh_tokens (token, created_at, updated_at, player_id, expires_at, session_id)
 VALUES (
     $1,
     NOW(),
     NOW(),
     $2,
-    NOW() AT TIME ZONE 'UTC' + INTERVAL '7 days'
+    NOW() AT TIME ZONE 'UTC' + INTERVAL '7 days',
+    $3
 )
-RETURNING token, created_at, updated_at, player_id, expires_at, revoked_at
+RETURNING token, created_at, updated_at, player_id, expires_at, revoked_at, session_id
 `
 
 type CreateRefreshTokenParams struct {
-	Token    string
-	PlayerID uuid.UUID
+	Token     string
+	PlayerID  uuid.UUID
+	SessionID uuid.UUID
 }
 
 func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, createRefreshToken, arg.Token, arg.PlayerID)
+	row := q.db.QueryRowContext(ctx, createRefreshToken, arg.Token, arg.PlayerID, arg.SessionID)
 	var i RefreshToken
 	err := row.Scan(
 		&i.Token,
@@ -38,6 +55,7 @@ func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshToken
 		&i.PlayerID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.SessionID,
 	)
 	return i, err
 }
@@ -53,14 +71,14 @@ func (q *Queries) DeleteRefreshToken(ctx context.Context, token string) error {
 	return err
 }
 
-const getRefreshTokenFromPlayerId = `-- name: GetRefreshTokenFromPlayerId :one
+const getUserFromRefreshToken = `-- name: GetUserFromRefreshToken :one
 
-SELECT token, created_at, updated_at, player_id, expires_at, revoked_at FROM refresh_tokens
-WHERE player_id = $1 AND (revoked_at != NULL OR expires_at >= NOW() AT TIME ZONE 'UTC')
+SELECT token, created_at, updated_at, player_id, expires_at, revoked_at, session_id FROM refresh_tokens
+WHERE token = $1
 `
 
-func (q *Queries) GetRefreshTokenFromPlayerId(ctx context.Context, playerID uuid.UUID) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, getRefreshTokenFromPlayerId, playerID)
+func (q *Queries) GetUserFromRefreshToken(ctx context.Context, token string) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, getUserFromRefreshToken, token)
 	var i RefreshToken
 	err := row.Scan(
 		&i.Token,
@@ -69,28 +87,21 @@ func (q *Queries) GetRefreshTokenFromPlayerId(ctx context.Context, playerID uuid
 		&i.PlayerID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.SessionID,
 	)
 	return i, err
 }
 
-const getUserFromRefreshToken = `-- name: GetUserFromRefreshToken :one
+const revokeAllRefreshTokensForPlayer = `-- name: RevokeAllRefreshTokensForPlayer :exec
 
-SELECT token, created_at, updated_at, player_id, expires_at, revoked_at FROM refresh_tokens
-WHERE token = $1
+UPDATE refresh_tokens
+SET revoked_at = NOW() AT TIME ZONE 'UTC', updated_at = NOW() AT TIME ZONE 'UTC'
+WHERE player_id = $1 AND revoked_at IS NULL
 `
 
-func (q *Queries) GetUserFromRefreshToken(ctx context.Context, token string) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, getUserFromRefreshToken, token)
-	var i RefreshToken
-	err := row.Scan(
-		&i.Token,
-		&i.CreatedAt,
-		&i.UpdatedAt,
-		&i.PlayerID,
-		&i.ExpiresAt,
-		&i.RevokedAt,
-	)
-	return i, err
+func (q *Queries) RevokeAllRefreshTokensForPlayer(ctx context.Context, playerID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeAllRefreshTokensForPlayer, playerID)
+	return err
 }
 
 const revokeRefreshToken = `-- name: RevokeRefreshToken :exec
@@ -104,3 +115,15 @@ func (q *Queries) RevokeRefreshToken(ctx context.Context, token string) error {
 	_, err := q.db.ExecContext(ctx, revokeRefreshToken, token)
 	return err
 }
+
+const revokeRefreshTokensForSession = `-- name: RevokeRefreshTokensForSession :exec
+
+UPDATE refresh_tokens
+SET revoked_at = NOW() AT TIME ZONE 'UTC', updated_at = NOW() AT TIME ZONE 'UTC'
+WHERE session_id = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeRefreshTokensForSession(ctx context.Context, sessionID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeRefreshTokensForSession, sessionID)
+	return err
+}
@@ -7,38 +7,63 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
 )
 
 const createVerificationToken = `-- name: CreateVerificationToken :one
-INSERT INTO verification_tokens (token_hash, player_id, expires_at, created_at)
+INSERT INTO verification_tokens (token_hash, player_id, expires_at, created_at, purpose, payload)
 VALUES (
     $1,
     $2,
-    NOW() AT TIME ZONE 'UTC' + INTERVAL '2 hours',
-    NOW() AT TIME ZONE 'UTC'
+    NOW() AT TIME ZONE 'UTC' + make_interval(mins => $3::INT),
+    NOW() AT TIME ZONE 'UTC',
+    $4,
+    $5
 )
-RETURNING token_hash, player_id, expires_at, created_at
+RETURNING token_hash, player_id, expires_at, created_at, purpose, payload
 `
 
 type CreateVerificationTokenParams struct {
-	TokenHash string
-	PlayerID  uuid.UUID
+	TokenHash        string
+	PlayerID         uuid.UUID
+	ExpiresInMinutes int32
+	Purpose          string
+	Payload          sql.NullString
 }
 
 func (q *Queries) CreateVerificationToken(ctx context.Context, arg CreateVerificationTokenParams) (VerificationToken, error) {
-	row := q.db.QueryRowContext(ctx, createVerificationToken, arg.TokenHash, arg.PlayerID)
+	row := q.db.QueryRowContext(ctx, createVerificationToken,
+		arg.TokenHash,
+		arg.PlayerID,
+		arg.ExpiresInMinutes,
+		arg.Purpose,
+		arg.Payload,
+	)
 	var i VerificationToken
 	err := row.Scan(
 		&i.TokenHash,
 		&i.PlayerID,
 		&i.ExpiresAt,
 		&i.CreatedAt,
+		&i.Purpose,
+		&i.Payload,
 	)
 	return i, err
 }
 
+const deleteAllVerificationTokensForPlayer = `-- name: DeleteAllVerificationTokensForPlayer :exec
+
+DELETE FROM verification_tokens
+WHERE player_id = $1
+`
+
+func (q *Queries) DeleteAllVerificationTokensForPlayer(ctx context.Context, playerID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteAllVerificationTokensForPlayer, playerID)
+	return err
+}
+
 const deleteVerificationToken = `-- name: DeleteVerificationToken :exec
 
 DELETE FROM verification_tokens
@@ -50,38 +75,105 @@ func (q *Queries) DeleteVerificationToken(ctx context.Context, tokenHash string)
 	return err
 }
 
+const deleteVerificationTokensForPlayer = `-- name: DeleteVerificationTokensForPlayer :exec
+
+DELETE FROM verification_tokens
+WHERE player_id = $1 AND purpose = $2
+`
+
+type DeleteVerificationTokensForPlayerParams struct {
+	PlayerID uuid.UUID
+	Purpose  string
+}
+
+func (q *Queries) DeleteVerificationTokensForPlayer(ctx context.Context, arg DeleteVerificationTokensForPlayerParams) error {
+	_, err := q.db.ExecContext(ctx, deleteVerificationTokensForPlayer, arg.PlayerID, arg.Purpose)
+	return err
+}
+
 const getVerificationToken = `-- name: GetVerificationToken :one
 
-SELECT token_hash, player_id, expires_at, created_at FROM verification_tokens
-WHERE token_hash = $1
+SELECT token_hash, player_id, expires_at, created_at, purpose, payload FROM verification_tokens
+WHERE token_hash = $1 AND purpose = $2
 `
 
-func (q *Queries) GetVerificationToken(ctx context.Context, tokenHash string) (VerificationToken, error) {
-	row := q.db.QueryRowContext(ctx, getVerificationToken, tokenHash)
+type GetVerificationTokenParams struct {
+	TokenHash string
+	Purpose   string
+}
+
+func (q *Queries) GetVerificationToken(ctx context.Context, arg GetVerificationTokenParams) (VerificationToken, error) {
+	row := q.db.QueryRowContext(ctx, getVerificationToken, arg.TokenHash, arg.Purpose)
 	var i VerificationToken
 	err := row.Scan(
 		&i.TokenHash,
 		&i.PlayerID,
 		&i.ExpiresAt,
 		&i.CreatedAt,
+		&i.Purpose,
+		&i.Payload,
 	)
 	return i, err
 }
 
 const getVerificationTokenByPlayerId = `-- name: GetVerificationTokenByPlayerId :one
 
-SELECT token_hash, player_id, expires_at, created_at FROM verification_tokens
-WHERE player_id = $1
+SELECT token_hash, player_id, expires_at, created_at, purpose, payload FROM verification_tokens
+WHERE player_id = $1 AND purpose = $2
 `
 
-func (q *Queries) GetVerificationTokenByPlayerId(ctx context.Context, playerID uuid.UUID) (VerificationToken, error) {
-	row := q.db.QueryRowContext(ctx, getVerificationTokenByPlayerId, playerID)
+type GetVerificationTokenByPlayerIdParams struct {
+	PlayerID uuid.UUID
+	Purpose  string
+}
+
+func (q *Queries) GetVerificationTokenByPlayerId(ctx context.Context, arg GetVerificationTokenByPlayerIdParams) (VerificationToken, error) {
+	row := q.db.QueryRowContext(ctx, getVerificationTokenByPlayerId, arg.PlayerID, arg.Purpose)
 	var i VerificationToken
 	err := row.Scan(
 		&i.TokenHash,
 		&i.PlayerID,
 		&i.ExpiresAt,
 		&i.CreatedAt,
+		&i.Purpose,
+		&i.Payload,
 	)
 	return i, err
 }
+
+const getVerificationTokensByPlayerId = `-- name: GetVerificationTokensByPlayerId :many
+
+SELECT token_hash, player_id, expires_at, created_at, purpose, payload FROM verification_tokens
+WHERE player_id = $1
+ORDER BY created_at
+`
+
+func (q *Queries) GetVerificationTokensByPlayerId(ctx context.Context, playerID uuid.UUID) ([]VerificationToken, error) {
+	rows, err := q.db.QueryContext(ctx, getVerificationTokensByPlayerId, playerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []VerificationToken
+	for rows.Next() {
+		var i VerificationToken
+		if err := rows.Scan(
+			&i.TokenHash,
+			&i.PlayerID,
+			&i.ExpiresAt,
+			&i.CreatedAt,
+			&i.Purpose,
+			&i.Payload,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
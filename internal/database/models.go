@@ -22,14 +22,86 @@ type Board struct {
 	Score     sql.NullInt32
 }
 
+type EmailOutbox struct {
+	ID            uuid.UUID
+	Recipient     string
+	Subject       string
+	Html          string
+	Text          string
+	Attempts      int32
+	NextAttemptAt time.Time
+	LastError     sql.NullString
+	CreatedAt     time.Time
+	SentAt        sql.NullTime
+	FailedAt      sql.NullTime
+}
+
+type Friendship struct {
+	RequesterID uuid.UUID
+	AddresseeID uuid.UUID
+	Status      string
+	CreatedAt   time.Time
+	AcceptedAt  sql.NullTime
+}
+
 type Game struct {
+	ID                 uuid.UUID
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+	Board1             uuid.UUID
+	Board2             uuid.NullUUID
+	Winner             uuid.NullUUID
+	PlayerTurn         uuid.NullUUID
+	EventSeq           int64
+	LastRoll           sql.NullInt32
+	IsPrivate          bool
+	InvitedPlayer      uuid.NullUUID
+	InviteCodeHash     sql.NullString
+	TurnTimeoutSeconds sql.NullInt32
+	TurnStartedAt      sql.NullTime
+	ReminderSentAt     sql.NullTime
+}
+
+type LoginFailure struct {
+	Key          string
+	Failures     int32
+	LastFailedAt time.Time
+}
+
+type Notification struct {
+	ID        uuid.UUID
+	PlayerID  uuid.UUID
+	Type      string
+	GameID    uuid.NullUUID
+	ActorID   uuid.NullUUID
+	CreatedAt time.Time
+	ReadAt    sql.NullTime
+}
+
+type NotificationPreference struct {
+	PlayerID      uuid.UUID
+	TurnReminders bool
+	UpdatedAt     time.Time
+}
+
+type OauthIdentity struct {
+	ID        uuid.UUID
+	PlayerID  uuid.UUID
+	Provider  string
+	Subject   string
+	Email     sql.NullString
+	CreatedAt time.Time
+}
+
+type PersonalAccessToken struct {
 	ID         uuid.UUID
+	PlayerID   uuid.UUID
+	Name       string
+	TokenHash  string
+	Scopes     []string
 	CreatedAt  time.Time
-	UpdatedAt  time.Time
-	Board1     uuid.UUID
-	Board2     uuid.NullUUID
-	Winner     uuid.NullUUID
-	PlayerTurn uuid.NullUUID
+	LastUsedAt sql.NullTime
+	ExpiresAt  sql.NullTime
 }
 
 type Player struct {
@@ -40,9 +112,52 @@ type Player struct {
 	Avatar         sql.NullString
 	HashedPassword sql.NullString
 	DisplayName    sql.NullString
-	GoogleID       sql.NullString
 	Email          sql.NullString
 	EmailVerified  sql.NullBool
+	DeletedAt      sql.NullTime
+	IsGuest        bool
+	Locale         string
+	IsBot          bool
+}
+
+type PlayerBlock struct {
+	BlockerID uuid.UUID
+	BlockedID uuid.UUID
+	CreatedAt time.Time
+}
+
+type PlayerReport struct {
+	ID         uuid.UUID
+	ReporterID uuid.UUID
+	ReportedID uuid.UUID
+	Reason     string
+	Details    string
+	GameID     uuid.NullUUID
+	CreatedAt  time.Time
+	ResolvedAt sql.NullTime
+}
+
+type PlayerTotp struct {
+	PlayerID    uuid.UUID
+	Secret      string
+	CreatedAt   time.Time
+	ConfirmedAt sql.NullTime
+	LastCounter int64
+}
+
+type RateLimitBucket struct {
+	Key       string
+	Tokens    float64
+	Allowed   bool
+	UpdatedAt time.Time
+}
+
+type RecoveryCode struct {
+	ID        uuid.UUID
+	PlayerID  uuid.UUID
+	CodeHash  string
+	CreatedAt time.Time
+	UsedAt    sql.NullTime
 }
 
 type RefreshToken struct {
@@ -52,6 +167,18 @@ type RefreshToken struct {
 	PlayerID  uuid.UUID
 	ExpiresAt time.Time
 	RevokedAt sql.NullTime
+	SessionID uuid.UUID
+}
+
+type Session struct {
+	ID         uuid.UUID
+	PlayerID   uuid.UUID
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+	UserAgent  string
+	Ip         string
+	RevokedAt  sql.NullTime
 }
 
 type VerificationToken struct {
@@ -59,4 +186,29 @@ type VerificationToken struct {
 	PlayerID  uuid.UUID
 	ExpiresAt time.Time
 	CreatedAt time.Time
+	Purpose   string
+	Payload   sql.NullString
+}
+
+type Webhook struct {
+	ID        uuid.UUID
+	PlayerID  uuid.NullUUID
+	Url       string
+	Secret    string
+	Events    []string
+	CreatedAt time.Time
+}
+
+type WebhookDelivery struct {
+	ID            uuid.UUID
+	WebhookID     uuid.UUID
+	Event         string
+	Payload       string
+	Attempts      int32
+	NextAttemptAt time.Time
+	LastStatus    sql.NullInt32
+	LastError     sql.NullString
+	CreatedAt     time.Time
+	DeliveredAt   sql.NullTime
+	FailedAt      sql.NullTime
 }
@@ -0,0 +1,239 @@
+// Package emails renders the transactional emails from the templates in
+// templates/, with their text taken from the catalog of the player's locale
+// in locales/.
+package emails
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/mailer"
+)
+
+// Names of the registered templates
+const (
+	Verification  = "verification"
+	PasswordReset = "password_reset"
+	EmailChange   = "email_change"
+	MagicLink     = "magic_link"
+	GameInvite    = "game_invite"
+	TurnReminder  = "turn_reminder"
+)
+
+const (
+	Brand = "Silly Mini Games"
+	// DefaultLocale is used for players without a supported locale, and for
+	// any text missing from the catalog of theirs
+	DefaultLocale  = "en"
+	deadlineLayout = "2006-01-02 15:04 UTC"
+)
+
+//go:embed templates locales
+var files embed.FS
+
+// Data fills in a template, each one uses the fields it needs
+type Data struct {
+	Link string
+	// how long Link works for, left out of the email when zero
+	ExpiresIn time.Duration
+	// the other player, who sent the invite or is waiting on a turn
+	Player   string
+	Deadline time.Time
+	// a link to stop getting emails like this one, left out when empty
+	UnsubscribeLink string
+}
+
+// view is what the templates execute with
+type view struct {
+	Data
+	Brand  string
+	Locale string
+}
+
+type emailTemplate struct {
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+type catalog map[string]string
+
+var (
+	registry = map[string]*emailTemplate{}
+	catalogs = map[string]catalog{}
+)
+
+func init() {
+	locales, err := files.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	for _, entry := range locales {
+		content, err := files.ReadFile(path.Join("locales", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		var messages catalog
+		if err = json.Unmarshal(content, &messages); err != nil {
+			panic(fmt.Sprintf("locales/%s: %v", entry.Name(), err))
+		}
+		catalogs[strings.TrimSuffix(entry.Name(), ".json")] = messages
+	}
+
+	for _, name := range []string{Verification, PasswordReset, EmailChange, MagicLink, GameInvite, TurnReminder} {
+		register(name)
+	}
+}
+
+// register parses the template of name into the HTML and text layouts. The
+// functions are replaced with ones for the locale on every render.
+func register(name string) {
+	funcs := translator{locale: DefaultLocale}.funcs()
+	content := "templates/" + name + ".tmpl"
+
+	registry[name] = &emailTemplate{
+		html: htmltemplate.Must(htmltemplate.New(name).Funcs(funcs).ParseFS(files, "templates/layout.html", content)),
+		text: texttemplate.Must(texttemplate.New(name).Funcs(funcs).ParseFS(files, "templates/layout.txt", content)),
+	}
+}
+
+// Names lists the registered templates
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Locales lists the locales emails can be sent in
+func Locales() []string {
+	locales := make([]string, 0, len(catalogs))
+	for locale := range catalogs {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Supported reports whether emails can be sent in locale
+func Supported(locale string) bool {
+	_, ok := catalogs[locale]
+	return ok
+}
+
+// MatchLocale picks the supported locale the client prefers most from an
+// Accept-Language header, or DefaultLocale when it prefers none of them
+func MatchLocale(acceptLanguage string) string {
+	best, bestWeight := DefaultLocale, 0.0
+	for _, entry := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(entry), ";")
+		weight := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			weight = parsed
+		}
+
+		// only the language is translated, not its regional variants
+		language, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if Supported(language) && weight > bestWeight {
+			best, bestWeight = language, weight
+		}
+	}
+	return best
+}
+
+// Render builds the email of the named template for the recipient, in their
+// locale when it's supported
+func Render(name, to, locale string, data Data) (mailer.Message, error) {
+	tmpl, ok := registry[name]
+	if !ok {
+		return mailer.Message{}, fmt.Errorf("no email template named %q", name)
+	}
+	if !Supported(locale) {
+		locale = DefaultLocale
+	}
+
+	funcs := translator{locale: locale}.funcs()
+	htmlTmpl, err := tmpl.html.Clone()
+	if err != nil {
+		return mailer.Message{}, err
+	}
+	textTmpl, err := tmpl.text.Clone()
+	if err != nil {
+		return mailer.Message{}, err
+	}
+	htmlTmpl.Funcs(funcs)
+	textTmpl.Funcs(funcs)
+
+	v := view{Data: data, Brand: Brand, Locale: locale}
+	var subject, html, text bytes.Buffer
+	if err = textTmpl.ExecuteTemplate(&subject, "subject", v); err != nil {
+		return mailer.Message{}, err
+	}
+	if err = htmlTmpl.ExecuteTemplate(&html, "layout.html", v); err != nil {
+		return mailer.Message{}, err
+	}
+	if err = textTmpl.ExecuteTemplate(&text, "layout.txt", v); err != nil {
+		return mailer.Message{}, err
+	}
+
+	return mailer.Message{
+		To:      to,
+		Subject: strings.TrimSpace(subject.String()),
+		HTML:    html.String(),
+		Text:    text.String(),
+	}, nil
+}
+
+// translator looks text up in the catalog of a locale
+type translator struct {
+	locale string
+}
+
+func (tr translator) funcs() map[string]any {
+	return map[string]any{
+		"t":        tr.translate,
+		"duration": tr.duration,
+		"date":     func(t time.Time) string { return t.UTC().Format(deadlineLayout) },
+	}
+}
+
+// translate formats the text of key with args, falling back to
+// DefaultLocale for text the locale doesn't have yet
+func (tr translator) translate(key string, args ...any) (string, error) {
+	for _, locale := range slices.Compact([]string{tr.locale, DefaultLocale}) {
+		if format, ok := catalogs[locale][key]; ok {
+			if len(args) == 0 {
+				return format, nil
+			}
+			return fmt.Sprintf(format, args...), nil
+		}
+	}
+	return "", fmt.Errorf("no text for %q", key)
+}
+
+// duration spells out d in whole hours, or in minutes when it isn't
+func (tr translator) duration(d time.Duration) (string, error) {
+	count, unit := int(d.Minutes()), "minute"
+	if d >= time.Hour && d%time.Hour == 0 {
+		count, unit = int(d.Hours()), "hour"
+	}
+	if count != 1 {
+		unit += "s"
+	}
+	return tr.translate("duration."+unit, count)
+}
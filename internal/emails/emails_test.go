@@ -0,0 +1,133 @@
+package emails
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files with the rendered emails")
+
+var goldenData = Data{
+	Link:            "https://example.com/action?token=abc123",
+	ExpiresIn:       2 * time.Hour,
+	Player:          "Arad",
+	Deadline:        time.Date(2025, time.March, 14, 18, 30, 0, 0, time.UTC),
+	UnsubscribeLink: "https://example.com/settings/notifications",
+}
+
+func TestRenderGolden(t *testing.T) {
+	for _, name := range Names() {
+		for _, locale := range Locales() {
+			t.Run(name+"/"+locale, func(t *testing.T) {
+				msg, err := Render(name, "player@example.com", locale, goldenData)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := "Subject: " + msg.Subject + "\n\n" + msg.Text + "\n\n---\n\n" + msg.HTML
+
+				golden := filepath.Join("testdata", name+"."+locale+".golden")
+				if *update {
+					if err = os.WriteFile(golden, []byte(got), 0o644); err != nil {
+						t.Fatal(err)
+					}
+				}
+				want, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatalf("%v, run the tests with -update to create it", err)
+				}
+				if got != string(want) {
+					t.Errorf("Rendered email differs from %s:\n%s", golden, got)
+				}
+			})
+		}
+	}
+}
+
+func TestCatalogsComplete(t *testing.T) {
+	for locale, messages := range catalogs {
+		for key := range catalogs[DefaultLocale] {
+			if _, ok := messages[key]; !ok {
+				t.Errorf("Locale %s has no text for %q", locale, key)
+			}
+		}
+	}
+}
+
+func TestRenderFallsBackToDefaultLocale(t *testing.T) {
+	msg, err := Render(Verification, "player@example.com", "xx", goldenData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Subject != "Verify your account" || msg.To != "player@example.com" {
+		t.Errorf("Got %q to %q, want the English email", msg.Subject, msg.To)
+	}
+}
+
+func TestRenderEscapesHTML(t *testing.T) {
+	data := goldenData
+	data.Player = `<script>alert("hi")</script>`
+
+	msg, err := Render(GameInvite, "player@example.com", DefaultLocale, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(msg.HTML, "<script>") {
+		t.Error("Player name was not escaped in the HTML")
+	}
+	if !strings.Contains(msg.Text, data.Player) || !strings.Contains(msg.Subject, data.Player) {
+		t.Error("Player name was escaped in the plain text")
+	}
+}
+
+func TestRenderWithoutOptionalFields(t *testing.T) {
+	msg, err := Render(MagicLink, "player@example.com", DefaultLocale, Data{Link: "https://example.com/magic-link?token=abc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(msg.Text, "expires") || strings.Contains(msg.Text, "Stop getting") {
+		t.Errorf("Got text with the optional lines:\n%s", msg.Text)
+	}
+}
+
+func TestRenderUnknownTemplate(t *testing.T) {
+	if _, err := Render("nope", "player@example.com", DefaultLocale, goldenData); err == nil {
+		t.Error("Rendered a template that doesn't exist")
+	}
+}
+
+func TestMatchLocale(t *testing.T) {
+	for header, want := range map[string]string{
+		"":                        "en",
+		"es":                      "es",
+		"es-MX,es;q=0.9,en;q=0.8": "es",
+		"en-US,en;q=0.9,es;q=0.8": "en",
+		"fr-FR,fr;q=0.9,es;q=0.5": "es",
+		"fr, de":                  "en",
+		"en;q=0.2, ES;q=0.7":      "es",
+		"es;q=0":                  "en",
+		"es;q=nonsense, en;q=0.1": "en",
+	} {
+		if got := MatchLocale(header); got != want {
+			t.Errorf("MatchLocale(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestDuration(t *testing.T) {
+	tr := translator{locale: "en"}
+	for d, want := range map[time.Duration]string{
+		time.Minute:      "1 minute",
+		15 * time.Minute: "15 minutes",
+		time.Hour:        "1 hour",
+		90 * time.Minute: "90 minutes",
+		48 * time.Hour:   "48 hours",
+	} {
+		if got, _ := tr.duration(d); got != want {
+			t.Errorf("duration(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package mailer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileOutbox writes every email as an .eml file to a directory instead of
+// sending it, for development and tests
+type FileOutbox struct {
+	dir  string
+	from string
+}
+
+func NewFileOutbox(dir, from string) (*FileOutbox, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileOutbox{
+		dir:  dir,
+		from: from,
+	}, nil
+}
+
+func (m *FileOutbox) Send(ctx context.Context, msg Message) error {
+	now := time.Now()
+	body, err := buildMessage(m.from, msg, now)
+	if err != nil {
+		return err
+	}
+
+	// named to sort in the order they were sent
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	name := now.UTC().Format("20060102T150405.000000000") + "-" + hex.EncodeToString(suffix) + ".eml"
+
+	// written under another name first so readers never see half a file
+	path := filepath.Join(m.dir, name)
+	if err = os.WriteFile(path+".tmp", body, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
@@ -0,0 +1,111 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Message is an email to a single recipient. Text is the plain-text
+// alternative of HTML and is left out when empty.
+type Message struct {
+	To      string
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// Mailer delivers emails, through a provider or wherever the backend puts
+// them
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// FromAddress is who the emails of the domain are sent as
+func FromAddress(domain string) string {
+	return fmt.Sprintf("Silly Mini Games <noreply@%s>", domain)
+}
+
+// buildMessage renders the message as RFC 5322 with a MIME body, as sent
+// over SMTP and written to .eml files
+func buildMessage(from string, msg Message, now time.Time) ([]byte, error) {
+	// a line break would let the value add headers of its own
+	if strings.ContainsAny(msg.To+msg.Subject, "\r\n") {
+		return nil, errors.New("header values can't contain line breaks")
+	}
+
+	var buf bytes.Buffer
+
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	header := textproto.MIMEHeader{}
+	header.Set("From", from)
+	header.Set("To", msg.To)
+	header.Set("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header.Set("Date", now.Format(time.RFC1123Z))
+	header.Set("Message-Id", fmt.Sprintf("<%s@sillyminigames>", hex.EncodeToString(id)))
+	header.Set("Mime-Version", "1.0")
+
+	if msg.Text == "" {
+		header.Set("Content-Type", `text/html; charset="utf-8"`)
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+		writeHeader(&buf, header)
+		if err := writeQuotedPrintable(&buf, msg.HTML); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	body := multipart.NewWriter(&buf)
+	header.Set("Content-Type", "multipart/alternative; boundary="+body.Boundary())
+	writeHeader(&buf, header)
+
+	// the last part is the one clients prefer
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain", msg.Text},
+		{"text/html", msg.HTML},
+	} {
+		w, err := body.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType + `; charset="utf-8"`},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err = writeQuotedPrintable(w, part.content); err != nil {
+			return nil, err
+		}
+	}
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeHeader(buf *bytes.Buffer, header textproto.MIMEHeader) {
+	for _, name := range []string{"From", "To", "Subject", "Date", "Message-Id", "Mime-Version", "Content-Type", "Content-Transfer-Encoding"} {
+		if value := header.Get(name); value != "" {
+			fmt.Fprintf(buf, "%s: %s\r\n", name, value)
+		}
+	}
+	buf.WriteString("\r\n")
+}
+
+func writeQuotedPrintable(w io.Writer, content string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(content)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
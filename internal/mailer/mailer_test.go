@@ -0,0 +1,205 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testMessage = Message{
+	To:      "player@example.com",
+	Subject: "Verify your account ✓",
+	HTML:    `<a href="https://example.com/verify?token=abc">Verify</a>`,
+	Text:    "Verify: https://example.com/verify?token=abc",
+}
+
+// parseMessage reads the parts of a built message by content type
+func parseMessage(t *testing.T, raw io.Reader) (*mail.Message, map[string]string) {
+	t.Helper()
+
+	msg, err := mail.ReadMessage(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := map[string]string{}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		body, _ := io.ReadAll(msg.Body)
+		parts[mediaType] = string(body)
+		return msg, parts
+	}
+
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return msg, parts
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		content, _ := io.ReadAll(part)
+		parts[partType] = string(content)
+	}
+}
+
+func TestFileOutbox(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+	outbox, err := NewFileOutbox(dir, FromAddress("example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = outbox.Send(context.Background(), testMessage); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(files) != 1 || !strings.HasSuffix(files[0], ".eml") {
+		t.Fatalf("Got files %v, want one .eml", files)
+	}
+	file, err := os.Open(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	msg, parts := parseMessage(t, file)
+	subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if subject != testMessage.Subject {
+		t.Errorf("Got subject %q, want %q", subject, testMessage.Subject)
+	}
+	if msg.Header.Get("To") != testMessage.To || msg.Header.Get("From") != "Silly Mini Games <noreply@example.com>" {
+		t.Errorf("Got headers %v", msg.Header)
+	}
+	if parts["text/plain"] != testMessage.Text || parts["text/html"] != testMessage.HTML {
+		t.Errorf("Got parts %q, want the text and HTML of the message", parts)
+	}
+}
+
+func TestBuildMessageHTMLOnly(t *testing.T) {
+	raw, err := buildMessage(FromAddress("example.com"), Message{To: "a@example.com", Subject: "Hi", HTML: "<p>Hi</p>"}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, parts := parseMessage(t, strings.NewReader(string(raw)))
+	if len(parts) != 1 || parts["text/html"] == "" {
+		t.Errorf("Got parts %q, want only HTML", parts)
+	}
+}
+
+func TestBuildMessageHeaderInjection(t *testing.T) {
+	for _, msg := range []Message{
+		{To: "a@example.com\r\nBcc: everyone@example.com", Subject: "Hi"},
+		{To: "a@example.com", Subject: "Hi\nBcc: everyone@example.com"},
+	} {
+		if _, err := buildMessage(FromAddress("example.com"), msg, time.Now()); err == nil {
+			t.Errorf("Message %q was built", msg.To+msg.Subject)
+		}
+	}
+}
+
+// fakeSMTPServer accepts a single message and passes on what it was sent
+func fakeSMTPServer(t *testing.T) (addr string, received chan string) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received = make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+		var transcript strings.Builder
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			command := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(command, "MAIL"), strings.HasPrefix(command, "RCPT"):
+				transcript.WriteString(strings.TrimSpace(line) + "\n")
+				reply("250 OK")
+			case command == "DATA":
+				reply("354 End data with <CR><LF>.<CR><LF>")
+				for {
+					data, err := r.ReadString('\n')
+					if err != nil || data == ".\r\n" {
+						break
+					}
+					transcript.WriteString(data)
+				}
+				reply("250 OK")
+			case command == "QUIT":
+				reply("221 Bye")
+				received <- transcript.String()
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+	return listener.Addr().String(), received
+}
+
+func TestSMTP(t *testing.T) {
+	addr, received := fakeSMTPServer(t)
+
+	m := NewSMTP(addr, "", "", FromAddress("example.com"))
+	if err := m.Send(context.Background(), testMessage); err != nil {
+		t.Fatal(err)
+	}
+
+	transcript := <-received
+	if !strings.Contains(transcript, "MAIL FROM:<noreply@example.com>") || !strings.Contains(transcript, "RCPT TO:<player@example.com>") {
+		t.Errorf("Got envelope:\n%s", transcript)
+	}
+
+	_, data, _ := strings.Cut(transcript, "RCPT TO:<player@example.com>\n")
+	_, parts := parseMessage(t, strings.NewReader(data))
+	if parts["text/plain"] != testMessage.Text {
+		t.Errorf("Got text %q, want %q", parts["text/plain"], testMessage.Text)
+	}
+}
+
+func TestSMTPUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	if err := NewSMTP(addr, "", "", FromAddress("example.com")).Send(context.Background(), testMessage); err == nil {
+		t.Error("Sent to a server that isn't there")
+	}
+}
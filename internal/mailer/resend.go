@@ -0,0 +1,31 @@
+package mailer
+
+import (
+	"context"
+
+	"github.com/resend/resend-go/v2"
+)
+
+// Resend sends through the Resend API
+type Resend struct {
+	client *resend.Client
+	from   string
+}
+
+func NewResend(apiKey, from string) *Resend {
+	return &Resend{
+		client: resend.NewClient(apiKey),
+		from:   from,
+	}
+}
+
+func (m *Resend) Send(ctx context.Context, msg Message) error {
+	_, err := m.client.Emails.SendWithContext(ctx, &resend.SendEmailRequest{
+		From:    m.from,
+		To:      []string{msg.To},
+		Subject: msg.Subject,
+		Html:    msg.HTML,
+		Text:    msg.Text,
+	})
+	return err
+}
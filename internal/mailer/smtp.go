@@ -0,0 +1,63 @@
+package mailer
+
+import (
+	"context"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"time"
+)
+
+// SMTP sends through a mail server, authenticating with PLAIN when a
+// username is set. net/smtp only sends credentials over TLS or to
+// localhost.
+type SMTP struct {
+	addr     string
+	username string
+	password string
+	from     string
+}
+
+func NewSMTP(addr, username, password, from string) *SMTP {
+	return &SMTP{
+		addr:     addr,
+		username: username,
+		password: password,
+		from:     from,
+	}
+}
+
+func (m *SMTP) Send(ctx context.Context, msg Message) error {
+	body, err := buildMessage(m.from, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	sender, err := mail.ParseAddress(m.from)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.username != "" {
+		host, _, err := net.SplitHostPort(m.addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", m.username, m.password, host)
+	}
+
+	// smtp.SendMail takes no context, the send is left to finish or fail
+	// on its own when the caller gives up
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(m.addr, auth, sender.Address, []string{msg.To}, body)
+	}()
+
+	select {
+	case err = <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,288 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// keys are fetched again after this long, providers rotate them
+	keysTTL = time.Hour
+	// a token with an unknown kid fetches the keys again, at most this often
+	minRefetchInterval = time.Minute
+	// clock drift allowed on exp, nbf and iat
+	leeway = time.Minute
+)
+
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// Provider is an OpenID Connect issuer players can login with
+type Provider struct {
+	Name     string `json:"name"`
+	Issuer   string `json:"issuer"`
+	ClientID string `json:"client_id"`
+	// found through the issuer's discovery document when empty
+	JWKSURL string `json:"jwks_url"`
+}
+
+// Claims are what an ID token says about the player
+type Claims struct {
+	Subject string
+	// empty unless the provider verified it
+	Email string
+	Name  string
+}
+
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Email string `json:"email"`
+	// some providers send it as a string
+	EmailVerified any    `json:"email_verified"`
+	GivenName     string `json:"given_name"`
+	Name          string `json:"name"`
+}
+
+// Verifier checks ID tokens of one provider against its published keys
+type Verifier struct {
+	Provider Provider
+	client   *http.Client
+
+	mux       sync.Mutex
+	jwksURL   string
+	keys      map[string]any
+	fetchedAt time.Time
+}
+
+func NewVerifier(provider Provider, client *http.Client) *Verifier {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Verifier{
+		Provider: provider,
+		client:   client,
+		jwksURL:  provider.JWKSURL,
+	}
+}
+
+// Verify checks the token's signature, issuer, audience and expiry
+func (v *Verifier) Verify(ctx context.Context, rawToken string) (Claims, error) {
+	claims := idTokenClaims{}
+	_, err := jwt.ParseWithClaims(rawToken, &claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return v.key(ctx, kid)
+	},
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithAudience(v.Provider.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(leeway),
+	)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	if !v.validIssuer(claims.Issuer) {
+		return Claims{}, fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+	if claims.Subject == "" {
+		return Claims{}, errors.New("ID token has no subject")
+	}
+
+	verified := Claims{
+		Subject: claims.Subject,
+		Name:    claims.GivenName,
+	}
+	if verified.Name == "" {
+		verified.Name = claims.Name
+	}
+	switch emailVerified := claims.EmailVerified.(type) {
+	case bool:
+		if emailVerified {
+			verified.Email = claims.Email
+		}
+	case string:
+		if emailVerified == "true" {
+			verified.Email = claims.Email
+		}
+	}
+	return verified, nil
+}
+
+// validIssuer also accepts the issuer without its scheme, Google signs
+// tokens with either
+func (v *Verifier) validIssuer(issuer string) bool {
+	return issuer == v.Provider.Issuer || "https://"+issuer == v.Provider.Issuer
+}
+
+func (v *Verifier) key(ctx context.Context, kid string) (any, error) {
+	v.mux.Lock()
+	defer v.mux.Unlock()
+
+	stale := time.Since(v.fetchedAt) > keysTTL
+	key, ok := v.keys[kid]
+	if ok && !stale {
+		return key, nil
+	}
+
+	// an unknown kid may be a key the provider just rotated in
+	if stale || time.Since(v.fetchedAt) > minRefetchInterval {
+		if err := v.fetchKeys(ctx); err != nil {
+			if ok {
+				return key, nil
+			}
+			return nil, err
+		}
+		if key, ok = v.keys[kid]; ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+// fetchKeys loads the provider's JWKS. The caller holds the lock.
+func (v *Verifier) fetchKeys(ctx context.Context) error {
+	if v.jwksURL == "" {
+		jwksURL, err := v.discover(ctx)
+		if err != nil {
+			return err
+		}
+		v.jwksURL = jwksURL
+	}
+
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := v.getJSON(ctx, v.jwksURL, &jwks); err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %v", err)
+	}
+
+	keys := make(map[string]any)
+	for _, k := range jwks.Keys {
+		if k.Use == "enc" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = key
+	}
+
+	v.keys = keys
+	v.fetchedAt = time.Now()
+	return nil
+}
+
+func (v *Verifier) discover(ctx context.Context) (string, error) {
+	var discovery struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	discoveryURL := strings.TrimSuffix(v.Provider.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := v.getJSON(ctx, discoveryURL, &discovery); err != nil {
+		return "", fmt.Errorf("failed to fetch discovery document: %v", err)
+	}
+	if discovery.Issuer != v.Provider.Issuer {
+		return "", fmt.Errorf("discovery document is for issuer %q", discovery.Issuer)
+	}
+	if discovery.JWKSURI == "" {
+		return "", errors.New("discovery document has no jwks_uri")
+	}
+	return discovery.JWKSURI, nil
+}
+
+func (v *Verifier) getJSON(ctx context.Context, url string, into any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	res, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %s", url, res.Status)
+	}
+	return json.NewDecoder(res.Body).Decode(into)
+}
+
+// jwk is a public key as JWKS publish them (RFC 7517)
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(bytes), nil
+}
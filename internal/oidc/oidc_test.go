@@ -0,0 +1,167 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/oidc/oidctest"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const clientID = "knucklebones"
+
+func TestVerify(t *testing.T) {
+	server := oidctest.NewServer(t)
+	verifier := NewVerifier(Provider{Name: "test", Issuer: server.Issuer, ClientID: clientID}, nil)
+
+	tests := []struct {
+		name      string
+		token     string
+		wantErr   bool
+		wantEmail string
+	}{
+		{
+			name:      "Valid token",
+			token:     server.IDToken("alice", clientID, nil),
+			wantEmail: "alice@example.com",
+		},
+		{
+			name:      "Email not verified",
+			token:     server.IDToken("alice", clientID, map[string]any{"email_verified": false}),
+			wantEmail: "",
+		},
+		{
+			name:      "Email verified as a string",
+			token:     server.IDToken("alice", clientID, map[string]any{"email_verified": "true"}),
+			wantEmail: "alice@example.com",
+		},
+		{
+			name:    "Another client's token",
+			token:   server.IDToken("alice", "someone-else", nil),
+			wantErr: true,
+		},
+		{
+			name:    "Another issuer",
+			token:   server.IDToken("alice", clientID, map[string]any{"iss": "https://evil.example.com"}),
+			wantErr: true,
+		},
+		{
+			name:    "Expired token",
+			token:   server.IDToken("alice", clientID, map[string]any{"exp": time.Now().Add(-time.Hour).Unix()}),
+			wantErr: true,
+		},
+		{
+			name:    "No expiry",
+			token:   server.IDToken("alice", clientID, map[string]any{"exp": nil}),
+			wantErr: true,
+		},
+		{
+			name:    "Garbage",
+			token:   "not.a.token",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := verifier.Verify(context.Background(), tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if claims.Subject != "alice" || claims.Email != tt.wantEmail || claims.Name != "Tester" {
+				t.Errorf("Verify() = %+v, want alice with email %q", claims, tt.wantEmail)
+			}
+		})
+	}
+}
+
+func TestVerifyKeyRotation(t *testing.T) {
+	server := oidctest.NewServer(t)
+	verifier := NewVerifier(Provider{Name: "test", Issuer: server.Issuer, ClientID: clientID}, nil)
+	ctx := context.Background()
+
+	if _, err := verifier.Verify(ctx, server.IDToken("alice", clientID, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.Verify(ctx, server.IDToken("alice", clientID, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if fetches := server.Fetches(); fetches != 1 {
+		t.Errorf("Got %d JWKS fetches, want the keys cached after the first", fetches)
+	}
+
+	// pretend the keys were fetched long enough ago to look again
+	server.Rotate()
+	verifier.fetchedAt = time.Now().Add(-2 * minRefetchInterval)
+	if _, err := verifier.Verify(ctx, server.IDToken("alice", clientID, nil)); err != nil {
+		t.Errorf("Token of a rotated in key rejected: %v", err)
+	}
+
+	// an unknown kid doesn't hammer the provider
+	server.Rotate()
+	if _, err := verifier.Verify(ctx, server.IDToken("alice", clientID, nil)); err == nil {
+		t.Errorf("Token of an unknown key accepted")
+	}
+	if fetches := server.Fetches(); fetches != 2 {
+		t.Errorf("Got %d JWKS fetches, want no refetch within a minute", fetches)
+	}
+}
+
+func TestVerifyWithoutDiscovery(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{
+				{"kty": "OKP", "crv": "Ed25519", "kid": "ed", "x": base64.RawURLEncoding.EncodeToString(public)},
+				{"kty": "oct", "kid": "secret", "k": "c2VjcmV0"},
+			},
+		})
+	}))
+	defer jwks.Close()
+
+	// an issuer without a discovery document, whose keys are configured
+	provider := Provider{Name: "test", Issuer: "https://issuer.example.com", ClientID: clientID, JWKSURL: jwks.URL}
+	verifier := NewVerifier(provider, nil)
+
+	sign := func(method jwt.SigningMethod, kid string, key any) string {
+		token := jwt.NewWithClaims(method, jwt.MapClaims{
+			"iss": provider.Issuer,
+			"sub": "bob",
+			"aud": clientID,
+			"exp": time.Now().Add(time.Hour).Unix(),
+		})
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	claims, err := verifier.Verify(context.Background(), sign(jwt.SigningMethodEdDSA, "ed", private))
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if claims.Subject != "bob" || claims.Email != "" {
+		t.Errorf("Verify() = %+v, want bob without an email", claims)
+	}
+
+	// symmetric keys in a JWKS would let anyone who reads it sign tokens
+	if _, err := verifier.Verify(context.Background(), sign(jwt.SigningMethodHS256, "secret", []byte("secret"))); err == nil {
+		t.Errorf("HS256 token accepted")
+	}
+}
@@ -0,0 +1,120 @@
+// Package oidctest is a local stand-in OpenID Connect provider for tests,
+// serving a discovery document and a JWKS and signing ID tokens
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type Server struct {
+	*httptest.Server
+	// Issuer is the server's URL, which is what its tokens have as iss
+	Issuer string
+
+	t       *testing.T
+	mux     sync.Mutex
+	key     *rsa.PrivateKey
+	kid     int
+	fetches int
+}
+
+// NewServer starts a provider, it is closed when the test ends
+func NewServer(t *testing.T) *Server {
+	t.Helper()
+
+	s := &Server{t: t}
+	s.Rotate()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   s.Issuer,
+			"jwks_uri": s.Issuer + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		s.mux.Lock()
+		defer s.mux.Unlock()
+
+		s.fetches++
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"use": "sig",
+				"alg": "RS256",
+				"kid": fmt.Sprint(s.kid),
+				"n":   base64.RawURLEncoding.EncodeToString(s.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.key.E)).Bytes()),
+			}},
+		})
+	})
+
+	s.Server = httptest.NewServer(mux)
+	s.Issuer = s.Server.URL
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Rotate replaces the signing key with a new one under a new kid
+func (s *Server) Rotate() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.key = key
+	s.kid++
+}
+
+// Fetches counts how often the JWKS was requested
+func (s *Server) Fetches() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.fetches
+}
+
+// IDToken signs an ID token for the subject and audience, valid for an
+// hour. Claims in extra are added or override the defaults.
+func (s *Server) IDToken(subject, audience string, extra map[string]any) string {
+	s.t.Helper()
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            s.Issuer,
+		"sub":            subject,
+		"aud":            audience,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"email":          subject + "@example.com",
+		"email_verified": true,
+		"given_name":     "Tester",
+	}
+	for name, value := range extra {
+		claims[name] = value
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = fmt.Sprint(s.kid)
+	signed, err := token.SignedString(s.key)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return signed
+}
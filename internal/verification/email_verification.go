@@ -6,81 +6,49 @@ import (
 	"encoding/hex"
 	"fmt"
 	"os"
+	"time"
+)
 
-	"github.com/resend/resend-go/v2"
+// Purposes of the tokens stored in verification_tokens, a token is only
+// accepted for the purpose it was issued for
+const (
+	PurposeEmailVerification = "email_verification"
+	PurposePasswordReset     = "password_reset"
+	PurposeEmailChange       = "email_change"
+	PurposeMagicLink         = "magic_link"
 )
 
-func GenerateVerificationToken() (token, hash string) {
-    bytes := make([]byte, 32)
-    rand.Read(bytes)
-    token = hex.EncodeToString(bytes)
+const (
+	EmailVerificationTTL = 120 * time.Minute
+	PasswordResetTTL     = 60 * time.Minute
+	EmailChangeTTL       = 60 * time.Minute
+	MagicLinkTTL         = 15 * time.Minute
+)
 
-    hasher := sha256.New()
-    hasher.Write([]byte(token))
-    hash = hex.EncodeToString(hasher.Sum(nil))
+func GenerateVerificationToken() (token, hash string) {
+	bytes := make([]byte, 32)
+	rand.Read(bytes)
+	token = hex.EncodeToString(bytes)
 
-    return token, hash
+	return token, HashToken(token)
 }
 
-func SendVerificationEmail(email string, token string) error {
-    client := resend.NewClient(os.Getenv("RESEND_API_KEY"))
-
-    verifyLink := fmt.Sprintf("%s/verify?token=%s", os.Getenv("FRONTEND_URL"), token)
-
-    html := fmt.Sprintf(`
-    <!DOCTYPE html>
-    <html>
-    <head>
-        <link href="https://fonts.googleapis.com/css2?family=Finger+Paint&display=swap" rel="stylesheet">
-    </head>
-    <body style="margin: 0; padding: 0; background-color: #1E1E24; font-family: 'Finger Paint', cursive;">
-        <table width="100%%" cellpadding="0" cellspacing="0" style="background-color: #1E1E24; padding: 40px 0;">
-            <tr>
-                <td align="center">
-                    <table width="600" cellpadding="0" cellspacing="0" style="background-color: #FFF3E5; border-radius: 5px; padding: 40px;">
-                        <tr>
-                            <td align="center">
-                                <h1 style="color: #1E1E24; font-size: 32px; margin-bottom: 20px;">
-                                    Welcome to Silly Mini Games!
-                                </h1>
-                                <p style="color: #1E1E24; font-size: 18px; margin-bottom: 30px;">
-                                    Click below to verify your email and start playing online!
-                                </p>
-                                <a href="%s" style="
-                                    background-color: #92140C;
-                                    color: #FFF8F0;
-                                    padding: 15px 40px;
-                                    text-decoration: none;
-                                    border-radius: 5px;
-                                    font-size: 20px;
-                                    display: inline-block;
-                                    margin-bottom: 30px;
-                                ">
-                                    Verify Email & Sign In
-                                </a>
-                                <p style="color: #666; font-size: 14px; margin-top: 30px;">
-                                    Or copy this link:<br>
-                                    <span style="color: #92140C;">%s</span>
-                                </p>
-                                <p style="color: #666; font-size: 12px; margin-top: 20px;">
-                                    This link expires in 120 minutes
-                                </p>
-                            </td>
-                        </tr>
-                    </table>
-                </td>
-            </tr>
-        </table>
-    </body>
-    </html>
-    `, verifyLink, verifyLink)
+// HashToken is how tokens are looked up, only the hash is ever stored
+func HashToken(token string) string {
+	hasher := sha256.New()
+	hasher.Write([]byte(token))
+	return hex.EncodeToString(hasher.Sum(nil))
+}
 
-    _, err := client.Emails.Send(&resend.SendEmailRequest{
-        From: fmt.Sprintf("Silly Mini Games <noreply@%s>", os.Getenv("EMAIL_DOMAIN")),
-        To: []string{email},
-        Subject: "Verify your account",
-        Html: html,
-    })
+// pages of the frontend the link of each purpose opens
+var linkPages = map[string]string{
+	PurposeEmailVerification: "verify",
+	PurposePasswordReset:     "reset-password",
+	PurposeEmailChange:       "confirm-email",
+	PurposeMagicLink:         "magic-link",
+}
 
-    return err
+// Link is where the emailed token of purpose is redeemed
+func Link(purpose, token string) string {
+	return fmt.Sprintf("%s/%s?token=%s", os.Getenv("FRONTEND_URL"), linkPages[purpose], token)
 }
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/auth"
+)
+
+// a rotated out key is accepted as long as the JWTs it signed can live
+const defaultKeyGracePeriod = 60 * time.Minute
+
+// loadTokenKeys signs with the key in JWT_SIGNING_KEY_FILE when it is set
+// and with TOKEN_SECERT otherwise. The previous key, and TOKEN_SECERT once a
+// key file replaces it, keep verifying tokens for JWT_KEY_GRACE_PERIOD after
+// JWT_KEY_RETIRED_AT. The grace period runs from the rotation rather than
+// from startup, so restarting doesn't extend it.
+func loadTokenKeys() (*auth.KeySet, error) {
+	grace := defaultKeyGracePeriod
+	if value := os.Getenv("JWT_KEY_GRACE_PERIOD"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWT_KEY_GRACE_PERIOD: %v", err)
+		}
+		grace = parsed
+	}
+
+	// only needed, and parsed, when there is a previous key
+	retiredUntil := func() (time.Time, error) {
+		value := os.Getenv("JWT_KEY_RETIRED_AT")
+		if value == "" {
+			return time.Time{}, fmt.Errorf("JWT_KEY_RETIRED_AT must be set while a previous key is accepted")
+		}
+		retiredAt, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid JWT_KEY_RETIRED_AT: %v", err)
+		}
+		return retiredAt.Add(grace), nil
+	}
+
+	secret := os.Getenv("TOKEN_SECERT")
+
+	var keys *auth.KeySet
+	if path := os.Getenv("JWT_SIGNING_KEY_FILE"); path != "" {
+		current, err := auth.LoadKeyFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load JWT_SIGNING_KEY_FILE: %v", err)
+		}
+		if !current.CanSign() {
+			return nil, fmt.Errorf("JWT_SIGNING_KEY_FILE must be a private key")
+		}
+		keys = auth.NewKeySet(current)
+
+		// tokens signed before switching to the key file
+		if secret != "" {
+			until, err := retiredUntil()
+			if err != nil {
+				return nil, err
+			}
+			keys.AddPrevious(auth.NewHMACKey([]byte(secret)), until)
+		}
+	} else {
+		if secret == "" {
+			return nil, fmt.Errorf("TOKEN_SECERT or JWT_SIGNING_KEY_FILE must be set")
+		}
+		keys = auth.NewKeySet(auth.NewHMACKey([]byte(secret)))
+	}
+
+	if path := os.Getenv("JWT_PREVIOUS_KEY_FILE"); path != "" {
+		previous, err := auth.LoadKeyFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load JWT_PREVIOUS_KEY_FILE: %v", err)
+		}
+		until, err := retiredUntil()
+		if err != nil {
+			return nil, err
+		}
+		keys.AddPrevious(previous, until)
+	}
+
+	// the token secret being replaced by another one
+	if previous := os.Getenv("JWT_PREVIOUS_SECRET"); previous != "" {
+		until, err := retiredUntil()
+		if err != nil {
+			return nil, err
+		}
+		keys.AddPrevious(auth.NewHMACKey([]byte(previous)), until)
+	}
+
+	return keys, nil
+}
+
+// handlerJWKS publishes the public keys tokens are signed with, so other
+// services can verify them without the secret
+func (cfg *apiConfig) handlerJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJSON(w, http.StatusOK, map[string][]auth.JWK{
+		"keys": cfg.tokenKeys.JWKS(),
+	})
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/auth"
+	"github.com/google/uuid"
+)
+
+func TestLoadTokenKeysRetirement(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "jwt.pem")
+	if err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// a JWT signed with the token secret before switching to the key file
+	oldToken, err := auth.MakeJWT(uuid.New(), auth.NewKeySet(auth.NewHMACKey([]byte(testSecret))), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		retiredAt string
+		wantErr   bool
+		wantValid bool
+	}{
+		{name: "Within the grace period", retiredAt: time.Now().Add(-30 * time.Minute).Format(time.RFC3339), wantValid: true},
+		{name: "Grace period over, whenever the server started", retiredAt: time.Now().Add(-2 * time.Hour).Format(time.RFC3339)},
+		{name: "Retirement time missing", wantErr: true},
+		{name: "Retirement time unreadable", retiredAt: "yesterday", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TOKEN_SECERT", testSecret)
+			t.Setenv("JWT_SIGNING_KEY_FILE", keyFile)
+			t.Setenv("JWT_PREVIOUS_KEY_FILE", "")
+			t.Setenv("JWT_PREVIOUS_SECRET", "")
+			t.Setenv("JWT_KEY_GRACE_PERIOD", "60m")
+			t.Setenv("JWT_KEY_RETIRED_AT", tt.retiredAt)
+
+			keys, err := loadTokenKeys()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Got error %v, want an error: %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if _, err = auth.ValidateJWT(oldToken, keys); (err == nil) != tt.wantValid {
+				t.Errorf("Validating a JWT of the retired key got %v, want it accepted: %v", err, tt.wantValid)
+			}
+		})
+	}
+}
+
+func TestLoadTokenKeysSecretRotation(t *testing.T) {
+	oldToken, err := auth.MakeJWT(uuid.New(), auth.NewKeySet(auth.NewHMACKey([]byte(testSecret))), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("TOKEN_SECERT", "a-brand-new-secret")
+	t.Setenv("JWT_SIGNING_KEY_FILE", "")
+	t.Setenv("JWT_PREVIOUS_KEY_FILE", "")
+	t.Setenv("JWT_PREVIOUS_SECRET", testSecret)
+	t.Setenv("JWT_KEY_GRACE_PERIOD", "60m")
+	t.Setenv("JWT_KEY_RETIRED_AT", time.Now().Add(-30*time.Minute).Format(time.RFC3339))
+
+	keys, err := loadTokenKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = auth.ValidateJWT(oldToken, keys); err != nil {
+		t.Errorf("JWT of the previous secret rejected during the grace period: %v", err)
+	}
+
+	newToken, err := auth.MakeJWT(uuid.New(), keys, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = auth.ValidateJWT(newToken, keys); err != nil {
+		t.Errorf("JWT of the new secret rejected: %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/emails"
+	"github.com/AradD7/Go-Knuclebones/internal/mailer"
+)
+
+// how long a send may take before it is given up on
+const emailSendTimeout = 30 * time.Second
+
+// loadMailer picks the email backend from MAILER: resend (default), smtp
+// or file, which writes .eml files to MAIL_OUTBOX_DIR instead of sending
+func loadMailer() (mailer.Mailer, error) {
+	from := mailer.FromAddress(os.Getenv("EMAIL_DOMAIN"))
+
+	switch os.Getenv("MAILER") {
+	case "smtp":
+		addr := os.Getenv("SMTP_ADDR")
+		if addr == "" {
+			return nil, fmt.Errorf("SMTP_ADDR must be set to send with smtp")
+		}
+		return mailer.NewSMTP(addr, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), from), nil
+	case "file":
+		dir := os.Getenv("MAIL_OUTBOX_DIR")
+		if dir == "" {
+			dir = "mail-outbox"
+		}
+		return mailer.NewFileOutbox(dir, from)
+	case "", "resend":
+		return mailer.NewResend(os.Getenv("RESEND_API_KEY"), from), nil
+	default:
+		return nil, fmt.Errorf("unknown MAILER %q", os.Getenv("MAILER"))
+	}
+}
+
+// requestLocale is the locale new players get their emails in, the one
+// their browser prefers
+func requestLocale(r *http.Request) string {
+	return emails.MatchLocale(r.Header.Get("Accept-Language"))
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/AradD7/Go-Knuclebones/internal/mailer"
+)
+
+// testMailer writes the emails handlers send as .eml files to a directory
+// of the test
+func testMailer(t *testing.T) (mailer.Mailer, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	outbox, err := mailer.NewFileOutbox(dir, mailer.FromAddress("example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return outbox, dir
+}
+
+// readEmail returns the recipient and plain text of an .eml file
+func readEmail(t *testing.T, path string) (to, text string) {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	msg, err := mail.ReadMessage(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := parts.NextPart()
+		if err != nil {
+			t.Fatalf("Email has no plain text part: %v", err)
+		}
+		if strings.HasPrefix(part.Header.Get("Content-Type"), "text/plain") {
+			content, err := io.ReadAll(part)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return msg.Header.Get("To"), string(content)
+		}
+	}
+}
@@ -1,15 +1,21 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
 	"net/http"
+	"net/netip"
 	"os"
 	"sync"
+	"time"
 
+	"github.com/AradD7/Go-Knuclebones/internal/auth"
 	"github.com/AradD7/Go-Knuclebones/internal/database"
-	"github.com/gorilla/websocket"
+	"github.com/AradD7/Go-Knuclebones/internal/mailer"
+	"github.com/AradD7/Go-Knuclebones/internal/oidc"
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
@@ -33,23 +39,37 @@ func corsMiddleware(next http.Handler) http.Handler {
 }
 
 type gameServer struct {
-	connections map[string][]*websocket.Conn
-	rwMux       *sync.RWMutex
+	connections    map[string][]subscriber
+	players        map[uuid.UUID][]subscriber
+	events         map[string]*gameLog
+	presence       map[string]map[uuid.UUID]string
+	rwMux          *sync.RWMutex
+	trackers       map[presenceKey]*presenceTracker
+	presenceMux    *sync.Mutex
+	idleAfter      time.Duration
+	reconnectGrace time.Duration
+	authorize      func(ctx context.Context, gameId, playerId uuid.UUID) error
+	backend        broadcastBackend
 }
 
 type apiConfig struct {
-	db             *database.Queries
-	tokenSecret    string
-	googleClientId string
-	platform       string
-	gs             *gameServer
+	db        *database.Queries
+	tokenKeys *auth.KeySet
+	oidc      map[string]*oidc.Verifier
+	mailer    mailer.Mailer
+	outbox    *emailOutbox
+	webhooks  *webhookDispatcher
+	adminKey  string
+	platform  string
+	gs        *gameServer
+	limiter   rateLimitBackend
+	// proxies whose X-Forwarded-For is believed
+	trustedProxies []netip.Prefix
 }
 
 func main() {
 	godotenv.Load()
 
-	secret := os.Getenv("TOKEN_SECERT")
-	clientId := os.Getenv("GOOGLE_CLIENT_ID")
 	const port = "8080"
 	const filepathRoot = "."
 	dbURL := os.Getenv("DB_URL")
@@ -59,15 +79,69 @@ func main() {
 		log.Fatalf("Failed to connect to DB: %v", err)
 	}
 
+	tokenKeys, err := loadTokenKeys()
+	if err != nil {
+		log.Fatalf("Failed to load JWT signing keys: %v", err)
+	}
+
+	providers, err := loadOIDCProviders()
+	if err != nil {
+		log.Fatalf("Failed to load login providers: %v", err)
+	}
+
+	trustedProxies, err := loadTrustedProxies()
+	if err != nil {
+		log.Fatalf("Failed to load trusted proxies: %v", err)
+	}
+
+	emailer, err := loadMailer()
+	if err != nil {
+		log.Fatalf("Failed to set up the mailer: %v", err)
+	}
+
 	apiCfg := apiConfig{
-		db:             database.New(db),
-		tokenSecret:    secret,
-		googleClientId: clientId,
-		platform:       os.Getenv("PLATFORM"),
-		gs: &gameServer{
-			connections: make(map[string][]*websocket.Conn),
-			rwMux:       &sync.RWMutex{},
-		},
+		db:        database.New(db),
+		tokenKeys: tokenKeys,
+		oidc:      providers,
+		mailer:    emailer,
+		adminKey:  os.Getenv("ADMIN_API_KEY"),
+		platform:  os.Getenv("PLATFORM"),
+		gs:        newGameServer(),
+
+		trustedProxies: trustedProxies,
+	}
+	apiCfg.gs.authorize = apiCfg.authorizeGame
+
+	switch os.Getenv("BROADCAST_BACKEND") {
+	case "postgres":
+		backend, err := newPostgresBackend(dbURL, db, apiCfg.gs.deliver)
+		if err != nil {
+			log.Fatalf("Failed to start postgres broadcast backend: %v", err)
+		}
+		defer backend.close()
+		apiCfg.gs.backend = backend
+	default:
+		apiCfg.gs.backend = newMemoryBackend(apiCfg.gs.deliver)
+	}
+
+	apiCfg.outbox = newEmailOutbox(apiCfg.db, apiCfg.mailer)
+	go apiCfg.outbox.run(context.Background())
+
+	apiCfg.webhooks = newWebhookDispatcher(apiCfg.db)
+	go apiCfg.webhooks.run(context.Background())
+
+	remindAfter, err := loadTurnReminderAfter()
+	if err != nil {
+		log.Fatalf("Failed to set up turn reminders: %v", err)
+	}
+	go newTurnScheduler(&apiCfg, remindAfter).run(context.Background())
+
+	switch os.Getenv("RATE_LIMIT_BACKEND") {
+	case "postgres":
+		apiCfg.limiter = newPostgresRateLimiter(apiCfg.db)
+	case "off":
+	default:
+		apiCfg.limiter = newMemoryRateLimiter()
 	}
 
 	mux := http.NewServeMux()
@@ -75,30 +149,94 @@ func main() {
 	mux.Handle("/app/", http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot))))
 
 	mux.HandleFunc("GET /api/health", apiCfg.handlerHealthCheck)
+	mux.HandleFunc("GET /.well-known/jwks.json", apiCfg.handlerJWKS)
 
 	mux.HandleFunc("POST /admin/reset", apiCfg.handlerReset)
-
-	mux.HandleFunc("POST /api/players/new", apiCfg.handlerNewPlayer)
-	mux.HandleFunc("POST /api/players/login", apiCfg.handlerPlayerLogin)
+	mux.HandleFunc("GET /admin/emails/failed", apiCfg.handlerGetFailedEmails)
+	mux.HandleFunc("POST /admin/emails/{email_id}/retry", apiCfg.handlerRetryEmail)
+	mux.HandleFunc("GET /admin/reports", apiCfg.handlerGetReports)
+	mux.HandleFunc("POST /admin/reports/{report_id}/resolve", apiCfg.handlerResolveReport)
+	mux.HandleFunc("GET /admin/webhooks", apiCfg.handlerAdminGetWebhooks)
+	mux.HandleFunc("POST /admin/webhooks", apiCfg.handlerAdminCreateWebhook)
+	mux.HandleFunc("DELETE /admin/webhooks/{webhook_id}", apiCfg.handlerAdminDeleteWebhook)
+	mux.HandleFunc("GET /admin/webhooks/{webhook_id}/deliveries", apiCfg.handlerAdminGetWebhookDeliveries)
+
+	mux.HandleFunc("POST /api/players/new", apiCfg.rateLimited("signup", authIPLimit, rateLimit{}, apiCfg.handlerNewPlayer))
+	mux.HandleFunc("POST /api/players/guest", apiCfg.rateLimited("signup", authIPLimit, rateLimit{}, apiCfg.handlerNewGuest))
+	mux.HandleFunc("POST /api/players/guest/upgrade", apiCfg.handlerUpgradeGuest)
+	mux.HandleFunc("POST /api/players/guest/upgrade/{provider}", apiCfg.handlerUpgradeGuestOIDC)
+	mux.HandleFunc("POST /api/players/login", apiCfg.rateLimited("login", authIPLimit, authUsernameLimit, apiCfg.handlerPlayerLogin))
+	mux.HandleFunc("POST /api/players/login/2fa", apiCfg.rateLimited("login", authIPLimit, rateLimit{}, apiCfg.handlerLoginTwoFactor))
 	mux.HandleFunc("GET /api/players/getplayer", apiCfg.handlerGetPlayer)
 	mux.HandleFunc("POST /api/players/update", apiCfg.handlerUpdateProfile)
-	mux.HandleFunc("POST /api/players/verify", apiCfg.handlerVerifyEmail)
-	mux.HandleFunc("POST /api/players/resendverification", apiCfg.handlerResendVerification)
+	mux.HandleFunc("POST /api/players/verify", apiCfg.rateLimited("verify", authIPLimit, rateLimit{}, apiCfg.handlerVerifyEmail))
+	mux.HandleFunc("POST /api/players/resendverification", apiCfg.rateLimited("resend", resendIPLimit, resendUserLimit, apiCfg.handlerResendVerification))
+	mux.HandleFunc("POST /api/players/password/forgot", apiCfg.rateLimited("forgot", resendIPLimit, rateLimit{}, apiCfg.handlerForgotPassword))
+	mux.HandleFunc("POST /api/players/password/reset", apiCfg.rateLimited("reset", authIPLimit, rateLimit{}, apiCfg.handlerResetPassword))
+	mux.HandleFunc("POST /api/players/password/change", apiCfg.handlerChangePassword)
+	mux.HandleFunc("POST /api/players/email/change", apiCfg.handlerChangeEmail)
+	mux.HandleFunc("POST /api/players/email/confirm", apiCfg.handlerConfirmEmailChange)
+	mux.HandleFunc("DELETE /api/players/me", apiCfg.handlerDeletePlayer)
+	mux.HandleFunc("GET /api/players/me/export", apiCfg.handlerExportPlayer)
+	mux.HandleFunc("GET /api/players/me/identities", apiCfg.handlerGetIdentities)
+	mux.HandleFunc("POST /api/players/me/identities/{provider}", apiCfg.handlerLinkIdentity)
+	mux.HandleFunc("DELETE /api/players/me/identities/{provider}", apiCfg.handlerUnlinkIdentity)
+	mux.HandleFunc("POST /api/players/2fa/enroll", apiCfg.handlerEnrollTwoFactor)
+	mux.HandleFunc("POST /api/players/2fa/confirm", apiCfg.handlerConfirmTwoFactor)
+	mux.HandleFunc("POST /api/players/2fa/disable", apiCfg.handlerDisableTwoFactor)
+	mux.HandleFunc("GET /api/players/search", apiCfg.handlerSearchPlayers)
+	mux.HandleFunc("GET /api/players/me/blocks", apiCfg.handlerGetBlockedPlayers)
+	mux.HandleFunc("POST /api/players/{player_id}/block", apiCfg.handlerBlockPlayer)
+	mux.HandleFunc("DELETE /api/players/{player_id}/block", apiCfg.handlerUnblockPlayer)
+	mux.HandleFunc("PUT /api/players/me/bot", apiCfg.handlerSetBot)
+	mux.HandleFunc("POST /api/players/{player_id}/report", apiCfg.handlerReportPlayer)
+
+	mux.HandleFunc("GET /api/friends", apiCfg.handlerGetFriends)
+	mux.HandleFunc("DELETE /api/friends/{player_id}", apiCfg.handlerRemoveFriend)
+	mux.HandleFunc("GET /api/friends/requests", apiCfg.handlerGetFriendRequests)
+	mux.HandleFunc("POST /api/friends/requests", apiCfg.handlerSendFriendRequest)
+	mux.HandleFunc("POST /api/friends/requests/{player_id}/accept", apiCfg.handlerAcceptFriendRequest)
+	mux.HandleFunc("POST /api/friends/requests/{player_id}/decline", apiCfg.handlerDeclineFriendRequest)
+
+	mux.HandleFunc("GET /api/notifications", apiCfg.handlerGetNotifications)
+	mux.HandleFunc("POST /api/notifications/read", apiCfg.handlerReadAllNotifications)
+	mux.HandleFunc("POST /api/notifications/{notification_id}/read", apiCfg.handlerReadNotification)
+	mux.HandleFunc("GET /api/notifications/preferences", apiCfg.handlerGetNotificationPreferences)
+	mux.HandleFunc("PUT /api/notifications/preferences", apiCfg.handlerUpdateNotificationPreferences)
+
+	mux.HandleFunc("GET /api/webhooks", apiCfg.handlerGetWebhooks)
+	mux.HandleFunc("POST /api/webhooks", apiCfg.handlerCreateWebhook)
+	mux.HandleFunc("DELETE /api/webhooks/{webhook_id}", apiCfg.handlerDeleteWebhook)
+	mux.HandleFunc("GET /api/webhooks/{webhook_id}/deliveries", apiCfg.handlerGetWebhookDeliveries)
 
 	mux.HandleFunc("GET /api/tokens/refresh", apiCfg.handlerRefresh)
 	mux.HandleFunc("GET /api/tokens/revoke", apiCfg.handlerRevoke)
-	mux.HandleFunc("POST /api/auth/google", apiCfg.handlerAuthGoogle)
+	mux.HandleFunc("GET /api/tokens/personal", apiCfg.handlerGetPersonalAccessTokens)
+	mux.HandleFunc("POST /api/tokens/personal", apiCfg.handlerCreatePersonalAccessToken)
+	mux.HandleFunc("DELETE /api/tokens/personal/{token_id}", apiCfg.handlerDeletePersonalAccessToken)
+	mux.HandleFunc("GET /api/sessions", apiCfg.handlerGetSessions)
+	mux.HandleFunc("DELETE /api/sessions/{session_id}", apiCfg.handlerDeleteSession)
+	mux.HandleFunc("POST /api/auth/google", apiCfg.rateLimited("oidc", authIPLimit, rateLimit{}, apiCfg.handlerAuthGoogle))
+	mux.HandleFunc("POST /api/auth/oidc/{provider}", apiCfg.rateLimited("oidc", authIPLimit, rateLimit{}, apiCfg.handlerAuthOIDC))
+	mux.HandleFunc("POST /api/auth/magic-link", apiCfg.rateLimited("magic-link", resendIPLimit, rateLimit{}, apiCfg.handlerRequestMagicLink))
+	mux.HandleFunc("POST /api/auth/magic-link/verify", apiCfg.rateLimited("verify", authIPLimit, rateLimit{}, apiCfg.handlerVerifyMagicLink))
 
 	mux.HandleFunc("GET /api/games", apiCfg.handlerGetGames)
 	mux.HandleFunc("GET /api/games/{game_id}", apiCfg.handlerGetGame)
 	mux.HandleFunc("GET /api/games/new", apiCfg.handlerNewGame)
+	mux.HandleFunc("POST /api/games/private", apiCfg.handlerNewPrivateGame)
+	mux.HandleFunc("GET /api/games/invites", apiCfg.handlerGetGameInvites)
+	mux.HandleFunc("DELETE /api/games/{game_id}/invite", apiCfg.handlerDeleteGameInvite)
 	mux.HandleFunc("GET /api/games/{game_id}/join", apiCfg.handlerJoinGame)
 	mux.HandleFunc("POST /api/games/move/{game_id}", apiCfg.handlerMakeMove)
 	mux.HandleFunc("POST /api/games/localgame", apiCfg.handlerLocalGame)
 	mux.HandleFunc("POST /api/games/computergame", apiCfg.handlerComputerGame)
-	mux.HandleFunc("GET /api/games/roll", apiCfg.handlerRoll)
+	mux.HandleFunc("GET /api/games/roll", apiCfg.rateLimited("roll", rollIPLimit, rateLimit{}, apiCfg.handlerRoll))
+	mux.HandleFunc("GET /api/games/{game_id}/events", apiCfg.handlerGameEvents)
+	mux.HandleFunc("GET /api/bots/events", apiCfg.handlerBotEvents)
 
 	mux.HandleFunc("/ws/games/{game_id}", apiCfg.handlerWebSocket)
+	mux.HandleFunc("/ws/players/me", apiCfg.handlerPlayerWebSocket)
 
 	srv := &http.Server{
 		Handler: corsMiddleware(mux),
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/database"
+	"github.com/AradD7/Go-Knuclebones/internal/emails"
+	"github.com/AradD7/Go-Knuclebones/internal/mailer"
+)
+
+const (
+	// how often the outbox looks for due emails when nothing wakes it
+	outboxPollInterval = 5 * time.Second
+	outboxBatchSize    = 10
+	// a claimed email is tried again after this long, in case the instance
+	// sending it died before recording how it went
+	outboxLease = emailSendTimeout + 30*time.Second
+	// an email failing this often is dead-lettered
+	outboxMaxAttempts   = 8
+	outboxRetryBase     = 30 * time.Second
+	outboxMaxRetryDelay = time.Hour
+	// sent emails are kept this long, for the record
+	outboxRetention     = 7 * 24 * time.Hour
+	outboxSweepInterval = time.Hour
+)
+
+// emailOutbox sends the emails queued in email_outbox, retrying failed
+// sends with exponential backoff until outboxMaxAttempts. Every instance
+// can run one, they claim emails with SKIP LOCKED and never send one twice
+// unless a send outlives its lease.
+type emailOutbox struct {
+	db        *database.Queries
+	mailer    mailer.Mailer
+	wake      chan struct{}
+	lastSweep time.Time
+}
+
+func newEmailOutbox(db *database.Queries, m mailer.Mailer) *emailOutbox {
+	return &emailOutbox{
+		db:     db,
+		mailer: m,
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// outboxRetryDelay is how long to wait after the email failed attempts
+// times
+func outboxRetryDelay(attempts int) time.Duration {
+	delay := outboxRetryBase
+	for range attempts - 1 {
+		delay *= 2
+		if delay >= outboxMaxRetryDelay {
+			return outboxMaxRetryDelay
+		}
+	}
+	return delay
+}
+
+// queueEmail renders the named email template in the recipient's locale and
+// stores it to be sent by the outbox, so it survives the mail provider being
+// down or the server restarting
+func (cfg *apiConfig) queueEmail(ctx context.Context, template, to, locale string, data emails.Data) error {
+	msg, err := emails.Render(template, to, locale, data)
+	if err != nil {
+		return err
+	}
+
+	if _, err = cfg.db.EnqueueEmail(ctx, database.EnqueueEmailParams{
+		Recipient: msg.To,
+		Subject:   msg.Subject,
+		Html:      msg.HTML,
+		Text:      msg.Text,
+	}); err != nil {
+		return err
+	}
+
+	// tests run without an outbox
+	if cfg.outbox != nil {
+		cfg.outbox.notify()
+	}
+	return nil
+}
+
+// notify wakes the outbox to send a new email without waiting for the poll
+func (o *emailOutbox) notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (o *emailOutbox) run(ctx context.Context) {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		// a full batch may have left more due
+		for o.deliver(ctx) == outboxBatchSize {
+		}
+		o.sweep(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-o.wake:
+		}
+	}
+}
+
+// deliver sends one batch of due emails and returns how many it claimed
+func (o *emailOutbox) deliver(ctx context.Context) int {
+	emails, err := o.db.ClaimDueEmails(ctx, database.ClaimDueEmailsParams{
+		Lease:     outboxLease.Seconds(),
+		BatchSize: outboxBatchSize,
+	})
+	if err != nil {
+		log.Printf("Failed to claim queued emails: %v", err)
+		return 0
+	}
+
+	for _, email := range emails {
+		o.send(ctx, email)
+	}
+	return len(emails)
+}
+
+func (o *emailOutbox) send(ctx context.Context, email database.EmailOutbox) {
+	sendCtx, cancel := context.WithTimeout(ctx, emailSendTimeout)
+	err := o.mailer.Send(sendCtx, mailer.Message{
+		To:      email.Recipient,
+		Subject: email.Subject,
+		HTML:    email.Html,
+		Text:    email.Text,
+	})
+	cancel()
+
+	if err == nil {
+		if err = o.db.MarkEmailSent(ctx, email.ID); err != nil {
+			log.Printf("Failed to mark email %v as sent: %v", email.ID, err)
+		}
+		return
+	}
+
+	lastError := sql.NullString{Valid: true, String: err.Error()}
+	attempts := int(email.Attempts) + 1
+	if attempts >= outboxMaxAttempts {
+		log.Printf("Giving up on %q email %v after %d attempts: %v", email.Subject, email.ID, attempts, err)
+		err = o.db.FailEmail(ctx, database.FailEmailParams{
+			ID:        email.ID,
+			LastError: lastError,
+		})
+	} else {
+		log.Printf("Failed to send %q email %v, retrying: %v", email.Subject, email.ID, err)
+		err = o.db.RetryEmail(ctx, database.RetryEmailParams{
+			ID:        email.ID,
+			LastError: lastError,
+			Delay:     outboxRetryDelay(attempts).Seconds(),
+		})
+	}
+	if err != nil {
+		log.Printf("Failed to record the failed send of email %v: %v", email.ID, err)
+	}
+}
+
+func (o *emailOutbox) sweep(ctx context.Context) {
+	if time.Since(o.lastSweep) < outboxSweepInterval {
+		return
+	}
+	o.lastSweep = time.Now()
+
+	if err := o.db.DeleteSentEmails(ctx, outboxRetention.Seconds()); err != nil {
+		log.Printf("Failed to delete sent emails: %v", err)
+	}
+}
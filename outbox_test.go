@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/database"
+	"github.com/AradD7/Go-Knuclebones/internal/emails"
+	"github.com/AradD7/Go-Knuclebones/internal/mailer"
+	"github.com/google/uuid"
+)
+
+type failingMailer struct{}
+
+func (failingMailer) Send(ctx context.Context, msg mailer.Message) error {
+	return errors.New("provider is down")
+}
+
+func TestOutboxRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: 30 * time.Second},
+		{attempts: 2, want: time.Minute},
+		{attempts: 5, want: 8 * time.Minute},
+		{attempts: 7, want: 32 * time.Minute},
+		{attempts: 8, want: time.Hour},
+		{attempts: 20, want: time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := outboxRetryDelay(tt.attempts); got != tt.want {
+			t.Errorf("outboxRetryDelay(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestOutboxDeliver(t *testing.T) {
+	tests := []struct {
+		name      string
+		failing   bool
+		attempts  int
+		wantQuery string
+		wantDelay float64
+	}{
+		{
+			name:      "Sent",
+			wantQuery: "MarkEmailSent",
+		},
+		{
+			name:      "First failure is retried",
+			failing:   true,
+			wantQuery: "RetryEmail",
+			wantDelay: outboxRetryBase.Seconds(),
+		},
+		{
+			name:      "Last attempt is dead-lettered",
+			failing:   true,
+			attempts:  outboxMaxAttempts - 1,
+			wantQuery: "FailEmail",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			emailId := uuid.New()
+			var recorded []string
+			var delay float64
+			record := func(name string) stubQuery {
+				return func(args []driver.NamedValue) ([][]driver.Value, error) {
+					if args[0].Value != emailId.String() {
+						t.Errorf("%s of %v, want %v", name, args[0].Value, emailId)
+					}
+					if name == "RetryEmail" {
+						delay = args[2].Value.(float64)
+					}
+					recorded = append(recorded, name)
+					return nil, nil
+				}
+			}
+
+			db := newStubDB(t, map[string]stubQuery{
+				"ClaimDueEmails": func(args []driver.NamedValue) ([][]driver.Value, error) {
+					now := time.Now()
+					return [][]driver.Value{{emailId.String(), "player@example.com", "Verify your account", "<p>Verify</p>", "Verify", tt.attempts, now, nil, now, nil, nil}}, nil
+				},
+				"MarkEmailSent": record("MarkEmailSent"),
+				"RetryEmail":    record("RetryEmail"),
+				"FailEmail":     record("FailEmail"),
+			})
+
+			var m mailer.Mailer = failingMailer{}
+			dir := ""
+			if !tt.failing {
+				m, dir = testMailer(t)
+			}
+
+			outbox := newEmailOutbox(db, m)
+			if claimed := outbox.deliver(context.Background()); claimed != 1 {
+				t.Fatalf("Claimed %d emails, want 1", claimed)
+			}
+
+			if len(recorded) != 1 || recorded[0] != tt.wantQuery {
+				t.Errorf("Recorded %v, want %s", recorded, tt.wantQuery)
+			}
+			if delay != tt.wantDelay {
+				t.Errorf("Retried in %vs, want %vs", delay, tt.wantDelay)
+			}
+			if tt.failing {
+				return
+			}
+
+			files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+			if len(files) != 1 {
+				t.Fatalf("Got %d emails in the outbox, want 1", len(files))
+			}
+			to, text := readEmail(t, files[0])
+			if to != "player@example.com" || text != "Verify" {
+				t.Errorf("Sent %q to %s", text, to)
+			}
+		})
+	}
+}
+
+func TestPostgresOutbox(t *testing.T) {
+	dbURL := os.Getenv("TEST_DB_URL")
+	if dbURL == "" {
+		t.Skip("TEST_DB_URL not set")
+	}
+
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	queries := database.New(db)
+	recipient := uuid.NewString() + "@example.com"
+
+	cfg := &apiConfig{db: queries}
+	if err = cfg.queueEmail(ctx, emails.MagicLink, recipient, emails.DefaultLocale, emails.Data{Link: "https://example.com/magic-link?token=abc"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// two outboxes stand in for two API instances, the email is sent once
+	m, dir := testMailer(t)
+	first := newEmailOutbox(queries, m)
+	second := newEmailOutbox(queries, m)
+	for first.deliver(ctx)+second.deliver(ctx) > 0 {
+	}
+
+	sent := 0
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	for _, file := range files {
+		if to, _ := readEmail(t, file); strings.EqualFold(to, recipient) {
+			sent++
+		}
+	}
+	if sent != 1 {
+		t.Errorf("Sent the email %d times, want once", sent)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	presenceConnected    = "connected"
+	presenceIdle         = "idle"
+	presenceReconnecting = "reconnecting"
+	presenceDisconnected = "disconnected"
+)
+
+const (
+	// a player with no message on any of their connections for this long is idle
+	defaultIdleAfter = 2 * time.Minute
+	// a player whose last connection dropped is reconnecting for this long,
+	// then disconnected
+	defaultReconnectGrace = 30 * time.Second
+)
+
+type presenceKey struct {
+	gameId   uuid.UUID
+	playerId uuid.UUID
+}
+
+// presenceTracker follows the connections one player holds to one game on
+// this instance. Its timer is either the idle timer, while connected, or the
+// reconnect grace timer, once the last connection dropped.
+type presenceTracker struct {
+	clients    int
+	status     string
+	lastActive time.Time
+	timer      *time.Timer
+
+	// publishMux keeps the changes of one player in order without holding
+	// presenceMux while they are published, published is the last status sent
+	publishMux sync.Mutex
+	published  string
+}
+
+func (gs *gameServer) playerConnected(gameId, playerId uuid.UUID) {
+	gs.presenceMux.Lock()
+	key := presenceKey{gameId: gameId, playerId: playerId}
+	tracker, ok := gs.trackers[key]
+	if !ok {
+		tracker = &presenceTracker{}
+		gs.trackers[key] = tracker
+	}
+
+	tracker.clients++
+	gs.resetIdleTimer(key, tracker)
+	tracker.status = presenceConnected
+	gs.presenceMux.Unlock()
+
+	gs.announcePresence(key, tracker)
+}
+
+func (gs *gameServer) playerActive(gameId, playerId uuid.UUID) {
+	gs.presenceMux.Lock()
+	key := presenceKey{gameId: gameId, playerId: playerId}
+	tracker, ok := gs.trackers[key]
+	if !ok || tracker.clients == 0 {
+		gs.presenceMux.Unlock()
+		return
+	}
+
+	gs.resetIdleTimer(key, tracker)
+	tracker.status = presenceConnected
+	gs.presenceMux.Unlock()
+
+	gs.announcePresence(key, tracker)
+}
+
+func (gs *gameServer) playerDisconnected(gameId, playerId uuid.UUID) {
+	gs.presenceMux.Lock()
+	key := presenceKey{gameId: gameId, playerId: playerId}
+	tracker, ok := gs.trackers[key]
+	if !ok {
+		gs.presenceMux.Unlock()
+		return
+	}
+
+	tracker.clients--
+	if tracker.clients > 0 {
+		gs.presenceMux.Unlock()
+		return
+	}
+
+	tracker.timer.Stop()
+	tracker.timer = time.AfterFunc(gs.reconnectGrace, func() {
+		gs.presenceMux.Lock()
+		if gs.trackers[key] != tracker || tracker.clients > 0 {
+			gs.presenceMux.Unlock()
+			return
+		}
+		tracker.status = presenceDisconnected
+		gs.presenceMux.Unlock()
+
+		gs.announcePresence(key, tracker)
+	})
+	tracker.status = presenceReconnecting
+	gs.presenceMux.Unlock()
+
+	gs.announcePresence(key, tracker)
+}
+
+// resetIdleTimer must be called with presenceMux held
+func (gs *gameServer) resetIdleTimer(key presenceKey, tracker *presenceTracker) {
+	if tracker.timer != nil {
+		tracker.timer.Stop()
+	}
+	tracker.lastActive = time.Now()
+	tracker.timer = time.AfterFunc(gs.idleAfter, func() {
+		gs.presenceMux.Lock()
+		// the player may have been active while this was waiting for the lock
+		if gs.trackers[key] != tracker || tracker.clients == 0 || time.Since(tracker.lastActive) < gs.idleAfter {
+			gs.presenceMux.Unlock()
+			return
+		}
+		tracker.status = presenceIdle
+		gs.presenceMux.Unlock()
+
+		gs.announcePresence(key, tracker)
+	})
+}
+
+// announcePresence broadcasts the status of the tracker if it changed since
+// the last broadcast. It is called after presenceMux is released, and reads
+// the status again once it holds publishMux, so a change that lost the race
+// to publish is never sent after a newer one.
+func (gs *gameServer) announcePresence(key presenceKey, tracker *presenceTracker) {
+	tracker.publishMux.Lock()
+	defer tracker.publishMux.Unlock()
+
+	gs.presenceMux.Lock()
+	status := tracker.status
+	gs.presenceMux.Unlock()
+
+	if status == tracker.published {
+		return
+	}
+	tracker.published = status
+
+	gs.publish(key.gameId, PlayerMessage{
+		Type:     "presence",
+		PlayerId: key.playerId,
+		Presence: status,
+	})
+
+	// the tracker is dropped only once its disconnect is out, so the next
+	// connection of the player can't overtake it
+	if status == presenceDisconnected {
+		gs.presenceMux.Lock()
+		if gs.trackers[key] == tracker && tracker.status == presenceDisconnected {
+			delete(gs.trackers, key)
+		}
+		gs.presenceMux.Unlock()
+	}
+}
+
+// recordPresence keeps the game-wide view of presence up to date from the
+// presence events every instance receives. Callers must hold the write lock.
+func (gs *gameServer) recordPresence(gameId string, msg PlayerMessage) {
+	if msg.Presence == presenceDisconnected {
+		delete(gs.presence[gameId], msg.PlayerId)
+		if len(gs.presence[gameId]) == 0 {
+			delete(gs.presence, gameId)
+		}
+		return
+	}
+
+	if gs.presence[gameId] == nil {
+		gs.presence[gameId] = make(map[uuid.UUID]string)
+	}
+	gs.presence[gameId][msg.PlayerId] = msg.Presence
+}
+
+func (gs *gameServer) playerPresence(gameId, playerId uuid.UUID) string {
+	gs.rwMux.RLock()
+	defer gs.rwMux.RUnlock()
+
+	if status, ok := gs.presence[gameId.String()][playerId]; ok {
+		return status
+	}
+	return presenceDisconnected
+}
+
+// presenceRank orders statuses from least to most present
+var presenceRank = map[string]int{
+	presenceDisconnected: 0,
+	presenceReconnecting: 1,
+	presenceIdle:         2,
+	presenceConnected:    3,
+}
+
+// playerStatus is the most present the player is in any of their games,
+// or disconnected when they have none open
+func (gs *gameServer) playerStatus(playerId uuid.UUID) string {
+	gs.rwMux.RLock()
+	defer gs.rwMux.RUnlock()
+
+	status := presenceDisconnected
+	for _, players := range gs.presence {
+		if current, ok := players[playerId]; ok && presenceRank[current] > presenceRank[status] {
+			status = current
+		}
+	}
+	return status
+}
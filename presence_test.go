@@ -0,0 +1,113 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestPresenceEvents(t *testing.T) {
+	gameId := uuid.New()
+	player := uuid.New()
+	opponent := uuid.New()
+
+	srv, cfg := newTestServer(t, map[uuid.UUID][]uuid.UUID{gameId: {player, opponent}})
+	cfg.gs.idleAfter = 200 * time.Millisecond
+	cfg.gs.reconnectGrace = 200 * time.Millisecond
+
+	conn := dialGame(t, srv, gameId, makeToken(t, player))
+	waitForConnections(t, cfg.gs, gameId, 1)
+	oppConn := dialGame(t, srv, gameId, makeToken(t, opponent))
+
+	wantPresence := func(want string) {
+		t.Helper()
+		for {
+			msg := readPresence(t, conn)
+			if msg.PlayerId != opponent {
+				continue
+			}
+			if msg.Presence != want {
+				t.Fatalf("Got opponent presence %q, want %q", msg.Presence, want)
+			}
+			if got := cfg.gs.playerPresence(gameId, opponent); got != want {
+				t.Fatalf("gameServer reports %q, want %q", got, want)
+			}
+			return
+		}
+	}
+
+	wantPresence(presenceConnected)
+	wantPresence(presenceIdle)
+
+	if err := oppConn.WriteJSON(PlayerMessage{Type: "ping"}); err != nil {
+		t.Fatalf("Failed to ping: %v", err)
+	}
+	wantPresence(presenceConnected)
+
+	oppConn.Close()
+	wantPresence(presenceReconnecting)
+	wantPresence(presenceDisconnected)
+}
+
+func TestPresenceReconnectWithinGrace(t *testing.T) {
+	gameId := uuid.New()
+	player := uuid.New()
+	opponent := uuid.New()
+
+	srv, cfg := newTestServer(t, map[uuid.UUID][]uuid.UUID{gameId: {player, opponent}})
+
+	conn := dialGame(t, srv, gameId, makeToken(t, player))
+	waitForConnections(t, cfg.gs, gameId, 1)
+
+	oppConn := dialGame(t, srv, gameId, makeToken(t, opponent))
+	waitForConnections(t, cfg.gs, gameId, 2)
+	oppConn.Close()
+	waitForConnections(t, cfg.gs, gameId, 1)
+	dialGame(t, srv, gameId, makeToken(t, opponent))
+
+	var got []string
+	for len(got) < 3 {
+		if msg := readPresence(t, conn); msg.PlayerId == opponent {
+			got = append(got, msg.Presence)
+		}
+	}
+
+	want := []string{presenceConnected, presenceReconnecting, presenceConnected}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Got presence sequence %v, want %v", got, want)
+		}
+	}
+}
+
+func TestPresenceNotHeldUpBySlowPublish(t *testing.T) {
+	slowGame := uuid.New()
+	release := make(chan struct{})
+	delivered := make(chan uuid.UUID, 2)
+
+	gs := newGameServer()
+	gs.backend = newMemoryBackend(func(event gameEvent) {
+		// a backend stuck on one game, like a slow Redis round trip
+		if event.GameId == slowGame {
+			<-release
+		}
+		delivered <- event.GameId
+	})
+	defer close(release)
+
+	go gs.playerConnected(slowGame, uuid.New())
+	time.Sleep(50 * time.Millisecond)
+
+	otherGame := uuid.New()
+	go gs.playerConnected(otherGame, uuid.New())
+
+	select {
+	case got := <-delivered:
+		if got != otherGame {
+			t.Fatalf("Got presence of game %s, want %s", got, otherGame)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Presence of another game waited for the slow publish")
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/database"
+)
+
+// rateLimit is a token bucket: burst requests at once, then one more every
+// interval
+type rateLimit struct {
+	burst int
+	every time.Duration
+}
+
+func (l rateLimit) perSecond() float64 {
+	return 1 / l.every.Seconds()
+}
+
+var (
+	authIPLimit       = rateLimit{burst: 20, every: 6 * time.Second}
+	authUsernameLimit = rateLimit{burst: 10, every: 30 * time.Second}
+	resendIPLimit     = rateLimit{burst: 5, every: time.Minute}
+	resendUserLimit   = rateLimit{burst: 3, every: 10 * time.Minute}
+	rollIPLimit       = rateLimit{burst: 30, every: 500 * time.Millisecond}
+)
+
+const (
+	// failed logins of a username that go unpunished
+	freeLoginFailures = 5
+	// the lockout after the first punished failure, doubling with each one after
+	loginBackoffBase = 30 * time.Second
+	maxLoginBackoff  = 15 * time.Minute
+	// failures are forgotten this long after the last one
+	loginFailureReset = time.Hour
+	// how often buckets and failures nobody touched in a while are dropped
+	rateLimitSweepInterval = 10 * time.Minute
+	// a bucket untouched this long is full again under every limit above
+	rateLimitIdle = time.Hour
+)
+
+// rateLimitBackend keeps the token buckets and the failed login counts. The
+// memory backend is per instance, the postgres backend shares them between
+// every instance behind a load balancer.
+type rateLimitBackend interface {
+	// take spends a token of the key's bucket, or tells how long until the
+	// next one
+	take(ctx context.Context, key string, limit rateLimit) (time.Duration, error)
+	recordFailure(ctx context.Context, key string) error
+	// failures counts the key's failed logins and how long ago the last was
+	failures(ctx context.Context, key string) (int, time.Duration, error)
+	resetFailures(ctx context.Context, key string) error
+}
+
+// loginBackoff is how long a username stays locked after its last failure
+func loginBackoff(failures int) time.Duration {
+	if failures < freeLoginFailures {
+		return 0
+	}
+	shift := failures - freeLoginFailures
+	if shift > 10 {
+		return maxLoginBackoff
+	}
+	return min(loginBackoffBase<<shift, maxLoginBackoff)
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+type loginFailures struct {
+	count    int
+	lastFail time.Time
+}
+
+type memoryRateLimiter struct {
+	buckets   map[string]*tokenBucket
+	failed    map[string]*loginFailures
+	lastSweep time.Time
+	now       func() time.Time
+	mux       *sync.Mutex
+}
+
+func newMemoryRateLimiter() *memoryRateLimiter {
+	return &memoryRateLimiter{
+		buckets:   make(map[string]*tokenBucket),
+		failed:    make(map[string]*loginFailures),
+		lastSweep: time.Now(),
+		now:       time.Now,
+		mux:       &sync.Mutex{},
+	}
+}
+
+func (m *memoryRateLimiter) take(ctx context.Context, key string, limit rateLimit) (time.Duration, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	bucket, ok := m.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(limit.burst), updated: now}
+		m.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(float64(limit.burst), bucket.tokens+now.Sub(bucket.updated).Seconds()*limit.perSecond())
+	bucket.updated = now
+
+	if bucket.tokens < 1 {
+		return time.Duration((1 - bucket.tokens) / limit.perSecond() * float64(time.Second)), nil
+	}
+	bucket.tokens--
+	return 0, nil
+}
+
+func (m *memoryRateLimiter) recordFailure(ctx context.Context, key string) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	now := m.now()
+	failed, ok := m.failed[key]
+	if !ok || now.Sub(failed.lastFail) > loginFailureReset {
+		failed = &loginFailures{}
+		m.failed[key] = failed
+	}
+	failed.count++
+	failed.lastFail = now
+	return nil
+}
+
+func (m *memoryRateLimiter) failures(ctx context.Context, key string) (int, time.Duration, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	failed, ok := m.failed[key]
+	if !ok {
+		return 0, 0, nil
+	}
+	return failed.count, m.now().Sub(failed.lastFail), nil
+}
+
+func (m *memoryRateLimiter) resetFailures(ctx context.Context, key string) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	delete(m.failed, key)
+	return nil
+}
+
+// sweep drops refilled buckets and forgotten failures so the maps don't
+// grow with every IP that ever showed up. The caller holds the lock.
+func (m *memoryRateLimiter) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	m.lastSweep = now
+
+	for key, bucket := range m.buckets {
+		if now.Sub(bucket.updated) > rateLimitIdle {
+			delete(m.buckets, key)
+		}
+	}
+	for key, failed := range m.failed {
+		if now.Sub(failed.lastFail) > loginFailureReset {
+			delete(m.failed, key)
+		}
+	}
+}
+
+type postgresRateLimiter struct {
+	db        *database.Queries
+	lastSweep time.Time
+	mux       *sync.Mutex
+}
+
+func newPostgresRateLimiter(db *database.Queries) *postgresRateLimiter {
+	return &postgresRateLimiter{
+		db:        db,
+		lastSweep: time.Now(),
+		mux:       &sync.Mutex{},
+	}
+}
+
+func (p *postgresRateLimiter) take(ctx context.Context, key string, limit rateLimit) (time.Duration, error) {
+	p.sweep(ctx)
+
+	bucket, err := p.db.TakeRateLimitToken(ctx, database.TakeRateLimitTokenParams{
+		Key:       key,
+		Burst:     float64(limit.burst),
+		PerSecond: limit.perSecond(),
+	})
+	if err != nil {
+		return 0, err
+	}
+	if bucket.Allowed {
+		return 0, nil
+	}
+	return time.Duration((1 - bucket.Tokens) / limit.perSecond() * float64(time.Second)), nil
+}
+
+func (p *postgresRateLimiter) recordFailure(ctx context.Context, key string) error {
+	return p.db.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+		Key:        key,
+		ResetAfter: loginFailureReset.Seconds(),
+	})
+}
+
+func (p *postgresRateLimiter) failures(ctx context.Context, key string) (int, time.Duration, error) {
+	failed, err := p.db.GetLoginFailures(ctx, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(failed.Failures), time.Duration(failed.SecondsSince * float64(time.Second)), nil
+}
+
+func (p *postgresRateLimiter) resetFailures(ctx context.Context, key string) error {
+	return p.db.DeleteLoginFailures(ctx, key)
+}
+
+// sweep is the memory backend's sweep done in the table, by whichever
+// instance gets to it first
+func (p *postgresRateLimiter) sweep(ctx context.Context) {
+	p.mux.Lock()
+	if time.Since(p.lastSweep) < rateLimitSweepInterval {
+		p.mux.Unlock()
+		return
+	}
+	p.lastSweep = time.Now()
+	p.mux.Unlock()
+
+	if err := p.db.DeleteStaleRateLimits(ctx, rateLimitIdle.Seconds()); err != nil {
+		log.Printf("Failed to delete stale rate limits: %v", err)
+	}
+	if err := p.db.DeleteStaleLoginFailures(ctx, loginFailureReset.Seconds()); err != nil {
+		log.Printf("Failed to delete stale login failures: %v", err)
+	}
+}
+
+func respondTooManyRequests(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(retryAfter.Seconds()))))
+	respondWithError(w, http.StatusTooManyRequests, "Too many requests, try again later", nil)
+}
+
+// rateLimited limits next per client IP, and per username too when
+// usernameLimit is set and the JSON body has one. Without a backend, or when
+// the backend fails, requests go through.
+func (cfg *apiConfig) rateLimited(route string, ipLimit, usernameLimit rateLimit, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cfg.limiter == nil {
+			next(w, r)
+			return
+		}
+
+		type check struct {
+			key   string
+			limit rateLimit
+		}
+		checks := []check{{key: route + ":ip:" + cfg.clientIP(r), limit: ipLimit}}
+		if usernameLimit.burst > 0 {
+			if username := peekUsername(r); username != "" {
+				checks = append(checks, check{key: route + ":username:" + username, limit: usernameLimit})
+			}
+		}
+
+		for _, c := range checks {
+			wait, err := cfg.limiter.take(r.Context(), c.key, c.limit)
+			if err != nil {
+				log.Printf("Rate limiter failed, letting the request through: %v", err)
+				break
+			}
+			if wait > 0 {
+				respondTooManyRequests(w, wait)
+				return
+			}
+		}
+
+		next(w, r)
+	}
+}
+
+// peekUsername reads the username from a JSON body and puts the body back
+// for the handler
+func peekUsername(r *http.Request) string {
+	if r.Body == nil {
+		return ""
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+
+	var params struct {
+		Username string `json:"username"`
+	}
+	json.Unmarshal(body, &params)
+	return strings.ToLower(params.Username)
+}
+
+// loginLockedFor is how long the username has to wait before it may try to
+// login again
+func (cfg *apiConfig) loginLockedFor(ctx context.Context, username string) time.Duration {
+	if cfg.limiter == nil {
+		return 0
+	}
+
+	count, since, err := cfg.limiter.failures(ctx, "login:"+strings.ToLower(username))
+	if err != nil {
+		log.Printf("Failed to get login failures: %v", err)
+		return 0
+	}
+	if since > loginFailureReset {
+		return 0
+	}
+	return max(loginBackoff(count)-since, 0)
+}
+
+func (cfg *apiConfig) recordLoginFailure(ctx context.Context, username string) {
+	if cfg.limiter == nil {
+		return
+	}
+	if err := cfg.limiter.recordFailure(ctx, "login:"+strings.ToLower(username)); err != nil {
+		log.Printf("Failed to record login failure: %v", err)
+	}
+}
+
+func (cfg *apiConfig) resetLoginFailures(ctx context.Context, username string) {
+	if cfg.limiter == nil {
+		return
+	}
+	if err := cfg.limiter.resetFailures(ctx, "login:"+strings.ToLower(username)); err != nil {
+		log.Printf("Failed to reset login failures: %v", err)
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/auth"
+	"github.com/AradD7/Go-Knuclebones/internal/database"
+	"github.com/google/uuid"
+)
+
+// fakeClock stands in for time.Now in the memory rate limiter
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func newTestRateLimiter() (*memoryRateLimiter, *fakeClock) {
+	clock := &fakeClock{now: time.Now()}
+	limiter := newMemoryRateLimiter()
+	limiter.now = clock.Now
+	return limiter, clock
+}
+
+func TestMemoryRateLimiterRefill(t *testing.T) {
+	limiter, clock := newTestRateLimiter()
+	limit := rateLimit{burst: 2, every: 10 * time.Second}
+	ctx := context.Background()
+
+	take := func() time.Duration {
+		t.Helper()
+		wait, err := limiter.take(ctx, "key", limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return wait
+	}
+
+	if take() != 0 || take() != 0 {
+		t.Fatalf("The burst was not allowed")
+	}
+	if wait := take(); wait != 10*time.Second {
+		t.Errorf("Got wait %v with an empty bucket, want 10s", wait)
+	}
+
+	clock.now = clock.now.Add(5 * time.Second)
+	if wait := take(); wait != 5*time.Second {
+		t.Errorf("Got wait %v half way through the refill, want 5s", wait)
+	}
+
+	clock.now = clock.now.Add(5 * time.Second)
+	if wait := take(); wait != 0 {
+		t.Errorf("Got wait %v after the refill, want none", wait)
+	}
+
+	if wait, _ := limiter.take(ctx, "other", limit); wait != 0 {
+		t.Errorf("Another key shares the bucket, got wait %v", wait)
+	}
+}
+
+func TestLoginBackoff(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: freeLoginFailures - 1, want: 0},
+		{failures: freeLoginFailures, want: loginBackoffBase},
+		{failures: freeLoginFailures + 1, want: 2 * loginBackoffBase},
+		{failures: freeLoginFailures + 2, want: 4 * loginBackoffBase},
+		{failures: freeLoginFailures + 100, want: maxLoginBackoff},
+	}
+
+	for _, tt := range tests {
+		if got := loginBackoff(tt.failures); got != tt.want {
+			t.Errorf("loginBackoff(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimitedPerUsername(t *testing.T) {
+	limiter, _ := newTestRateLimiter()
+	cfg := &apiConfig{limiter: limiter}
+
+	handler := cfg.rateLimited("test", rateLimit{burst: 10, every: time.Minute}, rateLimit{burst: 1, every: time.Minute},
+		func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			if !strings.Contains(string(body), "username") {
+				t.Errorf("Handler got body %q, want the original", body)
+			}
+			w.WriteHeader(http.StatusOK)
+		})
+
+	send := func(username string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"username": "`+username+`"}`))
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+
+	if w := send("alice"); w.Code != http.StatusOK {
+		t.Fatalf("First request got %d", w.Code)
+	}
+	w := send("Alice")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Second request for the username got %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("Got Retry-After %q, want 60", got)
+	}
+	if w := send("bob"); w.Code != http.StatusOK {
+		t.Errorf("Another username got %d", w.Code)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	cfg := &apiConfig{trustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{name: "Direct", remoteAddr: "203.0.113.7:1234", want: "203.0.113.7"},
+		{name: "Forged header", remoteAddr: "203.0.113.7:1234", forwarded: []string{"198.51.100.1"}, want: "203.0.113.7"},
+		{name: "Behind the proxy", remoteAddr: "10.0.0.2:1234", forwarded: []string{"198.51.100.1"}, want: "198.51.100.1"},
+		{name: "Forged through the proxy", remoteAddr: "10.0.0.2:1234", forwarded: []string{"192.0.2.9, 198.51.100.1"}, want: "198.51.100.1"},
+		{name: "Proxy chain", remoteAddr: "10.0.0.2:1234", forwarded: []string{"198.51.100.1, 10.0.0.3", "10.0.0.4"}, want: "198.51.100.1"},
+		{name: "Proxy without header", remoteAddr: "10.0.0.2:1234", want: "10.0.0.2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			if got := cfg.clientIP(req); got != tt.want {
+				t.Errorf("Got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	hashedPassword, err := auth.HashPassword("pa55word")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	playerId := uuid.New()
+	limiter, clock := newTestRateLimiter()
+	cfg := &apiConfig{
+		tokenKeys: testKeys,
+		limiter:   limiter,
+		db: newStubDB(t, map[string]stubQuery{
+			"GetPlayerByUsername": func(args []driver.NamedValue) ([][]driver.Value, error) {
+				return [][]driver.Value{playerRow(playerId, hashedPassword, "player@example.com")}, nil
+			},
+			"GetPlayerTOTP":      func(args []driver.NamedValue) ([][]driver.Value, error) { return nil, nil },
+			"CreateSession":      createSessionStub,
+			"CreateRefreshToken": createRefreshTokenStub,
+		}),
+	}
+
+	login := func(password string) *httptest.ResponseRecorder {
+		body := strings.NewReader(`{"username": "player", "password": "` + password + `"}`)
+		req := httptest.NewRequest(http.MethodPost, "/api/players/login", body)
+		w := httptest.NewRecorder()
+		cfg.handlerPlayerLogin(w, req)
+		return w
+	}
+
+	for range freeLoginFailures {
+		if w := login("guess"); w.Code != http.StatusBadRequest {
+			t.Fatalf("Wrong password got %d, want 400", w.Code)
+		}
+	}
+
+	w := login("pa55word")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Login while locked got %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("Got Retry-After %q, want 30", got)
+	}
+
+	clock.now = clock.now.Add(loginBackoffBase)
+	if w := login("guess"); w.Code != http.StatusBadRequest {
+		t.Fatalf("Wrong password after the lockout got %d, want 400", w.Code)
+	}
+	if w := login("pa55word"); w.Header().Get("Retry-After") != "60" {
+		t.Errorf("Got Retry-After %q after another failure, want the lockout doubled to 60", w.Header().Get("Retry-After"))
+	}
+
+	clock.now = clock.now.Add(2 * loginBackoffBase)
+	if w := login("pa55word"); w.Code != http.StatusOK {
+		t.Fatalf("Correct password after the lockout got %d: %s", w.Code, w.Body.String())
+	}
+	if count, _, _ := limiter.failures(context.Background(), "login:player"); count != 0 {
+		t.Errorf("Got %d failures after a successful login, want them reset", count)
+	}
+}
+
+func TestPostgresRateLimiter(t *testing.T) {
+	dbURL := os.Getenv("TEST_DB_URL")
+	if dbURL == "" {
+		t.Skip("TEST_DB_URL not set")
+	}
+
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	// two limiters stand in for two API instances sharing the table
+	first := newPostgresRateLimiter(database.New(db))
+	second := newPostgresRateLimiter(database.New(db))
+	ctx := context.Background()
+	key := "test:" + uuid.NewString()
+	limit := rateLimit{burst: 2, every: time.Hour}
+
+	for i, limiter := range []*postgresRateLimiter{first, second} {
+		if wait, err := limiter.take(ctx, key, limit); err != nil || wait != 0 {
+			t.Fatalf("Take %d got wait %v, err %v", i, wait, err)
+		}
+	}
+	wait, err := first.take(ctx, key, limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wait < 59*time.Minute {
+		t.Errorf("Got wait %v once the shared bucket is empty, want about an hour", wait)
+	}
+
+	failKey := "login:" + uuid.NewString()
+	defer first.resetFailures(ctx, failKey)
+	for range 3 {
+		if err := second.recordFailure(ctx, failKey); err != nil {
+			t.Fatal(err)
+		}
+	}
+	count, since, err := first.failures(ctx, failKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 || since > time.Minute {
+		t.Errorf("Got %d failures %v ago, want 3 just now", count, since)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/auth"
+	"github.com/AradD7/Go-Knuclebones/internal/database"
+	"github.com/google/uuid"
+)
+
+type Session struct {
+	Id         uuid.UUID `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	UserAgent  string    `json:"user_agent"`
+	Ip         string    `json:"ip"`
+}
+
+// startSession is a new login on a device, it gets its own refresh token
+// so logging out one device doesn't log out the others
+func (cfg *apiConfig) startSession(r *http.Request, playerId uuid.UUID) (database.RefreshToken, error) {
+	session, err := cfg.db.CreateSession(r.Context(), database.CreateSessionParams{
+		PlayerID:  playerId,
+		UserAgent: r.UserAgent(),
+		Ip:        cfg.clientIP(r),
+	})
+	if err != nil {
+		return database.RefreshToken{}, err
+	}
+
+	return cfg.db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		Token:     auth.MakeRefreshToken(),
+		PlayerID:  playerId,
+		SessionID: session.ID,
+	})
+}
+
+// revokeSession logs a device out, every refresh token it was handed stops
+// working
+func (cfg *apiConfig) revokeSession(r *http.Request, sessionId, playerId uuid.UUID) (bool, error) {
+	revoked, err := cfg.db.RevokeSession(r.Context(), database.RevokeSessionParams{
+		ID:       sessionId,
+		PlayerID: playerId,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if err = cfg.db.RevokeRefreshTokensForSession(r.Context(), sessionId); err != nil {
+		return false, err
+	}
+	return revoked > 0, nil
+}
+
+// clientIP is the address the request came from. X-Forwarded-For is only
+// believed when the request comes from one of TRUSTED_PROXIES, and then the
+// client is the last entry that isn't another trusted proxy, anything before
+// it could have been sent by the client itself.
+func (cfg *apiConfig) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !cfg.trustedProxy(host) {
+		return host
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip := strings.TrimSpace(forwarded[i])
+		if ip == "" {
+			continue
+		}
+		host = ip
+		if !cfg.trustedProxy(ip) {
+			break
+		}
+	}
+	return host
+}
+
+func (cfg *apiConfig) trustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range cfg.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadTrustedProxies reads TRUSTED_PROXIES, a comma separated list of the
+// addresses or CIDR ranges of the proxies in front of the server
+func loadTrustedProxies() ([]netip.Prefix, error) {
+	var proxies []netip.Prefix
+	for _, value := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(value, "/") {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid TRUSTED_PROXIES entry %q: %v", value, err)
+			}
+			proxies = append(proxies, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TRUSTED_PROXIES entry %q: %v", value, err)
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
+}
+
+func (cfg *apiConfig) handlerGetSessions(w http.ResponseWriter, r *http.Request) {
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return
+	}
+
+	sessions, err := cfg.db.GetSessionsByPlayerId(r.Context(), player.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get sessions", err)
+		return
+	}
+
+	now := time.Now().UTC()
+	response := []Session{}
+	for _, session := range sessions {
+		if session.RevokedAt.Valid || now.After(session.ExpiresAt) {
+			continue
+		}
+		response = append(response, Session{
+			Id:         session.ID,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt:  session.ExpiresAt,
+			UserAgent:  session.UserAgent,
+			Ip:         session.Ip,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (cfg *apiConfig) handlerDeleteSession(w http.ResponseWriter, r *http.Request) {
+	player, ok := cfg.authenticatedPlayer(w, r)
+	if !ok {
+		return
+	}
+
+	sessionId, err := uuid.Parse(r.PathValue("session_id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Session ID is not valid", err)
+		return
+	}
+
+	revoked, err := cfg.revokeSession(r, sessionId, player.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to revoke session", err)
+		return
+	}
+	if !revoked {
+		respondWithError(w, http.StatusNotFound, "Session not found", nil)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, nil)
+}
@@ -1,12 +1,13 @@
 -- name: CreatePlayer :one
-INSERT INTO players (id, created_at, updated_at, username, email, hashed_password)
+INSERT INTO players (id, created_at, updated_at, username, email, hashed_password, locale)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
     $2,
-    $3
+    $3,
+    $4
 )
 RETURNING *;
 --
@@ -33,8 +34,8 @@ SET display_name = $2, avatar = $3, updated_at = NOW()
 WHERE id = $1;
 --
 
--- name: CreatePlayerWithGoogle :one
-INSERT INTO players (id, created_at, updated_at, username, google_id, email, display_name, email_verified)
+-- name: CreateOAuthPlayer :one
+INSERT INTO players (id, created_at, updated_at, username, email, display_name, email_verified, locale)
 VALUES (
     gen_random_uuid(),
     NOW(),
@@ -43,16 +44,11 @@ VALUES (
     $2,
     $3,
     $4,
-    TRUE
+    $5
 )
 RETURNING *;
 --
 
--- name: GetPlayerByGoogleId :one
-SELECT * FROM players
-WHERE google_id = $1;
---
-
 -- name: VerifyPlayerEmail :exec
 UPDATE players
 SET email_verified = true, updated_at = NOW()
@@ -63,3 +59,91 @@ WHERE id = $1;
 SELECT * FROM players
 WHERE email = $1;
 --
+
+-- name: UpdatePlayerPassword :exec
+UPDATE players
+SET hashed_password = $2, updated_at = NOW()
+WHERE id = $1;
+--
+
+-- name: UpdatePlayerEmail :exec
+UPDATE players
+SET email = $2, email_verified = TRUE, updated_at = NOW()
+WHERE id = $1;
+--
+
+-- name: AnonymizePlayer :exec
+UPDATE players
+SET username = 'deleted-' || id::TEXT,
+    avatar = '008',
+    hashed_password = NULL,
+    display_name = 'Deleted player',
+    email = NULL,
+    email_verified = FALSE,
+    deleted_at = NOW(),
+    updated_at = NOW()
+WHERE id = $1;
+--
+
+-- name: CreateGuestPlayer :one
+INSERT INTO players (id, created_at, updated_at, username, display_name, is_guest, locale)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    'Guest',
+    TRUE,
+    $2
+)
+RETURNING *;
+--
+
+-- name: UpgradeGuestPlayer :one
+UPDATE players
+SET username = $2,
+    email = $3,
+    hashed_password = $4,
+    email_verified = FALSE,
+    is_guest = FALSE,
+    updated_at = NOW()
+WHERE id = $1 AND is_guest
+RETURNING *;
+--
+
+-- name: UpgradeGuestWithOAuth :one
+UPDATE players
+SET email = $2,
+    display_name = COALESCE(sqlc.narg(display_name), display_name),
+    email_verified = $3,
+    is_guest = FALSE,
+    updated_at = NOW()
+WHERE id = $1 AND is_guest
+RETURNING *;
+--
+
+-- name: UpdatePlayerLocale :exec
+UPDATE players
+SET locale = $2, updated_at = NOW()
+WHERE id = $1;
+--
+
+-- name: SearchPlayersByUsername :many
+SELECT * FROM players
+WHERE username ILIKE $1 AND id <> $2 AND deleted_at IS NULL AND NOT is_guest
+ORDER BY username
+LIMIT $3;
+--
+
+-- name: SetPlayerBot :exec
+UPDATE players
+SET is_bot = $2, updated_at = NOW()
+WHERE id = $1;
+--
+
+-- name: IsActivePlayer :one
+SELECT EXISTS (
+    SELECT 1 FROM players
+    WHERE id = $1 AND deleted_at IS NULL
+);
+--
@@ -16,6 +16,11 @@ SET game_id = $2, updated_at = NOW()
 WHERE id = $1;
 --
 
+-- name: DeleteBoard :exec
+DELETE FROM boards
+WHERE id = $1;
+--
+
 -- name: GetPlayerUsernameByBoardId :one
 SELECT players.username
 FROM boards
@@ -39,3 +44,9 @@ SET board = $2, score = $3, updated_at = NOW()
 WHERE id = $1;
 --
 
+
+-- name: GetBoardsByPlayerId :many
+SELECT * FROM boards
+WHERE player_id = $1
+ORDER BY created_at;
+--
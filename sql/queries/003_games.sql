@@ -1,11 +1,12 @@
 -- name: CreateNewGame :one
-INSERT INTO games(id, created_at, updated_at, board1, board2)
+INSERT INTO games(id, created_at, updated_at, board1, board2, turn_timeout_seconds)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3
 )
 RETURNING *;
 
@@ -23,7 +24,10 @@ SELECT
         WHEN b1.player_id = $1 THEN p2.display_name
         ELSE p1.display_name
     END::TEXT AS opponent_name,
-    g.winner AS winner_id
+    g.winner AS winner_id,
+    g.player_turn,
+    g.turn_timeout_seconds,
+    g.turn_started_at
 FROM games g
 JOIN boards b1 ON g.board1 = b1.id
 JOIN boards b2 ON g.board2 = b2.id
@@ -33,6 +37,7 @@ WHERE (b1.player_id = $1 OR b2.player_id = $1)
     AND (
         b1.board != '[[0, 0, 0], [0, 0, 0], [0, 0, 0]]'::jsonb
         OR b2.board != '[[0, 0, 0], [0, 0, 0], [0, 0, 0]]'::jsonb
+        OR g.turn_timeout_seconds IS NOT NULL
     );
 --
 
@@ -47,15 +52,15 @@ SET updated_at = NOW()
 WHERE id = $1;
 --
 
--- name: JoinGame :exec
+-- name: JoinGame :execrows
 UPDATE games
-SET board2 = $2, updated_at = NOW()
-WHERE id = $1;
+SET board2 = $2, invite_code_hash = NULL, updated_at = NOW()
+WHERE id = $1 AND board2 IS NULL;
 --
 
 -- name: SetPlayerTurn :exec
 UPDATE games
-SET player_turn = $2, updated_at = NOW()
+SET player_turn = $2, turn_started_at = NOW(), reminder_sent_at = NULL, updated_at = NOW()
 WHERE id = $1;
 --
 
@@ -66,3 +71,148 @@ WHERE games.board1 = boards.id
   AND boards.player_id = $1
   AND games.board2 IS NULL;
 --
+
+-- name: NextGameEventSeq :one
+UPDATE games
+SET event_seq = event_seq + 1
+WHERE id = $1
+RETURNING event_seq;
+--
+
+-- name: SetLastRoll :exec
+UPDATE games
+SET last_roll = $2, updated_at = NOW()
+WHERE id = $1;
+--
+
+-- name: SetPlayerRoll :execrows
+UPDATE games
+SET last_roll = $2, updated_at = NOW()
+WHERE id = $1
+  AND player_turn = $3
+  AND last_roll IS NULL
+  AND winner IS NULL
+  AND player_turn NOT IN (SELECT id FROM players WHERE is_bot);
+--
+
+-- name: GetGamesByPlayerId :many
+SELECT * FROM games
+WHERE id IN (SELECT game_id FROM boards WHERE player_id = $1)
+ORDER BY created_at;
+--
+
+-- name: CreatePrivateGame :one
+INSERT INTO games(id, created_at, updated_at, board1, is_private, invited_player, invite_code_hash, turn_timeout_seconds)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    TRUE,
+    $2,
+    $3,
+    $4
+)
+RETURNING *;
+--
+
+-- name: DeleteEmptyPublicGamesForPlayer :exec
+DELETE FROM games
+USING boards
+WHERE games.board1 = boards.id
+  AND boards.player_id = $1
+  AND games.board2 IS NULL
+  AND NOT games.is_private
+  AND games.turn_timeout_seconds IS NULL;
+--
+
+-- name: GetPendingInvites :many
+SELECT games.id, games.created_at, players.id AS player_id, players.username, players.display_name, players.avatar
+FROM games
+JOIN boards ON games.board1 = boards.id
+JOIN players ON boards.player_id = players.id
+WHERE games.invited_player = $1
+  AND games.board2 IS NULL
+ORDER BY games.created_at DESC;
+--
+
+-- name: DeleteGameInvite :execrows
+DELETE FROM games
+USING boards
+WHERE games.id = $1
+  AND games.board1 = boards.id
+  AND boards.player_id = $2
+  AND games.is_private
+  AND games.board2 IS NULL;
+--
+
+-- name: DeclineGameInvite :execrows
+DELETE FROM games
+WHERE id = $1
+  AND invited_player = $2
+  AND board2 IS NULL;
+--
+
+-- name: DeleteInvitesForPlayer :exec
+DELETE FROM games
+WHERE invited_player = $1
+  AND board2 IS NULL;
+--
+
+-- name: CountActiveCorrespondenceGames :one
+SELECT COUNT(*) FROM games
+JOIN boards ON boards.id IN (games.board1, games.board2)
+WHERE boards.player_id = $1
+  AND games.turn_timeout_seconds IS NOT NULL
+  AND games.winner IS NULL;
+--
+
+-- name: ForfeitExpiredGames :many
+UPDATE games
+SET winner = CASE WHEN b1.player_id = games.player_turn THEN b2.player_id ELSE b1.player_id END,
+    updated_at = NOW()
+FROM boards b1, boards b2
+WHERE games.board1 = b1.id
+  AND games.board2 = b2.id
+  AND games.turn_timeout_seconds IS NOT NULL
+  AND games.winner IS NULL
+  AND games.turn_started_at + make_interval(secs => games.turn_timeout_seconds) < NOW()
+RETURNING games.id, games.winner, games.player_turn;
+--
+
+-- name: ClaimTurnReminders :many
+UPDATE games
+SET reminder_sent_at = NOW()
+FROM boards, players
+WHERE games.id IN (
+    SELECT due.id FROM games due
+    LEFT JOIN notification_preferences ON notification_preferences.player_id = due.player_turn
+    WHERE due.turn_timeout_seconds IS NOT NULL
+      AND due.winner IS NULL
+      AND due.reminder_sent_at IS NULL
+      AND due.turn_started_at + make_interval(secs => LEAST(sqlc.arg(remind_after)::FLOAT8, due.turn_timeout_seconds / 2.0)) <= NOW()
+      AND COALESCE(notification_preferences.turn_reminders, TRUE)
+    LIMIT sqlc.arg(batch_size)
+    FOR UPDATE OF due SKIP LOCKED
+)
+  AND boards.id IN (games.board1, games.board2)
+  AND boards.player_id != games.player_turn
+  AND players.id = boards.player_id
+RETURNING games.id, games.player_turn, games.turn_started_at, games.turn_timeout_seconds, players.username AS opponent_username, players.display_name AS opponent_display_name;
+--
+
+-- name: SetBotRoll :one
+UPDATE games
+SET last_roll = $2, updated_at = NOW()
+WHERE id = $1
+  AND winner IS NULL
+  AND last_roll IS NULL
+  AND player_turn IN (SELECT id FROM players WHERE is_bot)
+RETURNING player_turn;
+--
+
+-- name: GetPlayerTurns :many
+SELECT id, last_roll FROM games
+WHERE player_turn = $1 AND winner IS NULL AND board2 IS NOT NULL
+ORDER BY turn_started_at;
+--
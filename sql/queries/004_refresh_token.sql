@@ -1,11 +1,12 @@
 -- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (token, created_at, updated_at, player_id, expires_at)
+INSERT INTO refresh_tokens (token, created_at, updated_at, player_id, expires_at, session_id)
 VALUES (
     $1,
     NOW(),
     NOW(),
     $2,
-    NOW() AT TIME ZONE 'UTC' + INTERVAL '7 days'
+    NOW() AT TIME ZONE 'UTC' + INTERVAL '7 days',
+    $3
 )
 RETURNING *;
 --
@@ -21,12 +22,25 @@ SET revoked_at = NOW() AT TIME ZONE 'UTC', updated_at = NOW() AT TIME ZONE 'UTC'
 WHERE token = $1;
 --
 
--- name: GetRefreshTokenFromPlayerId :one
-SELECT * FROM refresh_tokens
-WHERE player_id = $1 AND (revoked_at != NULL OR expires_at >= NOW() AT TIME ZONE 'UTC');
---
-
 -- name: DeleteRefreshToken :exec
 DELETE FROM refresh_tokens
 WHERE token = $1;
 --
+
+-- name: RevokeAllRefreshTokensForPlayer :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW() AT TIME ZONE 'UTC', updated_at = NOW() AT TIME ZONE 'UTC'
+WHERE player_id = $1 AND revoked_at IS NULL;
+--
+
+-- name: ConsumeRefreshToken :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW() AT TIME ZONE 'UTC', updated_at = NOW() AT TIME ZONE 'UTC'
+WHERE token = $1 AND revoked_at IS NULL;
+--
+
+-- name: RevokeRefreshTokensForSession :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW() AT TIME ZONE 'UTC', updated_at = NOW() AT TIME ZONE 'UTC'
+WHERE session_id = $1 AND revoked_at IS NULL;
+--
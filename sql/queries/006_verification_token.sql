@@ -1,10 +1,12 @@
 -- name: CreateVerificationToken :one
-INSERT INTO verification_tokens (token_hash, player_id, expires_at, created_at)
+INSERT INTO verification_tokens (token_hash, player_id, expires_at, created_at, purpose, payload)
 VALUES (
-    $1,
-    $2,
-    NOW() AT TIME ZONE 'UTC' + INTERVAL '2 hours',
-    NOW() AT TIME ZONE 'UTC'
+    sqlc.arg(token_hash),
+    sqlc.arg(player_id),
+    NOW() AT TIME ZONE 'UTC' + make_interval(mins => sqlc.arg(expires_in_minutes)::INT),
+    NOW() AT TIME ZONE 'UTC',
+    sqlc.arg(purpose),
+    sqlc.narg(payload)
 )
 RETURNING *;
 --
@@ -16,10 +18,26 @@ WHERE token_hash = $1;
 
 -- name: GetVerificationToken :one
 SELECT * FROM verification_tokens
-WHERE token_hash = $1;
+WHERE token_hash = $1 AND purpose = $2;
 --
 
 -- name: GetVerificationTokenByPlayerId :one
 SELECT * FROM verification_tokens
+WHERE player_id = $1 AND purpose = $2;
+--
+
+-- name: DeleteVerificationTokensForPlayer :exec
+DELETE FROM verification_tokens
+WHERE player_id = $1 AND purpose = $2;
+--
+
+-- name: DeleteAllVerificationTokensForPlayer :exec
+DELETE FROM verification_tokens
 WHERE player_id = $1;
 --
+
+-- name: GetVerificationTokensByPlayerId :many
+SELECT * FROM verification_tokens
+WHERE player_id = $1
+ORDER BY created_at;
+--
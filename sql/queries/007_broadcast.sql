@@ -0,0 +1,3 @@
+-- name: NotifyGameEvent :exec
+SELECT pg_notify('game_events', sqlc.arg(payload)::TEXT);
+--
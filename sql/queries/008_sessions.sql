@@ -0,0 +1,47 @@
+-- name: CreateSession :one
+INSERT INTO sessions (id, player_id, created_at, last_used_at, expires_at, user_agent, ip)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    NOW(),
+    NOW(),
+    NOW() AT TIME ZONE 'UTC' + INTERVAL '7 days',
+    $2,
+    $3
+)
+RETURNING *;
+--
+
+-- name: GetSessionById :one
+SELECT * FROM sessions
+WHERE id = $1;
+--
+
+-- name: GetSessionsByPlayerId :many
+SELECT * FROM sessions
+WHERE player_id = $1
+ORDER BY last_used_at DESC;
+--
+
+-- name: TouchSession :exec
+UPDATE sessions
+SET last_used_at = NOW(), expires_at = NOW() AT TIME ZONE 'UTC' + INTERVAL '7 days', user_agent = $2, ip = $3
+WHERE id = $1;
+--
+
+-- name: RevokeSession :execrows
+UPDATE sessions
+SET revoked_at = NOW() AT TIME ZONE 'UTC'
+WHERE id = $1 AND player_id = $2 AND revoked_at IS NULL;
+--
+
+-- name: RevokeAllSessionsForPlayer :exec
+UPDATE sessions
+SET revoked_at = NOW() AT TIME ZONE 'UTC'
+WHERE player_id = $1 AND revoked_at IS NULL;
+--
+
+-- name: DeleteSessionsForPlayer :exec
+DELETE FROM sessions
+WHERE player_id = $1;
+--
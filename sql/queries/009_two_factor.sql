@@ -0,0 +1,59 @@
+-- name: CreatePlayerTOTP :one
+INSERT INTO player_totp (player_id, secret, created_at)
+VALUES (
+    $1,
+    $2,
+    NOW()
+)
+ON CONFLICT (player_id) DO UPDATE
+SET secret = EXCLUDED.secret, created_at = NOW(), confirmed_at = NULL, last_counter = 0
+RETURNING *;
+--
+
+-- name: GetPlayerTOTP :one
+SELECT * FROM player_totp
+WHERE player_id = $1;
+--
+
+-- name: ConfirmPlayerTOTP :exec
+UPDATE player_totp
+SET confirmed_at = NOW(), last_counter = $2
+WHERE player_id = $1;
+--
+
+-- name: UseTOTPCounter :execrows
+UPDATE player_totp
+SET last_counter = $2
+WHERE player_id = $1 AND last_counter < $2;
+--
+
+-- name: DeletePlayerTOTP :exec
+DELETE FROM player_totp
+WHERE player_id = $1;
+--
+
+-- name: CreateRecoveryCode :exec
+INSERT INTO recovery_codes (id, player_id, code_hash, created_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    NOW()
+);
+--
+
+-- name: GetUnusedRecoveryCodes :many
+SELECT * FROM recovery_codes
+WHERE player_id = $1 AND used_at IS NULL;
+--
+
+-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes
+SET used_at = NOW()
+WHERE id = $1 AND used_at IS NULL;
+--
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_codes
+WHERE player_id = $1;
+--
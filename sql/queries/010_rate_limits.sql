@@ -0,0 +1,41 @@
+-- name: TakeRateLimitToken :one
+INSERT INTO rate_limit_buckets (key, tokens, allowed, updated_at)
+VALUES (sqlc.arg(key), sqlc.arg(burst)::FLOAT8 - 1, TRUE, NOW())
+ON CONFLICT (key) DO UPDATE SET
+    tokens = LEAST(sqlc.arg(burst)::FLOAT8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM NOW() - rate_limit_buckets.updated_at)::FLOAT8 * sqlc.arg(per_second)::FLOAT8)
+        - CASE WHEN LEAST(sqlc.arg(burst)::FLOAT8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM NOW() - rate_limit_buckets.updated_at)::FLOAT8 * sqlc.arg(per_second)::FLOAT8) >= 1 THEN 1 ELSE 0 END,
+    allowed = LEAST(sqlc.arg(burst)::FLOAT8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM NOW() - rate_limit_buckets.updated_at)::FLOAT8 * sqlc.arg(per_second)::FLOAT8) >= 1,
+    updated_at = NOW()
+RETURNING tokens, allowed;
+--
+
+-- name: RecordLoginFailure :exec
+INSERT INTO login_failures (key, failures, last_failed_at)
+VALUES (sqlc.arg(key), 1, NOW())
+ON CONFLICT (key) DO UPDATE SET
+    failures = CASE
+        WHEN login_failures.last_failed_at < NOW() - make_interval(secs => sqlc.arg(reset_after)::FLOAT8) THEN 1
+        ELSE login_failures.failures + 1
+    END,
+    last_failed_at = NOW();
+--
+
+-- name: GetLoginFailures :one
+SELECT failures, EXTRACT(EPOCH FROM NOW() - last_failed_at)::FLOAT8 AS seconds_since FROM login_failures
+WHERE key = $1;
+--
+
+-- name: DeleteLoginFailures :exec
+DELETE FROM login_failures
+WHERE key = $1;
+--
+
+-- name: DeleteStaleRateLimits :exec
+DELETE FROM rate_limit_buckets
+WHERE updated_at < NOW() - make_interval(secs => sqlc.arg(older_than)::FLOAT8);
+--
+
+-- name: DeleteStaleLoginFailures :exec
+DELETE FROM login_failures
+WHERE last_failed_at < NOW() - make_interval(secs => sqlc.arg(older_than)::FLOAT8);
+--
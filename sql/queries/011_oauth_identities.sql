@@ -0,0 +1,34 @@
+-- name: CreateOAuthIdentity :one
+INSERT INTO oauth_identities (id, player_id, provider, subject, email, created_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    $4,
+    NOW()
+)
+RETURNING *;
+--
+
+-- name: GetPlayerByOAuthIdentity :one
+SELECT players.* FROM players
+JOIN oauth_identities ON players.id = oauth_identities.player_id
+WHERE oauth_identities.provider = $1 AND oauth_identities.subject = $2;
+--
+
+-- name: GetOAuthIdentitiesByPlayerId :many
+SELECT * FROM oauth_identities
+WHERE player_id = $1
+ORDER BY created_at;
+--
+
+-- name: DeleteOAuthIdentity :execrows
+DELETE FROM oauth_identities
+WHERE player_id = $1 AND provider = $2;
+--
+
+-- name: DeleteOAuthIdentitiesForPlayer :exec
+DELETE FROM oauth_identities
+WHERE player_id = $1;
+--
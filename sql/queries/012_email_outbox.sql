@@ -0,0 +1,62 @@
+-- name: EnqueueEmail :one
+INSERT INTO email_outbox (id, recipient, subject, html, text, next_attempt_at, created_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    $4,
+    NOW(),
+    NOW()
+)
+RETURNING *;
+--
+
+-- name: ClaimDueEmails :many
+UPDATE email_outbox
+SET next_attempt_at = NOW() + make_interval(secs => sqlc.arg(lease)::FLOAT8)
+WHERE id IN (
+    SELECT id FROM email_outbox
+    WHERE sent_at IS NULL AND failed_at IS NULL AND next_attempt_at <= NOW()
+    ORDER BY next_attempt_at
+    LIMIT sqlc.arg(batch_size)
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+--
+
+-- name: MarkEmailSent :exec
+UPDATE email_outbox
+SET sent_at = NOW(), attempts = attempts + 1, html = '', text = ''
+WHERE id = $1;
+--
+
+-- name: RetryEmail :exec
+UPDATE email_outbox
+SET attempts = attempts + 1, last_error = $2, next_attempt_at = NOW() + make_interval(secs => sqlc.arg(delay)::FLOAT8)
+WHERE id = $1;
+--
+
+-- name: FailEmail :exec
+UPDATE email_outbox
+SET attempts = attempts + 1, last_error = $2, failed_at = NOW()
+WHERE id = $1;
+--
+
+-- name: GetFailedEmails :many
+SELECT * FROM email_outbox
+WHERE failed_at IS NOT NULL
+ORDER BY failed_at DESC
+LIMIT $1;
+--
+
+-- name: RequeueFailedEmail :execrows
+UPDATE email_outbox
+SET failed_at = NULL, attempts = 0, next_attempt_at = NOW()
+WHERE id = $1 AND failed_at IS NOT NULL;
+--
+
+-- name: DeleteSentEmails :exec
+DELETE FROM email_outbox
+WHERE sent_at < NOW() - make_interval(secs => sqlc.arg(older_than)::FLOAT8);
+--
@@ -0,0 +1,60 @@
+-- name: CreateFriendRequest :one
+INSERT INTO friendships (requester_id, addressee_id, status, created_at)
+VALUES (
+    $1,
+    $2,
+    'pending',
+    NOW()
+)
+ON CONFLICT DO NOTHING
+RETURNING *;
+--
+
+-- name: GetFriendship :one
+SELECT * FROM friendships
+WHERE (requester_id = $1 AND addressee_id = $2)
+   OR (requester_id = $2 AND addressee_id = $1);
+--
+
+-- name: AcceptFriendRequest :execrows
+UPDATE friendships
+SET status = 'accepted', accepted_at = NOW()
+WHERE requester_id = $1 AND addressee_id = $2 AND status = 'pending';
+--
+
+-- name: DeclineFriendRequest :execrows
+DELETE FROM friendships
+WHERE requester_id = $1 AND addressee_id = $2 AND status = 'pending';
+--
+
+-- name: DeleteFriendship :execrows
+DELETE FROM friendships
+WHERE (requester_id = $1 AND addressee_id = $2)
+   OR (requester_id = $2 AND addressee_id = $1);
+--
+
+-- name: GetFriends :many
+SELECT players.id, players.username, players.display_name, players.avatar, friendships.accepted_at FROM friendships
+JOIN players ON players.id = CASE WHEN friendships.requester_id = $1 THEN friendships.addressee_id ELSE friendships.requester_id END
+WHERE (friendships.requester_id = $1 OR friendships.addressee_id = $1) AND friendships.status = 'accepted'
+ORDER BY players.username;
+--
+
+-- name: GetIncomingFriendRequests :many
+SELECT players.id, players.username, players.display_name, players.avatar, friendships.created_at FROM friendships
+JOIN players ON players.id = friendships.requester_id
+WHERE friendships.addressee_id = $1 AND friendships.status = 'pending'
+ORDER BY friendships.created_at DESC;
+--
+
+-- name: GetOutgoingFriendRequests :many
+SELECT players.id, players.username, players.display_name, players.avatar, friendships.created_at FROM friendships
+JOIN players ON players.id = friendships.addressee_id
+WHERE friendships.requester_id = $1 AND friendships.status = 'pending'
+ORDER BY friendships.created_at DESC;
+--
+
+-- name: DeleteFriendshipsForPlayer :exec
+DELETE FROM friendships
+WHERE requester_id = $1 OR addressee_id = $1;
+--
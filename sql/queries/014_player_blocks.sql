@@ -0,0 +1,58 @@
+-- name: BlockPlayer :exec
+INSERT INTO player_blocks (blocker_id, blocked_id, created_at)
+VALUES (
+    $1,
+    $2,
+    NOW()
+)
+ON CONFLICT DO NOTHING;
+--
+
+-- name: UnblockPlayer :execrows
+DELETE FROM player_blocks
+WHERE blocker_id = $1 AND blocked_id = $2;
+--
+
+-- name: GetBlockedPlayers :many
+SELECT players.id, players.username, players.display_name, players.avatar, player_blocks.created_at
+FROM player_blocks
+JOIN players ON players.id = player_blocks.blocked_id
+WHERE player_blocks.blocker_id = $1
+ORDER BY player_blocks.created_at DESC;
+--
+
+-- name: IsBlockedBetween :one
+SELECT EXISTS (
+    SELECT 1 FROM player_blocks
+    WHERE (blocker_id = $1 AND blocked_id = $2)
+       OR (blocker_id = $2 AND blocked_id = $1)
+);
+--
+
+-- name: IsBlockedFromGame :one
+SELECT EXISTS (
+    SELECT 1 FROM boards, player_blocks
+    WHERE boards.game_id = sqlc.arg(game_id)
+      AND (
+        (player_blocks.blocker_id = boards.player_id AND player_blocks.blocked_id = sqlc.arg(player_id)::uuid)
+        OR (player_blocks.blocked_id = boards.player_id AND player_blocks.blocker_id = sqlc.arg(player_id)::uuid)
+      )
+);
+--
+
+-- name: DeleteInvitesBetweenPlayers :exec
+DELETE FROM games
+USING boards
+WHERE games.board1 = boards.id
+  AND games.board2 IS NULL
+  AND games.is_private
+  AND (
+    (boards.player_id = sqlc.arg(blocker_id)::uuid AND games.invited_player = sqlc.arg(blocked_id)::uuid)
+    OR (boards.player_id = sqlc.arg(blocked_id)::uuid AND games.invited_player = sqlc.arg(blocker_id)::uuid)
+  );
+--
+
+-- name: DeleteBlocksForPlayer :exec
+DELETE FROM player_blocks
+WHERE blocker_id = $1 OR blocked_id = $1;
+--
@@ -0,0 +1,45 @@
+-- name: CreatePlayerReport :one
+INSERT INTO player_reports (id, reporter_id, reported_id, reason, details, game_id, created_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    NOW()
+)
+ON CONFLICT DO NOTHING
+RETURNING *;
+--
+
+-- name: GetOpenReports :many
+SELECT
+    player_reports.id,
+    player_reports.reporter_id,
+    reporter.username AS reporter_username,
+    player_reports.reported_id,
+    reported.username AS reported_username,
+    player_reports.reason,
+    player_reports.details,
+    player_reports.game_id,
+    player_reports.created_at
+FROM player_reports
+JOIN players reporter ON reporter.id = player_reports.reporter_id
+JOIN players reported ON reported.id = player_reports.reported_id
+WHERE player_reports.resolved_at IS NULL
+ORDER BY player_reports.created_at
+LIMIT $1;
+--
+
+-- name: GetReportsByReporterId :many
+SELECT * FROM player_reports
+WHERE reporter_id = $1
+ORDER BY created_at;
+--
+
+-- name: ResolvePlayerReport :execrows
+UPDATE player_reports
+SET resolved_at = NOW()
+WHERE id = $1 AND resolved_at IS NULL;
+--
@@ -0,0 +1,49 @@
+-- name: CreateNotification :one
+INSERT INTO notifications (id, player_id, type, game_id, actor_id, created_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    $4,
+    NOW()
+)
+RETURNING *;
+--
+
+-- name: GetNotifications :many
+SELECT notifications.id, notifications.type, notifications.game_id, notifications.actor_id, players.username, players.display_name, players.avatar, notifications.created_at, notifications.read_at
+FROM notifications
+LEFT JOIN players ON players.id = notifications.actor_id
+WHERE notifications.player_id = $1
+ORDER BY notifications.created_at DESC
+LIMIT $2;
+--
+
+-- name: GetNotificationsByPlayerId :many
+SELECT * FROM notifications
+WHERE player_id = $1
+ORDER BY created_at;
+--
+
+-- name: CountUnreadNotifications :one
+SELECT COUNT(*) FROM notifications
+WHERE player_id = $1 AND read_at IS NULL;
+--
+
+-- name: MarkNotificationRead :execrows
+UPDATE notifications
+SET read_at = COALESCE(read_at, NOW())
+WHERE id = $1 AND player_id = $2;
+--
+
+-- name: MarkAllNotificationsRead :exec
+UPDATE notifications
+SET read_at = NOW()
+WHERE player_id = $1 AND read_at IS NULL;
+--
+
+-- name: DeleteNotificationsForPlayer :exec
+DELETE FROM notifications
+WHERE player_id = $1;
+--
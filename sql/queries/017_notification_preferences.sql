@@ -0,0 +1,21 @@
+-- name: GetNotificationPreferences :one
+SELECT * FROM notification_preferences
+WHERE player_id = $1;
+--
+
+-- name: UpsertNotificationPreferences :one
+INSERT INTO notification_preferences (player_id, turn_reminders, updated_at)
+VALUES (
+    $1,
+    $2,
+    NOW()
+)
+ON CONFLICT (player_id) DO UPDATE
+SET turn_reminders = EXCLUDED.turn_reminders, updated_at = NOW()
+RETURNING *;
+--
+
+-- name: DeleteNotificationPreferencesForPlayer :exec
+DELETE FROM notification_preferences
+WHERE player_id = $1;
+--
@@ -0,0 +1,92 @@
+-- name: CreateWebhook :one
+INSERT INTO webhooks (id, player_id, url, secret, events, created_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    $4,
+    NOW()
+)
+RETURNING *;
+--
+
+-- name: GetWebhooks :many
+SELECT * FROM webhooks
+WHERE player_id IS NOT DISTINCT FROM $1
+ORDER BY created_at;
+--
+
+-- name: GetWebhook :one
+SELECT * FROM webhooks
+WHERE id = $1 AND player_id IS NOT DISTINCT FROM $2;
+--
+
+-- name: CountWebhooks :one
+SELECT COUNT(*) FROM webhooks
+WHERE player_id IS NOT DISTINCT FROM $1;
+--
+
+-- name: DeleteWebhook :execrows
+DELETE FROM webhooks
+WHERE id = $1 AND player_id IS NOT DISTINCT FROM $2;
+--
+
+-- name: DeleteWebhooksForPlayer :exec
+DELETE FROM webhooks
+WHERE player_id = $1;
+--
+
+-- name: EnqueueWebhookDeliveries :execrows
+INSERT INTO webhook_deliveries (id, webhook_id, event, payload, next_attempt_at, created_at)
+SELECT gen_random_uuid(), webhooks.id, sqlc.arg(event)::TEXT, sqlc.arg(payload)::TEXT, NOW(), NOW()
+FROM webhooks
+WHERE sqlc.arg(event)::TEXT = ANY(webhooks.events)
+  AND (webhooks.player_id IS NULL OR webhooks.player_id = ANY(sqlc.arg(player_ids)::UUID[]));
+--
+
+-- name: ClaimDueWebhookDeliveries :many
+UPDATE webhook_deliveries
+SET next_attempt_at = NOW() + make_interval(secs => sqlc.arg(lease)::FLOAT8)
+FROM webhooks
+WHERE webhook_deliveries.id IN (
+    SELECT id FROM webhook_deliveries
+    WHERE delivered_at IS NULL AND failed_at IS NULL AND next_attempt_at <= NOW()
+    ORDER BY next_attempt_at
+    LIMIT sqlc.arg(batch_size)
+    FOR UPDATE SKIP LOCKED
+)
+  AND webhooks.id = webhook_deliveries.webhook_id
+RETURNING webhook_deliveries.id, webhook_deliveries.event, webhook_deliveries.payload, webhook_deliveries.attempts, webhooks.url, webhooks.secret, webhooks.player_id;
+--
+
+-- name: MarkWebhookDelivered :exec
+UPDATE webhook_deliveries
+SET attempts = attempts + 1, last_status = $2, last_error = NULL, delivered_at = NOW()
+WHERE id = $1;
+--
+
+-- name: RetryWebhookDelivery :exec
+UPDATE webhook_deliveries
+SET attempts = attempts + 1, last_status = $2, last_error = $3, next_attempt_at = NOW() + make_interval(secs => sqlc.arg(delay)::FLOAT8)
+WHERE id = $1;
+--
+
+-- name: FailWebhookDelivery :exec
+UPDATE webhook_deliveries
+SET attempts = attempts + 1, last_status = $2, last_error = $3, failed_at = NOW()
+WHERE id = $1;
+--
+
+-- name: GetWebhookDeliveries :many
+SELECT * FROM webhook_deliveries
+WHERE webhook_id = $1
+ORDER BY created_at DESC
+LIMIT $2;
+--
+
+-- name: DeleteOldWebhookDeliveries :exec
+DELETE FROM webhook_deliveries
+WHERE created_at < NOW() - make_interval(secs => sqlc.arg(older_than)::FLOAT8)
+  AND (delivered_at IS NOT NULL OR failed_at IS NOT NULL);
+--
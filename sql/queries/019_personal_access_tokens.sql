@@ -0,0 +1,47 @@
+-- name: CreatePersonalAccessToken :one
+INSERT INTO personal_access_tokens (id, player_id, name, token_hash, scopes, created_at, expires_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    $4,
+    NOW(),
+    $5
+)
+RETURNING *;
+--
+
+-- name: GetPersonalAccessTokens :many
+SELECT * FROM personal_access_tokens
+WHERE player_id = $1
+ORDER BY created_at;
+--
+
+-- name: CountPersonalAccessTokens :one
+SELECT COUNT(*) FROM personal_access_tokens
+WHERE player_id = $1;
+--
+
+-- name: GetPersonalAccessTokenByHash :one
+SELECT personal_access_tokens.id, personal_access_tokens.player_id, personal_access_tokens.scopes, personal_access_tokens.expires_at, players.is_bot, players.deleted_at
+FROM personal_access_tokens
+JOIN players ON players.id = personal_access_tokens.player_id
+WHERE personal_access_tokens.token_hash = $1;
+--
+
+-- name: TouchPersonalAccessToken :exec
+UPDATE personal_access_tokens
+SET last_used_at = NOW()
+WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute');
+--
+
+-- name: DeletePersonalAccessToken :execrows
+DELETE FROM personal_access_tokens
+WHERE id = $1 AND player_id = $2;
+--
+
+-- name: DeletePersonalAccessTokensForPlayer :exec
+DELETE FROM personal_access_tokens
+WHERE player_id = $1;
+--
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE games
+ADD COLUMN event_seq BIGINT NOT NULL DEFAULT 0,
+ADD COLUMN last_roll INTEGER;
+
+-- +goose Down
+ALTER TABLE games
+DROP COLUMN event_seq,
+DROP COLUMN last_roll;
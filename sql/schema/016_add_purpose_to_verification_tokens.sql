@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE verification_tokens
+ADD COLUMN purpose TEXT NOT NULL DEFAULT 'email_verification';
+
+-- +goose Down
+ALTER TABLE verification_tokens
+DROP COLUMN purpose;
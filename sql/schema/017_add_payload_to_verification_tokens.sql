@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE verification_tokens
+ADD COLUMN payload TEXT;
+
+-- +goose Down
+ALTER TABLE verification_tokens
+DROP COLUMN payload;
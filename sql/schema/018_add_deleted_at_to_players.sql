@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE players
+ADD COLUMN deleted_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE players
+DROP COLUMN deleted_at;
@@ -0,0 +1,32 @@
+-- +goose Up
+CREATE TABLE sessions(
+    id              UUID PRIMARY KEY,
+    player_id       UUID NOT NULL REFERENCES players(id) ON DELETE CASCADE,
+    created_at      TIMESTAMP NOT NULL,
+    last_used_at    TIMESTAMP NOT NULL,
+    expires_at      TIMESTAMP NOT NULL,
+    user_agent      TEXT NOT NULL DEFAULT '',
+    ip              TEXT NOT NULL DEFAULT '',
+    revoked_at      TIMESTAMP
+);
+
+ALTER TABLE refresh_tokens
+ADD COLUMN session_id UUID;
+
+-- every existing refresh token becomes its own session
+UPDATE refresh_tokens
+SET session_id = gen_random_uuid();
+
+INSERT INTO sessions (id, player_id, created_at, last_used_at, expires_at, revoked_at)
+SELECT session_id, player_id, created_at, updated_at, expires_at, revoked_at
+FROM refresh_tokens;
+
+ALTER TABLE refresh_tokens
+ALTER COLUMN session_id SET NOT NULL,
+ADD CONSTRAINT refresh_tokens_session_id_fkey FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE;
+
+-- +goose Down
+ALTER TABLE refresh_tokens
+DROP COLUMN session_id;
+
+DROP TABLE sessions;
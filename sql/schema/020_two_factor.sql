@@ -0,0 +1,21 @@
+-- +goose Up
+CREATE TABLE player_totp(
+    player_id       UUID PRIMARY KEY REFERENCES players(id) ON DELETE CASCADE,
+    secret          TEXT NOT NULL,
+    created_at      TIMESTAMP NOT NULL,
+    confirmed_at    TIMESTAMP,
+    -- the time step of the last accepted code, a code is only good once
+    last_counter    BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE recovery_codes(
+    id          UUID PRIMARY KEY,
+    player_id   UUID NOT NULL REFERENCES players(id) ON DELETE CASCADE,
+    code_hash   TEXT NOT NULL,
+    created_at  TIMESTAMP NOT NULL,
+    used_at     TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE recovery_codes;
+DROP TABLE player_totp;
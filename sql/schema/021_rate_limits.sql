@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE rate_limit_buckets(
+    key         TEXT PRIMARY KEY,
+    tokens      DOUBLE PRECISION NOT NULL,
+    -- whether the last request got a token
+    allowed     BOOLEAN NOT NULL,
+    updated_at  TIMESTAMP NOT NULL
+);
+
+CREATE TABLE login_failures(
+    key             TEXT PRIMARY KEY,
+    failures        INTEGER NOT NULL,
+    last_failed_at  TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE login_failures;
+DROP TABLE rate_limit_buckets;
@@ -0,0 +1,30 @@
+-- +goose Up
+CREATE TABLE oauth_identities (
+    id UUID PRIMARY KEY,
+    player_id UUID NOT NULL REFERENCES players(id) ON DELETE CASCADE,
+    provider TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    email TEXT,
+    created_at TIMESTAMP NOT NULL,
+    UNIQUE (provider, subject),
+    UNIQUE (player_id, provider)
+);
+
+INSERT INTO oauth_identities (id, player_id, provider, subject, email, created_at)
+SELECT gen_random_uuid(), id, 'google', google_id, email, NOW()
+FROM players
+WHERE google_id IS NOT NULL;
+
+ALTER TABLE players
+DROP COLUMN google_id;
+
+-- +goose Down
+ALTER TABLE players
+ADD COLUMN google_id TEXT UNIQUE;
+
+UPDATE players
+SET google_id = oauth_identities.subject
+FROM oauth_identities
+WHERE oauth_identities.player_id = players.id AND oauth_identities.provider = 'google';
+
+DROP TABLE oauth_identities;
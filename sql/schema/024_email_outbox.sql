@@ -0,0 +1,22 @@
+-- +goose Up
+CREATE TABLE email_outbox(
+    id              UUID PRIMARY KEY,
+    recipient       TEXT NOT NULL,
+    subject         TEXT NOT NULL,
+    -- emptied once sent, the bodies hold login and verification links
+    html            TEXT NOT NULL,
+    text            TEXT NOT NULL,
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL,
+    last_error      TEXT,
+    created_at      TIMESTAMP NOT NULL,
+    sent_at         TIMESTAMP,
+    -- set when the email was given up on
+    failed_at       TIMESTAMP
+);
+
+CREATE INDEX email_outbox_due_idx ON email_outbox (next_attempt_at)
+WHERE sent_at IS NULL AND failed_at IS NULL;
+
+-- +goose Down
+DROP TABLE email_outbox;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE players
+ADD COLUMN locale TEXT NOT NULL DEFAULT 'en';
+
+-- +goose Down
+ALTER TABLE players
+DROP COLUMN locale;
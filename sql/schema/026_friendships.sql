@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE friendships (
+    requester_id UUID NOT NULL REFERENCES players(id) ON DELETE CASCADE,
+    addressee_id UUID NOT NULL REFERENCES players(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'accepted')),
+    created_at TIMESTAMP NOT NULL,
+    accepted_at TIMESTAMP,
+    PRIMARY KEY (requester_id, addressee_id),
+    CHECK (requester_id <> addressee_id)
+);
+
+-- one friendship per pair, whoever asked first
+CREATE UNIQUE INDEX friendships_pair ON friendships (LEAST(requester_id, addressee_id), GREATEST(requester_id, addressee_id));
+CREATE INDEX friendships_addressee ON friendships (addressee_id);
+
+-- +goose Down
+DROP TABLE friendships;
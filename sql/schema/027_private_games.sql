@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE games
+ADD COLUMN is_private BOOLEAN NOT NULL DEFAULT FALSE,
+ADD COLUMN invited_player UUID REFERENCES players(id) ON DELETE SET NULL,
+ADD COLUMN invite_code_hash TEXT;
+
+CREATE INDEX games_pending_invites ON games (invited_player) WHERE board2 IS NULL;
+
+-- +goose Down
+DROP INDEX games_pending_invites;
+
+ALTER TABLE games
+DROP COLUMN invite_code_hash,
+DROP COLUMN invited_player,
+DROP COLUMN is_private;
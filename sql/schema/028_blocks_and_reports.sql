@@ -0,0 +1,31 @@
+-- +goose Up
+CREATE TABLE player_blocks (
+    blocker_id UUID NOT NULL REFERENCES players(id) ON DELETE CASCADE,
+    blocked_id UUID NOT NULL REFERENCES players(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (blocker_id, blocked_id),
+    CHECK (blocker_id <> blocked_id)
+);
+
+CREATE INDEX player_blocks_blocked ON player_blocks (blocked_id);
+
+CREATE TABLE player_reports (
+    id          UUID PRIMARY KEY,
+    reporter_id UUID NOT NULL REFERENCES players(id) ON DELETE CASCADE,
+    reported_id UUID NOT NULL REFERENCES players(id) ON DELETE CASCADE,
+    reason      TEXT NOT NULL,
+    details     TEXT NOT NULL DEFAULT '',
+    -- the game the report is about, if any
+    game_id     UUID REFERENCES games(id) ON DELETE SET NULL,
+    created_at  TIMESTAMP NOT NULL,
+    -- set by a moderator once the report was dealt with
+    resolved_at TIMESTAMP
+);
+
+-- a player can only have one open report against another
+CREATE UNIQUE INDEX player_reports_open ON player_reports (reporter_id, reported_id)
+WHERE resolved_at IS NULL;
+
+-- +goose Down
+DROP TABLE player_reports;
+DROP TABLE player_blocks;
@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE notifications (
+    id         UUID PRIMARY KEY,
+    player_id  UUID NOT NULL REFERENCES players(id) ON DELETE CASCADE,
+    type       TEXT NOT NULL,
+    game_id    UUID REFERENCES games(id) ON DELETE CASCADE,
+    -- the other player the notification is about
+    actor_id   UUID REFERENCES players(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL,
+    read_at    TIMESTAMP
+);
+
+CREATE INDEX notifications_player ON notifications (player_id, created_at DESC);
+
+-- +goose Down
+DROP TABLE notifications;
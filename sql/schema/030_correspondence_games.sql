@@ -0,0 +1,24 @@
+-- +goose Up
+ALTER TABLE games
+ADD COLUMN turn_timeout_seconds INTEGER,
+ADD COLUMN turn_started_at TIMESTAMP,
+ADD COLUMN reminder_sent_at TIMESTAMP;
+
+CREATE INDEX games_correspondence_turns ON games (turn_started_at)
+WHERE turn_timeout_seconds IS NOT NULL AND winner IS NULL;
+
+CREATE TABLE notification_preferences (
+    player_id      UUID PRIMARY KEY REFERENCES players(id) ON DELETE CASCADE,
+    turn_reminders BOOLEAN NOT NULL DEFAULT TRUE,
+    updated_at     TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE notification_preferences;
+
+DROP INDEX games_correspondence_turns;
+
+ALTER TABLE games
+DROP COLUMN reminder_sent_at,
+DROP COLUMN turn_started_at,
+DROP COLUMN turn_timeout_seconds;
@@ -0,0 +1,38 @@
+-- +goose Up
+CREATE TABLE webhooks (
+    id         UUID PRIMARY KEY,
+    -- NULL for the webhooks of admins, which hear about every game
+    player_id  UUID REFERENCES players(id) ON DELETE CASCADE,
+    url        TEXT NOT NULL,
+    -- kept as is, deliveries are signed with it
+    secret     TEXT NOT NULL,
+    events     TEXT[] NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX webhooks_player ON webhooks (player_id);
+
+CREATE TABLE webhook_deliveries (
+    id              UUID PRIMARY KEY,
+    webhook_id      UUID NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    event           TEXT NOT NULL,
+    -- the exact body that is signed and sent
+    payload         TEXT NOT NULL,
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL,
+    -- HTTP status of the last attempt, NULL when it got no response
+    last_status     INTEGER,
+    last_error      TEXT,
+    created_at      TIMESTAMP NOT NULL,
+    delivered_at    TIMESTAMP,
+    failed_at       TIMESTAMP
+);
+
+CREATE INDEX webhook_deliveries_due ON webhook_deliveries (next_attempt_at)
+WHERE delivered_at IS NULL AND failed_at IS NULL;
+
+CREATE INDEX webhook_deliveries_webhook ON webhook_deliveries (webhook_id, created_at DESC);
+
+-- +goose Down
+DROP TABLE webhook_deliveries;
+DROP TABLE webhooks;
@@ -0,0 +1,21 @@
+-- +goose Up
+ALTER TABLE players ADD COLUMN is_bot BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE personal_access_tokens (
+    id           UUID PRIMARY KEY,
+    player_id    UUID NOT NULL REFERENCES players(id) ON DELETE CASCADE,
+    name         TEXT NOT NULL,
+    -- only the hash is stored, the token is shown once when it's created
+    token_hash   TEXT NOT NULL UNIQUE,
+    scopes       TEXT[] NOT NULL,
+    created_at   TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP,
+    -- NULL for tokens that don't expire
+    expires_at   TIMESTAMP
+);
+
+CREATE INDEX personal_access_tokens_player ON personal_access_tokens (player_id);
+
+-- +goose Down
+DROP TABLE personal_access_tokens;
+ALTER TABLE players DROP COLUMN is_bot;
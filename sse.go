@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/auth"
+	"github.com/google/uuid"
+)
+
+const sseKeepAliveInterval = 15 * time.Second
+
+// handlerGameEvents streams the events of a game as Server-Sent Events, for
+// clients behind proxies that break websockets. Each event's data is the
+// same JSON the websocket sends and its id is the event seq, so a client
+// reconnecting with Last-Event-ID gets the events it missed.
+func (cfg *apiConfig) handlerGameEvents(w http.ResponseWriter, r *http.Request) {
+	gameId, err := uuid.Parse(r.PathValue("game_id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Game ID is not valid", err)
+		return
+	}
+
+	playerId, ok := cfg.authorizeToken(w, r, auth.ScopeGamesRead)
+	if !ok {
+		return
+	}
+
+	if err = cfg.gs.authorize(r.Context(), gameId, playerId); err != nil {
+		respondWithError(w, http.StatusForbidden, "Player is not in this game", err)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Streaming is not supported", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	sub := &sseSubscriber{
+		w:        w,
+		flusher:  flusher,
+		mux:      &sync.Mutex{},
+		playerId: playerId,
+	}
+	defer sub.close()
+
+	if lastEventId := r.Header.Get("Last-Event-ID"); lastEventId != "" {
+		lastSeq, err := strconv.ParseInt(lastEventId, 10, 64)
+		if err != nil {
+			lastSeq = 0
+		}
+		if err = cfg.gs.resumeConnection(gameId.String(), sub, lastSeq); err != nil {
+			return
+		}
+	} else {
+		cfg.gs.addConnection(gameId.String(), sub)
+	}
+
+	cfg.gs.playerConnected(gameId, playerId)
+	defer cfg.gs.playerDisconnected(gameId, playerId)
+	defer cfg.gs.removeConnection(gameId.String(), sub)
+
+	ticker := time.NewTicker(sseKeepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			if err := sub.keepAlive(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+var errStreamClosed = errors.New("event stream closed")
+
+type sseSubscriber struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	// guards against keep-alives interleaving with events, and against
+	// writes after the handler returned
+	mux      *sync.Mutex
+	closed   bool
+	playerId uuid.UUID
+}
+
+func (s *sseSubscriber) send(msg PlayerMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.closed {
+		return errStreamClosed
+	}
+	// player notifications have no seq, giving them an id would reset the
+	// Last-Event-ID the browser resumes from
+	if msg.Seq > 0 {
+		if _, err = fmt.Fprintf(s.w, "id: %d\n", msg.Seq); err != nil {
+			return err
+		}
+	}
+	if _, err = fmt.Fprintf(s.w, "data: %s\n\n", data); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+func (s *sseSubscriber) player() uuid.UUID {
+	return s.playerId
+}
+
+func (s *sseSubscriber) keepAlive() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.closed {
+		return errStreamClosed
+	}
+	if _, err := fmt.Fprint(s.w, ": keep-alive\n\n"); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// close stops any later write, deliver can still hold the subscriber for a
+// moment after it was removed, while the ResponseWriter is only valid until
+// the handler returns
+func (s *sseSubscriber) close() {
+	s.mux.Lock()
+	s.closed = true
+	s.mux.Unlock()
+}
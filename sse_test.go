@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type sseEvent struct {
+	id  int64
+	msg PlayerMessage
+}
+
+func openEvents(t *testing.T, srv *httptest.Server, gameId uuid.UUID, token, lastEventId string) *http.Response {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/games/"+gameId.String()+"/events", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if lastEventId != "" {
+		req.Header.Set("Last-Event-ID", lastEventId)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open event stream: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// readSSE reads the next n events from the stream, skipping presence events
+func readSSE(t *testing.T, resp *http.Response, n int) []sseEvent {
+	t.Helper()
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	var events []sseEvent
+	var current sseEvent
+	for len(events) < n {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatalf("Stream closed after %d events", len(events))
+			}
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				current.id, _ = strconv.ParseInt(strings.TrimPrefix(line, "id: "), 10, 64)
+			case strings.HasPrefix(line, "data: "):
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &current.msg); err != nil {
+					t.Fatalf("Failed to decode event data: %v", err)
+				}
+			case line == "":
+				if current.msg.Type != "" && current.msg.Type != "presence" {
+					events = append(events, current)
+				}
+				current = sseEvent{}
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timed out after %d events", len(events))
+		}
+	}
+	return events
+}
+
+func TestGameEventsAuthorization(t *testing.T) {
+	gameId := uuid.New()
+	member := uuid.New()
+
+	srv, _ := newTestServer(t, map[uuid.UUID][]uuid.UUID{gameId: {member}})
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+	}{
+		{name: "Invalid token", token: "invalid.token.string", wantStatus: http.StatusUnauthorized},
+		{name: "Not a player in the game", token: makeToken(t, uuid.New()), wantStatus: http.StatusForbidden},
+		{name: "Player in the game", token: makeToken(t, member), wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := openEvents(t, srv, gameId, tt.token, "")
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("Got status %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestGameEventsStream(t *testing.T) {
+	gameId := uuid.New()
+	member := uuid.New()
+
+	srv, cfg := newTestServer(t, map[uuid.UUID][]uuid.UUID{gameId: {member}})
+
+	resp := openEvents(t, srv, gameId, makeToken(t, member), "")
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Got content type %q", ct)
+	}
+	waitForConnections(t, cfg.gs, gameId, 1)
+
+	cfg.gs.broadcastJoined(gameId, "Opponent", "003")
+	cfg.gs.broadcastRolled(gameId, 5)
+
+	events := readSSE(t, resp, 2)
+	if events[0].msg.Type != "joined" || events[0].msg.DisplayName != "Opponent" {
+		t.Errorf("Got %+v, want joined event", events[0].msg)
+	}
+	if events[1].msg.Type != "roll" || events[1].msg.Dice != 5 {
+		t.Errorf("Got %+v, want roll of 5", events[1].msg)
+	}
+	for _, event := range events {
+		if event.id != event.msg.Seq {
+			t.Errorf("Event id %d doesn't match seq %d", event.id, event.msg.Seq)
+		}
+	}
+}
+
+func TestGameEventsLastEventIdReplay(t *testing.T) {
+	gameId := uuid.New()
+	member := uuid.New()
+
+	srv, cfg := newTestServer(t, map[uuid.UUID][]uuid.UUID{gameId: {member}})
+
+	cfg.gs.broadcastRolled(gameId, 1)
+	cfg.gs.broadcastToGame(gameId)
+	cfg.gs.broadcastRolled(gameId, 6)
+
+	resp := openEvents(t, srv, gameId, makeToken(t, member), "1")
+	events := readSSE(t, resp, 2)
+	if events[0].id != 2 || events[0].msg.Type != "refresh" {
+		t.Errorf("Got %+v, want refresh with id 2", events[0])
+	}
+	if events[1].id != 3 || events[1].msg.Dice != 6 {
+		t.Errorf("Got %+v, want roll of 6 with id 3", events[1])
+	}
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/database"
+	"github.com/google/uuid"
+)
+
+// Events webhooks can subscribe to
+const (
+	webhookGameCreated  = "game.created"
+	webhookGameJoined   = "game.joined"
+	webhookMoveMade     = "move.made"
+	webhookGameFinished = "game.finished"
+)
+
+var webhookEvents = map[string]bool{
+	webhookGameCreated:  true,
+	webhookGameJoined:   true,
+	webhookMoveMade:     true,
+	webhookGameFinished: true,
+}
+
+const (
+	webhookSignatureHeader = "X-Webhook-Signature-256"
+	webhookEventHeader     = "X-Webhook-Event"
+	webhookDeliveryHeader  = "X-Webhook-Delivery"
+
+	webhookSendTimeout = 10 * time.Second
+	// how often the dispatcher looks for due deliveries when nothing wakes it
+	webhookPollInterval = 5 * time.Second
+	webhookBatchSize    = 20
+	// a claimed delivery is tried again after this long, in case the
+	// instance sending it died before recording how it went
+	webhookLease = webhookSendTimeout + 30*time.Second
+	// a delivery failing this often is given up on
+	webhookMaxAttempts   = 6
+	webhookRetryBase     = 30 * time.Second
+	webhookMaxRetryDelay = time.Hour
+	// finished deliveries stay in the log this long
+	webhookRetention     = 7 * 24 * time.Hour
+	webhookSweepInterval = time.Hour
+)
+
+// WebhookPayload is the body of every delivery, Data depends on the event
+type WebhookPayload struct {
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+type WebhookGameCreated struct {
+	GameId           uuid.UUID `json:"game_id"`
+	PlayerId         uuid.UUID `json:"player_id"`
+	IsPrivate        bool      `json:"is_private"`
+	TurnTimeoutHours int       `json:"turn_timeout_hours,omitzero"`
+}
+
+type WebhookGameJoined struct {
+	GameId uuid.UUID `json:"game_id"`
+	// the player who joined and the one who created the game
+	PlayerId   uuid.UUID `json:"player_id"`
+	OpponentId uuid.UUID `json:"opponent_id"`
+	// whose turn it is first
+	PlayerTurn uuid.UUID `json:"player_turn"`
+}
+
+type WebhookMoveMade struct {
+	GameId     uuid.UUID `json:"game_id"`
+	PlayerId   uuid.UUID `json:"player_id"`
+	Dice       int       `json:"dice"`
+	Row        int       `json:"row"`
+	Col        int       `json:"col"`
+	PlayerTurn uuid.UUID `json:"player_turn"`
+}
+
+type WebhookGameFinished struct {
+	GameId   uuid.UUID `json:"game_id"`
+	WinnerId uuid.UUID `json:"winner_id"`
+	LoserId  uuid.UUID `json:"loser_id"`
+	// board_full, or forfeit when a correspondence game ran out of time
+	Reason string `json:"reason"`
+}
+
+// signWebhook is the signature header of body, an HMAC-SHA256 with the
+// webhook's secret
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// publishWebhook queues event for the webhooks subscribed to it: those of
+// the players it is about, and every admin webhook. What it is about
+// already happened, so failures are only logged.
+func (cfg *apiConfig) publishWebhook(ctx context.Context, event string, data any, playerIds ...uuid.UUID) {
+	payload, err := json.Marshal(WebhookPayload{
+		Event:     event,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		log.Printf("Failed to encode the %s webhook: %v", event, err)
+		return
+	}
+
+	queued, err := cfg.db.EnqueueWebhookDeliveries(ctx, database.EnqueueWebhookDeliveriesParams{
+		Event:     event,
+		Payload:   string(payload),
+		PlayerIds: playerIds,
+	})
+	if err != nil {
+		log.Printf("Failed to queue the %s webhooks: %v", event, err)
+		return
+	}
+
+	// tests run without a dispatcher
+	if queued > 0 && cfg.webhooks != nil {
+		cfg.webhooks.notify()
+	}
+}
+
+// errWebhookAddressNotAllowed keeps player webhooks out of the server's own
+// network. It is checked on the address being dialed, so a host that passed
+// validation and later resolves to a private address is refused too.
+var errWebhookAddressNotAllowed = errors.New("webhook address is not allowed")
+
+// reservedPrefixes aren't covered by netip's checks but aren't reachable on
+// the internet either
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// publicAddress is whether player webhooks may be delivered to addr: not
+// loopback, private, link-local, multicast or otherwise reserved
+func publicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+func webhookDialControl(network, address string, _ syscall.RawConn) error {
+	addr, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !publicAddress(addr.Addr()) {
+		return errWebhookAddressNotAllowed
+	}
+	return nil
+}
+
+// newWebhookClient sends deliveries without following redirects, a 3xx is
+// recorded as the receiver's answer. With a dial control, deliveries go
+// straight to the receiver rather than through a proxy from the environment,
+// so the control sees the receiver's address.
+func newWebhookClient(control func(network, address string, c syscall.RawConn) error) *http.Client {
+	client := &http.Client{
+		Timeout: webhookSendTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	if control != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = nil
+		transport.DialContext = (&net.Dialer{
+			Timeout:   webhookSendTimeout,
+			KeepAlive: 30 * time.Second,
+			Control:   control,
+		}).DialContext
+		client.Transport = transport
+	}
+	return client
+}
+
+// webhookDispatcher sends the deliveries queued in webhook_deliveries,
+// retrying failed ones with exponential backoff until webhookMaxAttempts.
+// Like the email outbox every instance can run one.
+type webhookDispatcher struct {
+	db *database.Queries
+	// client only reaches public addresses, adminClient sends the admin
+	// webhooks which may be internal services
+	client      *http.Client
+	adminClient *http.Client
+	wake        chan struct{}
+	lastSweep   time.Time
+}
+
+func newWebhookDispatcher(db *database.Queries) *webhookDispatcher {
+	return &webhookDispatcher{
+		db:          db,
+		client:      newWebhookClient(webhookDialControl),
+		adminClient: newWebhookClient(nil),
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// webhookRetryDelay is how long to wait after the delivery failed attempts
+// times
+func webhookRetryDelay(attempts int) time.Duration {
+	delay := webhookRetryBase
+	for range attempts - 1 {
+		delay *= 2
+		if delay >= webhookMaxRetryDelay {
+			return webhookMaxRetryDelay
+		}
+	}
+	return delay
+}
+
+// notify wakes the dispatcher to send new deliveries without waiting for
+// the poll
+func (d *webhookDispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (d *webhookDispatcher) run(ctx context.Context) {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		// a full batch may have left more due
+		for d.deliver(ctx) == webhookBatchSize {
+		}
+		d.sweep(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// deliver sends one batch of due deliveries and returns how many it claimed
+func (d *webhookDispatcher) deliver(ctx context.Context) int {
+	deliveries, err := d.db.ClaimDueWebhookDeliveries(ctx, database.ClaimDueWebhookDeliveriesParams{
+		Lease:     webhookLease.Seconds(),
+		BatchSize: webhookBatchSize,
+	})
+	if err != nil {
+		log.Printf("Failed to claim webhook deliveries: %v", err)
+		return 0
+	}
+
+	for _, delivery := range deliveries {
+		d.send(ctx, delivery)
+	}
+	return len(deliveries)
+}
+
+// post sends the delivery and returns the status it got, 0 without a
+// response
+func (d *webhookDispatcher) post(ctx context.Context, delivery database.ClaimDueWebhookDeliveriesRow) (int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookEventHeader, delivery.Event)
+	req.Header.Set(webhookDeliveryHeader, delivery.ID.String())
+	req.Header.Set(webhookSignatureHeader, signWebhook(delivery.Secret, body))
+
+	client := d.adminClient
+	if delivery.PlayerID.Valid {
+		client = d.client
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// webhookSendError is the last_error players see for a delivery that got no
+// response
+func webhookSendError(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, errWebhookAddressNotAllowed):
+		return "the receiver's address is not allowed"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "the receiver timed out"
+	default:
+		return "failed to connect to the receiver"
+	}
+}
+
+func (d *webhookDispatcher) send(ctx context.Context, delivery database.ClaimDueWebhookDeliveriesRow) {
+	status, err := d.post(ctx, delivery)
+	lastStatus := sql.NullInt32{Int32: int32(status), Valid: status != 0}
+
+	if err == nil {
+		if err = d.db.MarkWebhookDelivered(ctx, database.MarkWebhookDeliveredParams{
+			ID:         delivery.ID,
+			LastStatus: lastStatus,
+		}); err != nil {
+			log.Printf("Failed to mark webhook delivery %v as delivered: %v", delivery.ID, err)
+		}
+		return
+	}
+
+	lastError := sql.NullString{Valid: true, String: err.Error()}
+	// players see the delivery log, they only learn why a delivery failed
+	// in general terms and not how the server's network answered
+	if delivery.PlayerID.Valid && status == 0 {
+		log.Printf("Failed to send %s webhook delivery %v: %v", delivery.Event, delivery.ID, err)
+		lastError.String = webhookSendError(err)
+	}
+	attempts := int(delivery.Attempts) + 1
+	if attempts >= webhookMaxAttempts {
+		log.Printf("Giving up on %s webhook delivery %v after %d attempts: %v", delivery.Event, delivery.ID, attempts, err)
+		err = d.db.FailWebhookDelivery(ctx, database.FailWebhookDeliveryParams{
+			ID:         delivery.ID,
+			LastStatus: lastStatus,
+			LastError:  lastError,
+		})
+	} else {
+		err = d.db.RetryWebhookDelivery(ctx, database.RetryWebhookDeliveryParams{
+			ID:         delivery.ID,
+			LastStatus: lastStatus,
+			LastError:  lastError,
+			Delay:      webhookRetryDelay(attempts).Seconds(),
+		})
+	}
+	if err != nil {
+		log.Printf("Failed to record the failed webhook delivery %v: %v", delivery.ID, err)
+	}
+}
+
+func (d *webhookDispatcher) sweep(ctx context.Context) {
+	if time.Since(d.lastSweep) < webhookSweepInterval {
+		return
+	}
+	d.lastSweep = time.Now()
+
+	if err := d.db.DeleteOldWebhookDeliveries(ctx, webhookRetention.Seconds()); err != nil {
+		log.Printf("Failed to delete old webhook deliveries: %v", err)
+	}
+}
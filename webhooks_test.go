@@ -0,0 +1,360 @@
+package main
+
+import (
+	"crypto/hmac"
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestWebhookRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: 30 * time.Second},
+		{attempts: 2, want: time.Minute},
+		{attempts: 5, want: 8 * time.Minute},
+		{attempts: 8, want: time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := webhookRetryDelay(tt.attempts); got != tt.want {
+			t.Errorf("webhookRetryDelay(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestPublicAddress(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{addr: "93.184.216.34", want: true},
+		{addr: "2606:2800:220:1:248:1893:25c8:1946", want: true},
+		{addr: "127.0.0.1"},
+		{addr: "10.1.2.3"},
+		{addr: "192.168.0.1"},
+		{addr: "169.254.169.254"},
+		{addr: "100.64.0.1"},
+		{addr: "0.0.0.0"},
+		{addr: "::1"},
+		{addr: "fd00::1"},
+		{addr: "fe80::1"},
+		{addr: "::ffff:127.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		if got := publicAddress(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("publicAddress(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookDispatcherDeliver(t *testing.T) {
+	const secret = "a-long-enough-secret"
+	payload := `{"event":"game.created","created_at":"2025-03-14T06:30:00Z","data":{}}`
+
+	tests := []struct {
+		name       string
+		status     int
+		down       bool
+		attempts   int
+		player     bool
+		wantQuery  string
+		wantStatus driver.Value
+		wantDelay  float64
+		wantError  driver.Value
+	}{
+		{
+			name:       "Delivered",
+			status:     http.StatusNoContent,
+			wantQuery:  "MarkWebhookDelivered",
+			wantStatus: int64(http.StatusNoContent),
+		},
+		{
+			name:       "Receiver error is retried",
+			status:     http.StatusInternalServerError,
+			wantQuery:  "RetryWebhookDelivery",
+			wantStatus: int64(http.StatusInternalServerError),
+			wantDelay:  webhookRetryBase.Seconds(),
+			wantError:  "receiver responded 500 Internal Server Error",
+		},
+		{
+			name:       "Redirect isn't followed",
+			status:     http.StatusFound,
+			wantQuery:  "RetryWebhookDelivery",
+			wantStatus: int64(http.StatusFound),
+			wantDelay:  webhookRetryBase.Seconds(),
+			wantError:  "receiver responded 302 Found",
+		},
+		{
+			name:      "Player webhook to a private address",
+			status:    http.StatusNoContent,
+			player:    true,
+			wantQuery: "RetryWebhookDelivery",
+			wantDelay: webhookRetryBase.Seconds(),
+			wantError: "the receiver's address is not allowed",
+		},
+		{
+			name:      "Unreachable receiver is retried",
+			down:      true,
+			attempts:  1,
+			wantQuery: "RetryWebhookDelivery",
+			wantDelay: 2 * webhookRetryBase.Seconds(),
+		},
+		{
+			name:       "Last attempt fails",
+			status:     http.StatusGone,
+			attempts:   webhookMaxAttempts - 1,
+			wantQuery:  "FailWebhookDelivery",
+			wantStatus: int64(http.StatusGone),
+			wantError:  "receiver responded 410 Gone",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deliveryId := uuid.New()
+			received := 0
+
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received++
+				body, _ := io.ReadAll(r.Body)
+				if string(body) != payload {
+					t.Errorf("Received %s, want %s", body, payload)
+				}
+				if got := r.Header.Get(webhookSignatureHeader); !hmac.Equal([]byte(got), []byte(signWebhook(secret, body))) {
+					t.Errorf("Got signature %q, want the HMAC of the body", got)
+				}
+				if r.Header.Get(webhookEventHeader) != webhookGameCreated || r.Header.Get(webhookDeliveryHeader) != deliveryId.String() {
+					t.Errorf("Got headers %v", r.Header)
+				}
+				if tt.status == http.StatusFound {
+					w.Header().Set("Location", "/elsewhere")
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer receiver.Close()
+			if tt.down {
+				receiver.Close()
+			}
+
+			var recorded []string
+			var status, lastError driver.Value
+			var delay float64
+			record := func(name string) stubQuery {
+				return func(args []driver.NamedValue) ([][]driver.Value, error) {
+					if args[0].Value != deliveryId.String() {
+						t.Errorf("%s of %v, want %v", name, args[0].Value, deliveryId)
+					}
+					status = args[1].Value
+					if name != "MarkWebhookDelivered" {
+						lastError = args[2].Value
+					}
+					if name == "RetryWebhookDelivery" {
+						delay = args[3].Value.(float64)
+					}
+					recorded = append(recorded, name)
+					return nil, nil
+				}
+			}
+
+			// the receiver is on loopback, which only admin webhooks may reach
+			var owner driver.Value
+			if tt.player {
+				owner = uuid.NewString()
+			}
+			db := newStubDB(t, map[string]stubQuery{
+				"ClaimDueWebhookDeliveries": func(args []driver.NamedValue) ([][]driver.Value, error) {
+					return [][]driver.Value{{deliveryId.String(), webhookGameCreated, payload, tt.attempts, receiver.URL, secret, owner}}, nil
+				},
+				"MarkWebhookDelivered": record("MarkWebhookDelivered"),
+				"RetryWebhookDelivery": record("RetryWebhookDelivery"),
+				"FailWebhookDelivery":  record("FailWebhookDelivery"),
+			})
+
+			if claimed := newWebhookDispatcher(db).deliver(t.Context()); claimed != 1 {
+				t.Fatalf("Claimed %d deliveries, want 1", claimed)
+			}
+
+			if len(recorded) != 1 || recorded[0] != tt.wantQuery {
+				t.Errorf("Recorded %v, want %s", recorded, tt.wantQuery)
+			}
+			if status != tt.wantStatus {
+				t.Errorf("Recorded status %v, want %v", status, tt.wantStatus)
+			}
+			if delay != tt.wantDelay {
+				t.Errorf("Retried in %vs, want %vs", delay, tt.wantDelay)
+			}
+			if tt.wantError != nil && lastError != tt.wantError {
+				t.Errorf("Recorded error %v, want %v", lastError, tt.wantError)
+			}
+			wantReceived := 1
+			if tt.down || tt.player {
+				wantReceived = 0
+			}
+			if received != wantReceived {
+				t.Errorf("Receiver got %d requests, want %d", received, wantReceived)
+			}
+		})
+	}
+}
+
+func TestCreateWebhook(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		guest      bool
+		count      int64
+		wantStatus int
+	}{
+		{
+			name:       "Created",
+			body:       `{"url": "https://bot.example.com/hook", "secret": "a-long-enough-secret", "events": ["game.finished", "game.created", "game.finished"]}`,
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "Plain http",
+			body:       `{"url": "http://bot.example.com/hook", "secret": "a-long-enough-secret", "events": ["game.created"]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Private address",
+			body:       `{"url": "https://169.254.169.254/latest", "secret": "a-long-enough-secret", "events": ["game.created"]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Localhost",
+			body:       `{"url": "https://localhost:8080/hook", "secret": "a-long-enough-secret", "events": ["game.created"]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Short secret",
+			body:       `{"url": "https://bot.example.com/hook", "secret": "short", "events": ["game.created"]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Unknown event",
+			body:       `{"url": "https://bot.example.com/hook", "secret": "a-long-enough-secret", "events": ["game.paused"]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "No events",
+			body:       `{"url": "https://bot.example.com/hook", "secret": "a-long-enough-secret", "events": []}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Too many webhooks",
+			body:       `{"url": "https://bot.example.com/hook", "secret": "a-long-enough-secret", "events": ["game.created"]}`,
+			count:      maxWebhooksPerPlayer,
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "Guest",
+			body:       `{"url": "https://bot.example.com/hook", "secret": "a-long-enough-secret", "events": ["game.created"]}`,
+			guest:      true,
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			playerId := uuid.New()
+			var events driver.Value
+
+			cfg := &apiConfig{
+				tokenKeys: testKeys,
+				db: newStubDB(t, map[string]stubQuery{
+					"GetPlayerByPlayerId": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						if tt.guest {
+							return [][]driver.Value{guestRow(playerId, "guest-1234")}, nil
+						}
+						return [][]driver.Value{playerRow(playerId, nil, "player@example.com")}, nil
+					},
+					"CountWebhooks": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						return [][]driver.Value{{tt.count}}, nil
+					},
+					"CreateWebhook": func(args []driver.NamedValue) ([][]driver.Value, error) {
+						if args[0].Value != playerId.String() || args[2].Value != "a-long-enough-secret" {
+							t.Errorf("Created a webhook for %v with secret %v", args[0].Value, args[2].Value)
+						}
+						events = args[3].Value
+						return [][]driver.Value{{uuid.NewString(), args[0].Value, args[1].Value, args[2].Value, args[3].Value, time.Now()}}, nil
+					},
+				}),
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/webhooks", strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+makeToken(t, playerId))
+			w := httptest.NewRecorder()
+			cfg.handlerCreateWebhook(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Got status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if w.Code != http.StatusCreated {
+				return
+			}
+
+			if events != `{"game.created","game.finished"}` {
+				t.Errorf("Stored events %v, want them sorted without duplicates", events)
+			}
+			if strings.Contains(w.Body.String(), "a-long-enough-secret") {
+				t.Errorf("Response %s gives the secret away", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestPublishWebhook(t *testing.T) {
+	gameId := uuid.New()
+	winnerId := uuid.New()
+	loserId := uuid.New()
+	var args []driver.NamedValue
+
+	cfg := &apiConfig{
+		db: newStubDB(t, map[string]stubQuery{
+			"EnqueueWebhookDeliveries": func(a []driver.NamedValue) ([][]driver.Value, error) {
+				args = a
+				return rowsAffected(2), nil
+			},
+		}),
+	}
+
+	cfg.publishWebhook(t.Context(), webhookGameFinished, WebhookGameFinished{
+		GameId:   gameId,
+		WinnerId: winnerId,
+		LoserId:  loserId,
+		Reason:   "board_full",
+	}, winnerId, loserId)
+
+	if args == nil {
+		t.Fatal("Nothing was queued")
+	}
+	if args[0].Value != webhookGameFinished {
+		t.Errorf("Queued event %v, want %s", args[0].Value, webhookGameFinished)
+	}
+	if want := `{"` + winnerId.String() + `","` + loserId.String() + `"}`; args[2].Value != want {
+		t.Errorf("Queued for the webhooks of %v, want %s", args[2].Value, want)
+	}
+
+	var payload struct {
+		Event string              `json:"event"`
+		Data  WebhookGameFinished `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(args[1].Value.(string)), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Event != webhookGameFinished || payload.Data.GameId != gameId || payload.Data.WinnerId != winnerId || payload.Data.LoserId != loserId {
+		t.Errorf("Queued payload %+v", payload)
+	}
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
 	"slices"
+	"sync"
+	"time"
 
 	"github.com/AradD7/Go-Knuclebones/internal/auth"
+	"github.com/AradD7/Go-Knuclebones/internal/database"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
@@ -23,18 +27,33 @@ var (
 	}
 )
 
+// Application close codes, mirroring the HTTP statuses the REST handlers use
+const (
+	closeUnauthorized = 4001 // token missing, invalid or expired
+	closeForbidden    = 4003 // player is not part of the game
+)
+
+const authMessageTimeout = 10 * time.Second
+
 type PlayerMessage struct {
-	Type        string `json:"type"`
-	Token       string `json:"token"`
-	DisplayName string `json:"display_name"`
-	Avatar      string `json:"avatar"`
-	Dice        int    `json:"dice"`
+	Type        string    `json:"type"`
+	Token       string    `json:"token"`
+	DisplayName string    `json:"display_name"`
+	Avatar      string    `json:"avatar"`
+	Dice        int       `json:"dice"`
+	Seq         int64     `json:"seq"`
+	LastSeq     int64     `json:"last_seq"`
+	PlayerId    uuid.UUID `json:"player_id,omitzero"`
+	Presence    string    `json:"presence"`
+	GameId      uuid.UUID `json:"game_id,omitzero"`
+	// set on events about a notification stored in the player's inbox
+	NotificationId uuid.UUID `json:"notification_id,omitzero"`
 }
 
 func (cfg apiConfig) handlerWebSocket(w http.ResponseWriter, r *http.Request) {
-	gameId := r.PathValue("game_id")
-	if gameId == "" {
-		respondWithError(w, http.StatusBadRequest, "faild to get gameid from url", nil)
+	gameId, err := uuid.Parse(r.PathValue("game_id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "faild to get gameid from url", err)
 		return
 	}
 
@@ -44,38 +63,203 @@ func (cfg apiConfig) handlerWebSocket(w http.ResponseWriter, r *http.Request) {
 	}
 	defer conn.Close()
 
-	var msg PlayerMessage
-	if err := conn.ReadJSON(&msg); err != nil {
+	msg, playerId, ok := cfg.authenticateConn(r.Context(), conn)
+	if !ok {
 		return
 	}
 
-	_, err = auth.ValidateJWT(msg.Token, cfg.tokenSecret)
-	if err != nil {
+	if err = cfg.gs.authorize(r.Context(), gameId, playerId); err != nil {
+		closeWithCode(conn, closeForbidden, "player is not in this game")
 		return
 	}
 
-	cfg.gs.addConnection(gameId, conn)
+	// a client that dropped sends "resume" with the last seq it saw and is
+	// caught up before it starts receiving live events
+	sub := &wsSubscriber{conn: conn, playerId: playerId}
+	if msg.Type == "resume" {
+		if err = cfg.gs.resumeConnection(gameId.String(), sub, msg.LastSeq); err != nil {
+			return
+		}
+	} else {
+		cfg.gs.addConnection(gameId.String(), sub)
+	}
 
+	cfg.gs.playerConnected(gameId, playerId)
+	defer cfg.gs.playerDisconnected(gameId, playerId)
+
+	// any message from the client counts as activity, clients send "ping"
+	// while the player is interacting to avoid showing up as idle
 	for {
 		_, _, err := conn.ReadMessage()
 		if err != nil {
-			cfg.gs.removeConnection(gameId, conn)
+			cfg.gs.removeConnection(gameId.String(), sub)
+			return
+		}
+		cfg.gs.playerActive(gameId, playerId)
+	}
+}
+
+// handlerPlayerWebSocket is the player's own channel, delivering the
+// notifications about any of their games whether or not they have it open.
+// It authenticates the same way as a game websocket. Missed notifications
+// aren't replayed, clients fetch the inbox when they (re)connect.
+func (cfg *apiConfig) handlerPlayerWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	_, playerId, ok := cfg.authenticateConn(r.Context(), conn)
+	if !ok {
+		return
+	}
+
+	sub := &wsSubscriber{conn: conn, playerId: playerId}
+	cfg.gs.addPlayerConnection(sub)
+	defer cfg.gs.removePlayerConnection(sub)
+
+	// the client has nothing to say, reading only notices it going away
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
 			return
 		}
 	}
 }
 
-func (gs *gameServer) addConnection(id string, conn *websocket.Conn) {
+// authenticateConn reads the auth message a client has to send first, and
+// closes the connection when it doesn't arrive in time or its token is no
+// good. Personal access tokens need the games:read scope.
+func (cfg *apiConfig) authenticateConn(ctx context.Context, conn *websocket.Conn) (PlayerMessage, uuid.UUID, bool) {
+	conn.SetReadDeadline(time.Now().Add(authMessageTimeout))
+	var msg PlayerMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		closeWithCode(conn, closeUnauthorized, "auth message not received")
+		return PlayerMessage{}, uuid.Nil, false
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	playerId, err := cfg.validateAccessToken(ctx, msg.Token, auth.ScopeGamesRead)
+	if err != nil {
+		closeWithCode(conn, closeUnauthorized, "token is invalid or expired")
+		return PlayerMessage{}, uuid.Nil, false
+	}
+	return msg, playerId, true
+}
+
+// authorizeGame is the gameServer authorizer backed by the DB: a player may
+// follow a game only if one of its boards belongs to them, and there is no
+// block between them and anyone else in it
+func (cfg *apiConfig) authorizeGame(ctx context.Context, gameId, playerId uuid.UUID) error {
+	game := uuid.NullUUID{
+		Valid: true,
+		UUID:  gameId,
+	}
+	_, err := cfg.db.GetBoardByPlayerIdAndGameId(ctx, database.GetBoardByPlayerIdAndGameIdParams{
+		PlayerID: playerId,
+		GameID:   game,
+	})
+	if err != nil {
+		return err
+	}
+
+	blocked, err := cfg.db.IsBlockedFromGame(ctx, database.IsBlockedFromGameParams{
+		GameID:   game,
+		PlayerID: playerId,
+	})
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return errBlocked
+	}
+	return nil
+}
+
+// subscriber is a client following a game, over a websocket or an SSE stream.
+// send is called without gameServer's lock held, so a slow client only holds
+// up itself, and has to be safe for concurrent use.
+type subscriber interface {
+	send(msg PlayerMessage) error
+	// player is who the client authenticated as
+	player() uuid.UUID
+}
+
+type wsSubscriber struct {
+	conn *websocket.Conn
+	// a websocket connection supports one concurrent writer
+	mux      sync.Mutex
+	playerId uuid.UUID
+}
+
+func (s *wsSubscriber) send(msg PlayerMessage) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.conn.WriteJSON(msg)
+}
+
+func (s *wsSubscriber) player() uuid.UUID {
+	return s.playerId
+}
+
+func closeWithCode(conn *websocket.Conn, code int, reason string) {
+	conn.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(code, reason),
+		time.Now().Add(time.Second),
+	)
+}
+
+func newGameServer() *gameServer {
+	return &gameServer{
+		connections:    make(map[string][]subscriber),
+		players:        make(map[uuid.UUID][]subscriber),
+		events:         make(map[string]*gameLog),
+		presence:       make(map[string]map[uuid.UUID]string),
+		trackers:       make(map[presenceKey]*presenceTracker),
+		rwMux:          &sync.RWMutex{},
+		presenceMux:    &sync.Mutex{},
+		idleAfter:      defaultIdleAfter,
+		reconnectGrace: defaultReconnectGrace,
+	}
+}
+
+func (gs *gameServer) addConnection(id string, sub subscriber) {
 
 	gs.rwMux.Lock()
-	gs.connections[id] = append(gs.connections[id], conn)
+	gs.connections[id] = append(gs.connections[id], sub)
 	gs.rwMux.Unlock()
 }
 
-func (gs *gameServer) removeConnection(id string, conn *websocket.Conn) {
+// resumeConnection replays the events sub missed, then registers it once
+// there is nothing more to replay. The check and the registration share the
+// lock, so nothing published in between is lost, while the replay itself is
+// written without it.
+func (gs *gameServer) resumeConnection(id string, sub subscriber, lastSeq int64) error {
+	for {
+		gs.rwMux.Lock()
+		missed := gs.missedEvents(id, lastSeq)
+		if len(missed) == 0 {
+			gs.connections[id] = append(gs.connections[id], sub)
+			gs.rwMux.Unlock()
+			return nil
+		}
+		gs.rwMux.Unlock()
+
+		for _, msg := range missed {
+			if err := sub.send(msg); err != nil {
+				return err
+			}
+			lastSeq = msg.Seq
+		}
+	}
+}
+
+func (gs *gameServer) removeConnection(id string, sub subscriber) {
 	gs.rwMux.Lock()
 	for i, connection := range gs.connections[id] {
-		if connection == conn {
+		if connection == sub {
 			gs.connections[id] = slices.Delete(gs.connections[id], i, i+1)
 			break
 		}
@@ -83,44 +267,107 @@ func (gs *gameServer) removeConnection(id string, conn *websocket.Conn) {
 	gs.rwMux.Unlock()
 }
 
-func (gs *gameServer) broadcastToGame(gameId uuid.UUID) {
-	gs.rwMux.RLock()
-	for i, conn := range gs.connections[gameId.String()] {
-		err := conn.WriteJSON(PlayerMessage{
-			Type: "refresh",
-		})
-		if err != nil {
-			fmt.Printf("ERROR sending to connection %d: %v\n", i, err)
+func (gs *gameServer) addPlayerConnection(sub subscriber) {
+	gs.rwMux.Lock()
+	gs.players[sub.player()] = append(gs.players[sub.player()], sub)
+	gs.rwMux.Unlock()
+}
+
+func (gs *gameServer) removePlayerConnection(sub subscriber) {
+	gs.rwMux.Lock()
+	defer gs.rwMux.Unlock()
+
+	id := sub.player()
+	for i, connection := range gs.players[id] {
+		if connection == sub {
+			gs.players[id] = slices.Delete(gs.players[id], i, i+1)
+			break
 		}
 	}
-	gs.rwMux.RUnlock()
+	if len(gs.players[id]) == 0 {
+		delete(gs.players, id)
+	}
+}
+
+func (gs *gameServer) broadcastToGame(gameId uuid.UUID) {
+	gs.publish(gameId, PlayerMessage{
+		Type: "refresh",
+	})
 }
 
 func (gs *gameServer) broadcastJoined(gameId uuid.UUID, displayName, avatar string) {
-	gs.rwMux.RLock()
-	for i, conn := range gs.connections[gameId.String()] {
-		err := conn.WriteJSON(PlayerMessage{
-			Type:        "joined",
-			DisplayName: displayName,
-			Avatar:      avatar,
-		})
-		if err != nil {
-			fmt.Printf("ERROR sending to connection %d: %v\n", i, err)
-		}
-	}
-	gs.rwMux.RUnlock()
+	gs.publish(gameId, PlayerMessage{
+		Type:        "joined",
+		DisplayName: displayName,
+		Avatar:      avatar,
+	})
 }
 
 func (gs *gameServer) broadcastRolled(gameId uuid.UUID, dice int) {
-	gs.rwMux.RLock()
-	for i, conn := range gs.connections[gameId.String()] {
-		err := conn.WriteJSON(PlayerMessage{
-			Type: "roll",
-			Dice: dice,
-		})
-		if err != nil {
-			fmt.Printf("ERROR sending to connection %d: %v\n", i, err)
+	gs.publish(gameId, PlayerMessage{
+		Type: "roll",
+		Dice: dice,
+	})
+}
+
+func (gs *gameServer) publish(gameId uuid.UUID, msg PlayerMessage) {
+	ctx := context.Background()
+
+	seq, err := gs.backend.nextSeq(ctx, gameId)
+	if err != nil {
+		fmt.Printf("ERROR sequencing %s for game %s: %v\n", msg.Type, gameId, err)
+		return
+	}
+	msg.Seq = seq
+
+	err = gs.backend.publish(ctx, gameEvent{
+		GameId:  gameId,
+		Message: msg,
+	})
+	if err != nil {
+		fmt.Printf("ERROR publishing %s to game %s: %v\n", msg.Type, gameId, err)
+	}
+}
+
+// notifyPlayer sends msg to every connection the player has open, their own
+// channel and whichever games they follow. These events aren't part of any
+// game so they have no seq and aren't replayed to a client that missed them.
+func (gs *gameServer) notifyPlayer(playerId uuid.UUID, msg PlayerMessage) {
+	err := gs.backend.publish(context.Background(), gameEvent{
+		PlayerId: playerId,
+		Message:  msg,
+	})
+	if err != nil {
+		fmt.Printf("ERROR publishing %s to player %s: %v\n", msg.Type, playerId, err)
+	}
+}
+
+// deliver records an event and writes it to the connections this instance
+// holds for its game, or for its player. The connections are looked up under
+// the lock but written to after it is released, so one slow client doesn't
+// stall every other game.
+func (gs *gameServer) deliver(event gameEvent) {
+	var subs []subscriber
+
+	gs.rwMux.Lock()
+	if event.PlayerId != uuid.Nil {
+		subs = slices.Clone(gs.players[event.PlayerId])
+		for _, connections := range gs.connections {
+			for _, sub := range connections {
+				if sub.player() == event.PlayerId {
+					subs = append(subs, sub)
+				}
+			}
+		}
+	} else {
+		gs.record(event)
+		subs = slices.Clone(gs.connections[event.GameId.String()])
+	}
+	gs.rwMux.Unlock()
+
+	for i, sub := range subs {
+		if err := sub.send(event.Message); err != nil {
+			fmt.Printf("ERROR sending %s to connection %d: %v\n", event.Message.Type, i, err)
 		}
 	}
-	gs.rwMux.RUnlock()
 }
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AradD7/Go-Knuclebones/internal/auth"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+const testSecret = "test-secret"
+
+var testKeys = auth.NewKeySet(auth.NewHMACKey([]byte(testSecret)))
+
+func newTestServer(t *testing.T, members map[uuid.UUID][]uuid.UUID) (*httptest.Server, *apiConfig) {
+	t.Helper()
+
+	cfg := &apiConfig{
+		db: newStubDB(t, map[string]stubQuery{
+			"IsActivePlayer": activePlayer,
+			// the game's first member is the one to move, and hasn't rolled
+			"GetGameById": func(args []driver.NamedValue) ([][]driver.Value, error) {
+				gameId, _ := uuid.Parse(args[0].Value.(string))
+				row := gameRow(gameId, uuid.New(), false, nil, nil)
+				if len(members[gameId]) > 0 {
+					row[6] = members[gameId][0].String()
+				}
+				return [][]driver.Value{row}, nil
+			},
+			"SetPlayerRoll": func(args []driver.NamedValue) ([][]driver.Value, error) {
+				return rowsAffected(1), nil
+			},
+		}),
+		tokenKeys: testKeys,
+		gs:        newGameServer(),
+	}
+	cfg.gs.authorize = func(ctx context.Context, gameId, playerId uuid.UUID) error {
+		for _, id := range members[gameId] {
+			if id == playerId {
+				return nil
+			}
+		}
+		return errors.New("not a member")
+	}
+	cfg.gs.backend = newMemoryBackend(cfg.gs.deliver)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/games/roll", cfg.handlerRoll)
+	mux.HandleFunc("GET /api/games/{game_id}/events", cfg.handlerGameEvents)
+	mux.HandleFunc("/ws/games/{game_id}", cfg.handlerWebSocket)
+	mux.HandleFunc("/ws/players/me", cfg.handlerPlayerWebSocket)
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	t.Setenv("FRONTEND_URL", srv.URL)
+
+	return srv, cfg
+}
+
+func dialGame(t *testing.T, srv *httptest.Server, gameId uuid.UUID, token string) *websocket.Conn {
+	t.Helper()
+
+	return dialGameWith(t, srv, gameId, PlayerMessage{Type: "auth", Token: token})
+}
+
+func dialGameWith(t *testing.T, srv *httptest.Server, gameId uuid.UUID, first PlayerMessage) *websocket.Conn {
+	t.Helper()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws/games/" + gameId.String()
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {srv.URL}})
+	if err != nil {
+		t.Fatalf("Failed to dial websocket: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	if err = conn.WriteJSON(first); err != nil {
+		t.Fatalf("Failed to send auth message: %v", err)
+	}
+	return conn
+}
+
+func makeToken(t *testing.T, playerId uuid.UUID) string {
+	t.Helper()
+
+	token, err := auth.MakeJWT(playerId, testKeys, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to make JWT: %v", err)
+	}
+	return token
+}
+
+func waitForConnections(t *testing.T, gs *gameServer, gameId uuid.UUID, want int) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		gs.rwMux.RLock()
+		got := len(gs.connections[gameId.String()])
+		gs.rwMux.RUnlock()
+		if got == want {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Expected %d connections for game %s", want, gameId)
+}
+
+func roll(t *testing.T, srv *httptest.Server, gameId uuid.UUID, token string) int {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/games/roll?game_id="+gameId.String(), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to roll: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestWebSocketAuthorization(t *testing.T) {
+	gameId := uuid.New()
+	member := uuid.New()
+	outsider := uuid.New()
+
+	tests := []struct {
+		name      string
+		token     string
+		wantClose int
+	}{
+		{
+			name:      "Invalid token",
+			token:     "invalid.token.string",
+			wantClose: closeUnauthorized,
+		},
+		{
+			name:      "Not a player in the game",
+			token:     makeToken(t, outsider),
+			wantClose: closeForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, cfg := newTestServer(t, map[uuid.UUID][]uuid.UUID{gameId: {member}})
+
+			conn := dialGame(t, srv, gameId, tt.token)
+			conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+			_, _, err := conn.ReadMessage()
+
+			var closeErr *websocket.CloseError
+			if !errors.As(err, &closeErr) {
+				t.Fatalf("Expected a close error, got %v", err)
+			}
+			if closeErr.Code != tt.wantClose {
+				t.Errorf("Got close code %d, want %d", closeErr.Code, tt.wantClose)
+			}
+
+			cfg.gs.rwMux.RLock()
+			defer cfg.gs.rwMux.RUnlock()
+			if len(cfg.gs.connections[gameId.String()]) != 0 {
+				t.Errorf("Unauthorized connection was registered")
+			}
+		})
+	}
+}
+
+func TestRollBroadcastAuthorization(t *testing.T) {
+	gameId := uuid.New()
+	member := uuid.New()
+	outsider := uuid.New()
+
+	srv, cfg := newTestServer(t, map[uuid.UUID][]uuid.UUID{gameId: {member}})
+
+	conn := dialGame(t, srv, gameId, makeToken(t, member))
+	waitForConnections(t, cfg.gs, gameId, 1)
+
+	if code := roll(t, srv, gameId, makeToken(t, outsider)); code != http.StatusForbidden {
+		t.Fatalf("Outsider roll got status %d, want %d", code, http.StatusForbidden)
+	}
+
+	if code := roll(t, srv, gameId, makeToken(t, member)); code != http.StatusOK {
+		t.Fatalf("Member roll got status %d, want %d", code, http.StatusOK)
+	}
+
+	// the outsider's roll must not have been broadcast, so the first
+	// message the member sees is their own roll
+	msg := readMessages(t, conn, 1)[0]
+	if msg.Type != "roll" || msg.Dice < 1 || msg.Dice > 6 {
+		t.Errorf("Unexpected broadcast %+v", msg)
+	}
+
+	expectNoMessage(t, conn)
+}
+
+// readMessages reads the next n game events, skipping presence events
+func readMessages(t *testing.T, conn *websocket.Conn, n int) []PlayerMessage {
+	t.Helper()
+
+	var msgs []PlayerMessage
+	for len(msgs) < n {
+		var msg PlayerMessage
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("Failed to read message %d: %v", len(msgs), err)
+		}
+		if msg.Type != "presence" {
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs
+}
+
+func readPresence(t *testing.T, conn *websocket.Conn) PlayerMessage {
+	t.Helper()
+
+	for {
+		var msg PlayerMessage
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("Failed to read presence: %v", err)
+		}
+		if msg.Type == "presence" {
+			return msg
+		}
+	}
+}
+
+func expectNoMessage(t *testing.T, conn *websocket.Conn) {
+	t.Helper()
+
+	for {
+		var msg PlayerMessage
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		if err := conn.ReadJSON(&msg); err != nil {
+			return
+		}
+		if msg.Type != "presence" {
+			t.Errorf("Got unexpected message %+v", msg)
+		}
+	}
+}
+
+func TestResumeReplaysMissedEvents(t *testing.T) {
+	gameId := uuid.New()
+	member := uuid.New()
+
+	srv, cfg := newTestServer(t, map[uuid.UUID][]uuid.UUID{gameId: {member}})
+
+	cfg.gs.broadcastRolled(gameId, 4)
+	cfg.gs.broadcastToGame(gameId)
+	cfg.gs.broadcastRolled(gameId, 2)
+
+	conn := dialGameWith(t, srv, gameId, PlayerMessage{
+		Type:    "resume",
+		Token:   makeToken(t, member),
+		LastSeq: 1,
+	})
+	missed := readMessages(t, conn, 2)
+	if missed[0].Type != "refresh" || missed[0].Seq != 2 {
+		t.Errorf("Got %+v, want refresh with seq 2", missed[0])
+	}
+	if missed[1].Type != "roll" || missed[1].Dice != 2 || missed[1].Seq != 3 {
+		t.Errorf("Got %+v, want roll of 2 with seq 3", missed[1])
+	}
+
+	// live events continue the sequence after the replay, the first being
+	// the member's own presence
+	if presence := readPresence(t, conn); presence.PlayerId != member || presence.Seq != 4 {
+		t.Errorf("Got presence %+v, want the member's with seq 4", presence)
+	}
+	cfg.gs.broadcastToGame(gameId)
+	if live := readMessages(t, conn, 1)[0]; live.Seq != 5 {
+		t.Errorf("Got live event %+v, want seq 5", live)
+	}
+}
+
+func TestResumeSendsSnapshotWhenBufferIsExceeded(t *testing.T) {
+	gameId := uuid.New()
+	member := uuid.New()
+
+	tests := []struct {
+		name    string
+		lastSeq int64
+	}{
+		{name: "Fell out of the buffer", lastSeq: 0},
+		{name: "Ahead of the server", lastSeq: maxBufferedEvents + 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// a server of its own, so the presence events of the other
+			// subtest's connection don't move the seq
+			srv, cfg := newTestServer(t, map[uuid.UUID][]uuid.UUID{gameId: {member}})
+			for range maxBufferedEvents + 1 {
+				cfg.gs.broadcastToGame(gameId)
+			}
+
+			conn := dialGameWith(t, srv, gameId, PlayerMessage{
+				Type:    "resume",
+				Token:   makeToken(t, member),
+				LastSeq: tt.lastSeq,
+			})
+			got := readMessages(t, conn, 1)[0]
+			if got.Type != "snapshot" || got.Seq != maxBufferedEvents+1 {
+				t.Errorf("Got %+v, want snapshot at seq %d", got, maxBufferedEvents+1)
+			}
+		})
+	}
+}
+
+func TestPruneEventLogsForgetsSequences(t *testing.T) {
+	gs := newGameServer()
+	backend := newMemoryBackend(gs.deliver)
+	gs.backend = backend
+
+	stale := uuid.New()
+	gs.publish(stale, PlayerMessage{Type: "refresh"})
+	gs.rwMux.Lock()
+	gs.events[stale.String()].updatedAt = time.Now().Add(-2 * eventLogTTL)
+	gs.rwMux.Unlock()
+
+	// the first event of another game runs the sweep
+	gs.publish(uuid.New(), PlayerMessage{Type: "refresh"})
+
+	gs.rwMux.RLock()
+	_, logged := gs.events[stale.String()]
+	gs.rwMux.RUnlock()
+	backend.mux.Lock()
+	_, sequenced := backend.seqs[stale]
+	backend.mux.Unlock()
+	if logged || sequenced {
+		t.Errorf("Stale game still has an event log %v, a sequence %v", logged, sequenced)
+	}
+}
+
+// stalledSubscriber is a client that stopped reading, its writes block
+// until released
+type stalledSubscriber struct {
+	writing chan struct{}
+	release chan struct{}
+}
+
+func (s *stalledSubscriber) send(msg PlayerMessage) error {
+	s.writing <- struct{}{}
+	<-s.release
+	return nil
+}
+
+func (s *stalledSubscriber) player() uuid.UUID {
+	return uuid.Nil
+}
+
+func TestStalledConnectionDoesNotBlockOtherGames(t *testing.T) {
+	stalledGame := uuid.New()
+	gameId := uuid.New()
+	member := uuid.New()
+
+	srv, cfg := newTestServer(t, map[uuid.UUID][]uuid.UUID{gameId: {member}})
+
+	stalled := &stalledSubscriber{writing: make(chan struct{}), release: make(chan struct{})}
+	defer close(stalled.release)
+	cfg.gs.addConnection(stalledGame.String(), stalled)
+	go cfg.gs.broadcastToGame(stalledGame)
+	<-stalled.writing
+
+	conn := dialGame(t, srv, gameId, makeToken(t, member))
+	waitForConnections(t, cfg.gs, gameId, 1)
+	cfg.gs.broadcastRolled(gameId, 3)
+
+	if msg := readMessages(t, conn, 1)[0]; msg.Type != "roll" || msg.Dice != 3 {
+		t.Errorf("Got %+v, want the roll of 3", msg)
+	}
+}